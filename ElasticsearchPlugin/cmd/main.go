@@ -9,6 +9,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
@@ -16,6 +17,7 @@ import (
 
 	"elasticsearchplugin/pkg/config"
 	"elasticsearchplugin/pkg/elasticsearch"
+	"elasticsearchplugin/pkg/health"
 	"elasticsearchplugin/pkg/util"
 
 	log "github.com/sirupsen/logrus"
@@ -27,6 +29,8 @@ var (
 	logDir           string
 	logLevel         int
 	enableConsoleLog bool
+	listenAddress    string
+	reingest         bool
 	version          bool
 	appVersion       string
 )
@@ -48,6 +52,26 @@ func main() {
 		log.WithFields(log.Fields{"error": err}).Fatal("Error while reading config")
 	}
 
+	//open the on-disk queue of failed requests before any data is pushed
+	err = elasticsearch.InitRetryQueue(conf.RetryQueue)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatal("Error while opening retry queue")
+	}
+	err = elasticsearch.InitDeadLetter(conf.DeadLetterFile)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatal("Error while creating dead letter file")
+	}
+	//existing files already pushed to elasticsearch are skipped, unless re-ingest is forced
+	err = util.InitLedger(conf.LedgerFile, reingest)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatal("Error while opening processed file ledger")
+	}
+
+	//expose health endpoints over HTTP
+	if listenAddress != "" {
+		go startHTTPServer(listenAddress, conf)
+	}
+
 	if conf.ElasticsearchConf.InitializeClusterSetting {
 		elasticsearch.SetConfig(conf.ElasticsearchConf)
 	}
@@ -100,6 +124,8 @@ func parseFlags() {
 	flag.StringVar(&logDir, "log_dir", "../log", "Log directory")
 	flag.IntVar(&logLevel, "log_level", 4, "Log level")
 	flag.BoolVar(&enableConsoleLog, "enable_console_log", false, "Enable console logging, if true logs won't be written to file")
+	flag.StringVar(&listenAddress, "listen_address", "", "Address on which health endpoints are exposed")
+	flag.BoolVar(&reingest, "reingest", false, "Push all the existing files to elasticsearch again, ignoring the processed file ledger")
 	flag.BoolVar(&version, "v", false, "Prints OSSMediator's version")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: ./elasticsearchplugin [options]\n")
@@ -109,6 +135,8 @@ func parseFlags() {
 		fmt.Fprintf(os.Stderr, "\t-log_dir\n\t\tLog Directory (default \"../log\"), logs will be stored in ElasticsearchPlugin.log file.\n")
 		fmt.Fprintf(os.Stderr, "\t-log_level\n\t\tLog Level (default 4). Values: 0 (PANIC), 1 (FATAl), 2 (ERROR), 3 (WARNING), 4 (INFO), 5 (DEBUG)\n")
 		fmt.Fprintf(os.Stderr, "\t-enable_console_log\n\t\tEnable console logging, if true logs won't be written to file\n")
+		fmt.Fprintf(os.Stderr, "\t-listen_address\n\t\tAddress (ex: \":9101\") on which health endpoints (/healthz, /readyz) are exposed, disabled if empty.\n")
+		fmt.Fprintf(os.Stderr, "\t-reingest\n\t\tPush all the existing files to elasticsearch again, ignoring the processed file ledger.\n")
 		fmt.Fprintf(os.Stderr, "\t-v\n\t\tPrints OSSMediator's version\n")
 	}
 	flag.Parse()
@@ -151,6 +179,17 @@ func initLogger(logDir string, logLevel int) {
 	log.SetLevel(log.Level(logLevel))
 }
 
+// starts the HTTP server exposing plugin's health endpoints.
+func startHTTPServer(address string, conf config.Config) {
+	mux := http.NewServeMux()
+	health.Register(mux, conf)
+	log.Infof("Exposing health endpoints on %s", address)
+	err := http.ListenAndServe(address, mux)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Unable to start HTTP server on %s", address)
+	}
+}
+
 func shutdownHook() {
 	osSignal := make(chan os.Signal, 1)
 	signal.Notify(osSignal, syscall.SIGINT, syscall.SIGTERM)
@@ -17,12 +17,28 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	//default no. of failed bulk requests after which plugin is reported as not ready
+	defaultMaxFailedBacklog = 100
+	//default directory and size of the on-disk queue of failed bulk requests
+	defaultRetryQueueDir       = "../retry_queue"
+	defaultRetryQueueMaxSizeMB = 1024
+	//default file to which documents rejected by elasticsearch are written
+	defaultDeadLetterFile = "../dead_letter/rejected_documents.json"
+	//default file in which the files already pushed to elasticsearch are recorded
+	defaultLedgerFile = "../ledger/processed_files.json"
+)
+
 // Config read from resources/conf.json file
 type Config struct {
 	SourceDirs           []string          `json:"source_dirs"`
 	CleanupDuration      int               `json:"cleanup_duration"`
 	ElasticsearchConf    ElasticsearchConf `json:"elasticsearch"`
 	MaxConcurrentProcess int               `json:"max_concurrent_process"`
+	MaxFailedBacklog     int               `json:"max_failed_backlog"`
+	RetryQueue           RetryQueueConf    `json:"retry_queue"`
+	DeadLetterFile       string            `json:"dead_letter_file"`
+	LedgerFile           string            `json:"ledger_file"`
 }
 
 type ElasticsearchConf struct {
@@ -34,6 +50,12 @@ type ElasticsearchConf struct {
 	MaxShardsPerNode         int    `json:"max_shards_per_node"`
 }
 
+// RetryQueueConf keeps the location and size limit of the on-disk queue of failed bulk requests.
+type RetryQueueConf struct {
+	Dir       string `json:"dir"`
+	MaxSizeMB int    `json:"max_size_mb"`
+}
+
 // ReadConfig reads the configurations from conf.json file
 func ReadConfig(confFile string) (Config, error) {
 	var config Config
@@ -68,6 +90,24 @@ func ReadConfig(confFile string) (Config, error) {
 	if config.MaxConcurrentProcess <= 0 {
 		config.MaxConcurrentProcess = 1
 	}
+	if config.MaxFailedBacklog <= 0 {
+		config.MaxFailedBacklog = defaultMaxFailedBacklog
+	}
+	config.RetryQueue.Dir = strings.TrimSpace(config.RetryQueue.Dir)
+	if config.RetryQueue.Dir == "" {
+		config.RetryQueue.Dir = defaultRetryQueueDir
+	}
+	if config.RetryQueue.MaxSizeMB <= 0 {
+		config.RetryQueue.MaxSizeMB = defaultRetryQueueMaxSizeMB
+	}
+	config.DeadLetterFile = strings.TrimSpace(config.DeadLetterFile)
+	if config.DeadLetterFile == "" {
+		config.DeadLetterFile = defaultDeadLetterFile
+	}
+	config.LedgerFile = strings.TrimSpace(config.LedgerFile)
+	if config.LedgerFile == "" {
+		config.LedgerFile = defaultLedgerFile
+	}
 
 	log.Info("Config read successfully.")
 	return config, nil
@@ -62,6 +62,15 @@ func TestReadConfig(t *testing.T) {
 	if err != nil || conf.ElasticsearchConf.URL != "http://127.0.0.1:9200" || conf.ElasticsearchConf.Password != "test1" {
 		t.Fail()
 	}
+	if conf.RetryQueue.Dir != defaultRetryQueueDir || conf.RetryQueue.MaxSizeMB != defaultRetryQueueMaxSizeMB {
+		t.Errorf("unexpected default retry queue config: %+v", conf.RetryQueue)
+	}
+	if conf.DeadLetterFile != defaultDeadLetterFile {
+		t.Errorf("unexpected default dead letter file: %s", conf.DeadLetterFile)
+	}
+	if conf.LedgerFile != defaultLedgerFile {
+		t.Errorf("unexpected default ledger file: %s", conf.LedgerFile)
+	}
 }
 
 // Reading config from non-existing file
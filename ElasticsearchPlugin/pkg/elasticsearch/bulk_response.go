@@ -0,0 +1,178 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	//error type returned by elasticsearch when the write thread pool queue is full
+	esRejectedExecution = "es_rejected_execution_exception"
+)
+
+var (
+	deadLetterWriter io.Writer
+	deadLetterMux    sync.Mutex
+)
+
+// bulkResponse is the response of elasticsearch _bulk API.
+type bulkResponse struct {
+	Errors bool                        `json:"errors"`
+	Items  []map[string]bulkItemResult `json:"items"`
+}
+
+// bulkItemResult is the result of a single action of the bulk request.
+type bulkItemResult struct {
+	Index  string         `json:"_index"`
+	ID     string         `json:"_id"`
+	Status int            `json:"status"`
+	Error  *bulkItemError `json:"error,omitempty"`
+}
+
+type bulkItemError struct {
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+// deadLetter is written to the dead letter file for each document rejected permanently by elasticsearch.
+type deadLetter struct {
+	Timestamp string          `json:"timestamp"`
+	File      string          `json:"file"`
+	Index     string          `json:"index"`
+	ID        string          `json:"id"`
+	Status    int             `json:"status"`
+	ErrorType string          `json:"error_type"`
+	Reason    string          `json:"reason"`
+	Document  json.RawMessage `json:"document"`
+}
+
+// InitDeadLetter sets the file to which documents rejected permanently by elasticsearch are written.
+func InitDeadLetter(filePath string) error {
+	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	deadLetterMux.Lock()
+	defer deadLetterMux.Unlock()
+	deadLetterWriter = &lumberjack.Logger{
+		Filename:   filePath,
+		MaxSize:    100, // Max megabytes before file is rotated
+		MaxBackups: 10,  // Max number of old files to keep
+		Compress:   true,
+	}
+	return nil
+}
+
+// pushes bulk request to elasticsearch and checks the result of each item.
+// It returns the part of the request which has to be retried, documents rejected permanently are sent to the dead letter file.
+func bulkPush(elkURL, elkUser, elkPassword string, data string, filePath string) (string, error) {
+	resp, err := httpCall(http.MethodPost, elkURL, elkUser, elkPassword, &data, nil, defaultTimeout)
+	if err != nil {
+		return data, err
+	}
+	retryData, rejected, err := parseBulkResponse(resp, data)
+	if err != nil {
+		//request was accepted, the response just couldn't be verified
+		log.WithFields(log.Fields{"error": err, "url": elkURL, "file": filePath}).Warn("Unable to parse bulk response")
+		return "", nil
+	}
+	if len(rejected) > 0 {
+		writeDeadLetters(rejected, filePath)
+	}
+	if retryData != "" {
+		return retryData, fmt.Errorf("%d documents rejected by elasticsearch with retryable error", strings.Count(retryData, "\n")/2)
+	}
+	return "", nil
+}
+
+// parses the bulk response, returns the actions to be retried and the documents rejected permanently.
+func parseBulkResponse(resp []byte, data string) (string, []deadLetter, error) {
+	var bulkResp bulkResponse
+	err := json.Unmarshal(resp, &bulkResp)
+	if err != nil {
+		return "", nil, err
+	}
+	if !bulkResp.Errors {
+		return "", nil, nil
+	}
+
+	//each action is followed by its document in the bulk request
+	lines := strings.Split(strings.TrimSuffix(data, "\n"), "\n")
+	if len(lines) != 2*len(bulkResp.Items) {
+		return "", nil, fmt.Errorf("bulk response has %d items for %d request lines", len(bulkResp.Items), len(lines))
+	}
+
+	var retryData strings.Builder
+	var rejected []deadLetter
+	for i, item := range bulkResp.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 {
+				continue
+			}
+			if isRetryable(result) {
+				retryData.WriteString(lines[2*i] + "\n" + lines[2*i+1] + "\n")
+				continue
+			}
+			dl := deadLetter{
+				Index:    result.Index,
+				ID:       result.ID,
+				Status:   result.Status,
+				Document: json.RawMessage(lines[2*i+1]),
+			}
+			if result.Error != nil {
+				dl.ErrorType = result.Error.Type
+				dl.Reason = result.Error.Reason
+			}
+			rejected = append(rejected, dl)
+		}
+	}
+	return retryData.String(), rejected, nil
+}
+
+// only throttled requests are retried, other errors (ex: mapping conflicts) would fail again.
+func isRetryable(result bulkItemResult) bool {
+	if result.Status == http.StatusTooManyRequests {
+		return true
+	}
+	return result.Error != nil && result.Error.Type == esRejectedExecution
+}
+
+func writeDeadLetters(rejected []deadLetter, filePath string) {
+	deadLetterMux.Lock()
+	defer deadLetterMux.Unlock()
+	for _, dl := range rejected {
+		log.WithFields(log.Fields{"file": filePath, "index": dl.Index, "id": dl.ID, "status": dl.Status, "error_type": dl.ErrorType, "reason": dl.Reason}).Error("Document rejected by elasticsearch")
+		if deadLetterWriter == nil {
+			continue
+		}
+		dl.Timestamp = currentTime().UTC().Format(timestampFormat)
+		dl.File = filePath
+		if !json.Valid(dl.Document) {
+			dl.Document, _ = json.Marshal(string(dl.Document))
+		}
+		record, err := json.Marshal(dl)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err, "file": filePath, "id": dl.ID}).Error("Unable to write document to dead letter file")
+			continue
+		}
+		_, err = deadLetterWriter.Write(append(record, '\n'))
+		if err != nil {
+			log.WithFields(log.Fields{"error": err, "file": filePath, "id": dl.ID}).Error("Unable to write document to dead letter file")
+		}
+	}
+}
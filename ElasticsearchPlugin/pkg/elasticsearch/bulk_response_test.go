@@ -0,0 +1,145 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package elasticsearch
+
+import (
+	"bytes"
+	"elasticsearchplugin/pkg/config"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	testBulkRequest = `{"index": {"_index": "4g-pm", "_id": "1"}}
+{"counter": 1}
+{"index": {"_index": "4g-pm", "_id": "2"}}
+{"counter": "abc"}
+{"index": {"_index": "4g-pm", "_id": "3"}}
+{"counter": 3}
+`
+	testBulkResponse = `{
+  "took": 3,
+  "errors": true,
+  "items": [
+    {"index": {"_index": "4g-pm", "_id": "1", "status": 201}},
+    {"index": {"_index": "4g-pm", "_id": "2", "status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse field [counter] of type [long]"}}},
+    {"index": {"_index": "4g-pm", "_id": "3", "status": 429, "error": {"type": "es_rejected_execution_exception", "reason": "rejected execution of coordinating operation"}}}
+  ]
+}`
+)
+
+func TestParseBulkResponse(t *testing.T) {
+	retryData, rejected, err := parseBulkResponse([]byte(testBulkResponse), testBulkRequest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedRetryData := `{"index": {"_index": "4g-pm", "_id": "3"}}` + "\n" + `{"counter": 3}` + "\n"
+	if retryData != expectedRetryData {
+		t.Errorf("unexpected retry data: %s", retryData)
+	}
+	if len(rejected) != 1 || rejected[0].ID != "2" || rejected[0].ErrorType != "mapper_parsing_exception" || string(rejected[0].Document) != `{"counter": "abc"}` {
+		t.Errorf("unexpected rejected documents: %+v", rejected)
+	}
+}
+
+func TestParseBulkResponseWithoutErrors(t *testing.T) {
+	retryData, rejected, err := parseBulkResponse([]byte(`{"took": 3, "errors": false, "items": []}`), testBulkRequest)
+	if err != nil || retryData != "" || len(rejected) != 0 {
+		t.Errorf("expected no failed items, got retry data: %s, rejected: %+v, error: %v", retryData, rejected, err)
+	}
+}
+
+func TestParseBulkResponseWithMismatchedItems(t *testing.T) {
+	resp := `{"errors": true, "items": [{"index": {"_index": "4g-pm", "_id": "1", "status": 429}}]}`
+	_, _, err := parseBulkResponse([]byte(resp), testBulkRequest)
+	if err == nil {
+		t.Fail()
+	}
+}
+
+func TestPushDataRetriesOnlyRetryableItems(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, string(body))
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(testBulkResponse))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errors": false, "items": [{"index": {"_index": "4g-pm", "_id": "3", "status": 201}}]}`))
+	}))
+	defer server.Close()
+
+	var deadLetters bytes.Buffer
+	deadLetterWriter = &deadLetters
+	defer func() { deadLetterWriter = nil }()
+
+	pushData(server.URL+elkBulkAPI, "", "", testBulkRequest, "pmdata_4g_test.json")
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 bulk requests, got %d", len(requests))
+	}
+	if strings.Contains(requests[1], `"_id": "1"`) || strings.Contains(requests[1], `"_id": "2"`) || !strings.Contains(requests[1], `"_id": "3"`) {
+		t.Errorf("expected only throttled document to be retried, got %s", requests[1])
+	}
+
+	var dl deadLetter
+	err := json.Unmarshal(deadLetters.Bytes(), &dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.ID != "2" || dl.File != "pmdata_4g_test.json" || dl.Status != 400 || !strings.Contains(dl.Reason, "failed to parse field") {
+		t.Errorf("unexpected dead letter: %+v", dl)
+	}
+}
+
+func TestReplayFailedDataKeepsOnlyRetryableItems(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, string(body))
+		if len(requests) == 1 {
+			_, _ = w.Write([]byte(testBulkResponse))
+			return
+		}
+		_, _ = w.Write([]byte(`{"errors": false, "items": [{"index": {"_index": "4g-pm", "_id": "3", "status": 201}}]}`))
+	}))
+	defer server.Close()
+
+	err := InitRetryQueue(config.RetryQueueConf{Dir: t.TempDir(), MaxSizeMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { retryQueue = nil }()
+	err = retryQueue.Append("pmdata_4g_test.json", []byte(testBulkRequest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deadLetters bytes.Buffer
+	deadLetterWriter = &deadLetters
+	defer func() { deadLetterWriter = nil }()
+
+	esConf := config.ElasticsearchConf{URL: server.URL}
+	replayFailedData(esConf)
+	if FailedDataCount() != 1 {
+		t.Fatalf("expected partially pushed request to be kept in retry queue, got %d", FailedDataCount())
+	}
+	replayFailedData(esConf)
+	if FailedDataCount() != 0 {
+		t.Errorf("expected empty retry queue, queue depth: %d", FailedDataCount())
+	}
+	if len(requests) != 2 || strings.Contains(requests[1], `"_id": "1"`) || strings.Contains(requests[1], `"_id": "2"`) || !strings.Contains(requests[1], `"_id": "3"`) {
+		t.Errorf("expected only throttled document to be replayed again, got %v", requests)
+	}
+	//rejected document is written to the dead letter file only once
+	if strings.Count(deadLetters.String(), "\n") != 1 || !strings.Contains(deadLetters.String(), `"id":"2"`) {
+		t.Errorf("unexpected dead letters: %s", deadLetters.String())
+	}
+}
@@ -36,10 +36,16 @@ func SetConfig(esConf config.ElasticsearchConf) {
 	log.Info("Default OpenSearch settings done")
 }
 
+// CheckReachability returns error if Elasticsearch is not reachable.
+func CheckReachability(esConf config.ElasticsearchConf) error {
+	_, err := httpCall(http.MethodGet, esConf.URL, esConf.User, esConf.Password, nil, nil, defaultTimeout)
+	return err
+}
+
 // Check if Elasticsearch is reachable
 func waitForElasticsearch(esConf config.ElasticsearchConf) {
 	for {
-		_, err := httpCall(http.MethodGet, esConf.URL, esConf.User, esConf.Password, nil, nil, defaultTimeout)
+		err := CheckReachability(esConf)
 		if err == nil {
 			log.Info("OpenSearch is reachable")
 			return
@@ -9,10 +9,13 @@ package elasticsearch
 import (
 	"bytes"
 	"elasticsearchplugin/pkg/config"
+	"io"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -303,6 +306,11 @@ func TestPushFailedDataToElasticsearch(t *testing.T) {
 	esConf := config.ElasticsearchConf{
 		URL: "http://localhost:12345",
 	}
+	err = InitRetryQueue(config.RetryQueueConf{Dir: t.TempDir(), MaxSizeMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { retryQueue = nil }()
 
 	PushData(fileName, esConf)
 	if !strings.Contains(buf.String(), "Unable to push data to elasticsearch, will be retried later") {
@@ -318,6 +326,107 @@ func TestPushFailedDataToElasticsearch(t *testing.T) {
 	}
 }
 
+func TestReplayFailedDataFromRetryQueue(t *testing.T) {
+	var failing atomic.Bool
+	failing.Store(true)
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	err := InitRetryQueue(config.RetryQueueConf{Dir: dir, MaxSizeMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { retryQueue = nil }()
+
+	esConf := config.ElasticsearchConf{URL: server.URL}
+	pushData(server.URL+elkBulkAPI, "", "", "data1", "file1")
+	pushData(server.URL+elkBulkAPI, "", "", "data2", "file2")
+	if FailedDataCount() != 2 {
+		t.Fatalf("expected 2 failed requests in retry queue, got %d", FailedDataCount())
+	}
+
+	//failed requests are kept across restart
+	err = InitRetryQueue(config.RetryQueueConf{Dir: dir, MaxSizeMB: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if FailedDataCount() != 2 {
+		t.Fatalf("expected 2 failed requests after reopening retry queue, got %d", FailedDataCount())
+	}
+
+	replayFailedData(esConf)
+	if FailedDataCount() != 2 || len(received) != 0 {
+		t.Errorf("expected failed requests to be kept, queue depth: %d", FailedDataCount())
+	}
+
+	failing.Store(false)
+	replayFailedData(esConf)
+	if FailedDataCount() != 0 || FailedDataAge() != 0 {
+		t.Errorf("expected empty retry queue, queue depth: %d", FailedDataCount())
+	}
+	if len(received) != 2 || received[0] != "data1" || received[1] != "data2" {
+		t.Errorf("failed requests replayed out of order: %v", received)
+	}
+}
+
+func TestPushReaderIndexesSameAsPushData(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	fileName := "./pmdata_RADIO_reader_data.json"
+	err := createTestData(fileName, testPMData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(fileName)
+	esConf := config.ElasticsearchConf{URL: server.URL}
+
+	err = PushData(fileName, esConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = PushReader(fileName, strings.NewReader(testPMData), esConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(received) != 2 {
+		t.Fatalf("expected 2 bulk requests, got %d", len(received))
+	}
+	//action lines carry the index and document ID, document sources differ only by timestamp
+	fromFile := strings.Split(received[0], "\n")
+	fromReader := strings.Split(received[1], "\n")
+	if len(fromFile) != len(fromReader) {
+		t.Fatalf("expected same number of lines, got %d and %d", len(fromFile), len(fromReader))
+	}
+	for i := 0; i < len(fromFile); i += 2 {
+		if fromFile[i] != fromReader[i] {
+			t.Errorf("expected action %s, got %s", fromFile[i], fromReader[i])
+		}
+	}
+}
+
+func TestPushReaderWithUnsupportedData(t *testing.T) {
+	err := PushReader("gng_user_response.json", strings.NewReader("invalid"), config.ElasticsearchConf{URL: "http://127.0.0.1:1"})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
 func searchOnElastic(indices []string) (string, error) {
 	searchURL := elasticsearchURL + "/" + strings.Join(indices, ",") + "/_search"
 	resp, err := httpCall(http.MethodGet, searchURL, "", "", nil, nil, defaultTimeout)
@@ -10,8 +10,8 @@ import (
 	"elasticsearchplugin/pkg/config"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
 	"path"
 	"strconv"
 	"strings"
@@ -50,44 +50,30 @@ const (
 	reindexPostData = `{"source":{"index":"SOURCE"},"dest":{"index":"DEST"}}`
 )
 
-func pushFMData(filePath string, esConf config.ElasticsearchConf) {
+func pushFMData(filePath string, r io.Reader, esConf config.ElasticsearchConf) error {
 	elkURL := esConf.URL + elkBulkAPI
 	log.Infof("Pushing data from %s to elasticsearch", filePath)
 	fileName := path.Base(filePath)
 	baseMetricType := strings.Split(fileName, "_")[1]
 	baseMetricType = strings.ToLower(baseMetricType)
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Errorf("Error while reading file: %s", filePath)
-		return
-	}
-	defer file.Close()
-
 	index := strings.Join([]string{baseMetricType, "fm"}, "-")
 	var postData string
-	dec := json.NewDecoder(file)
-
-	// read open bracket
-	t, err := dec.Token()
+	//error of the last chunk which could neither be pushed nor stored in retry queue
+	var failedErr error
+	dec, err := newRecordDecoder(filePath, r)
 	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Errorf("Error while getting json token: %s", filePath)
-		return
-	}
-	if delim, ok := t.(json.Delim); !ok || delim != '[' {
-		log.WithFields(log.Fields{"error": err}).Errorf("Invalid file %s, array starting not found", filePath)
-		return
+		return err
 	}
 
-	// while the array contains values
+	// while the file contains records
 	i := 0
 	for dec.More() {
 		var resp fmResponse
 		var id, metricType string
 		err = dec.Decode(&resp)
 		if err != nil {
-			log.WithFields(log.Fields{"error": err}).Errorf("Error while decoding json: %s", filePath)
-			return
+			return err
 		}
 		i++
 
@@ -121,65 +107,50 @@ func pushFMData(filePath string, esConf config.ElasticsearchConf) {
 		postData += `{"index": {"_index": "` + index + `", "_id": "` + id + `"}}` + "\n"
 		postData += string(source) + "\n"
 		if i%elkNoOfRecordsPerAPI == 0 {
-			pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
+			if pushErr := pushData(elkURL, esConf.User, esConf.Password, postData, filePath); pushErr != nil {
+				failedErr = pushErr
+			}
 			postData = ""
 		}
 	}
 
 	if postData != "" {
-		pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
+		if pushErr := pushData(elkURL, esConf.User, esConf.Password, postData, filePath); pushErr != nil {
+			failedErr = pushErr
+		}
 		postData = ""
 	}
 
-	// read closing bracket
-	t, err = dec.Token()
+	err = dec.Close()
 	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Errorf("Error while getting json token: %s", filePath)
-		return
-	}
-	if delim, ok := t.(json.Delim); !ok || delim != ']' {
-		log.WithFields(log.Fields{"error": err}).Errorf("Invalid file %s, array ending not found", filePath)
-		return
+		return err
 	}
+	return failedErr
 }
 
-func pushPMData(filePath string, esConf config.ElasticsearchConf) {
+func pushPMData(filePath string, r io.Reader, esConf config.ElasticsearchConf) error {
 	elkURL := esConf.URL + elkBulkAPI
 	log.Infof("Pushing data from %s to elasticsearch", filePath)
 
-	file, err := os.Open(filePath)
-	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Errorf("Error while reading file: %s", filePath)
-		return
-	}
-	defer file.Close()
-
 	fileName := path.Base(filePath)
 	metricType := strings.Split(fileName, "_")[1]
 	metricType = strings.ToLower(metricType)
 	var postData string
+	//error of the last chunk which could neither be pushed nor stored in retry queue
+	var failedErr error
 	currTime := time.Now().UTC()
-	dec := json.NewDecoder(file)
-
-	// read open bracket
-	t, err := dec.Token()
+	dec, err := newRecordDecoder(filePath, r)
 	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Errorf("Error while getting json token: %s", filePath)
-		return
-	}
-	if delim, ok := t.(json.Delim); !ok || delim != '[' {
-		log.WithFields(log.Fields{"error": err}).Errorf("Invalid file %s, array starting not found", filePath)
-		return
+		return err
 	}
 
-	// while the array contains values
+	// while the file contains records
 	i := 0
 	for dec.More() {
 		var resp pmResponse
 		err = dec.Decode(&resp)
 		if err != nil {
-			log.WithFields(log.Fields{"error": err}).Errorf("Error while decoding json: %s", filePath)
-			return
+			return err
 		}
 		i++
 
@@ -208,26 +179,25 @@ func pushPMData(filePath string, esConf config.ElasticsearchConf) {
 		postData += `{"index": {"_index": "` + index + `", "_id": "` + id + `"}}` + "\n"
 		postData += string(source) + "\n"
 		if i%elkNoOfRecordsPerAPI == 0 {
-			pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
+			if pushErr := pushData(elkURL, esConf.User, esConf.Password, postData, filePath); pushErr != nil {
+				failedErr = pushErr
+			}
 			postData = ""
 		}
 	}
 
 	if postData != "" {
-		pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
+		if pushErr := pushData(elkURL, esConf.User, esConf.Password, postData, filePath); pushErr != nil {
+			failedErr = pushErr
+		}
 		postData = ""
 	}
 
-	// read closing bracket
-	t, err = dec.Token()
+	err = dec.Close()
 	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Errorf("Error while getting json token: %s", filePath)
-		return
-	}
-	if delim, ok := t.(json.Delim); !ok || delim != ']' {
-		log.WithFields(log.Fields{"error": err}).Errorf("Invalid file %s, array ending not found", filePath)
-		return
+		return err
 	}
+	return failedErr
 }
 
 func AddPMMapping(esConf config.ElasticsearchConf, index string) {
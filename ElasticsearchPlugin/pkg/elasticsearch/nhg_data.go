@@ -9,6 +9,7 @@ package elasticsearch
 import (
 	"elasticsearchplugin/pkg/config"
 	"encoding/json"
+	"io"
 	"path"
 	"strings"
 	"time"
@@ -81,30 +82,24 @@ type HwSet struct {
 	SerialNo string `json:"serial_no"`
 }
 
-func pushNHGData(filePath string, esConf config.ElasticsearchConf) {
+func pushNHGData(filePath string, r io.Reader, esConf config.ElasticsearchConf) error {
 	//deleting data from nhg-data index
 	deletionTime := currentTime().Add(-15 * time.Minute).UTC().Format(timestampFormat)
 	deleteData([]string{indexMetaData[nhgData]}, deletionTime, esConf)
 
 	elkURL := esConf.URL + elkBulkAPI
 	log.Infof("Pushing data from %s to elasticsearch", filePath)
-	data, err := readFile(filePath)
-	if err != nil {
-		return
-	}
-
 	fileName := path.Base(filePath)
 	keys := strings.Split(fileName, "_")
 	metric := strings.ToLower(keys[0])
 	user := strings.ToLower(keys[1])
 
 	var nhgs nhgResponse
-	err = json.Unmarshal(data, &nhgs)
+	err := decodeData(filePath, r, &nhgs)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Errorf("Unable to unmarshal json data %s", filePath)
-		return
+		return err
 	}
-	data = nil
 	var postData string
 	index := indexMetaData[nhgData]
 	currTime := time.Now().UTC()
@@ -152,7 +147,7 @@ func pushNHGData(filePath string, esConf config.ElasticsearchConf) {
 			}
 		}
 	}
-	pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
+	return pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
 }
 
 func addToBulkReq(index, id string, details nhgDetails) string {
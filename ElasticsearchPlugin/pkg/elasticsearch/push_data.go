@@ -8,8 +8,10 @@ package elasticsearch
 
 import (
 	"bytes"
+	"compress/gzip"
 	"crypto/tls"
 	"elasticsearchplugin/pkg/config"
+	"elasticsearchplugin/pkg/spool"
 	"fmt"
 	"io"
 	"net/http"
@@ -25,7 +27,7 @@ import (
 var (
 	once        sync.Once
 	netClient   *http.Client
-	failedData  []failedResponse
+	retryQueue  *spool.Spool
 	retryTicker *time.Ticker
 
 	//indexList from which old data will be deleted
@@ -77,11 +79,6 @@ const (
 	apSimsData      = "access-point-sims"
 )
 
-type failedResponse struct {
-	filePath string
-	data     string
-}
-
 func newNetClient() *http.Client {
 	once.Do(func() {
 		netTransport := &http.Transport{
@@ -96,34 +93,85 @@ func newNetClient() *http.Client {
 	return netClient
 }
 
-func PushData(filePath string, esConf config.ElasticsearchConf) {
+// PushData pushes the data from the collected file to elasticsearch.
+// It returns nil once all the data is either pushed or stored in the retry queue.
+func PushData(filePath string, esConf config.ElasticsearchConf) error {
+	if !isSupported(filePath) {
+		return nil
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Error while reading file: %s", filePath)
+		return err
+	}
+	defer file.Close()
+	return PushReader(filePath, file, esConf)
+}
+
+// PushReader pushes the data read from r to elasticsearch.
+// filePath is the name with which the collector writes the data, index names and document IDs are derived from it,
+// so the data pushed from memory and from the collected file are indexed the same way.
+// The data is JSON array or NDJSON, gzip compressed if filePath has .gz extension.
+// It returns nil once all the data is either pushed or stored in the retry queue.
+func PushReader(filePath string, r io.Reader, esConf config.ElasticsearchConf) error {
+	if strings.HasSuffix(filePath, ".gz") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Errorf("Error while reading gzip file: %s", filePath)
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	switch apiType(filePath) {
+	case fmData:
+		return pushFMData(filePath, r, esConf)
+	case pmData:
+		return pushPMData(filePath, r, esConf)
+	case nhgData:
+		return pushNHGData(filePath, r, esConf)
+	case simsData, accountSimsData:
+		return pushSimsData(filePath, r, esConf)
+	case apSimsData:
+		return pushAPSimsData(filePath, r, esConf)
+	}
+	return nil
+}
+
+func apiType(filePath string) string {
 	fileName := path.Base(filePath)
-	apiType := strings.Split(fileName, "_")[0]
-	if apiType == fmData {
-		pushFMData(filePath, esConf)
-	} else if apiType == pmData {
-		pushPMData(filePath, esConf)
-	} else if apiType == nhgData {
-		pushNHGData(filePath, esConf)
-	} else if apiType == simsData || apiType == accountSimsData {
-		pushSimsData(filePath, esConf)
-	} else if apiType == apSimsData {
-		pushAPSimsData(filePath, esConf)
+	return strings.Split(fileName, "_")[0]
+}
+
+func isSupported(filePath string) bool {
+	switch apiType(filePath) {
+	case fmData, pmData, nhgData, simsData, accountSimsData, apSimsData:
+		return true
 	}
+	return false
 }
 
-func pushData(elkURL, elkUser, elkPassword string, data string, filePath string) {
-	_, err := httpCall(http.MethodPost, elkURL, elkUser, elkPassword, &data, nil, defaultTimeout)
+func pushData(elkURL, elkUser, elkPassword string, data string, filePath string) error {
+	data, err := bulkPush(elkURL, elkUser, elkPassword, data, filePath)
 	if err != nil {
 		log.WithFields(log.Fields{"Error": err, "url": elkURL, "file": filePath}).Error("Unable to push data to elasticsearch, push to elasticsearch will be retried")
-		err = retryPushData(elkURL, elkUser, elkPassword, &data)
+		data, err = retryPushData(elkURL, elkUser, elkPassword, data, filePath)
 		if err != nil {
-			failedData = append(failedData, failedResponse{filePath: filePath, data: data})
+			if retryQueue == nil {
+				log.WithFields(log.Fields{"Error": err, "url": elkURL, "file": filePath}).Error("Unable to push data to elasticsearch, retry queue is not initialized, data will be lost")
+				return err
+			}
+			spoolErr := retryQueue.Append(filePath, []byte(data))
+			if spoolErr != nil {
+				log.WithFields(log.Fields{"Error": spoolErr, "url": elkURL, "file": filePath}).Error("Unable to write failed data to retry queue, data will be lost")
+				return spoolErr
+			}
 			log.WithFields(log.Fields{"Error": err, "url": elkURL, "file": filePath}).Error("Unable to push data to elasticsearch, will be retried later...")
-			return
+			return nil
 		}
 	}
 	log.Infof("Data from %s pushed to elasticsearch successfully", filePath)
+	return nil
 }
 
 func httpCall(httpMethod, elkURL, elkUser, elkPassword string, data *string, queryParams map[string]string, timeout time.Duration) ([]byte, error) {
@@ -168,52 +216,92 @@ func httpCall(httpMethod, elkURL, elkUser, elkPassword string, data *string, que
 	return resp, nil
 }
 
-func retryPushData(elkURL, elkUser, elkPassword string, data *string) error {
+// retries the failed part of bulk request, returns the data which is still not pushed.
+func retryPushData(elkURL, elkUser, elkPassword string, data string, filePath string) (string, error) {
 	var err error
 	for i := 0; i < maxRetryAttempts; i++ {
 		log.WithFields(log.Fields{"url": elkURL}).Error("retrying push data to elasticsearch")
-		_, err = httpCall(http.MethodPost, elkURL, elkUser, elkPassword, data, nil, defaultTimeout)
+		data, err = bulkPush(elkURL, elkUser, elkPassword, data, filePath)
 		if err == nil {
-			return nil
+			return "", nil
 		}
 	}
-	return err
+	return data, err
+}
+
+// InitRetryQueue opens the on-disk queue in which failed bulk requests are kept until they are pushed to elasticsearch.
+func InitRetryQueue(queueConf config.RetryQueueConf) error {
+	queue, err := spool.Open(queueConf.Dir, int64(queueConf.MaxSizeMB)*1024*1024)
+	if err != nil {
+		return err
+	}
+	retryQueue = queue
+	if depth := queue.Depth(); depth > 0 {
+		log.Infof("Found %d failed requests in retry queue %s, oldest entry age: %v", depth, queueConf.Dir, queue.OldestAge())
+	}
+	return nil
 }
 
-// PushFailedData pushes previously failed files from failedData map to elasticsearch every 5 min.
+// PushFailedData pushes previously failed requests from the retry queue to elasticsearch at startup and every 5 min.
 func PushFailedData(esConf config.ElasticsearchConf) {
-	elkURL := esConf.URL + elkBulkAPI
 	if retryTicker == nil {
 		retryTicker = time.NewTicker(retryDuration)
 	}
 
 	go func() {
+		replayFailedData(esConf)
 		for {
 			<-retryTicker.C
-			for i := len(failedData) - 1; i >= 0; i-- {
-				filePath := failedData[i].filePath
-				data := failedData[i].data
-				log.Infof("Retrying to push failed data from %s to elasticsearch", filePath)
-				_, err := httpCall(http.MethodPost, elkURL, esConf.User, esConf.Password, &data, nil, defaultTimeout)
-				if err == nil {
-					failedData = append(failedData[:i], failedData[i+1:]...)
-					log.Infof("Data from %s pushed to elasticsearch successfully", filePath)
-				} else {
-					log.WithFields(log.Fields{"Error": err, "url": elkURL, "file": filePath}).Error("Unable to push data to elasticsearch, push to elasticsearch will be retried")
-				}
-			}
+			replayFailedData(esConf)
 		}
 	}()
 }
 
-func readFile(filePath string) ([]byte, error) {
-	f, err := os.Open(filePath)
+// pushes the requests from retry queue in the order they failed, stops at first failure to keep the order.
+// Of a partially accepted request only the documents failed with retryable error are kept in the queue,
+// documents rejected permanently are written to the dead letter file by bulkPush.
+func replayFailedData(esConf config.ElasticsearchConf) {
+	if retryQueue == nil || retryQueue.Depth() == 0 {
+		return
+	}
+	elkURL := esConf.URL + elkBulkAPI
+	log.Infof("Retrying to push %d failed requests to elasticsearch, oldest entry age: %v", retryQueue.Depth(), retryQueue.OldestAge())
+	_, err := retryQueue.Replay(func(entry spool.Entry) error {
+		log.Infof("Retrying to push failed data from %s to elasticsearch", entry.Source)
+		retryData, err := bulkPush(elkURL, esConf.User, esConf.Password, string(entry.Data), entry.Source)
+		if err != nil {
+			log.WithFields(log.Fields{"Error": err, "url": elkURL, "file": entry.Source}).Error("Unable to push data to elasticsearch, push to elasticsearch will be retried")
+			if retryData != "" && retryData != string(entry.Data) {
+				return &spool.PartialError{Remaining: []byte(retryData), Err: err}
+			}
+			return err
+		}
+		log.Infof("Data from %s pushed to elasticsearch successfully", entry.Source)
+		return nil
+	})
 	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Errorf("Error while reading file: %s", filePath)
-		return nil, err
+		log.WithFields(log.Fields{"queue_depth": retryQueue.Depth(), "oldest_entry_age": retryQueue.OldestAge()}).Warn("Failed requests remaining in retry queue")
+	}
+}
+
+// FailedDataCount returns the no. of failed bulk requests waiting in the retry queue to be pushed again to elasticsearch.
+func FailedDataCount() int {
+	if retryQueue == nil {
+		return 0
 	}
-	defer f.Close()
-	data, err := io.ReadAll(f)
+	return retryQueue.Depth()
+}
+
+// FailedDataAge returns the age of the oldest failed bulk request waiting in the retry queue.
+func FailedDataAge() time.Duration {
+	if retryQueue == nil {
+		return 0
+	}
+	return retryQueue.OldestAge()
+}
+
+func readData(filePath string, r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Errorf("Error while reading file: %s", filePath)
 		return nil, err
@@ -0,0 +1,115 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Extensions of the collected files written in NDJSON format, other files are JSON arrays.
+const (
+	ndjsonExtension     = ".ndjson"
+	ndjsonGzipExtension = ".ndjson.gz"
+)
+
+func isNDJSON(filePath string) bool {
+	return strings.HasSuffix(filePath, ndjsonExtension) || strings.HasSuffix(filePath, ndjsonGzipExtension)
+}
+
+// recordDecoder decodes the records of a collected file one by one, the file is either a JSON array or NDJSON with
+// one record per line.
+type recordDecoder struct {
+	filePath string
+	dec      *json.Decoder
+	ndjson   bool
+}
+
+// newRecordDecoder returns the decoder of the records read from r, for JSON array the array start is read.
+func newRecordDecoder(filePath string, r io.Reader) (*recordDecoder, error) {
+	d := &recordDecoder{filePath: filePath, dec: json.NewDecoder(r), ndjson: isNDJSON(filePath)}
+	if d.ndjson {
+		return d, nil
+	}
+
+	// read open bracket
+	t, err := d.dec.Token()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Error while getting json token: %s", filePath)
+		return nil, err
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != '[' {
+		log.WithFields(log.Fields{"error": err}).Errorf("Invalid file %s, array starting not found", filePath)
+		return nil, fmt.Errorf("invalid file %s, array starting not found", filePath)
+	}
+	return d, nil
+}
+
+// More returns true if there are more records to decode.
+func (d *recordDecoder) More() bool {
+	return d.dec.More()
+}
+
+// Decode decodes the next record into v.
+func (d *recordDecoder) Decode(v interface{}) error {
+	err := d.dec.Decode(v)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Error while decoding json: %s", d.filePath)
+	}
+	return err
+}
+
+// Close reads the array end of JSON array, it's a no-op for NDJSON.
+func (d *recordDecoder) Close() error {
+	if d.ndjson {
+		return nil
+	}
+
+	// read closing bracket
+	t, err := d.dec.Token()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Error while getting json token: %s", d.filePath)
+		return err
+	}
+	if delim, ok := t.(json.Delim); !ok || delim != ']' {
+		log.WithFields(log.Fields{"error": err}).Errorf("Invalid file %s, array ending not found", d.filePath)
+		return fmt.Errorf("invalid file %s, array ending not found", d.filePath)
+	}
+	return nil
+}
+
+// decodeData decodes the whole collected file into v. For NDJSON the records are appended to v if it's a slice,
+// otherwise the file's single record is decoded into v.
+func decodeData(filePath string, r io.Reader, v interface{}) error {
+	if !isNDJSON(filePath) {
+		data, err := readData(filePath, r)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, v)
+	}
+
+	dec := json.NewDecoder(r)
+	slice := reflect.ValueOf(v).Elem()
+	if slice.Kind() != reflect.Slice {
+		return dec.Decode(v)
+	}
+	for dec.More() {
+		item := reflect.New(slice.Type().Elem())
+		err := dec.Decode(item.Interface())
+		if err != nil {
+			return err
+		}
+		slice.Set(reflect.Append(slice, item.Elem()))
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package elasticsearch
+
+import (
+	"bytes"
+	"compress/gzip"
+	"elasticsearchplugin/pkg/config"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// converts the JSON array to NDJSON with one record per line.
+func toNDJSON(t *testing.T, data string) string {
+	var records []json.RawMessage
+	err := json.Unmarshal([]byte(data), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	for _, record := range records {
+		err = json.Compact(&buf, record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+func gzipData(t *testing.T, data string) string {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return buf.String()
+}
+
+// returns the action lines of the bulk requests, document sources differ only by timestamp.
+func bulkActions(requests []string) []string {
+	var actions []string
+	for _, request := range requests {
+		lines := strings.Split(request, "\n")
+		for i := 0; i < len(lines); i += 2 {
+			actions = append(actions, lines[i])
+		}
+	}
+	return actions
+}
+
+func TestPushReaderWithNDJSON(t *testing.T) {
+	tests := []struct {
+		apiType string
+		data    string
+	}{
+		{"pmdata_RADIO", testPMData},
+		{"fmdata_RADIO_HISTORY", testFMData},
+		{"network-hardware-groups_testuser@nokia.com", testNhgData},
+		{"access-point-sims_12345", testApSimsData},
+	}
+	for _, test := range tests {
+		var received []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, elkBulkAPI) {
+				body, _ := io.ReadAll(r.Body)
+				received = append(received, string(body))
+			}
+			w.WriteHeader(http.StatusOK)
+		}))
+		esConf := config.ElasticsearchConf{URL: server.URL}
+		ndjson := toNDJSON(t, test.data)
+
+		err := PushReader(test.apiType+"_response_1.json", strings.NewReader(test.data), esConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromJSON := bulkActions(received)
+		received = nil
+		err = PushReader(test.apiType+"_response_1.ndjson", strings.NewReader(ndjson), esConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromNDJSON := bulkActions(received)
+		received = nil
+		err = PushReader(test.apiType+"_response_1.ndjson.gz", strings.NewReader(gzipData(t, ndjson)), esConf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fromGzip := bulkActions(received)
+		server.Close()
+
+		if len(fromJSON) == 0 || strings.Join(fromJSON, "\n") != strings.Join(fromNDJSON, "\n") || strings.Join(fromJSON, "\n") != strings.Join(fromGzip, "\n") {
+			t.Errorf("expected same actions for %s, got %v, %v and %v", test.apiType, fromJSON, fromNDJSON, fromGzip)
+		}
+	}
+}
+
+func TestDecodeDataWithNDJSONObject(t *testing.T) {
+	var sims simsResponse
+	err := decodeData("sims_12345_response_1.ndjson", strings.NewReader(toNDJSON(t, "["+testSimData+"]")), &sims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sims.Subsc) == 0 {
+		t.Error("expected sims to be decoded")
+	}
+
+	err = PushReader("pmdata_RADIO_response_1.ndjson.gz", strings.NewReader("invalid"), config.ElasticsearchConf{URL: "http://127.0.0.1:1"})
+	if err == nil {
+		t.Error("expected error for invalid gzip data")
+	}
+}
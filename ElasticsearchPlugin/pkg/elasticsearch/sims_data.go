@@ -9,6 +9,7 @@ package elasticsearch
 import (
 	"elasticsearchplugin/pkg/config"
 	"encoding/json"
+	"io"
 	"path"
 	"strings"
 	"time"
@@ -82,30 +83,24 @@ type apSimsDetails struct {
 	Timestamp       time.Time   `json:"timestamp"`
 }
 
-func pushAPSimsData(filePath string, esConf config.ElasticsearchConf) {
+func pushAPSimsData(filePath string, r io.Reader, esConf config.ElasticsearchConf) error {
 	//deleting data from ap-sims-data index
 	deletionTime := currentTime().Add(-15 * time.Minute).UTC().Format(timestampFormat)
 	deleteData([]string{indexMetaData[apSimsData]}, deletionTime, esConf)
 
 	elkURL := esConf.URL + elkBulkAPI
 	log.Infof("Pushing data from %s to elasticsearch", filePath)
-	data, err := readFile(filePath)
-	if err != nil {
-		return
-	}
-
 	fileName := path.Base(filePath)
 	keys := strings.Split(fileName, "_")
 	metric := strings.ToLower(keys[0])
 	accID := strings.ToLower(keys[1])
 
 	var apSims apSimsResponse
-	err = json.Unmarshal(data, &apSims)
+	err := decodeData(filePath, r, &apSims)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Errorf("Unable to unmarshal json data %s", filePath)
-		return
+		return err
 	}
-	data = nil
 
 	var postData string
 	index := indexMetaData[metric]
@@ -125,36 +120,30 @@ func pushAPSimsData(filePath string, esConf config.ElasticsearchConf) {
 	}
 	if postData == "" {
 		log.WithFields(log.Fields{"file": filePath}).Debug("Found no sims data")
-		return
+		return nil
 	}
 
-	pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
+	return pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
 }
 
-func pushSimsData(filePath string, esConf config.ElasticsearchConf) {
+func pushSimsData(filePath string, r io.Reader, esConf config.ElasticsearchConf) error {
 	//deleting data from sims-data and account-sims-data indices
 	deletionTime := currentTime().Add(-15 * time.Minute).UTC().Format(timestampFormat)
 	deleteData([]string{indexMetaData[simsData], indexMetaData[accountSimsData]}, deletionTime, esConf)
 
 	elkURL := esConf.URL + elkBulkAPI
 	log.Infof("Pushing data from %s to elasticsearch", filePath)
-	data, err := readFile(filePath)
-	if err != nil {
-		return
-	}
-
 	fileName := path.Base(filePath)
 	keys := strings.Split(fileName, "_")
 	metric := strings.ToLower(keys[0])
 	accID := strings.ToLower(keys[1])
 
 	var sims simsResponse
-	err = json.Unmarshal(data, &sims)
+	err := decodeData(filePath, r, &sims)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Errorf("Unable to unmarshal json data %s", filePath)
-		return
+		return err
 	}
-	data = nil
 
 	var postData string
 	index := indexMetaData[metric]
@@ -195,8 +184,8 @@ func pushSimsData(filePath string, esConf config.ElasticsearchConf) {
 	}
 	if postData == "" {
 		log.WithFields(log.Fields{"file": filePath}).Debug("Found no sims data")
-		return
+		return nil
 	}
 
-	pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
+	return pushData(elkURL, esConf.User, esConf.Password, postData, filePath)
 }
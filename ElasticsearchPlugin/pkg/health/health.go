@@ -0,0 +1,74 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package health
+
+import (
+	"elasticsearchplugin/pkg/config"
+	"elasticsearchplugin/pkg/elasticsearch"
+	"encoding/json"
+	"net/http"
+)
+
+var (
+	//checks used by readiness endpoint, overridden in tests
+	checkReachability = elasticsearch.CheckReachability
+	failedDataCount   = elasticsearch.FailedDataCount
+	failedDataAge     = elasticsearch.FailedDataAge
+)
+
+// ReadinessStatus is the response body of readiness endpoint.
+type ReadinessStatus struct {
+	Ready                  bool    `json:"ready"`
+	ElasticsearchReachable bool    `json:"elasticsearch_reachable"`
+	Error                  string  `json:"error,omitempty"`
+	FailedBacklog          int     `json:"failed_backlog"`
+	FailedBacklogAge       float64 `json:"failed_backlog_oldest_age_seconds"`
+	MaxFailedBacklog       int     `json:"max_failed_backlog"`
+}
+
+// Register adds /healthz and /readyz endpoints to mux.
+func Register(mux *http.ServeMux, conf config.Config) {
+	mux.HandleFunc("/healthz", healthHandler)
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readinessHandler(w, conf)
+	})
+}
+
+// liveness check, plugin is healthy as long as it is able to serve the request.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// readiness check, plugin is ready when elasticsearch is reachable and failed data backlog is within the limit.
+func readinessHandler(w http.ResponseWriter, conf config.Config) {
+	status := GetReadinessStatus(conf)
+	w.Header().Set("Content-Type", "application/json")
+	if status.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// GetReadinessStatus checks elasticsearch reachability, the size and the age of failed data backlog.
+func GetReadinessStatus(conf config.Config) ReadinessStatus {
+	status := ReadinessStatus{
+		FailedBacklog:    failedDataCount(),
+		FailedBacklogAge: failedDataAge().Seconds(),
+		MaxFailedBacklog: conf.MaxFailedBacklog,
+	}
+	err := checkReachability(conf.ElasticsearchConf)
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.ElasticsearchReachable = true
+	}
+	status.Ready = status.ElasticsearchReachable && status.FailedBacklog <= status.MaxFailedBacklog
+	return status
+}
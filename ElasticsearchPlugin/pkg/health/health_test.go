@@ -0,0 +1,80 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package health
+
+import (
+	"elasticsearchplugin/pkg/config"
+	"elasticsearchplugin/pkg/elasticsearch"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux, config.Config{})
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fail()
+	}
+}
+
+func TestReadyzWithReachableElasticsearch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	mux := http.NewServeMux()
+	Register(mux, config.Config{ElasticsearchConf: config.ElasticsearchConf{URL: server.URL}, MaxFailedBacklog: 10})
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", recorder.Code)
+	}
+	var status ReadinessStatus
+	err := json.NewDecoder(recorder.Body).Decode(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Ready || !status.ElasticsearchReachable || status.FailedBacklog != 0 {
+		t.Errorf("unexpected readiness status: %+v", status)
+	}
+}
+
+func TestReadyzWithUnreachableElasticsearch(t *testing.T) {
+	checkReachability = func(config.ElasticsearchConf) error { return errors.New("connection refused") }
+	defer func() { checkReachability = elasticsearch.CheckReachability }()
+
+	mux := http.NewServeMux()
+	Register(mux, config.Config{MaxFailedBacklog: 10})
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code 503, got %d", recorder.Code)
+	}
+}
+
+func TestReadyzWithLargeBacklog(t *testing.T) {
+	checkReachability = func(config.ElasticsearchConf) error { return nil }
+	failedDataCount = func() int { return 11 }
+	failedDataAge = func() time.Duration { return 90 * time.Second }
+	defer func() {
+		checkReachability = elasticsearch.CheckReachability
+		failedDataCount = elasticsearch.FailedDataCount
+		failedDataAge = elasticsearch.FailedDataAge
+	}()
+
+	status := GetReadinessStatus(config.Config{MaxFailedBacklog: 10})
+	if status.Ready || !status.ElasticsearchReachable || status.FailedBacklog != 11 || status.FailedBacklogAge != 90 {
+		t.Errorf("unexpected readiness status: %+v", status)
+	}
+}
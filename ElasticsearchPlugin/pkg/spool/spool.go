@@ -0,0 +1,370 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	segmentExt    = ".seg"
+	tmpFilePrefix = ".tmp-"
+)
+
+var currentTime = time.Now
+
+// Spool is a durable, size bounded FIFO queue backed by segment files in a directory.
+// Each entry is stored in its own segment file named after its sequence number.
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mux      sync.Mutex
+	segments []segment
+	size     int64
+	nextSeq  uint64
+
+	//serializes replays, so that entries are never pushed twice or out of order
+	replayMux sync.Mutex
+}
+
+// Entry is a payload read back from the spool.
+type Entry struct {
+	Source  string
+	Data    []byte
+	Created time.Time
+}
+
+// PartialError is returned by the replay function when only a part of the entry could be replayed.
+// The entry's data is replaced with Remaining, so that the replayed part isn't replayed again.
+type PartialError struct {
+	Remaining []byte
+	Err       error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PartialError) Unwrap() error {
+	return e.Err
+}
+
+// segment keeps the metadata of a segment file present in the spool.
+type segment struct {
+	seq     uint64
+	size    int64
+	created time.Time
+}
+
+// header written as the first line of each segment file.
+type header struct {
+	Source  string    `json:"source"`
+	Created time.Time `json:"created"`
+}
+
+// Open creates the spool directory if needed and loads the segments left over from the previous run.
+func Open(dir string, maxBytes int64) (*Spool, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("invalid spool size: %d", maxBytes)
+	}
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes, nextSeq: 1}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			continue
+		}
+		//partially written segments from an unclean shutdown are discarded
+		if strings.HasPrefix(name, tmpFilePrefix) {
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if filepath.Ext(name) != segmentExt {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, err
+		}
+		hdr, err := readHeader(filepath.Join(dir, name))
+		if err != nil {
+			log.WithFields(log.Fields{"error": err, "file": name}).Warn("Discarding corrupted spool segment")
+			_ = os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		s.segments = append(s.segments, segment{seq: seq, size: info.Size(), created: hdr.Created})
+		s.size += info.Size()
+		if seq >= s.nextSeq {
+			s.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].seq < s.segments[j].seq })
+	return s, nil
+}
+
+// Append durably writes data to a new segment file.
+// If the spool would exceed its size limit, the oldest entries are dropped to make room.
+func (s *Spool) Append(source string, data []byte) error {
+	now := currentTime()
+	hdr, err := json.Marshal(header{Source: source, Created: now})
+	if err != nil {
+		return err
+	}
+	segSize := int64(len(hdr) + 1 + len(data))
+	if segSize > s.maxBytes {
+		return fmt.Errorf("entry of %d bytes exceeds spool size limit of %d bytes", segSize, s.maxBytes)
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for len(s.segments) > 0 && s.size+segSize > s.maxBytes {
+		oldest := s.segments[0]
+		err = os.Remove(s.segmentPath(oldest.seq))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		s.segments = s.segments[1:]
+		s.size -= oldest.size
+		log.WithFields(log.Fields{"seq": oldest.seq, "created": oldest.created}).Warn("Spool size limit reached, dropped oldest entry")
+	}
+
+	seq := s.nextSeq
+	tmpFile := filepath.Join(s.dir, tmpFilePrefix+strconv.FormatUint(seq, 10))
+	err = writeSync(tmpFile, append(append(hdr, '\n'), data...))
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+	err = os.Rename(tmpFile, s.segmentPath(seq))
+	if err != nil {
+		_ = os.Remove(tmpFile)
+		return err
+	}
+	err = syncDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	s.nextSeq++
+	s.segments = append(s.segments, segment{seq: seq, size: segSize, created: now})
+	s.size += segSize
+	return nil
+}
+
+// Replay passes the spooled entries to fn in the order they were appended.
+// An entry is removed once fn returns nil, replay stops at the first error so that the order is preserved.
+// If fn returns PartialError, the entry is kept with the remaining data.
+// It returns the no. of entries replayed successfully.
+func (s *Spool) Replay(fn func(Entry) error) (int, error) {
+	s.replayMux.Lock()
+	defer s.replayMux.Unlock()
+
+	replayed := 0
+	for {
+		s.mux.Lock()
+		if len(s.segments) == 0 {
+			s.mux.Unlock()
+			return replayed, nil
+		}
+		seg := s.segments[0]
+		s.mux.Unlock()
+
+		entry, err := readEntry(s.segmentPath(seg.seq))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.WithFields(log.Fields{"error": err, "seq": seg.seq}).Error("Discarding unreadable spool segment")
+			}
+			s.remove(seg.seq)
+			continue
+		}
+		err = fn(entry)
+		var partial *PartialError
+		if errors.As(err, &partial) {
+			updateErr := s.update(seg.seq, entry, partial.Remaining)
+			if updateErr != nil {
+				log.WithFields(log.Fields{"error": updateErr, "seq": seg.seq}).Error("Unable to update spool segment, entry is kept as a whole")
+			}
+		}
+		if err != nil {
+			return replayed, err
+		}
+		s.remove(seg.seq)
+		replayed++
+	}
+}
+
+// Depth returns the no. of entries in the spool.
+func (s *Spool) Depth() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return len(s.segments)
+}
+
+// Size returns the total size in bytes of the entries in the spool.
+func (s *Spool) Size() int64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	return s.size
+}
+
+// OldestAge returns the age of the oldest entry in the spool, 0 if the spool is empty.
+func (s *Spool) OldestAge() time.Duration {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if len(s.segments) == 0 {
+		return 0
+	}
+	return currentTime().Sub(s.segments[0].created)
+}
+
+// removes the segment file with the given sequence no., it might have already been dropped by Append.
+func (s *Spool) remove(seq uint64) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i, seg := range s.segments {
+		if seg.seq != seq {
+			continue
+		}
+		err := os.Remove(s.segmentPath(seq))
+		if err != nil && !os.IsNotExist(err) {
+			log.WithFields(log.Fields{"error": err, "seq": seq}).Error("Unable to remove spool segment")
+		}
+		s.segments = append(s.segments[:i], s.segments[i+1:]...)
+		s.size -= seg.size
+		return
+	}
+}
+
+// replaces the data of the segment with the given sequence no., keeping its source and creation time.
+func (s *Spool) update(seq uint64, entry Entry, data []byte) error {
+	hdr, err := json.Marshal(header{Source: entry.Source, Created: entry.Created})
+	if err != nil {
+		return err
+	}
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for i, seg := range s.segments {
+		if seg.seq != seq {
+			continue
+		}
+		tmpFile := filepath.Join(s.dir, tmpFilePrefix+strconv.FormatUint(seq, 10))
+		err = writeSync(tmpFile, append(append(hdr, '\n'), data...))
+		if err != nil {
+			_ = os.Remove(tmpFile)
+			return err
+		}
+		err = os.Rename(tmpFile, s.segmentPath(seq))
+		if err != nil {
+			_ = os.Remove(tmpFile)
+			return err
+		}
+		segSize := int64(len(hdr) + 1 + len(data))
+		s.size += segSize - seg.size
+		s.segments[i].size = segSize
+		return syncDir(s.dir)
+	}
+	return nil
+}
+
+func (s *Spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
+
+func readHeader(filePath string) (header, error) {
+	var hdr header
+	f, err := os.Open(filePath)
+	if err != nil {
+		return hdr, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil {
+		return hdr, err
+	}
+	err = json.Unmarshal(line, &hdr)
+	return hdr, err
+}
+
+func readEntry(filePath string) (Entry, error) {
+	var entry Entry
+	f, err := os.Open(filePath)
+	if err != nil {
+		return entry, err
+	}
+	defer f.Close()
+	content, err := io.ReadAll(f)
+	if err != nil {
+		return entry, err
+	}
+	idx := bytes.IndexByte(content, '\n')
+	if idx < 0 {
+		return entry, fmt.Errorf("missing header in %s", filePath)
+	}
+	var hdr header
+	err = json.Unmarshal(content[:idx], &hdr)
+	if err != nil {
+		return entry, err
+	}
+	entry.Source = hdr.Source
+	entry.Created = hdr.Created
+	entry.Data = content[idx+1:]
+	return entry, nil
+}
+
+// writes data to filePath and flushes it to the disk.
+func writeSync(filePath string, data []byte) error {
+	f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err != nil {
+		return err
+	}
+	return closeErr
+}
+
+// flushes the directory entry, so that the renamed segment survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,195 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package spool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestReplayInOrder(t *testing.T) {
+	s, err := Open(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		err = s.Append("file"+strconv.Itoa(i), []byte("data"+strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Depth() != 3 {
+		t.Errorf("expected depth 3, got %d", s.Depth())
+	}
+
+	var sources []string
+	replayed, err := s.Replay(func(e Entry) error {
+		sources = append(sources, e.Source)
+		if string(e.Data) != "data"+strconv.Itoa(len(sources)-1) {
+			t.Errorf("unexpected data %s for %s", e.Data, e.Source)
+		}
+		return nil
+	})
+	if err != nil || replayed != 3 {
+		t.Errorf("expected 3 entries to be replayed, got %d, error: %v", replayed, err)
+	}
+	if len(sources) != 3 || sources[0] != "file0" || sources[1] != "file1" || sources[2] != "file2" {
+		t.Errorf("entries replayed out of order: %v", sources)
+	}
+	if s.Depth() != 0 || s.Size() != 0 {
+		t.Errorf("expected empty spool, got depth %d, size %d", s.Depth(), s.Size())
+	}
+}
+
+func TestReplayStopsOnFailure(t *testing.T) {
+	s, err := Open(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Append("file0", []byte("data0"))
+	_ = s.Append("file1", []byte("data1"))
+
+	calls := 0
+	replayed, err := s.Replay(func(e Entry) error {
+		calls++
+		return errors.New("connection refused")
+	})
+	if err == nil || replayed != 0 || calls != 1 {
+		t.Errorf("expected replay to stop at first failure, replayed: %d, calls: %d, error: %v", replayed, calls, err)
+	}
+	if s.Depth() != 2 {
+		t.Errorf("expected failed entries to be kept, got depth %d", s.Depth())
+	}
+}
+
+func TestReplayKeepsRemainingDataOnPartialFailure(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Append("file0", []byte("data0 data1"))
+	_ = s.Append("file1", []byte("data2"))
+
+	replayed, err := s.Replay(func(e Entry) error {
+		return &PartialError{Remaining: []byte("data1"), Err: errors.New("1 document rejected")}
+	})
+	if err == nil || err.Error() != "1 document rejected" || replayed != 0 {
+		t.Errorf("expected replay to stop at partial failure, replayed: %d, error: %v", replayed, err)
+	}
+	if s.Depth() != 2 {
+		t.Errorf("expected entries to be kept, got depth %d", s.Depth())
+	}
+
+	//remaining data is persisted with the entry's source
+	s, err = Open(dir, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []Entry
+	_, err = s.Replay(func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil || len(entries) != 2 || entries[0].Source != "file0" || string(entries[0].Data) != "data1" || string(entries[1].Data) != "data2" {
+		t.Errorf("unexpected entries after partial replay: %v, error: %v", entries, err)
+	}
+	if s.Size() != 0 {
+		t.Errorf("expected empty spool, got size %d", s.Size())
+	}
+}
+
+func TestSpoolPersistsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = s.Append("file0", []byte("data0"))
+	_ = s.Append("file1", []byte("data1"))
+	//leftover of an interrupted write
+	err = os.WriteFile(filepath.Join(dir, tmpFilePrefix+"3"), []byte("partial"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = Open(dir, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Depth() != 2 {
+		t.Errorf("expected depth 2 after reopening, got %d", s.Depth())
+	}
+	if _, err = os.Stat(filepath.Join(dir, tmpFilePrefix+"3")); !os.IsNotExist(err) {
+		t.Error("expected temporary file to be removed")
+	}
+	_ = s.Append("file2", []byte("data2"))
+
+	var sources []string
+	_, err = s.Replay(func(e Entry) error {
+		sources = append(sources, e.Source)
+		return nil
+	})
+	if err != nil || len(sources) != 3 || sources[0] != "file0" || sources[2] != "file2" {
+		t.Errorf("unexpected replay after reopening: %v, error: %v", sources, err)
+	}
+}
+
+func TestSpoolDropsOldestWhenFull(t *testing.T) {
+	s, err := Open(t.TempDir(), 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 50)
+	for i := 0; i < 5; i++ {
+		err = s.Append("file"+strconv.Itoa(i), data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if s.Size() > 200 {
+		t.Errorf("spool size %d exceeds limit", s.Size())
+	}
+
+	var sources []string
+	_, _ = s.Replay(func(e Entry) error {
+		sources = append(sources, e.Source)
+		return nil
+	})
+	if len(sources) == 0 || sources[len(sources)-1] != "file4" || sources[0] == "file0" {
+		t.Errorf("expected oldest entries to be dropped, got %v", sources)
+	}
+
+	err = s.Append("large", make([]byte, 500))
+	if err == nil {
+		t.Error("expected error for entry larger than the spool")
+	}
+}
+
+func TestOldestAge(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	currentTime = func() time.Time { return now }
+	defer func() { currentTime = time.Now }()
+
+	s, err := Open(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.OldestAge() != 0 {
+		t.Errorf("expected 0 age for empty spool, got %v", s.OldestAge())
+	}
+	_ = s.Append("file0", []byte("data0"))
+	now = now.Add(5 * time.Minute)
+	_ = s.Append("file1", []byte("data1"))
+	if s.OldestAge() != 5*time.Minute {
+		t.Errorf("expected age 5m, got %v", s.OldestAge())
+	}
+}
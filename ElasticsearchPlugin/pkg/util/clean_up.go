@@ -45,6 +45,13 @@ func RemoveFiles(cleanupDuration int, path string) {
 			err = os.Remove(fileName)
 			if err != nil {
 				log.WithFields(log.Fields{"error": err}).Error("Error while deleting file ", fileName)
+				continue
+			}
+			if ledger != nil {
+				err = ledger.Remove(fileName)
+				if err != nil {
+					log.WithFields(log.Fields{"error": err}).Error("Unable to remove ", fileName, " from processed file ledger")
+				}
 			}
 		}
 	}
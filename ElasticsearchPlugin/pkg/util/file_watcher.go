@@ -12,6 +12,8 @@ import (
 	"fmt"
 	"math"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/fsnotify/fsnotify"
@@ -72,16 +74,17 @@ func add(sourceDir string) error {
 }
 
 // WatchEvents watches file creation events and formats PM/FM data.
+// Collector writes the response to a temporary file and renames it, so the complete file is processed on its creation event.
 func WatchEvents(conf config.Config) {
 	requests := make(chan struct{}, conf.MaxConcurrentProcess)
 	for {
 		select {
 		case event := <-watcher.Events:
-			if event.Op&fsnotify.Write == fsnotify.Write {
+			if event.Op&fsnotify.Create == fsnotify.Create && !isTempFile(event.Name) {
 				log.Infof("Received event: %s", event.Name)
 				requests <- struct{}{}
 				go func() {
-					elasticsearch.PushData(event.Name, conf.ElasticsearchConf)
+					pushFile(event.Name, conf)
 					<-requests
 				}()
 			}
@@ -105,17 +108,47 @@ func processExistingFiles(directory string, conf config.Config) {
 	wg := sync.WaitGroup{}
 	requests := make(chan struct{}, int(math.Ceil(float64(conf.MaxConcurrentProcess)/4)))
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() || isTempFile(file.Name()) {
 			continue
 		}
+		filePath := directory + "/" + file.Name()
+		if ledger != nil {
+			info, err := file.Info()
+			if err == nil && ledger.IsProcessed(filePath, info) {
+				log.Debugf("Skipping %s, already pushed to elasticsearch", filePath)
+				continue
+			}
+		}
 		//push data to elk
 		requests <- struct{}{}
 		wg.Add(1)
-		go func(fileName string) {
-			elasticsearch.PushData(directory+"/"+fileName, conf.ElasticsearchConf)
+		go func(filePath string) {
+			pushFile(filePath, conf)
 			wg.Done()
 			<-requests
-		}(file.Name())
+		}(filePath)
 	}
 	wg.Wait()
 }
+
+// pushes the file to elasticsearch and records it in the ledger.
+func pushFile(filePath string, conf config.Config) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Unable to get file info of %s", filePath)
+		return
+	}
+	err = elasticsearch.PushData(filePath, conf.ElasticsearchConf)
+	if err != nil || ledger == nil {
+		return
+	}
+	err = ledger.Record(filePath, info)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Unable to record %s in processed file ledger", filePath)
+	}
+}
+
+// checks if the file is a temporary file being written by the collector.
+func isTempFile(filePath string) bool {
+	return strings.HasPrefix(filepath.Base(filePath), ".")
+}
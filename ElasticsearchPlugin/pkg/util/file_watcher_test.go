@@ -216,6 +216,35 @@ func TestWatchEvents(t *testing.T) {
 	}
 }
 
+func TestWatchEventsForRenamedFile(t *testing.T) {
+	dir, _ := os.Getwd()
+	tmpDir := "./tmp"
+	conf := config.Config{
+		SourceDirs:           []string{dir + "/tmp"},
+		CleanupDuration:      60,
+		MaxConcurrentProcess: 1,
+	}
+	os.MkdirAll(tmpDir+"/pmdata", os.ModePerm)
+	defer os.RemoveAll(tmpDir)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetLevel(log.Level(5))
+	defer func() {
+		log.SetOutput(os.Stderr)
+	}()
+	AddWatcher(conf)
+	go WatchEvents(conf)
+
+	tmpFile := tmpDir + "/pmdata/.test_file.json.123.tmp"
+	os.WriteFile(tmpFile, []byte("test"), 0644)
+	os.Rename(tmpFile, tmpDir+"/pmdata/test_file.json")
+	time.Sleep(10 * time.Millisecond)
+	if strings.Contains(buf.String(), "Received event: "+dir+"/tmp/pmdata/.test_file.json.123.tmp") || !strings.Contains(buf.String(), "Received event: "+dir+"/tmp/pmdata/test_file.json") {
+		t.Fail()
+	}
+}
+
 func TestProcessExistingFilesWithNonExistingDir(t *testing.T) {
 	var buf bytes.Buffer
 	log.SetOutput(&buf)
@@ -0,0 +1,170 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var ledger *Ledger
+
+// Ledger keeps the record of the files pushed to elasticsearch, so that they are not pushed again after restart.
+// Records are appended to the ledger file, which is compacted when it's opened.
+type Ledger struct {
+	filePath string
+	mux      sync.Mutex
+	file     *os.File
+	entries  map[string]ledgerEntry
+}
+
+// ledgerEntry is a line of the ledger file.
+type ledgerEntry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Removed bool      `json:"removed,omitempty"`
+}
+
+// InitLedger opens the ledger of processed files, if reset is true the existing records are discarded.
+func InitLedger(filePath string, reset bool) error {
+	l, err := openLedger(filePath, reset)
+	if err != nil {
+		return err
+	}
+	ledger = l
+	return nil
+}
+
+func openLedger(filePath string, reset bool) (*Ledger, error) {
+	err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	l := &Ledger{filePath: filePath, entries: make(map[string]ledgerEntry)}
+	if !reset {
+		err = l.load()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		log.Infof("Discarding processed file ledger %s, all the existing files will be pushed again", filePath)
+	}
+	err = l.compact()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// reads the records from ledger file, latest record of a file wins.
+func (l *Ledger) load() error {
+	f, err := os.Open(l.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry ledgerEntry
+		err = json.Unmarshal(scanner.Bytes(), &entry)
+		if err != nil {
+			//last line might be incomplete after a crash
+			log.WithFields(log.Fields{"error": err, "file": l.filePath}).Warn("Skipping invalid ledger record")
+			continue
+		}
+		if entry.Removed {
+			delete(l.entries, entry.Name)
+			continue
+		}
+		l.entries[entry.Name] = entry
+	}
+	return scanner.Err()
+}
+
+// rewrites the ledger file with the records of files still present on the disk.
+func (l *Ledger) compact() error {
+	tmpFile := l.filePath + ".tmp"
+	f, err := os.OpenFile(tmpFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for name, entry := range l.entries {
+		if _, err = os.Stat(name); os.IsNotExist(err) {
+			delete(l.entries, name)
+			continue
+		}
+		record, _ := json.Marshal(entry)
+		_, _ = w.Write(append(record, '\n'))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmpFile, l.filePath)
+	if err != nil {
+		return err
+	}
+	l.file, err = os.OpenFile(l.filePath, os.O_WRONLY|os.O_APPEND, 0644)
+	return err
+}
+
+// IsProcessed checks if the file with the same size and modification time was already pushed.
+func (l *Ledger) IsProcessed(filePath string, info os.FileInfo) bool {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	entry, ok := l.entries[filepath.Clean(filePath)]
+	return ok && entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime())
+}
+
+// Record adds the file to the ledger after it's pushed successfully.
+func (l *Ledger) Record(filePath string, info os.FileInfo) error {
+	entry := ledgerEntry{Name: filepath.Clean(filePath), Size: info.Size(), ModTime: info.ModTime()}
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	l.entries[entry.Name] = entry
+	return l.append(entry)
+}
+
+// Remove deletes the record of the file from the ledger.
+func (l *Ledger) Remove(filePath string) error {
+	name := filepath.Clean(filePath)
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if _, ok := l.entries[name]; !ok {
+		return nil
+	}
+	delete(l.entries, name)
+	return l.append(ledgerEntry{Name: name, Removed: true})
+}
+
+func (l *Ledger) append(entry ledgerEntry) error {
+	record, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = l.file.Write(append(record, '\n'))
+	if err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
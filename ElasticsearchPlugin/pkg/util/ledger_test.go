@@ -0,0 +1,129 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package util
+
+import (
+	"bytes"
+	"elasticsearchplugin/pkg/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestLedgerRecord(t *testing.T) {
+	dir := t.TempDir()
+	ledgerFile := filepath.Join(dir, "ledger", "processed_files.json")
+	dataFile := filepath.Join(dir, "pmdata_RADIO_data.json")
+	err := os.WriteFile(dataFile, []byte("[]"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(dataFile)
+
+	l, err := openLedger(ledgerFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.IsProcessed(dataFile, info) {
+		t.Error("file shouldn't be processed before it's recorded")
+	}
+	err = l.Record(dataFile, info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//records are kept across restart
+	l, err = openLedger(ledgerFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !l.IsProcessed(dataFile, info) {
+		t.Error("expected file to be processed after reopening ledger")
+	}
+
+	//modified file has to be pushed again
+	err = os.WriteFile(dataFile, []byte("[{}]"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	modifiedInfo, _ := os.Stat(dataFile)
+	if l.IsProcessed(dataFile, modifiedInfo) {
+		t.Error("modified file shouldn't be processed")
+	}
+
+	l, err = openLedger(ledgerFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.IsProcessed(dataFile, info) {
+		t.Error("expected ledger to be reset")
+	}
+}
+
+func TestLedgerRemove(t *testing.T) {
+	dir := t.TempDir()
+	ledgerFile := filepath.Join(dir, "processed_files.json")
+	dataFile := filepath.Join(dir, "fmdata_RADIO_ACTIVE_data.json")
+	err := os.WriteFile(dataFile, []byte("[]"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(dataFile)
+
+	l, err := openLedger(ledgerFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = l.Record(dataFile, info)
+	err = l.Remove(dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err = openLedger(ledgerFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.IsProcessed(dataFile, info) {
+		t.Error("expected removed file to be dropped from ledger")
+	}
+}
+
+func TestProcessExistingFilesSkipsRecordedFiles(t *testing.T) {
+	dir := t.TempDir()
+	fmDirPath := filepath.Join(dir, "fmdata")
+	os.MkdirAll(fmDirPath, os.ModePerm)
+	fmFile := fmDirPath + "/fmdata_RADIO_ACTIVE_data.json"
+	err := createTestData(fmFile, testFMData)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, _ := os.Stat(fmFile)
+
+	err = InitLedger(filepath.Join(dir, "processed_files.json"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { ledger = nil }()
+	_ = ledger.Record(fmFile, info)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetLevel(log.Level(5))
+	defer func() {
+		log.SetOutput(os.Stderr)
+	}()
+	processExistingFiles(fmDirPath, config.Config{CleanupDuration: 60, MaxConcurrentProcess: 1})
+	time.Sleep(10 * time.Millisecond)
+	if !strings.Contains(buf.String(), "Skipping "+fmFile+", already pushed to elasticsearch") || strings.Contains(buf.String(), "Pushing data from "+fmFile) {
+		t.Fail()
+	}
+}
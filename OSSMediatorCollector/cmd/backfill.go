@@ -0,0 +1,180 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package main
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/ndacapis"
+	"collector/pkg/sink"
+	"collector/pkg/utils"
+	"collector/pkg/validator"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const backfillUsage = `Usage: ./collector backfill -user <email> -api <pmdata|fmdata> -from <time> -to <time> [options]
+Collects the historical PM/FM data of the user's NHGs between -from and -to, in API's interval sized windows.
+The data is written to the configured sink as for the periodic calls, checkpoints of the running collector aren't updated.
+Options:
+`
+
+// runs the backfill subcommand with args following it, returns the exit code.
+func runBackfill(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	fs.SetOutput(out)
+	fs.StringVar(&confFile, "conf_file", "../resources/conf.json", "Config file path")
+	fs.StringVar(&certFile, "cert_file", "", "Certificate file path")
+	fs.BoolVar(&skipTLS, "skip_tls", false, "Skip TLS authentication")
+	fs.IntVar(&logLevel, "log_level", 4, "Log level, logs are written to stderr")
+	fs.StringVar(&secretKeyFile, "secret_key_file", "", "Secret key file path, "+utils.SecretKeyEnv+" environment variable is used if empty")
+	email := fs.String("user", "", "User's email")
+	apiName := fs.String("api", "", "API, ex: pmdata or /fmdata")
+	metricType := fs.String("metric_type", "", "API's metric type, required if the API is configured for multiple metric types")
+	apiType := fs.String("type", "", "API's type, required if the API is configured for multiple types")
+	var nhgIDs string
+	fs.StringVar(&nhgIDs, "nhg", "", "Comma separated NHG IDs, all the user's NHGs if empty")
+	fs.StringVar(&nhgIDs, "nhg_id", "", "Same as -nhg, for consistency with checkpoints subcommand")
+	from := fs.String("from", "", "Start time in RFC3339 format, ex: 2024-01-02T00:00:00Z")
+	to := fs.String("to", "", "End time in RFC3339 format, ex: 2024-01-03T00:00:00Z")
+	concurrency := fs.Int("concurrency", 1, "No. of concurrent API calls")
+	fs.Usage = func() {
+		fmt.Fprint(out, backfillUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *email == "" || *apiName == "" || *from == "" || *to == "" {
+		fmt.Fprintln(out, "-user, -api, -from and -to are required")
+		return 2
+	}
+	fromTime, err := time.Parse(time.RFC3339, *from)
+	if err != nil {
+		fmt.Fprintf(out, "invalid -from time: %v\n", err)
+		return 2
+	}
+	toTime, err := time.Parse(time.RFC3339, *to)
+	if err != nil {
+		fmt.Fprintf(out, "invalid -to time: %v\n", err)
+		return 2
+	}
+
+	//logs are written to stderr, so that they aren't mixed with the data written by STDOUT sink
+	log.SetOutput(os.Stderr)
+	log.SetFormatter(&log.TextFormatter{})
+	log.SetLevel(log.Level(logLevel))
+
+	err = config.ReadConfig(confFile)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	err = validator.ValidateConf(config.Current())
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	err = sink.InitOneShot()
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	user, api, err := findBackfillTarget(*email, *apiName, *metricType, *apiType)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	var nhgs []string
+	if nhgIDs != "" {
+		for _, nhgID := range strings.Split(nhgIDs, ",") {
+			nhgs = append(nhgs, strings.TrimSpace(nhgID))
+		}
+	}
+
+	err = utils.InitSecretKey(secretKeyFile)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	ndacapis.CreateHTTPClient(certFile, skipTLS)
+	authenticate(user)
+
+	//interrupted backfill reports the remaining windows as failed, so they can be backfilled again
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	go ndacapis.RefreshToken(ctx, user)
+	defer func() {
+		if err := ndacapis.Logout(user); err != nil {
+			log.WithFields(log.Fields{"error": err}).Errorf("Logout failed for %s", user.Email)
+		}
+	}()
+	createResponseDirectories(user)
+	failed, err := ndacapis.Backfill(ctx, ndacapis.BackfillRequest{
+		User:        user,
+		API:         api,
+		NhgIDs:      nhgs,
+		From:        fromTime,
+		To:          toTime,
+		Concurrency: *concurrency,
+	})
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	if len(failed) > 0 {
+		fmt.Fprintf(out, "Backfill failed for %d windows:\n", len(failed))
+		for _, window := range failed {
+			fmt.Fprintf(out, "nhg_id: %s, from: %s, to: %s\n", window.NhgID, window.StartTime, window.EndTime)
+		}
+		return 1
+	}
+	fmt.Fprintln(out, "Backfill completed successfully")
+	return 0
+}
+
+// finds the configured user and metric API to be backfilled.
+// The configured API is used, so that its aggregation and sink are applied to the backfilled data as well.
+func findBackfillTarget(email, apiName, metricType, apiType string) (*config.User, *config.APIConf, error) {
+	var user *config.User
+	for _, u := range config.Current().Users {
+		if u.Email == email {
+			user = u
+			break
+		}
+	}
+	if user == nil {
+		return nil, nil, fmt.Errorf("user %s isn't configured", email)
+	}
+
+	var apis []*config.APIConf
+	for _, api := range config.Current().MetricAPIs {
+		if path.Base(api.API) != path.Base(apiName) ||
+			(metricType != "" && api.MetricType != metricType) ||
+			(apiType != "" && api.Type != apiType) {
+			continue
+		}
+		apis = append(apis, api)
+	}
+	if len(apis) == 0 {
+		return nil, nil, fmt.Errorf("API %s with metric type %q and type %q isn't configured", apiName, metricType, apiType)
+	}
+	if len(apis) > 1 {
+		return nil, nil, fmt.Errorf("API %s is configured multiple times, -metric_type and -type are required", apiName)
+	}
+	return user, apis[0], nil
+}
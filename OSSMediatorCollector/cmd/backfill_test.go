@@ -0,0 +1,72 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package main
+
+import (
+	"bytes"
+	"collector/pkg/config"
+	"strings"
+	"testing"
+)
+
+func TestBackfillWithInvalidArgs(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"-user", "user1@nokia.com", "-api", "pmdata"},
+		{"-user", "user1@nokia.com", "-api", "pmdata", "-from", "yesterday", "-to", "2024-01-02T00:00:00Z"},
+		{"-user", "user1@nokia.com", "-api", "pmdata", "-from", "2024-01-01T00:00:00Z", "-to", "today"},
+	}
+	for _, args := range tests {
+		var out bytes.Buffer
+		if code := runBackfill(args, &out); code != 2 {
+			t.Errorf("expected exit code 2 for %v, got %d", args, code)
+		}
+	}
+}
+
+func TestBackfillAcceptsNHGFlags(t *testing.T) {
+	for _, flag := range []string{"-nhg", "-nhg_id"} {
+		var out bytes.Buffer
+		args := []string{flag, "nhg1,nhg2", "-user", "user1@nokia.com", "-api", "pmdata", "-from", "yesterday", "-to", "today"}
+		runBackfill(args, &out)
+		if !strings.Contains(out.String(), "invalid -from time") {
+			t.Errorf("expected %s flag to be parsed, got %s", flag, out.String())
+		}
+	}
+}
+
+func TestFindBackfillTarget(t *testing.T) {
+	tmp := config.Conf
+	defer func() { config.Conf = tmp }()
+	config.Conf.Users = []*config.User{{Email: "user1@nokia.com"}}
+	config.Conf.MetricAPIs = []*config.APIConf{
+		{API: "/pmdata", MetricType: "RADIO"},
+		{API: "/fmdata", MetricType: "RADIO", Type: "ACTIVE"},
+		{API: "/fmdata", MetricType: "RADIO", Type: "HISTORY"},
+	}
+
+	user, api, err := findBackfillTarget("user1@nokia.com", "pmdata", "", "")
+	if err != nil || user != config.Conf.Users[0] || api != config.Conf.MetricAPIs[0] {
+		t.Errorf("expected pmdata API, got %v, %v", api, err)
+	}
+	_, api, err = findBackfillTarget("user1@nokia.com", "/fmdata", "", "HISTORY")
+	if err != nil || api != config.Conf.MetricAPIs[2] {
+		t.Errorf("expected HISTORY fmdata API, got %v, %v", api, err)
+	}
+	_, _, err = findBackfillTarget("user1@nokia.com", "fmdata", "", "")
+	if err == nil || !strings.Contains(err.Error(), "configured multiple times") {
+		t.Error(err)
+	}
+	_, _, err = findBackfillTarget("user2@nokia.com", "pmdata", "", "")
+	if err == nil || !strings.Contains(err.Error(), "isn't configured") {
+		t.Error(err)
+	}
+	_, _, err = findBackfillTarget("user1@nokia.com", "pmdata", "CORE", "")
+	if err == nil || !strings.Contains(err.Error(), "isn't configured") {
+		t.Error(err)
+	}
+}
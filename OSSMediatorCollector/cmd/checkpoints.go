@@ -0,0 +1,137 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package main
+
+import (
+	"collector/pkg/checkpoint"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"text/tabwriter"
+)
+
+const checkpointsUsage = `Usage: ./collector checkpoints <list|show|set|reset> [options]
+Commands:
+	list
+		Lists the checkpoints matching the given user, API, metric type, type and NHG ID.
+	show
+		Shows the checkpoint of the user's API for the NHG, -user and -api are required.
+	set
+		Sets the checkpoint of the user's API for the NHG to -time, -user, -api and -time are required.
+	reset
+		Removes the checkpoints matching the given options, data is then collected from the default start time.
+		At least one option or -all is required.
+NOTE: collector should be stopped before running these commands, as the checkpoint store is locked by the running collector.
+Options:
+`
+
+// runs the checkpoints subcommand with args following it, returns the exit code.
+func runCheckpoints(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("checkpoints", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dbPath := fs.String("checkpoint_db", defaultCheckpointDB, "Checkpoint store file path")
+	var filter checkpoint.Key
+	fs.StringVar(&filter.User, "user", "", "User's email")
+	fs.StringVar(&filter.API, "api", "", "API, ex: pmdata or /fmdata")
+	fs.StringVar(&filter.MetricType, "metric_type", "", "API's metric type, ex: RADIO")
+	fs.StringVar(&filter.Type, "type", "", "API's type, ex: ACTIVE")
+	fs.StringVar(&filter.NhgID, "nhg_id", "", "NHG ID")
+	checkpointTime := fs.String("time", "", "Checkpoint time in RFC3339 format, ex: 2024-01-02T15:04:00Z, used by set")
+	all := fs.Bool("all", false, "Reset all the checkpoints, used by reset")
+	fs.Usage = func() {
+		fmt.Fprint(out, checkpointsUsage)
+		fs.PrintDefaults()
+	}
+
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	command := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if filter.API != "" {
+		filter.API = path.Base(filter.API)
+	}
+
+	switch command {
+	case "list", "show", "set", "reset":
+	default:
+		fmt.Fprintf(out, "Unknown command: %s\n", command)
+		fs.Usage()
+		return 2
+	}
+	if (command == "show" || command == "set") && (filter.User == "" || filter.API == "") {
+		fmt.Fprintf(out, "-user and -api are required for %s\n", command)
+		return 2
+	}
+	if command == "set" && *checkpointTime == "" {
+		fmt.Fprintln(out, "-time is required for set")
+		return 2
+	}
+	if command == "reset" && !*all && filter == (checkpoint.Key{}) {
+		fmt.Fprintln(out, "at least one option or -all is required for reset")
+		return 2
+	}
+
+	err := checkpoint.Open(*dbPath)
+	if err != nil {
+		fmt.Fprintf(out, "Unable to open checkpoint store: %v\n", err)
+		return 1
+	}
+	defer checkpoint.Close()
+
+	switch command {
+	case "list":
+		err = listCheckpoints(out, filter)
+	case "show":
+		err = showCheckpoint(out, filter)
+	case "set":
+		err = checkpoint.Set(filter, *checkpointTime)
+		if err == nil {
+			fmt.Fprintf(out, "Checkpoint of %s set to %s\n", filter, *checkpointTime)
+		}
+	case "reset":
+		var count int
+		count, err = checkpoint.Reset(filter)
+		if err == nil {
+			fmt.Fprintf(out, "%d checkpoints reset\n", count)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	return 0
+}
+
+func listCheckpoints(out io.Writer, filter checkpoint.Key) error {
+	checkpoints, err := checkpoint.List(filter)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tAPI\tMETRIC_TYPE\tTYPE\tNHG_ID\tCHECKPOINT")
+	for _, c := range checkpoints {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.User, c.API, c.MetricType, c.Type, c.NhgID, c.Time)
+	}
+	return w.Flush()
+}
+
+func showCheckpoint(out io.Writer, key checkpoint.Key) error {
+	checkpointTime, err := checkpoint.Get(key)
+	if err != nil {
+		return err
+	}
+	if checkpointTime == "" {
+		return fmt.Errorf("no checkpoint found for %s", key)
+	}
+	fmt.Fprintln(out, checkpointTime)
+	return nil
+}
@@ -0,0 +1,75 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckpointsCommand(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "checkpoints.db")
+	run := func(args ...string) (int, string) {
+		var out bytes.Buffer
+		code := runCheckpoints(append(args, "-checkpoint_db", dbPath), &out)
+		return code, out.String()
+	}
+
+	code, out := run("set", "-user", "user1@nokia.com", "-api", "/pmdata", "-metric_type", "RADIO", "-nhg_id", "nhg1", "-time", "2024-01-02T15:04:00Z")
+	if code != 0 {
+		t.Fatalf("set failed: %s", out)
+	}
+	run("set", "-user", "user2@nokia.com", "-api", "fmdata", "-metric_type", "DAC", "-type", "ACTIVE", "-nhg_id", "nhg2", "-time", "2024-01-02T16:04:00Z")
+
+	code, out = run("show", "-user", "user1@nokia.com", "-api", "pmdata", "-metric_type", "RADIO", "-nhg_id", "nhg1")
+	if code != 0 || strings.TrimSpace(out) != "2024-01-02T15:04:00Z" {
+		t.Errorf("unexpected show output: %d, %s", code, out)
+	}
+
+	code, out = run("list")
+	if code != 0 || !strings.Contains(out, "user1@nokia.com") || !strings.Contains(out, "user2@nokia.com") {
+		t.Errorf("unexpected list output: %s", out)
+	}
+	code, out = run("list", "-api", "fmdata")
+	if code != 0 || strings.Contains(out, "user1@nokia.com") || !strings.Contains(out, "2024-01-02T16:04:00Z") {
+		t.Errorf("unexpected filtered list output: %s", out)
+	}
+
+	code, out = run("reset", "-user", "user1@nokia.com")
+	if code != 0 || !strings.Contains(out, "1 checkpoints reset") {
+		t.Errorf("unexpected reset output: %s", out)
+	}
+	code, out = run("show", "-user", "user1@nokia.com", "-api", "pmdata", "-metric_type", "RADIO", "-nhg_id", "nhg1")
+	if code != 1 || !strings.Contains(out, "no checkpoint found") {
+		t.Errorf("expected checkpoint to be reset: %s", out)
+	}
+}
+
+func TestCheckpointsCommandWithInvalidArgs(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "checkpoints.db")
+	tests := [][]string{
+		{},
+		{"unknown"},
+		{"show", "-user", "user1@nokia.com"},
+		{"set", "-user", "user1@nokia.com", "-api", "pmdata"},
+		{"reset"},
+	}
+	for _, args := range tests {
+		var out bytes.Buffer
+		if code := runCheckpoints(append(args, "-checkpoint_db", dbPath), &out); code != 2 {
+			t.Errorf("expected exit code 2 for %v, got %d", args, code)
+		}
+	}
+
+	var out bytes.Buffer
+	code := runCheckpoints([]string{"set", "-user", "user1@nokia.com", "-api", "pmdata", "-time", "yesterday", "-checkpoint_db", dbPath}, &out)
+	if code != 1 || !strings.Contains(out.String(), "invalid checkpoint time") {
+		t.Errorf("expected invalid time error, got %d: %s", code, out.String())
+	}
+}
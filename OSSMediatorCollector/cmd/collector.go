@@ -7,18 +7,27 @@
 package main
 
 import (
+	"collector/pkg/checkpoint"
 	"collector/pkg/config"
+	"collector/pkg/credentials"
+	"collector/pkg/health"
+	"collector/pkg/inventory"
+	"collector/pkg/metrics"
 	"collector/pkg/ndacapis"
+	"collector/pkg/sink"
 	"collector/pkg/utils"
 	"collector/pkg/validator"
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	logger "log"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"syscall"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	lumberjack "gopkg.in/natefinch/lumberjack.v2"
@@ -31,11 +40,35 @@ var (
 	logDir           string
 	logLevel         int
 	enableConsoleLog bool
+	listenAddress    string
+	checkpointDB     string
+	inventoryDir     string
+	secretKeyFile    string
+	shutdownTimeout  int
+	watchConfigFile  bool
 	version          bool
 	appVersion       string
 )
 
+const (
+	defaultCheckpointDB = "../checkpoints/checkpoints.db"
+	defaultInventoryDir = "../inventory"
+	//directory in which checkpoints were stored as files earlier, migrated to the checkpoint store on startup
+	legacyCheckpointDir = "./checkpoints"
+)
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "checkpoints":
+			os.Exit(runCheckpoints(os.Args[2:], os.Stdout))
+		case "backfill":
+			os.Exit(runBackfill(os.Args[2:], os.Stdout))
+		case "pmexport":
+			os.Exit(runPMExport(os.Args[2:], os.Stdout))
+		}
+	}
+
 	//Read command line options
 	parseFlags()
 	if version {
@@ -54,75 +87,148 @@ func main() {
 	}
 
 	//validate config
-	err = validator.ValidateConf(config.Conf)
+	err = validator.ValidateConf(config.Current())
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	//prepare the sink destinations, ex: retry queue and index mappings of elasticsearch
+	err = sink.Init()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatal("Error while initializing sink")
+	}
+
+	//expose collector metrics and health endpoints over HTTP
+	if listenAddress != "" {
+		go startHTTPServer(listenAddress)
+	}
+
 	//Create HTTP client for all the GET/POST API calls
 	ndacapis.CreateHTTPClient(certFile, skipTLS)
 
+	//load the key used to decrypt the passwords and tokens stored by storesecret
+	err = utils.InitSecretKey(secretKeyFile)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatal("Unable to load secret key")
+	}
+
 	// Authenticating the users
-	for _, user := range config.Conf.Users {
-		//if usertype is ABAC, no need to login
-		authType := strings.ToUpper(user.AuthType)
-		if authType == "PASSWORD" {
-			user.Password, err = utils.ReadPassword(user.Email)
-			if err != nil {
-				fmt.Printf("\nUnable to read password for: %s\nError: %v", user.Email, err)
-				log.WithFields(log.Fields{"error": err}).Fatalf("Login Failed for %s", user.Email)
-			}
-			err = ndacapis.Login(user)
-			if err != nil {
-				log.WithFields(log.Fields{"error": err}).Fatalf("Login Failed for %s", user.Email)
-			}
-		} else {
-			sessionToken, err := utils.ReadSessionToken(user.Email)
-			if err != nil {
-				fmt.Printf("\nUnable to read sessionToken for: %s\nError: %v", user.Email, err)
-				log.WithFields(log.Fields{"error": err}).Fatalf("Token Authorization Failed for %s", user.Email)
-			}
-			err = ndacapis.TokenAuthorize(user, sessionToken)
-			if err != nil {
-				fmt.Printf("\nToken Authorization Failed for %s...\nError: %v", user.Email, err)
-				log.WithFields(log.Fields{"error": err}).Fatalf("Token Authorization Failed for %s", user.Email)
-			}
-		}
+	for _, user := range config.Current().Users {
+		authenticate(user)
+	}
+
+	log.Infof("Opening checkpoint store %s", checkpointDB)
+	err = checkpoint.Open(checkpointDB)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatal("Unable to open checkpoint store")
+	}
+	migrated, err := checkpoint.MigrateFiles(legacyCheckpointDir, config.Current().Users, config.Current().MetricAPIs)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatalf("Unable to migrate checkpoints from %s", legacyCheckpointDir)
+	}
+	if migrated > 0 {
+		log.Infof("Migrated %d checkpoints from %s to checkpoint store", migrated, legacyCheckpointDir)
+	}
+	err = metrics.LoadCheckpoints()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warn("Unable to load the stored checkpoints to metrics")
 	}
 
-	checkpointPath := "./checkpoints"
-	log.Info("Creating checkpoints directory")
-	err = os.MkdirAll(checkpointPath, os.ModePerm)
+	err = inventory.Init(inventoryDir)
 	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Fatal("Unable to create checkpoints folder")
+		log.WithFields(log.Fields{"error": err}).Fatal("Unable to initialize network inventory store")
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	//refreshing access token before expiry
-	for _, user := range config.Conf.Users {
-		go ndacapis.RefreshToken(user)
-		//Create the sub response directory for the API under the user's base response directory.
-		utils.CreateResponseDirectory(user.ResponseDest, config.Conf.ListNetworkAPI.NhgAPI)
-		if config.Conf.ListNetworkAPI.GngAPI != "" {
-			utils.CreateResponseDirectory(user.ResponseDest, config.Conf.ListNetworkAPI.GngAPI)
+	for _, user := range config.Current().Users {
+		startSession(ctx, user)
+		createResponseDirectories(user)
+	}
+
+	//start data collection from configured APIs, until the collector receives SIGINT/SIGTERM
+	ndacapis.StartDataCollection(ctx)
+	watchConfig(ctx, confFile)
+
+	//complete the API calls in progress and logout
+	shutdown(time.Duration(shutdownTimeout) * time.Second)
+}
+
+// authenticates the user at startup, the collector is terminated if it fails as the user's APIs can't be called.
+func authenticate(user *config.User) {
+	err := authenticateUser(user)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Fatalf("Authentication failed for %s", user.Email)
+	}
+}
+
+// logs in the user with the password read from user's credential provider, or authorizes with the session token for ABAC user.
+func authenticateUser(user *config.User) error {
+	//if usertype is ABAC, no need to login
+	authType := strings.ToUpper(user.AuthType)
+	if authType == "PASSWORD" {
+		creds, err := credentials.Get(user)
+		if err != nil {
+			return fmt.Errorf("unable to read password for %s: %w", user.Email, err)
+		}
+		config.SetPassword(user, creds.Password)
+		err = ndacapis.Login(user)
+		if err != nil {
+			return fmt.Errorf("login failed for %s: %w", user.Email, err)
+		}
+		return nil
+	}
+	creds, err := credentials.Get(user)
+	if err != nil {
+		return fmt.Errorf("unable to read sessionToken for %s: %w", user.Email, err)
+	}
+	err = ndacapis.TokenAuthorize(user, creds.SessionToken())
+	if err != nil {
+		return fmt.Errorf("token authorization failed for %s: %w", user.Email, err)
+	}
+	return nil
+}
+
+// applies the user's credentials changed in the mounted files, the password is used by the next login
+// and the session token replaces the current one.
+func applyCredentials(user *config.User, creds *credentials.Credentials) {
+	if strings.ToUpper(user.AuthType) == "PASSWORD" {
+		config.SetPassword(user, creds.Password)
+		return
+	}
+	err := ndacapis.TokenAuthorize(user, creds.SessionToken())
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Token Authorization Failed for %s", user.Email)
+	}
+}
+
+// Create the sub response directory for the API under the user's base response directory, if response is written to file.
+func createResponseDirectories(user *config.User) {
+	conf := config.Current()
+	if sink.ConfFor(user, nil).Type == config.FileSink {
+		utils.CreateResponseDirectory(user.ResponseDest, conf.ListNetworkAPI.NhgAPI)
+		if conf.ListNetworkAPI.GngAPI != "" {
+			utils.CreateResponseDirectory(user.ResponseDest, conf.ListNetworkAPI.GngAPI)
 		}
+		utils.CreateResponseDirectory(user.ResponseDest, ndacapis.NetworkEventsAPI)
 		if strings.ToUpper(user.AuthType) == "ADTOKEN" {
-			utils.CreateResponseDirectory(user.ResponseDest, config.Conf.UserAGAPIs.ListOrgUUID)
-			utils.CreateResponseDirectory(user.ResponseDest, config.Conf.UserAGAPIs.ListAccUUID)
+			utils.CreateResponseDirectory(user.ResponseDest, conf.UserAGAPIs.ListOrgUUID)
+			utils.CreateResponseDirectory(user.ResponseDest, conf.UserAGAPIs.ListAccUUID)
 		}
+	}
 
-		for _, api := range config.Conf.MetricAPIs {
+	for _, api := range conf.MetricAPIs {
+		if sink.ConfFor(user, api).Type == config.FileSink {
 			utils.CreateResponseDirectory(user.ResponseDest, api.API)
 		}
-		for _, api := range config.Conf.SimAPIs {
+	}
+	for _, api := range conf.SimAPIs {
+		if sink.ConfFor(user, api).Type == config.FileSink {
 			utils.CreateResponseDirectory(user.ResponseDest, api.API)
 		}
 	}
-
-	//start data collection from configured APIs
-	ndacapis.StartDataCollection()
-
-	//Perform logout when program terminates using os.Interrupt(ctrl+c)
-	shutdownHook()
 }
 
 // Reads command line options
@@ -133,10 +239,19 @@ func parseFlags() {
 	flag.BoolVar(&skipTLS, "skip_tls", false, "skip TLS authentication")
 	flag.StringVar(&logDir, "log_dir", "../log", "Log directory")
 	flag.IntVar(&logLevel, "log_level", 4, "Log level")
-	flag.BoolVar(&enableConsoleLog, "enable_console_log", false, "Enable console logging, if true logs won't be written to file")
+	flag.BoolVar(&enableConsoleLog, "enable_console_log", false, "Enable console logging to stderr, if true logs won't be written to file")
+	flag.StringVar(&listenAddress, "listen_address", "", "Address on which metrics and health endpoints are exposed")
+	flag.StringVar(&checkpointDB, "checkpoint_db", defaultCheckpointDB, "Checkpoint store file path")
+	flag.StringVar(&inventoryDir, "inventory_dir", defaultInventoryDir, "Directory in which the users' network inventory is stored, disabled if empty")
+	flag.StringVar(&secretKeyFile, "secret_key_file", "", "Secret key file path, used to decrypt the stored secrets")
+	flag.IntVar(&shutdownTimeout, "shutdown_timeout", 30, "Time in seconds to wait for the API calls in progress on shutdown")
+	flag.BoolVar(&watchConfigFile, "watch_config", false, "Reload the config when the config file changes")
 	flag.BoolVar(&version, "v", false, "Prints OSSMediator's version")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: ./collector [options]\n")
+		fmt.Fprintf(os.Stderr, "       ./collector checkpoints <list|show|set|reset> [options]\n")
+		fmt.Fprintf(os.Stderr, "       ./collector backfill -user <email> -api <pmdata|fmdata> -from <time> -to <time> [options]\n")
+		fmt.Fprintf(os.Stderr, "       ./collector pmexport -input <path> -output <dir> [options]\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fmt.Fprintf(os.Stderr, "\t-h, --help\n\t\tOutput a usage message and exit.\n")
 		fmt.Fprintf(os.Stderr, "\t-conf_file string\n\t\tConfig file path (default \"../resources/conf.json\")\n")
@@ -144,17 +259,23 @@ func parseFlags() {
 		fmt.Fprintf(os.Stderr, "\t-log_dir string\n\t\tLog Directory (default \"../log\"), logs will be stored in collector.log file.\n")
 		fmt.Fprintf(os.Stderr, "\t-log_level int\n\t\tLog Level (default 4). Values: 0 (PANIC), 1 (FATAl), 2 (ERROR), 3 (WARNING), 4 (INFO), 5 (DEBUG)\n")
 		fmt.Fprintf(os.Stderr, "\t-skip_tls\n\t\tSkip TLS Authentication\n")
-		fmt.Fprintf(os.Stderr, "\t-enable_console_long\n\t\tEnable console logging, if true logs won't be written to file\n")
+		fmt.Fprintf(os.Stderr, "\t-enable_console_long\n\t\tEnable console logging to stderr, if true logs won't be written to file\n")
+		fmt.Fprintf(os.Stderr, "\t-listen_address string\n\t\tAddress (ex: \":9100\") on which Prometheus metrics (/metrics) and health endpoints (/healthz, /readyz) are exposed, disabled if empty.\n")
+		fmt.Fprintf(os.Stderr, "\t-checkpoint_db string\n\t\tCheckpoint store file path (default \"../checkpoints/checkpoints.db\"), checkpoints from ./checkpoints directory are migrated to it on startup.\n")
+		fmt.Fprintf(os.Stderr, "\t-inventory_dir string\n\t\tDirectory (default \"../inventory\") in which the last known network inventory of the users is stored, it's used at startup until the network list is fetched. Disabled if empty.\n")
+		fmt.Fprintf(os.Stderr, "\t-secret_key_file string\n\t\tFile containing base64 encoded AES-256 key used by storesecret to encrypt the secrets, %s environment variable is used if empty.\n", utils.SecretKeyEnv)
+		fmt.Fprintf(os.Stderr, "\t-shutdown_timeout int\n\t\tTime in seconds (default 30) to wait on SIGINT/SIGTERM for the API calls in progress to complete, they are aborted after it.\n")
+		fmt.Fprintf(os.Stderr, "\t-watch_config\n\t\tReload the config when the config file changes, it's reloaded on SIGHUP as well.\n")
 		fmt.Fprintf(os.Stderr, "\t-v\n\t\tPrints OSSMediator's version\n")
 	}
 	flag.Parse()
 }
 
 // create log file (collector.log) within logDir (in case of failure logs will be written to console)
-// if console logs is enabled then logs are written to stdout instead of file.
+// if console logs is enabled then logs are written to stderr instead of file, so that they aren't mixed with the records of STDOUT sink.
 func initLogger(logDir string, logLevel int) {
 	if enableConsoleLog {
-		log.SetOutput(os.Stdout)
+		log.SetOutput(os.Stderr)
 		log.SetFormatter(&log.TextFormatter{})
 		log.SetLevel(log.Level(logLevel))
 		return
@@ -164,7 +285,7 @@ func initLogger(logDir string, logLevel int) {
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Warningf("Unable to create log directory %s", logDir)
 		log.Info("Failed to log to file, using default stderr")
-		log.SetOutput(os.Stdout)
+		log.SetOutput(os.Stderr)
 		log.SetFormatter(&log.TextFormatter{})
 		log.SetLevel(log.Level(logLevel))
 		return
@@ -183,24 +304,43 @@ func initLogger(logDir string, logLevel int) {
 		log.SetOutput(lumberjackLogrotate)
 	} else {
 		log.Info("Failed to log to file, using default stderr")
-		log.SetOutput(os.Stdout)
+		log.SetOutput(os.Stderr)
 	}
 	logger.SetOutput(io.Discard)
 	log.SetFormatter(&log.TextFormatter{})
 	log.SetLevel(log.Level(logLevel))
 }
 
-func shutdownHook() {
-	osSignal := make(chan os.Signal, 1)
-	signal.Notify(osSignal, syscall.SIGINT, syscall.SIGTERM)
-	<-osSignal
-	log.Info("Received shutdown signal...Logging out...")
-	for _, user := range config.Conf.Users {
+// starts the HTTP server exposing collector's metrics and health endpoints.
+func startHTTPServer(address string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	health.Register(mux)
+	mux.HandleFunc("/circuit_breakers", ndacapis.CircuitBreakerHandler)
+	log.Infof("Exposing metrics and health endpoints on %s", address)
+	err := http.ListenAndServe(address, mux)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Unable to start HTTP server on %s", address)
+	}
+}
+
+// stops the data collection, waiting up to timeout for the API calls in progress to complete, then closes the
+// checkpoint store and logs out the users.
+func shutdown(timeout time.Duration) {
+	log.Infof("Received shutdown signal...Waiting up to %v for the API calls in progress...", timeout)
+	if !ndacapis.Shutdown(timeout) {
+		log.Warn("API calls in progress were aborted, their data will be collected on next start")
+	}
+	err := checkpoint.Close()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Unable to close checkpoint store")
+	}
+	log.Info("Logging out...")
+	for _, user := range config.Current().Users {
 		err := ndacapis.Logout(user)
 		if err != nil {
 			log.WithFields(log.Fields{"error": err}).Errorf("Logout failed for %s", user.Email)
 		}
 	}
 	log.Info("Terminating DA OSS Collector...")
-	os.Exit(0)
 }
@@ -7,8 +7,18 @@
 package main
 
 import (
+	"collector/pkg/config"
+	"collector/pkg/credentials"
+	"collector/pkg/ndacapis"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"sync"
 	"testing"
+
+	log "github.com/sirupsen/logrus"
 )
 
 func TestInitLogger(t *testing.T) {
@@ -40,3 +50,32 @@ func TestParseFlag(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestApplyCredentialsWhileLoggingIn(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	testServer := httptest.NewServer(http.NotFoundHandler())
+	defer testServer.Close()
+	prevConf := config.Current()
+	defer config.Set(prevConf)
+	config.Set(config.Config{BaseURL: testServer.URL, UMAPIs: config.UMConf{Login: "/login"}})
+	ndacapis.CreateHTTPClient("", false)
+	user := &config.User{Email: "user1@nokia.com", AuthType: "PASSWORD", SessionToken: &config.SessionToken{}}
+
+	//password changed by the credential watch while the user logs in, run with -race to find the unsynchronized access
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			ndacapis.Login(user)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		applyCredentials(user, &credentials.Credentials{Password: "password" + strconv.Itoa(i)})
+	}
+	wg.Wait()
+	if config.PasswordFor(user) != "password19" {
+		t.Errorf("expected changed password, got %s", config.PasswordFor(user))
+	}
+}
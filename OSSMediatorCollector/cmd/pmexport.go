@@ -0,0 +1,71 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package main
+
+import (
+	"collector/pkg/pmexport"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const pmexportUsage = `Usage: ./collector pmexport -input <path> -output <dir> [options]
+Exports the PM counters of the pmdata response files as rows to hourly Parquet or CSV files, partitioned by metric type,
+NHG ID and date: <output>/metric_type=<type>/nhg_id=<id>/date=<date>/pmdata_<date>T<hour>.<format>
+Each row is a counter of a record with its pm_data_source fields, existing hourly files are merged with the exported rows.
+Options:
+`
+
+// runs the pmexport subcommand with args following it, returns the exit code.
+func runPMExport(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("pmexport", flag.ContinueOnError)
+	fs.SetOutput(out)
+	input := fs.String("input", "", "Comma separated pmdata response files or directories, directories are read recursively")
+	output := fs.String("output", "", "Output directory of the exported files")
+	format := fs.String("format", pmexport.ParquetFormat, "Output format, parquet or csv")
+	fs.IntVar(&logLevel, "log_level", 4, "Log level, logs are written to console")
+	fs.Usage = func() {
+		fmt.Fprint(out, pmexportUsage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *input == "" || *output == "" {
+		fmt.Fprintln(out, "-input and -output are required")
+		return 2
+	}
+	*format = strings.ToLower(strings.TrimSpace(*format))
+	if *format != pmexport.ParquetFormat && *format != pmexport.CSVFormat {
+		fmt.Fprintf(out, "invalid -format: %s, accepted values are parquet/csv\n", *format)
+		return 2
+	}
+	var inputs []string
+	for _, path := range strings.Split(*input, ",") {
+		inputs = append(inputs, strings.TrimSpace(path))
+	}
+
+	enableConsoleLog = true
+	initLogger("", logLevel)
+
+	summary, err := pmexport.Export(inputs, *output, *format)
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 1
+	}
+	fmt.Fprintf(out, "Exported %d pmdata files, %d rows written to %d files\n", summary.Files, summary.Rows, len(summary.OutputFiles))
+	if len(summary.Failed) > 0 {
+		fmt.Fprintf(out, "Export failed for %d files:\n", len(summary.Failed))
+		for _, file := range summary.Failed {
+			fmt.Fprintln(out, file)
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,27 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPMExportWithInvalidArgs(t *testing.T) {
+	tests := [][]string{
+		{},
+		{"-input", "./pmdata"},
+		{"-output", "./export"},
+		{"-input", "./pmdata", "-output", "./export", "-format", "orc"},
+	}
+	for _, args := range tests {
+		var out bytes.Buffer
+		if code := runPMExport(args, &out); code != 2 {
+			t.Errorf("expected exit code 2 for %v, got %d", args, code)
+		}
+	}
+}
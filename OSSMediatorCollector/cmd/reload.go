@@ -0,0 +1,230 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package main
+
+import (
+	"bytes"
+	"collector/pkg/config"
+	"collector/pkg/credentials"
+	"collector/pkg/ndacapis"
+	"collector/pkg/sink"
+	"collector/pkg/validator"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	//stops the token refresh and credential watch of the users, keyed by user
+	sessions   = map[*config.User]context.CancelFunc{}
+	sessionMux = sync.Mutex{}
+
+	//interval at which the config file is checked for change when -watch_config is set, overridden in tests
+	configWatchInterval = 10 * time.Second
+)
+
+// starts refreshing the user's access token before expiry and watching the user's credentials, until ctx is cancelled
+// or the user is removed from the config.
+func startSession(ctx context.Context, user *config.User) {
+	userCtx, stop := context.WithCancel(ctx)
+	sessionMux.Lock()
+	sessions[user] = stop
+	sessionMux.Unlock()
+	go ndacapis.RefreshToken(userCtx, user)
+	go credentials.Watch(user, userCtx.Done(), func(creds *credentials.Credentials) { applyCredentials(user, creds) })
+}
+
+// stops the user's token refresh and credential watch, and logs out the user.
+func endSession(user *config.User) {
+	sessionMux.Lock()
+	stop, ok := sessions[user]
+	delete(sessions, user)
+	sessionMux.Unlock()
+	if ok {
+		stop()
+	}
+	err := ndacapis.Logout(user)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Logout failed for %s", user.Email)
+	}
+}
+
+// reloads the config on SIGHUP, and on change of confFile if -watch_config is set, until ctx is cancelled.
+// If the reloaded config is invalid the current config is kept.
+func watchConfig(ctx context.Context, confFile string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var changed <-chan time.Time
+	last := fileChecksum(confFile)
+	if watchConfigFile {
+		ticker := time.NewTicker(configWatchInterval)
+		defer ticker.Stop()
+		changed = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Info("Received SIGHUP, reloading config...")
+		case <-changed:
+			current := fileChecksum(confFile)
+			if current == nil || bytes.Equal(current, last) {
+				continue
+			}
+			log.Infof("%s is changed, reloading config...", confFile)
+		}
+		last = fileChecksum(confFile)
+		err := reloadConfig(ctx, confFile)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Unable to reload config, keeping the current config")
+		}
+	}
+}
+
+// returns the checksum of the file's content, nil if it can't be read.
+func fileChecksum(file string) []byte {
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+	sum := sha256.Sum256(contents)
+	return sum[:]
+}
+
+// reloadConfig reads and validates confFile and applies it. Only the jobs of the changed users and APIs are restarted,
+// the unchanged users keep their sessions. Added users are logged in before their jobs are started, the users failing
+// authentication aren't added and if they were changed their current config is kept.
+func reloadConfig(ctx context.Context, confFile string) error {
+	conf, err := config.LoadConfig(confFile)
+	if err != nil {
+		return err
+	}
+	err = validator.ValidateConf(conf)
+	if err != nil {
+		return err
+	}
+	current := config.Current()
+	keepStaticConf(&conf, current)
+
+	users, added, removed := mergeUsers(current.Users, conf.Users)
+	var started []*config.User
+	for _, user := range added {
+		err = authenticateUser(user)
+		if err == nil {
+			started = append(started, user)
+			continue
+		}
+		log.WithFields(log.Fields{"error": err}).Errorf("Authentication failed for %s, the user isn't reloaded", user.Email)
+		old, ok := removed[user.Email]
+		delete(removed, user.Email)
+		for i, u := range users {
+			if u != user {
+				continue
+			}
+			if ok {
+				users[i] = old
+			} else {
+				users = append(users[:i], users[i+1:]...)
+			}
+			break
+		}
+	}
+	conf.Users = users
+
+	config.Set(conf)
+	err = sink.Init()
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Error while initializing sink")
+	}
+	for _, user := range conf.Users {
+		createResponseDirectories(user)
+	}
+	for _, user := range started {
+		startSession(ctx, user)
+	}
+	ndacapis.SyncJobs()
+	for _, user := range removed {
+		endSession(user)
+	}
+	log.Infof("Config reloaded, sessions of %d users started and %d users stopped", len(started), len(removed))
+	return nil
+}
+
+// mergeUsers matches the users of the new config with the current users by email. The unchanged users are kept as is
+// with their sessions and network details, the new and changed users are returned as added and the users which are
+// no longer configured or changed are returned as removed, keyed by email.
+func mergeUsers(current []*config.User, updated []*config.User) (users []*config.User, added []*config.User, removed map[string]*config.User) {
+	removed = map[string]*config.User{}
+	for _, user := range current {
+		removed[user.Email] = user
+	}
+	for _, user := range updated {
+		old, ok := removed[user.Email]
+		if ok && userConf(old) == userConf(user) {
+			delete(removed, user.Email)
+			users = append(users, old)
+			continue
+		}
+		users = append(users, user)
+		added = append(added, user)
+	}
+	return users, added, removed
+}
+
+// returns the configured fields of the user, used to find the changed users.
+func userConf(user *config.User) string {
+	conf, _ := json.Marshal(struct {
+		AuthType         string
+		ResponseDest     string
+		AllowedSliceIDs  []string
+		Sink             *config.SinkConf
+		Credentials      *config.CredentialConf
+		BaseURL          string
+		UMAPIs           *config.UMConf
+		AzureSessionAPIs *config.AzureConf
+		Proxy            *config.ProxyConfig
+		TLS              *config.TLSConf
+	}{user.AuthType, user.ResponseDest, user.AllowedSliceIDs, user.Sink, user.Credentials, user.BaseURL, user.UMAPIs, user.AzureSessionAPIs, user.Proxy, user.TLS})
+	return string(conf)
+}
+
+// keeps the config used for the HTTP client and the user management APIs unchanged, as they are applied only at startup.
+func keepStaticConf(conf *config.Config, current config.Config) {
+	static := []struct {
+		name    string
+		value   interface{}
+		current interface{}
+	}{
+		{"base_url", &conf.BaseURL, current.BaseURL},
+		{"azure_session_api", &conf.AzureSessionAPIs, current.AzureSessionAPIs},
+		{"um_api", &conf.UMAPIs, current.UMAPIs},
+		{"userAG_apis", &conf.UserAGAPIs, current.UserAGAPIs},
+		{"proxy", &conf.Proxy, current.Proxy},
+		{"timeout", &conf.Timeout, current.Timeout},
+		{"rate_limit", &conf.RateLimit, current.RateLimit},
+		{"tls", &conf.TLS, current.TLS},
+	}
+	for _, field := range static {
+		value := reflect.ValueOf(field.value).Elem()
+		if reflect.DeepEqual(value.Interface(), field.current) {
+			continue
+		}
+		log.Warnf("Change of %s is applied only on restart, keeping the current value", field.name)
+		value.Set(reflect.ValueOf(field.current))
+	}
+}
@@ -0,0 +1,182 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package main
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/health"
+	"collector/pkg/metrics"
+	"collector/pkg/ndacapis"
+	"collector/pkg/sink"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const reloadConf = `{
+	"base_url": "http://changed.example.com",
+	"um_api": {"login": "/login", "refresh": "/refresh", "logout": "/logout"},
+	"list_network_api": {"nhg_api": "/network-hardware-groups", "interval": 60},
+	"metric_apis": [
+		{"api": "/fmdata", "type": "ACTIVE", "metric_type": "RADIO", "interval": 15},
+		{"api": "/pmdata", "metric_type": "RADIO", "interval": 15}
+	],
+	"users": [
+		{"email_id": "user1@nokia.com", "response_dest": "%s"},
+		{"email_id": "user3@nokia.com", "response_dest": "%s", "credentials": {"type": "ENV", "password_env": "RELOAD_TEST_UNSET_PASSWORD"}}
+	],
+	"limit": 10,
+	"delay": 7
+}`
+
+func TestMergeUsers(t *testing.T) {
+	user1 := &config.User{Email: "user1@nokia.com", ResponseDest: "./tmp"}
+	user2 := &config.User{Email: "user2@nokia.com", ResponseDest: "./tmp"}
+	user3 := &config.User{Email: "user3@nokia.com", ResponseDest: "./tmp"}
+	updated1 := &config.User{Email: "user1@nokia.com", ResponseDest: "./tmp"}
+	updated2 := &config.User{Email: "user2@nokia.com", ResponseDest: "./tmp", AllowedSliceIDs: []string{"slice1"}}
+
+	users, added, removed := mergeUsers([]*config.User{user1, user2, user3}, []*config.User{updated1, updated2})
+	if len(users) != 2 || users[0] != user1 || users[1] != updated2 {
+		t.Errorf("unchanged user should be kept and changed user replaced: %v", users)
+	}
+	if len(added) != 1 || added[0] != updated2 {
+		t.Errorf("changed user should be added: %v", added)
+	}
+	if len(removed) != 2 || removed["user2@nokia.com"] != user2 || removed["user3@nokia.com"] != user3 {
+		t.Errorf("changed and deleted users should be removed: %v", removed)
+	}
+}
+
+func TestKeepStaticConf(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	current := config.Config{BaseURL: "http://localhost:8080", Timeout: 5, Limit: 10}
+	conf := config.Config{BaseURL: "http://changed.example.com", Timeout: 5, Limit: 20}
+	keepStaticConf(&conf, current)
+	if conf.BaseURL != current.BaseURL || conf.Limit != 20 {
+		t.Errorf("base_url should be kept and limit reloaded: %s, %d", conf.BaseURL, conf.Limit)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	testServer := httptest.NewServer(http.NotFoundHandler())
+	defer testServer.Close()
+	responseDest := t.TempDir()
+	user1 := &config.User{Email: "user1@nokia.com", ResponseDest: responseDest, SessionToken: &config.SessionToken{}}
+	user2 := &config.User{Email: "user2@nokia.com", ResponseDest: responseDest, SessionToken: &config.SessionToken{}}
+	prevConf := config.Conf
+	defer func() { config.Conf = prevConf }()
+	config.Conf = config.Config{
+		BaseURL:              testServer.URL,
+		UMAPIs:               config.UMConf{Login: "/login", Refresh: "/refresh", Logout: "/logout"},
+		ListNetworkAPI:       &config.ListNetworkAPIConf{NhgAPI: "/network-hardware-groups", Interval: 60},
+		MetricAPIs:           []*config.APIConf{{API: "/fmdata", Type: "ACTIVE", MetricType: "RADIO", Interval: 15}},
+		Users:                []*config.User{user1, user2},
+		Limit:                10,
+		Delay:                7,
+		MaxConcurrentProcess: 1,
+	}
+	ndacapis.CreateHTTPClient("", false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		ndacapis.Shutdown(time.Second)
+	}()
+	ndacapis.StartDataCollection(ctx)
+
+	confFile := filepath.Join(t.TempDir(), "conf.json")
+	os.WriteFile(confFile, []byte("{invalid"), 0600)
+	if err := reloadConfig(ctx, confFile); err == nil || len(config.Conf.Users) != 2 {
+		t.Errorf("invalid config shouldn't be applied: %v", err)
+	}
+
+	os.WriteFile(confFile, []byte(fmt.Sprintf(reloadConf, responseDest, responseDest)), 0600)
+	if err := reloadConfig(ctx, confFile); err != nil {
+		t.Fatal(err)
+	}
+	//user3 fails authentication and isn't added, user2 is removed
+	if len(config.Conf.Users) != 1 || config.Conf.Users[0] != user1 {
+		t.Errorf("unchanged user should be kept: %v", config.Conf.Users)
+	}
+	if len(config.Conf.MetricAPIs) != 2 || config.Conf.BaseURL != testServer.URL {
+		t.Errorf("APIs should be reloaded and base_url kept: %d, %s", len(config.Conf.MetricAPIs), config.Conf.BaseURL)
+	}
+}
+
+func TestReloadConfigWhileReading(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	testServer := httptest.NewServer(http.NotFoundHandler())
+	defer testServer.Close()
+	responseDest := t.TempDir()
+	user1 := &config.User{Email: "user1@nokia.com", ResponseDest: responseDest, SessionToken: &config.SessionToken{}}
+	prevConf := config.Current()
+	defer config.Set(prevConf)
+	config.Set(config.Config{
+		BaseURL:              testServer.URL,
+		UMAPIs:               config.UMConf{Login: "/login", Refresh: "/refresh", Logout: "/logout"},
+		ListNetworkAPI:       &config.ListNetworkAPIConf{NhgAPI: "/network-hardware-groups", Interval: 60},
+		Users:                []*config.User{user1},
+		MaxConcurrentProcess: 1,
+	})
+	ndacapis.CreateHTTPClient("", false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		ndacapis.Shutdown(time.Second)
+	}()
+	confFile := filepath.Join(t.TempDir(), "conf.json")
+	os.WriteFile(confFile, []byte(fmt.Sprintf(reloadConf, responseDest, responseDest)), 0600)
+
+	//readers of the config running alongside the reload, run with -race to find the unsynchronized access
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	readers := []func(){
+		func() { health.GetReadinessStatus() },
+		func() {
+			metrics.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		},
+		func() { sink.ConfFor(user1, nil) },
+		func() { config.BaseURLFor(user1) },
+	}
+	for _, read := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					read()
+				}
+			}
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		if err := reloadConfig(ctx, confFile); err != nil {
+			t.Error(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+	if conf := config.Current(); conf.Limit != 10 || conf.BaseURL != testServer.URL {
+		t.Errorf("config should be reloaded: limit %d, base_url %s", conf.Limit, conf.BaseURL)
+	}
+}
@@ -0,0 +1,334 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package checkpoint
+
+import (
+	"collector/pkg/config"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	//key separator, emails and NHG IDs don't contain it
+	keySeparator = "/"
+	//time to wait for the store's lock held by another process
+	openTimeout = 2 * time.Second
+)
+
+var (
+	checkpointBucket = []byte("checkpoints")
+
+	db    *bolt.DB
+	dbMux sync.RWMutex
+
+	errNotOpened = errors.New("checkpoint store isn't opened")
+)
+
+// Key identifies the checkpoint of user's API per NHG.
+// API is the base path of the API, ex: pmdata.
+type Key struct {
+	User       string
+	API        string
+	MetricType string
+	Type       string
+	NhgID      string
+}
+
+// Checkpoint is the last received data time of the API, stored in RFC3339 format.
+type Checkpoint struct {
+	Key
+	Time string
+}
+
+// KeyFor returns the checkpoint key of the user's API for the NHG.
+func KeyFor(user *config.User, api *config.APIConf, nhgID string) Key {
+	return Key{
+		User:       user.Email,
+		API:        path.Base(api.API),
+		MetricType: api.MetricType,
+		Type:       api.Type,
+		NhgID:      nhgID,
+	}
+}
+
+func (k Key) String() string {
+	return strings.Join([]string{k.User, k.API, k.MetricType, k.Type, k.NhgID}, keySeparator)
+}
+
+// matches returns true if all the non-empty fields of filter are same as key's.
+func (k Key) matches(filter Key) bool {
+	return (filter.User == "" || filter.User == k.User) &&
+		(filter.API == "" || filter.API == k.API) &&
+		(filter.MetricType == "" || filter.MetricType == k.MetricType) &&
+		(filter.Type == "" || filter.Type == k.Type) &&
+		(filter.NhgID == "" || filter.NhgID == k.NhgID)
+}
+
+func parseKey(s string) (Key, error) {
+	fields := strings.SplitN(s, keySeparator, 5)
+	if len(fields) != 5 {
+		return Key{}, fmt.Errorf("invalid checkpoint key: %s", s)
+	}
+	return Key{User: fields[0], API: fields[1], MetricType: fields[2], Type: fields[3], NhgID: fields[4]}, nil
+}
+
+// Open opens the checkpoint store at dbPath, creating it if it doesn't exist.
+// The store is locked by the process which opened it until it's closed.
+func Open(dbPath string) error {
+	err := os.MkdirAll(filepath.Dir(dbPath), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	store, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			return fmt.Errorf("checkpoint store %s is in use by another process", dbPath)
+		}
+		return err
+	}
+	err = store.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(checkpointBucket)
+		return err
+	})
+	if err != nil {
+		store.Close()
+		return err
+	}
+
+	dbMux.Lock()
+	defer dbMux.Unlock()
+	if db != nil {
+		db.Close()
+	}
+	db = store
+	return nil
+}
+
+// Close closes the checkpoint store.
+func Close() error {
+	dbMux.Lock()
+	defer dbMux.Unlock()
+	if db == nil {
+		return nil
+	}
+	err := db.Close()
+	db = nil
+	return err
+}
+
+// Get returns the checkpoint time of the key, empty if it's not stored.
+func Get(key Key) (string, error) {
+	dbMux.RLock()
+	defer dbMux.RUnlock()
+	if db == nil {
+		return "", errNotOpened
+	}
+	var value string
+	err := db.View(func(tx *bolt.Tx) error {
+		value = string(tx.Bucket(checkpointBucket).Get([]byte(key.String())))
+		return nil
+	})
+	return value, err
+}
+
+// Set stores checkpointTime, in RFC3339 format, for the key.
+func Set(key Key, checkpointTime string) error {
+	_, err := time.Parse(time.RFC3339, checkpointTime)
+	if err != nil {
+		return fmt.Errorf("invalid checkpoint time %s, expected RFC3339 format: %v", checkpointTime, err)
+	}
+	return Update(key, func(string) (string, error) {
+		return checkpointTime, nil
+	})
+}
+
+// Update atomically replaces the checkpoint time of the key with the one returned by fn for the current time.
+// current is empty if the checkpoint isn't stored.
+func Update(key Key, fn func(current string) (string, error)) error {
+	dbMux.RLock()
+	defer dbMux.RUnlock()
+	if db == nil {
+		return errNotOpened
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(checkpointBucket)
+		value, err := fn(string(bucket.Get([]byte(key.String()))))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key.String()), []byte(value))
+	})
+}
+
+// List returns the stored checkpoints matching the non-empty fields of filter, sorted by key.
+func List(filter Key) ([]Checkpoint, error) {
+	dbMux.RLock()
+	defer dbMux.RUnlock()
+	if db == nil {
+		return nil, errNotOpened
+	}
+	var checkpoints []Checkpoint
+	err := db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(checkpointBucket).ForEach(func(k, v []byte) error {
+			key, err := parseKey(string(k))
+			if err != nil {
+				log.WithFields(log.Fields{"error": err}).Warn("Skipping invalid checkpoint")
+				return nil
+			}
+			if key.matches(filter) {
+				checkpoints = append(checkpoints, Checkpoint{Key: key, Time: string(v)})
+			}
+			return nil
+		})
+	})
+	return checkpoints, err
+}
+
+// Reset removes the stored checkpoints matching the non-empty fields of filter, the data is then collected from
+// the default start time. Returns the no. of checkpoints removed.
+func Reset(filter Key) (int, error) {
+	dbMux.RLock()
+	defer dbMux.RUnlock()
+	if db == nil {
+		return 0, errNotOpened
+	}
+	count := 0
+	err := db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(checkpointBucket)
+		var keys [][]byte
+		err := bucket.ForEach(func(k, _ []byte) error {
+			key, err := parseKey(string(k))
+			if err == nil && key.matches(filter) {
+				keys = append(keys, append([]byte{}, k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			err = bucket.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		count = len(keys)
+		return nil
+	})
+	return count, err
+}
+
+// MigrateFiles moves the checkpoints from the per API files in legacy checkpoint directory to the store.
+// The file names are matched against the configured users and APIs, as they can't be split unambiguously.
+// Migrated files are removed, the later of the stored and the file's checkpoint is kept.
+// Returns the no. of checkpoints migrated.
+func MigrateFiles(dir string, users []*config.User, apis []*config.APIConf) (int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	//legacy file name prefix of each user's API, longest first so that the most specific prefix is matched
+	prefixes := make(map[string]Key)
+	for _, user := range users {
+		for _, api := range apis {
+			key := KeyFor(user, api, "")
+			prefixes[legacyFileName(key)] = key
+		}
+	}
+	names := make([]string, 0, len(prefixes))
+	for name := range prefixes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+
+	count := 0
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		key, ok := matchLegacyFile(file.Name(), names, prefixes)
+		if !ok {
+			log.Warnf("Unable to migrate checkpoint file %s, no matching user and API found in config", file.Name())
+			continue
+		}
+		filePath := filepath.Join(dir, file.Name())
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			return count, err
+		}
+		fileTime := strings.TrimSpace(string(data))
+		parsedFileTime, err := time.Parse(time.RFC3339, fileTime)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Warnf("Skipping checkpoint file %s with invalid time", file.Name())
+			continue
+		}
+		err = Update(key, func(current string) (string, error) {
+			if t, err := time.Parse(time.RFC3339, current); err == nil && t.After(parsedFileTime) {
+				return current, nil
+			}
+			return fileTime, nil
+		})
+		if err != nil {
+			return count, err
+		}
+		err = os.Remove(filePath)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Warnf("Unable to remove migrated checkpoint file %s", filePath)
+		}
+		count++
+	}
+
+	//remove the legacy directory if all the files are migrated
+	if files, err = os.ReadDir(dir); err == nil && len(files) == 0 {
+		os.Remove(dir)
+	}
+	return count, nil
+}
+
+// name of the file in which checkpoint was stored earlier
+func legacyFileName(key Key) string {
+	fileName := key.API
+	if key.MetricType != "" {
+		fileName = fileName + "_" + key.MetricType
+	}
+	if key.Type != "" {
+		fileName = fileName + "_" + key.Type
+	}
+	fileName = fileName + "_" + key.User
+	if key.NhgID != "" {
+		fileName = fileName + "_" + key.NhgID
+	}
+	return fileName
+}
+
+func matchLegacyFile(fileName string, names []string, prefixes map[string]Key) (Key, bool) {
+	for _, name := range names {
+		key := prefixes[name]
+		if fileName == name {
+			return key, true
+		}
+		if strings.HasPrefix(fileName, name+"_") {
+			key.NhgID = strings.TrimPrefix(fileName, name+"_")
+			return key, true
+		}
+	}
+	return Key{}, false
+}
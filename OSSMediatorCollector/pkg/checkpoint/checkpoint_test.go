@@ -0,0 +1,163 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package checkpoint
+
+import (
+	"collector/pkg/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func openTestStore(t *testing.T) string {
+	dbPath := filepath.Join(t.TempDir(), "checkpoints", "checkpoints.db")
+	err := Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Close() })
+	return dbPath
+}
+
+func TestSetAndGet(t *testing.T) {
+	dbPath := openTestStore(t)
+	user := &config.User{Email: "user1@nokia.com"}
+	api := &config.APIConf{API: "/fmdata", MetricType: "RADIO", Type: "ACTIVE"}
+	key := KeyFor(user, api, "nhg1")
+
+	value, err := Get(key)
+	if err != nil || value != "" {
+		t.Errorf("expected no checkpoint, got %s, %v", value, err)
+	}
+	err = Set(key, "2024-01-02T15:04:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Set(key, "invalid")
+	if err == nil {
+		t.Error("expected error for invalid checkpoint time")
+	}
+
+	//checkpoints are kept across restart
+	Close()
+	err = Open(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err = Get(key)
+	if err != nil || value != "2024-01-02T15:04:00Z" {
+		t.Errorf("expected stored checkpoint, got %s, %v", value, err)
+	}
+}
+
+func TestNotOpened(t *testing.T) {
+	_, err := Get(Key{User: "user1@nokia.com", API: "pmdata"})
+	if err != errNotOpened {
+		t.Errorf("expected %v, got %v", errNotOpened, err)
+	}
+}
+
+func TestListAndReset(t *testing.T) {
+	openTestStore(t)
+	keys := []Key{
+		{User: "user1@nokia.com", API: "pmdata", MetricType: "RADIO", NhgID: "nhg1"},
+		{User: "user1@nokia.com", API: "fmdata", MetricType: "RADIO", Type: "ACTIVE", NhgID: "nhg1"},
+		{User: "user2@nokia.com", API: "pmdata", MetricType: "RADIO", NhgID: "nhg2"},
+	}
+	for _, key := range keys {
+		if err := Set(key, "2024-01-02T15:04:00Z"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checkpoints, err := List(Key{})
+	if err != nil || len(checkpoints) != 3 {
+		t.Fatalf("expected 3 checkpoints, got %d, %v", len(checkpoints), err)
+	}
+	checkpoints, err = List(Key{API: "pmdata"})
+	if err != nil || len(checkpoints) != 2 {
+		t.Fatalf("expected 2 pmdata checkpoints, got %d, %v", len(checkpoints), err)
+	}
+	checkpoints, _ = List(Key{User: "user1@nokia.com", API: "fmdata"})
+	if len(checkpoints) != 1 || checkpoints[0].Key != keys[1] || checkpoints[0].Time != "2024-01-02T15:04:00Z" {
+		t.Errorf("unexpected checkpoints: %+v", checkpoints)
+	}
+
+	count, err := Reset(Key{User: "user1@nokia.com"})
+	if err != nil || count != 2 {
+		t.Errorf("expected 2 checkpoints reset, got %d, %v", count, err)
+	}
+	checkpoints, _ = List(Key{})
+	if len(checkpoints) != 1 || checkpoints[0].Key != keys[2] {
+		t.Errorf("unexpected checkpoints after reset: %+v", checkpoints)
+	}
+}
+
+func TestMigrateFiles(t *testing.T) {
+	openTestStore(t)
+	dir := t.TempDir()
+	users := []*config.User{{Email: "user1@nokia.com"}, {Email: "user_2@nokia.com"}}
+	apis := []*config.APIConf{
+		{API: "/pmdata", MetricType: "RADIO"},
+		{API: "/fmdata", MetricType: "RADIO", Type: "ACTIVE"},
+		{API: "/fmdata", MetricType: "RADIO", Type: "HISTORY"},
+	}
+	files := map[string]string{
+		"pmdata_RADIO_user1@nokia.com_nhg_1":         "2024-01-02T15:04:00Z",
+		"fmdata_RADIO_ACTIVE_user_2@nokia.com_nhg_2": "2024-01-02T16:04:00Z\n",
+		"fmdata_RADIO_HISTORY_user1@nokia.com":       "2024-01-02T17:04:00+05:30",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//stored checkpoint later than the file's is kept
+	later := Key{User: "user1@nokia.com", API: "pmdata", MetricType: "RADIO", NhgID: "nhg_1"}
+	if err := Set(later, "2024-01-03T00:00:00Z"); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := MigrateFiles(dir, users, apis)
+	if err != nil || count != 3 {
+		t.Fatalf("expected 3 checkpoints migrated, got %d, %v", count, err)
+	}
+	expected := map[Key]string{
+		later: "2024-01-03T00:00:00Z",
+		{User: "user_2@nokia.com", API: "fmdata", MetricType: "RADIO", Type: "ACTIVE", NhgID: "nhg_2"}: "2024-01-02T16:04:00Z",
+		{User: "user1@nokia.com", API: "fmdata", MetricType: "RADIO", Type: "HISTORY"}:                 "2024-01-02T17:04:00+05:30",
+	}
+	for key, value := range expected {
+		if stored, _ := Get(key); stored != value {
+			t.Errorf("expected %s for %s, got %s", value, key, stored)
+		}
+	}
+	if _, err = os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("expected legacy checkpoint directory to be removed, %v", err)
+	}
+}
+
+func TestMigrateFilesKeepsUnknownFiles(t *testing.T) {
+	openTestStore(t)
+	dir := t.TempDir()
+	unknown := filepath.Join(dir, "pmdata_CORE_user3@nokia.com_nhg_1")
+	if err := os.WriteFile(unknown, []byte("2024-01-02T15:04:00Z"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	count, err := MigrateFiles(dir, []*config.User{{Email: "user1@nokia.com"}}, []*config.APIConf{{API: "/pmdata", MetricType: "CORE"}})
+	if err != nil || count != 0 {
+		t.Errorf("expected no checkpoint migrated, got %d, %v", count, err)
+	}
+	if _, err = os.Stat(unknown); err != nil {
+		t.Errorf("expected unknown checkpoint file to be kept, %v", err)
+	}
+
+	count, err = MigrateFiles(filepath.Join(dir, "missing"), nil, nil)
+	if err != nil || count != 0 {
+		t.Errorf("expected missing directory to be ignored, got %d, %v", count, err)
+	}
+}
@@ -9,6 +9,7 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"os"
 	"strings"
 	"sync"
@@ -28,6 +29,128 @@ type ProxyConfig struct {
 	URL     string `json:"url"`
 }
 
+// TLSConf keeps the TLS config used to connect to the console.
+type TLSConf struct {
+	CACertFile         string `json:"ca_cert_file"`         //CA certificate file of the console, root certificates are used if empty.
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` //Skips verifying the console's certificate.
+	//Client certificate and its key in PEM format, sent when the console or the API gateway requires mTLS.
+	ClientCertFile string `json:"client_cert_file"`
+	ClientKeyFile  string `json:"client_key_file"`
+	//PKCS#12 file containing the client certificate and key, used instead of client_cert_file and client_key_file.
+	ClientPKCS12File         string   `json:"client_pkcs12_file"`
+	ClientPKCS12PasswordFile string   `json:"client_pkcs12_password_file"` //File containing the password of the PKCS#12 file.
+	MinVersion               string   `json:"min_version"`                 //Minimum TLS version, 1.0, 1.1, 1.2 or 1.3, default is 1.2.
+	CipherSuites             []string `json:"cipher_suites"`               //Cipher suites allowed up to TLS 1.2, ex: TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256.
+}
+
+// Output sink types
+const (
+	FileSink   = "FILE"   //writes the response to the user's response_dest directory
+	StdoutSink = "STDOUT" //writes the response records as NDJSON to stdout
+	HTTPSink   = "HTTP"   //posts the response records as NDJSON to the configured URL
+	//indexes the response records directly to elasticsearch, same as ElasticsearchPlugin
+	ElasticsearchSink = "ELASTICSEARCH"
+)
+
+// Formats of the response files written by FILE sink
+const (
+	JSONFormat       = "json"      //JSON array per page, pretty printed if pretty_response is true
+	NDJSONFormat     = "ndjson"    //one record of the page per line
+	NDJSONGzipFormat = "ndjson.gz" //gzip compressed NDJSON
+)
+
+// Defaults of ELASTICSEARCH sink, kept apart from ElasticsearchPlugin's defaults so both can run from the same installation.
+const (
+	defaultESRetryQueueDir       = "../elasticsearch_sink/retry_queue"
+	defaultESRetryQueueMaxSizeMB = 1024
+	defaultESDeadLetterFile      = "../elasticsearch_sink/dead_letter/rejected_documents.json"
+)
+
+// SinkConf keeps the output sink config, where the collected data is written.
+type SinkConf struct {
+	Type    string            `json:"type"`    //Sink type, FILE, STDOUT or HTTP, default is FILE.
+	URL     string            `json:"url"`     //URL to which the data is posted by HTTP sink.
+	Headers map[string]string `json:"headers"` //Additional headers sent by HTTP sink.
+	Timeout int               `json:"timeout"` //HTTP sink request timeout in seconds.
+	//Elasticsearch details for ELASTICSEARCH sink.
+	Elasticsearch *ElasticsearchSinkConf `json:"elasticsearch"`
+}
+
+// ElasticsearchSinkConf keeps the elasticsearch details of ELASTICSEARCH sink, same as ElasticsearchPlugin's config.
+type ElasticsearchSinkConf struct {
+	URL                   string `json:"url"`                     //Elasticsearch URL.
+	User                  string `json:"user"`                    //Elasticsearch user.
+	Password              string `json:"password"`                //Elasticsearch user's base64 encoded password.
+	DataRetentionDuration int    `json:"data_retention_duration"` //Days after which data is deleted from elasticsearch, 0 disables deletion.
+	RetryQueueDir         string `json:"retry_queue_dir"`         //Directory of the on-disk queue of failed bulk requests.
+	RetryQueueMaxSizeMB   int    `json:"retry_queue_max_size_mb"` //Size limit of the retry queue in MB.
+	DeadLetterFile        string `json:"dead_letter_file"`        //File to which the documents rejected by elasticsearch are written.
+}
+
+// Defaults of the retry policy of DAC API calls.
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 1
+	defaultRetryMaxBackoff     = 60
+	defaultRetryMultiplier     = 2
+	defaultRetryJitter         = 0.2
+	defaultRetryMaxRetryAfter  = 300
+)
+
+// RetryConf keeps the retry policy of DAC API calls failed with 429, 5xx status code or network error.
+// The backoff is exponential with jitter, Retry-After sent by the API takes precedence over it.
+type RetryConf struct {
+	MaxAttempts    int     `json:"max_attempts"`    //Max no. of retries of a failed call, default is 3.
+	InitialBackoff int     `json:"initial_backoff"` //Backoff before the first retry in seconds, default is 1.
+	MaxBackoff     int     `json:"max_backoff"`     //Max backoff between the retries in seconds, default is 60.
+	Multiplier     float64 `json:"multiplier"`      //Factor by which the backoff is increased after each retry, default is 2.
+	Jitter         float64 `json:"jitter"`          //Fraction of the backoff randomly added or subtracted, default is 0.2.
+	MaxRetryAfter  int     `json:"max_retry_after"` //Max Retry-After in seconds which is honored, call isn't retried if API asks to wait longer, default is 300.
+}
+
+// Defaults of the circuit breaker of DAC API endpoints.
+const (
+	defaultCircuitFailureThreshold = 5
+	defaultCircuitOpenTimeout      = 60
+)
+
+// CircuitBreakerConf keeps the circuit breaker config of DAC API endpoints.
+// The circuit of an endpoint is opened after failure_threshold consecutive failures, and the calls are short-circuited
+// until open_timeout elapses, after which a single trial call is allowed.
+type CircuitBreakerConf struct {
+	FailureThreshold int `json:"failure_threshold"` //Consecutive failures after which the circuit is opened, default is 5.
+	OpenTimeout      int `json:"open_timeout"`      //Time in seconds for which the circuit is kept open, default is 60.
+}
+
+// RateLimitConf keeps the client side rate limit of DAC API calls, zero values disable the limit.
+type RateLimitConf struct {
+	RequestsPerSecond float64 `json:"requests_per_second"` //Requests per second allowed per base URL and user.
+	Burst             int     `json:"burst"`               //Max requests allowed together above the rate, default is requests_per_second rounded up.
+	MaxInFlight       int     `json:"max_in_flight"`       //Max requests in progress at a time across all users.
+}
+
+// Credential provider types
+const (
+	SecretFileCredential = "SECRET_FILE" //reads the user's secret file stored by storesecret
+	EnvCredential        = "ENV"         //reads the credentials from environment variables
+	FileCredential       = "FILE"        //reads the credentials from mounted secret files, re-read when they change
+	CommandCredential    = "COMMAND"     //runs an external command which prints the credentials as JSON
+)
+
+// CredentialConf keeps the user's credential provider config, from where the password or session token is read.
+// Password is used by PASSWORD users, access and refresh token are used by ADTOKEN users.
+type CredentialConf struct {
+	Type             string   `json:"type"`               //Credential provider type, SECRET_FILE, ENV, FILE or COMMAND, default is SECRET_FILE.
+	PasswordEnv      string   `json:"password_env"`       //Environment variable containing password, used by ENV provider.
+	AccessTokenEnv   string   `json:"access_token_env"`   //Environment variable containing access token, used by ENV provider.
+	RefreshTokenEnv  string   `json:"refresh_token_env"`  //Environment variable containing refresh token, used by ENV provider.
+	PasswordFile     string   `json:"password_file"`      //File containing password, used by FILE provider.
+	AccessTokenFile  string   `json:"access_token_file"`  //File containing access token, used by FILE provider.
+	RefreshTokenFile string   `json:"refresh_token_file"` //File containing refresh token, used by FILE provider.
+	Command          []string `json:"command"`            //Command and its arguments, used by COMMAND provider.
+	Timeout          int      `json:"timeout"`            //Command timeout in seconds, default is 30.
+}
+
 // Config keeps the config from json
 type Config struct {
 	BaseURL              string              `json:"base_url"` //Base URL of the API
@@ -44,6 +167,12 @@ type Config struct {
 	PrettyResponse       bool                `json:"pretty_response"`
 	Proxy                ProxyConfig         `json:"proxy"`
 	Timeout              int                 `json:"timeout"`
+	Sink                 *SinkConf           `json:"sink"`            //Default output sink for all the users and APIs.
+	Retry                RetryConf           `json:"retry"`           //Retry policy of the failed API calls.
+	RateLimit            RateLimitConf       `json:"rate_limit"`      //Client side rate limit of the API calls.
+	CircuitBreaker       CircuitBreakerConf  `json:"circuit_breaker"` //Circuit breaker of the API endpoints.
+	TLS                  TLSConf             `json:"tls"`             //TLS config of the console, -cert_file and -skip_tls options override it.
+	ResponseFormat       string              `json:"response_format"` //Format of the response files, json, ndjson or ndjson.gz, default is json.
 }
 
 type OrgDetails struct {
@@ -64,19 +193,37 @@ type OrgAccDetails struct {
 // User keeps Login configurations
 type User struct {
 	Email           string        `json:"email_id"` //User's email ID
-	Password        string        //User's password read from configuration file
+	Password        string        //User's password read from configuration file, it's changed by credential watch so it's read with PasswordFor.
 	AuthType        string        `json:"auth_type"`     //authentication type
 	ResponseDest    string        `json:"response_dest"` //Base directory where subdirectories will be created for each APIs to store its response.
 	AllowedSliceIDs []string      `json:"slice_ids"`
 	SessionToken    *SessionToken //SessionToken variable keeps track of access_token, refresh_token and expiry_time of the token. It is used for authenticating the API calls.
 	RefreshDone     chan struct{}
 	NhgMux          sync.RWMutex
-	IsSessionAlive  bool
-	NhgIDsABAC      map[string]OrgAccDetails
-	HwIDsABAC       map[string]OrgAccDetails
-	AccountIDsABAC  map[string][]string
-	NhgIDs          []string
-	HwIDs           []string
+	sessionMux      sync.RWMutex
+	IsSessionAlive  bool //True if the user is logged in and has active networks, it's updated by the API calls so it's read with SessionAlive.
+	networks        *NetworkSnapshot
+	NetworkFetched  time.Time //Time at which user's network list was last fetched successfully.
+	NetworkRestored bool      //Network list is restored from the stored inventory and isn't fetched since start.
+	Sink            *SinkConf `json:"sink"` //Output sink for the user's APIs, overrides global sink.
+	//Credential provider for user's password or session token, default is the secret file stored by storesecret.
+	Credentials *CredentialConf `json:"credentials"`
+	//Console of the user, overrides the global base_url, um_api, azure_session_api and proxy, ex: for staging or regional console.
+	BaseURL          string       `json:"base_url"`
+	UMAPIs           *UMConf      `json:"um_api"`
+	AzureSessionAPIs *AzureConf   `json:"azure_session_api"`
+	Proxy            *ProxyConfig `json:"proxy"`
+	TLS              *TLSConf     `json:"tls"` //TLS config of the user's console, overrides the global tls config.
+}
+
+// NetworkSnapshot keeps the user's network inventory built by a network list refresh.
+// It's built fresh on every refresh and isn't modified once it's set by SetNetworks, so it can be read without holding NhgMux.
+type NetworkSnapshot struct {
+	NhgIDs         []string                 //ACTIVE NHGs and GNGs of RBAC user.
+	HwIDs          []string                 //Access point hardware of RBAC user.
+	NhgIDsABAC     map[string]OrgAccDetails //ACTIVE NHGs and GNGs of ABAC user along with their org and account.
+	HwIDsABAC      map[string]OrgAccDetails //Access point hardware of ABAC user along with their org and account.
+	AccountIDsABAC map[string][]string      //Accounts of ABAC user by org.
 }
 
 // SessionToken struct tracks the access_token, refresh_token and expiry_time of the token
@@ -100,12 +247,25 @@ type AzureConf struct {
 
 // APIConf keeps API configs
 type APIConf struct {
-	API          string `json:"api"`           //API URL
-	Type         string `json:"type"`          //API type, HISTORY or ACTIVE from FM API.
-	MetricType   string `json:"metric_type"`   //Metrics type for the API, RADIO and DAC from FM API.
-	Interval     int    `json:"interval"`      //Interval at which the API will be triggered periodically.
-	SyncDuration int    `json:"sync_duration"` //Interval in minutes for which duration FM will be re-synced.
-	Aggregation  string `json:"aggregation"`
+	API          string    `json:"api"`           //API URL
+	Type         string    `json:"type"`          //API type, HISTORY or ACTIVE from FM API.
+	MetricType   string    `json:"metric_type"`   //Metrics type for the API, RADIO and DAC from FM API.
+	Interval     int       `json:"interval"`      //Interval at which the API will be triggered periodically.
+	SyncDuration int       `json:"sync_duration"` //Interval in minutes for which duration FM will be re-synced.
+	Aggregation  string    `json:"aggregation"`
+	Sink         *SinkConf `json:"sink"` //Output sink for the API, overrides user's and global sink.
+	//Schedule at which the API is triggered, by default it's triggered every interval starting from the next quarter hour plus delay.
+	Schedule *ScheduleConf `json:"schedule"`
+	//Format of the API's response files, overrides global response_format.
+	ResponseFormat string `json:"response_format"`
+}
+
+// ScheduleConf keeps the schedule of an API, either a cron expression or an interval aligned to the clock with an offset.
+type ScheduleConf struct {
+	Cron     string `json:"cron"`     //Cron expression (minute hour day-of-month month day-of-week) or descriptor like @daily.
+	Interval int    `json:"interval"` //Interval in minutes aligned to the clock, default is API's interval.
+	Offset   int    `json:"offset"`   //Offset in seconds from the start of the interval.
+	Jitter   int    `json:"jitter"`   //Maximum random delay in seconds added to each trigger.
 }
 
 // ListNetworkAPIConf keeps network API configs
@@ -116,58 +276,313 @@ type ListNetworkAPIConf struct {
 }
 
 var (
-	//Conf keeps the config from json and console
-	Conf Config
+	//Conf keeps the config from json and console. It's replaced by Set when the config is reloaded, so the code
+	//running alongside the reload reads it with Current.
+	Conf    Config
+	confMux sync.RWMutex
 )
 
+// Current returns a copy of the current config, it isn't affected by the reload of the config.
+func Current() Config {
+	confMux.RLock()
+	defer confMux.RUnlock()
+	return Conf
+}
+
+// Set replaces the current config, used when the config is read or reloaded.
+func Set(conf Config) {
+	confMux.Lock()
+	defer confMux.Unlock()
+	Conf = conf
+}
+
 // ReadConfig reads the configurations from resources/conf.json file and sets the Config object.
 func ReadConfig(confFile string) error {
+	conf, err := LoadConfig(confFile)
+	if err != nil {
+		return err
+	}
+	Set(conf)
+	log.Info("Config read successfully.")
+	return nil
+}
+
+// LoadConfig reads the configurations from confFile and returns it with the defaults set, the Config object isn't changed.
+// Used to validate the config before applying it when it's reloaded.
+func LoadConfig(confFile string) (Config, error) {
+	//defaults of retry policy are set before reading the config, so that 0 can be configured, ex: to disable retries
+	conf := Config{Retry: defaultRetryConf()}
 	contents, err := os.ReadFile(confFile)
 	if err != nil {
-		return fmt.Errorf("error while reading conf file: %v", err)
+		return conf, fmt.Errorf("error while reading conf file: %v", err)
 	}
-	err = json.Unmarshal(contents, &Conf)
+	err = json.Unmarshal(contents, &conf)
 	if err != nil {
-		return fmt.Errorf("invalid conf file: %v", err)
+		return conf, fmt.Errorf("invalid conf file: %v", err)
 	}
 
 	//trim spaces
-	Conf.BaseURL = strings.TrimSpace(Conf.BaseURL)
-	Conf.AzureSessionAPIs.Refresh = strings.TrimSpace(Conf.AzureSessionAPIs.Refresh)
-	Conf.UMAPIs.Login = strings.TrimSpace(Conf.UMAPIs.Login)
-	Conf.UMAPIs.Logout = strings.TrimSpace(Conf.UMAPIs.Logout)
-	Conf.UMAPIs.Refresh = strings.TrimSpace(Conf.UMAPIs.Refresh)
-	Conf.UserAGAPIs.ListOrgUUID = strings.TrimSpace(Conf.UserAGAPIs.ListOrgUUID)
-	Conf.UserAGAPIs.ListAccUUID = strings.TrimSpace(Conf.UserAGAPIs.ListAccUUID)
-
-	for _, api := range Conf.MetricAPIs {
+	conf.BaseURL = strings.TrimSpace(conf.BaseURL)
+	conf.AzureSessionAPIs.Refresh = strings.TrimSpace(conf.AzureSessionAPIs.Refresh)
+	conf.UMAPIs.Login = strings.TrimSpace(conf.UMAPIs.Login)
+	conf.UMAPIs.Logout = strings.TrimSpace(conf.UMAPIs.Logout)
+	conf.UMAPIs.Refresh = strings.TrimSpace(conf.UMAPIs.Refresh)
+	trimTLSConf(&conf.TLS)
+	conf.ResponseFormat = strings.ToLower(strings.TrimSpace(conf.ResponseFormat))
+	if conf.ResponseFormat == "" {
+		conf.ResponseFormat = JSONFormat
+	}
+	conf.UserAGAPIs.ListOrgUUID = strings.TrimSpace(conf.UserAGAPIs.ListOrgUUID)
+	conf.UserAGAPIs.ListAccUUID = strings.TrimSpace(conf.UserAGAPIs.ListAccUUID)
+
+	trimSinkConf(conf.Sink)
+
+	for _, api := range conf.MetricAPIs {
 		api.API = strings.TrimSpace(api.API)
 		api.Type = strings.TrimSpace(api.Type)
 		api.MetricType = strings.TrimSpace(api.MetricType)
+		api.ResponseFormat = strings.ToLower(strings.TrimSpace(api.ResponseFormat))
+		trimSinkConf(api.Sink)
+		if api.Schedule != nil {
+			api.Schedule.Cron = strings.TrimSpace(api.Schedule.Cron)
+		}
 	}
 
-	for _, api := range Conf.SimAPIs {
+	for _, api := range conf.SimAPIs {
 		api.API = strings.TrimSpace(api.API)
 		api.Type = strings.TrimSpace(api.Type)
 		api.MetricType = strings.TrimSpace(api.MetricType)
+		api.ResponseFormat = strings.ToLower(strings.TrimSpace(api.ResponseFormat))
+		trimSinkConf(api.Sink)
+		if api.Schedule != nil {
+			api.Schedule.Cron = strings.TrimSpace(api.Schedule.Cron)
+		}
 	}
 
-	for _, user := range Conf.Users {
+	for _, user := range conf.Users {
 		user.Email = strings.TrimSpace(user.Email)
 		user.ResponseDest = strings.TrimSpace(user.ResponseDest)
 		user.AuthType = strings.TrimSpace(user.AuthType)
 		if user.AuthType == "" {
 			user.AuthType = "PASSWORD"
 		}
+		trimSinkConf(user.Sink)
+		trimCredentialConf(user.Credentials)
+		user.BaseURL = strings.TrimSpace(user.BaseURL)
+		if user.UMAPIs != nil {
+			user.UMAPIs.Login = strings.TrimSpace(user.UMAPIs.Login)
+			user.UMAPIs.Logout = strings.TrimSpace(user.UMAPIs.Logout)
+			user.UMAPIs.Refresh = strings.TrimSpace(user.UMAPIs.Refresh)
+		}
+		if user.AzureSessionAPIs != nil {
+			user.AzureSessionAPIs.Refresh = strings.TrimSpace(user.AzureSessionAPIs.Refresh)
+		}
+		trimTLSConf(user.TLS)
 	}
 
-	if Conf.MaxConcurrentProcess <= 0 {
-		Conf.MaxConcurrentProcess = 1
+	if conf.MaxConcurrentProcess <= 0 {
+		conf.MaxConcurrentProcess = 1
 	}
 
-	if Conf.Timeout <= 0 {
-		Conf.Timeout = 120
+	if conf.Timeout <= 0 {
+		conf.Timeout = 120
 	}
-	log.Info("Config read successfully.")
-	return nil
+	if conf.CircuitBreaker.FailureThreshold == 0 {
+		conf.CircuitBreaker.FailureThreshold = defaultCircuitFailureThreshold
+	}
+	if conf.CircuitBreaker.OpenTimeout == 0 {
+		conf.CircuitBreaker.OpenTimeout = defaultCircuitOpenTimeout
+	}
+	if conf.RateLimit.RequestsPerSecond > 0 && conf.RateLimit.Burst == 0 {
+		conf.RateLimit.Burst = int(math.Ceil(conf.RateLimit.RequestsPerSecond))
+	}
+	return conf, nil
+}
+
+// returns the default retry policy of the failed API calls.
+func defaultRetryConf() RetryConf {
+	return RetryConf{
+		MaxAttempts:    defaultRetryMaxAttempts,
+		InitialBackoff: defaultRetryInitialBackoff,
+		MaxBackoff:     defaultRetryMaxBackoff,
+		Multiplier:     defaultRetryMultiplier,
+		Jitter:         defaultRetryJitter,
+		MaxRetryAfter:  defaultRetryMaxRetryAfter,
+	}
+}
+
+func trimCredentialConf(credentials *CredentialConf) {
+	if credentials == nil {
+		return
+	}
+	credentials.Type = strings.ToUpper(strings.TrimSpace(credentials.Type))
+	if credentials.Type == "" {
+		credentials.Type = SecretFileCredential
+	}
+	credentials.PasswordEnv = strings.TrimSpace(credentials.PasswordEnv)
+	credentials.AccessTokenEnv = strings.TrimSpace(credentials.AccessTokenEnv)
+	credentials.RefreshTokenEnv = strings.TrimSpace(credentials.RefreshTokenEnv)
+	credentials.PasswordFile = strings.TrimSpace(credentials.PasswordFile)
+	credentials.AccessTokenFile = strings.TrimSpace(credentials.AccessTokenFile)
+	credentials.RefreshTokenFile = strings.TrimSpace(credentials.RefreshTokenFile)
+	if credentials.Timeout <= 0 {
+		credentials.Timeout = 30
+	}
+}
+
+func trimSinkConf(sink *SinkConf) {
+	if sink == nil {
+		return
+	}
+	sink.Type = strings.ToUpper(strings.TrimSpace(sink.Type))
+	if sink.Type == "" {
+		sink.Type = FileSink
+	}
+	sink.URL = strings.TrimSpace(sink.URL)
+	if es := sink.Elasticsearch; es != nil {
+		es.URL = strings.TrimSpace(es.URL)
+		es.User = strings.TrimSpace(es.User)
+		es.Password = strings.TrimSpace(es.Password)
+		es.RetryQueueDir = strings.TrimSpace(es.RetryQueueDir)
+		if es.RetryQueueDir == "" {
+			es.RetryQueueDir = defaultESRetryQueueDir
+		}
+		if es.RetryQueueMaxSizeMB <= 0 {
+			es.RetryQueueMaxSizeMB = defaultESRetryQueueMaxSizeMB
+		}
+		es.DeadLetterFile = strings.TrimSpace(es.DeadLetterFile)
+		if es.DeadLetterFile == "" {
+			es.DeadLetterFile = defaultESDeadLetterFile
+		}
+	}
+}
+
+func trimTLSConf(tlsConf *TLSConf) {
+	if tlsConf == nil {
+		return
+	}
+	tlsConf.CACertFile = strings.TrimSpace(tlsConf.CACertFile)
+	tlsConf.ClientCertFile = strings.TrimSpace(tlsConf.ClientCertFile)
+	tlsConf.ClientKeyFile = strings.TrimSpace(tlsConf.ClientKeyFile)
+	tlsConf.ClientPKCS12File = strings.TrimSpace(tlsConf.ClientPKCS12File)
+	tlsConf.ClientPKCS12PasswordFile = strings.TrimSpace(tlsConf.ClientPKCS12PasswordFile)
+	tlsConf.MinVersion = strings.TrimSpace(tlsConf.MinVersion)
+	for i := range tlsConf.CipherSuites {
+		tlsConf.CipherSuites[i] = strings.TrimSpace(tlsConf.CipherSuites[i])
+	}
+}
+
+// ResponseFormatFor returns the format of the API's response files, global response_format is used if it isn't set for the API.
+func ResponseFormatFor(api *APIConf) string {
+	if api != nil && api.ResponseFormat != "" {
+		return api.ResponseFormat
+	}
+	if Current().ResponseFormat == "" {
+		return JSONFormat
+	}
+	return Current().ResponseFormat
+}
+
+// BaseURLFor returns the base URL of the user's console, global base_url is used if the user's base_url isn't set.
+func BaseURLFor(user *User) string {
+	if user != nil && user.BaseURL != "" {
+		return user.BaseURL
+	}
+	return Current().BaseURL
+}
+
+// UMAPIsFor returns the user management APIs of the user, global um_api is used for the APIs not set for the user.
+func UMAPIsFor(user *User) UMConf {
+	apis := Current().UMAPIs
+	if user == nil || user.UMAPIs == nil {
+		return apis
+	}
+	if user.UMAPIs.Login != "" {
+		apis.Login = user.UMAPIs.Login
+	}
+	if user.UMAPIs.Refresh != "" {
+		apis.Refresh = user.UMAPIs.Refresh
+	}
+	if user.UMAPIs.Logout != "" {
+		apis.Logout = user.UMAPIs.Logout
+	}
+	return apis
+}
+
+// AzureSessionAPIsFor returns the azure session APIs of the user, global azure_session_api is used if it isn't set for the user.
+func AzureSessionAPIsFor(user *User) AzureConf {
+	if user != nil && user.AzureSessionAPIs != nil && user.AzureSessionAPIs.Refresh != "" {
+		return *user.AzureSessionAPIs
+	}
+	return Current().AzureSessionAPIs
+}
+
+// ProxyFor returns the proxy config of the user's console, global proxy is used if the user's proxy isn't set.
+func ProxyFor(user *User) ProxyConfig {
+	if user != nil && user.Proxy != nil {
+		return *user.Proxy
+	}
+	return Current().Proxy
+}
+
+// PasswordFor returns the user's current password.
+func PasswordFor(user *User) string {
+	user.sessionMux.RLock()
+	defer user.sessionMux.RUnlock()
+	return user.Password
+}
+
+// SetPassword replaces the user's password, the new password is used by the next login.
+func SetPassword(user *User, password string) {
+	user.sessionMux.Lock()
+	defer user.sessionMux.Unlock()
+	user.Password = password
+}
+
+// SessionAlive returns true if the user is logged in and has active networks.
+func SessionAlive(user *User) bool {
+	user.sessionMux.RLock()
+	defer user.sessionMux.RUnlock()
+	return user.IsSessionAlive
+}
+
+// SetSessionAlive updates the user's session state, ex: on login, logout and when the network list is fetched.
+func SetSessionAlive(user *User, alive bool) {
+	user.sessionMux.Lock()
+	defer user.sessionMux.Unlock()
+	user.IsSessionAlive = alive
+}
+
+// NetworksFor returns the user's current network inventory, an empty inventory is returned if the network list isn't fetched yet.
+// The returned inventory must not be modified.
+func NetworksFor(user *User) *NetworkSnapshot {
+	user.NhgMux.RLock()
+	defer user.NhgMux.RUnlock()
+	if user.networks == nil {
+		return &NetworkSnapshot{}
+	}
+	return user.networks
+}
+
+// SetNetworks replaces the user's network inventory with the inventory fetched at the given time.
+func SetNetworks(user *User, networks *NetworkSnapshot, fetched time.Time) {
+	user.NhgMux.Lock()
+	defer user.NhgMux.Unlock()
+	user.networks = networks
+	user.NetworkFetched = fetched
+	user.NetworkRestored = false
+}
+
+// RestoreNetworks sets the user's network inventory restored from the stored inventory fetched at the given time.
+// The inventory isn't restored if the user's network list is already fetched, returns true if it's restored.
+func RestoreNetworks(user *User, networks *NetworkSnapshot, fetched time.Time) bool {
+	user.NhgMux.Lock()
+	defer user.NhgMux.Unlock()
+	if !user.NetworkFetched.IsZero() {
+		return false
+	}
+	user.networks = networks
+	user.NetworkFetched = fetched
+	user.NetworkRestored = true
+	return true
 }
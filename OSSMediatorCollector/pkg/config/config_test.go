@@ -81,6 +81,10 @@ func TestReadConfig(t *testing.T) {
 	if Conf.BaseURL != "https://localhost:8080/api/v2" || len(Conf.Users) != 2 || Conf.Users[0].Email != "user1@nokia.com" {
 		t.Fail()
 	}
+	//retry policy defaults are set when it isn't configured
+	if Conf.Retry.MaxAttempts != 3 || Conf.Retry.InitialBackoff != 1 || Conf.Retry.MaxBackoff != 60 || Conf.Retry.MaxRetryAfter != 300 {
+		t.Errorf("unexpected retry defaults %+v", Conf.Retry)
+	}
 }
 
 //Reading config from non existing file
@@ -91,6 +95,44 @@ func TestReadConfigWithNonExistingFile(t *testing.T) {
 	}
 }
 
+//Loading config doesn't change the current config
+func TestLoadConfig(t *testing.T) {
+	tmpfile, err := createTmpFile(".", "conf", []byte(`{"base_url": " https://localhost:8080/api/v2 ", "users": [{"email_id": "user1@nokia.com"}]}`))
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(tmpfile)
+	prevConf := Conf
+	defer func() { Conf = prevConf }()
+	Conf = Config{BaseURL: "http://localhost:9090"}
+	conf, err := LoadConfig(tmpfile)
+	if err != nil {
+		t.Error(err)
+	}
+	if conf.BaseURL != "https://localhost:8080/api/v2" || len(conf.Users) != 1 || conf.MaxConcurrentProcess != 1 {
+		t.Errorf("unexpected config: %+v", conf)
+	}
+	if Conf.BaseURL != "http://localhost:9090" || len(Conf.Users) != 0 {
+		t.Errorf("current config shouldn't be changed: %+v", Conf)
+	}
+}
+
+//0 configured in retry policy isn't replaced by the defaults
+func TestLoadConfigWithRetryDisabled(t *testing.T) {
+	tmpfile, err := createTmpFile(".", "conf", []byte(`{"retry": {"max_attempts": 0, "jitter": 0, "initial_backoff": 5}}`))
+	if err != nil {
+		t.Error(err)
+	}
+	defer os.Remove(tmpfile)
+	conf, err := LoadConfig(tmpfile)
+	if err != nil {
+		t.Error(err)
+	}
+	if conf.Retry.MaxAttempts != 0 || conf.Retry.Jitter != 0 || conf.Retry.InitialBackoff != 5 || conf.Retry.MaxBackoff != 60 || conf.Retry.Multiplier != 2 {
+		t.Errorf("unexpected retry config %+v", conf.Retry)
+	}
+}
+
 func createTmpFile(dir string, prefix string, content []byte) (string, error) {
 	tmpfile, err := ioutil.TempFile(dir, prefix)
 	if err != nil {
@@ -104,3 +146,33 @@ func createTmpFile(dir string, prefix string, content []byte) (string, error) {
 	}
 	return tmpfile.Name(), nil
 }
+
+//Console of the user overrides the global console
+func TestConsoleFor(t *testing.T) {
+	prevConf := Conf
+	defer func() { Conf = prevConf }()
+	Conf = Config{
+		BaseURL:          "https://global.example.com",
+		UMAPIs:           UMConf{Login: "/login", Refresh: "/refresh", Logout: "/logout"},
+		AzureSessionAPIs: AzureConf{Refresh: "/azure/refresh"},
+		Proxy:            ProxyConfig{Enabled: true, Mode: "SYSTEM"},
+	}
+	user := &User{
+		BaseURL:          "https://staging.example.com",
+		UMAPIs:           &UMConf{Login: "/v2/login"},
+		AzureSessionAPIs: &AzureConf{Refresh: "/v2/azure/refresh"},
+		Proxy:            &ProxyConfig{},
+	}
+	if BaseURLFor(user) != "https://staging.example.com" || BaseURLFor(&User{}) != "https://global.example.com" || BaseURLFor(nil) != "https://global.example.com" {
+		t.Error("unexpected base url")
+	}
+	if UMAPIsFor(user) != (UMConf{Login: "/v2/login", Refresh: "/refresh", Logout: "/logout"}) || UMAPIsFor(&User{}) != Conf.UMAPIs {
+		t.Errorf("unexpected um apis: %+v", UMAPIsFor(user))
+	}
+	if AzureSessionAPIsFor(user).Refresh != "/v2/azure/refresh" || AzureSessionAPIsFor(&User{}).Refresh != "/azure/refresh" {
+		t.Error("unexpected azure session apis")
+	}
+	if ProxyFor(user).Enabled || !ProxyFor(&User{}).Enabled {
+		t.Error("unexpected proxy")
+	}
+}
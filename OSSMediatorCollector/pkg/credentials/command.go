@@ -0,0 +1,76 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package credentials
+
+import (
+	"bytes"
+	"collector/pkg/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandRequest is written as JSON to the command's stdin.
+type commandRequest struct {
+	Email    string `json:"email_id"`
+	AuthType string `json:"auth_type"`
+	Credentials
+}
+
+// commandProvider runs the configured command to get and store the credentials, as git credential helpers.
+// The command is called with "get" or "store" argument appended and the request as JSON on stdin,
+// "get" should print the credentials as JSON to stdout, ex: {"password": "..."} or {"access_token": "...", "refresh_token": "..."}.
+type commandProvider struct {
+	conf *config.CredentialConf
+}
+
+func (p commandProvider) Get(user *config.User) (*Credentials, error) {
+	output, err := p.run("get", commandRequest{Email: user.Email, AuthType: user.AuthType})
+	if err != nil {
+		return nil, err
+	}
+	credentials := new(Credentials)
+	err = json.Unmarshal(output, credentials)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode credentials printed by %s: %v", p.conf.Command[0], err)
+	}
+	return credentials, nil
+}
+
+func (p commandProvider) Store(user *config.User, credentials *Credentials) error {
+	_, err := p.run("store", commandRequest{Email: user.Email, AuthType: user.AuthType, Credentials: *credentials})
+	return err
+}
+
+func (p commandProvider) run(action string, req commandRequest) ([]byte, error) {
+	input, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(p.conf.Timeout)*time.Second)
+	defer cancel()
+
+	args := append(append([]string{}, p.conf.Command[1:]...), action)
+	cmd := exec.CommandContext(ctx, p.conf.Command[0], args...)
+	//don't wait for the output of the processes started by the command, after it's killed on timeout
+	cmd.WaitDelay = time.Second
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("credential command %s %s timed out after %ds", p.conf.Command[0], action, p.conf.Timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("credential command %s %s failed: %v %s", p.conf.Command[0], action, err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package credentials
+
+import (
+	"collector/pkg/config"
+	"errors"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	//interval at which FILE credentials are checked for change, overridden in tests
+	watchInterval = 30 * time.Second
+
+	errorEmptyPassword = errors.New("password is empty")
+	errorEmptyToken    = errors.New("access token or refresh token is empty")
+)
+
+// Credentials keeps the user's password, or access and refresh token for ADTOKEN users.
+type Credentials struct {
+	Password     string `json:"password,omitempty"`
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// SessionToken returns the access and refresh token separated by new line, as accepted by TokenAuthorize.
+func (c *Credentials) SessionToken() string {
+	return c.AccessToken + "\n" + c.RefreshToken
+}
+
+// Provider reads the user's credentials from its source.
+type Provider interface {
+	//Get returns the user's current credentials.
+	Get(user *config.User) (*Credentials, error)
+	//Store persists the tokens rotated by refresh API, it's a no-op for the read-only sources.
+	Store(user *config.User, credentials *Credentials) error
+}
+
+// For returns the credential provider of the user, secret file stored by storesecret if it's not configured.
+func For(user *config.User) Provider {
+	conf := user.Credentials
+	if conf == nil {
+		return secretFileProvider{}
+	}
+	switch conf.Type {
+	case config.EnvCredential:
+		return envProvider{conf: conf}
+	case config.FileCredential:
+		return fileProvider{conf: conf}
+	case config.CommandCredential:
+		return commandProvider{conf: conf}
+	default:
+		return secretFileProvider{}
+	}
+}
+
+// Get reads the user's credentials from the user's provider.
+// Returns error if the password, or the tokens for ADTOKEN user, are empty.
+func Get(user *config.User) (*Credentials, error) {
+	credentials, err := For(user).Get(user)
+	if err != nil {
+		return nil, err
+	}
+	if isADToken(user) {
+		if credentials.AccessToken == "" || credentials.RefreshToken == "" {
+			return nil, errorEmptyToken
+		}
+	} else if credentials.Password == "" {
+		return nil, errorEmptyPassword
+	}
+	return credentials, nil
+}
+
+// StoreSessionToken stores the user's tokens rotated by refresh API through the user's provider.
+func StoreSessionToken(user *config.User, accessToken string, refreshToken string) error {
+	return For(user).Store(user, &Credentials{AccessToken: accessToken, RefreshToken: refreshToken})
+}
+
+// Watch checks the user's FILE credentials for change every watchInterval and calls onChange with the changed
+// credentials, ex: when a mounted kubernetes secret is updated. It returns immediately for the other providers,
+// as their credentials are read only at login. It runs until done is closed.
+func Watch(user *config.User, done <-chan struct{}, onChange func(credentials *Credentials)) {
+	if user.Credentials == nil || user.Credentials.Type != config.FileCredential {
+		return
+	}
+	last, err := Get(user)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Warnf("Unable to read credentials of %s", user.Email)
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		current, err := Get(user)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Warnf("Unable to read credentials of %s", user.Email)
+			continue
+		}
+		if last != nil && *current == *last {
+			continue
+		}
+		log.Infof("Credentials of %s are changed", user.Email)
+		last = current
+		onChange(current)
+	}
+}
+
+func isADToken(user *config.User) bool {
+	return strings.ToUpper(user.AuthType) == "ADTOKEN"
+}
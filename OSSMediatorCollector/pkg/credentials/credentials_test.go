@@ -0,0 +1,162 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package credentials
+
+import (
+	"collector/pkg/config"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFromSecretFile(t *testing.T) {
+	assert.Nil(t, os.MkdirAll(".secret", os.ModePerm))
+	defer os.RemoveAll(".secret")
+	user := &config.User{Email: "testuser@nokia.com", AuthType: "ADTOKEN"}
+
+	err := StoreSessionToken(user, "access", "refresh")
+	assert.Nil(t, err)
+	creds, err := Get(user)
+	assert.Nil(t, err)
+	assert.Equal(t, &Credentials{AccessToken: "access", RefreshToken: "refresh"}, creds)
+
+	user = &config.User{Email: "testuser2@nokia.com", AuthType: "PASSWORD"}
+	assert.Nil(t, os.WriteFile(".secret/."+user.Email, []byte(base64.StdEncoding.EncodeToString([]byte("test"))), 0600))
+	creds, err = Get(user)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", creds.Password)
+}
+
+func TestGetFromEnv(t *testing.T) {
+	t.Setenv("TEST_PASSWORD", "test")
+	t.Setenv("TEST_ACCESS_TOKEN", "access")
+	user := &config.User{
+		Email:       "testuser@nokia.com",
+		AuthType:    "PASSWORD",
+		Credentials: &config.CredentialConf{Type: config.EnvCredential, PasswordEnv: "TEST_PASSWORD", AccessTokenEnv: "TEST_ACCESS_TOKEN", RefreshTokenEnv: "TEST_REFRESH_TOKEN"},
+	}
+	creds, err := Get(user)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", creds.Password)
+
+	//refresh token isn't set
+	user.AuthType = "ADTOKEN"
+	creds, err = Get(user)
+	assert.Nil(t, creds)
+	assert.Equal(t, errorEmptyToken, err)
+
+	//rotated tokens are kept only in memory
+	assert.Nil(t, StoreSessionToken(user, "access2", "refresh2"))
+	assert.Equal(t, "access", os.Getenv("TEST_ACCESS_TOKEN"))
+}
+
+func TestGetFromFile(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "access_token"), []byte("access\n"), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "refresh_token"), []byte("refresh"), 0600))
+	user := &config.User{
+		Email:    "testuser@nokia.com",
+		AuthType: "ADTOKEN",
+		Credentials: &config.CredentialConf{
+			Type:             config.FileCredential,
+			AccessTokenFile:  filepath.Join(dir, "access_token"),
+			RefreshTokenFile: filepath.Join(dir, "refresh_token"),
+		},
+	}
+	creds, err := Get(user)
+	assert.Nil(t, err)
+	assert.Equal(t, "access\nrefresh", creds.SessionToken())
+
+	user.AuthType = "PASSWORD"
+	creds, err = Get(user)
+	assert.Nil(t, creds)
+	assert.NotNil(t, err)
+}
+
+func TestGetFromCommand(t *testing.T) {
+	dir := t.TempDir()
+	stored := filepath.Join(dir, "stored.json")
+	//prints the credentials for get, and writes the request to stored.json for store
+	script := `read -r input
+case "$1" in
+get) echo '{"access_token": "access", "refresh_token": "refresh"}' ;;
+store) echo "$input" > ` + stored + ` ;;
+*) echo "unknown action" >&2; exit 1 ;;
+esac`
+	user := &config.User{
+		Email:       "testuser@nokia.com",
+		AuthType:    "ADTOKEN",
+		Credentials: &config.CredentialConf{Type: config.CommandCredential, Command: []string{"sh", "-c", script, "helper"}, Timeout: 5},
+	}
+	creds, err := Get(user)
+	assert.Nil(t, err)
+	assert.Equal(t, &Credentials{AccessToken: "access", RefreshToken: "refresh"}, creds)
+
+	err = StoreSessionToken(user, "access2", "refresh2")
+	assert.Nil(t, err)
+	data, err := os.ReadFile(stored)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"email_id": "testuser@nokia.com", "auth_type": "ADTOKEN", "access_token": "access2", "refresh_token": "refresh2"}`, string(data))
+}
+
+func TestGetFromFailedCommand(t *testing.T) {
+	user := &config.User{
+		Email:       "testuser@nokia.com",
+		AuthType:    "PASSWORD",
+		Credentials: &config.CredentialConf{Type: config.CommandCredential, Command: []string{"sh", "-c", "echo 'not found' >&2; exit 1"}, Timeout: 5},
+	}
+	creds, err := Get(user)
+	assert.Nil(t, creds)
+	assert.Contains(t, err.Error(), "not found")
+
+	user.Credentials.Command = []string{"sh", "-c", "echo invalid"}
+	creds, err = Get(user)
+	assert.Nil(t, creds)
+	assert.Contains(t, err.Error(), "unable to decode credentials")
+
+	user.Credentials.Command = []string{"sh", "-c", "exec sleep 5"}
+	user.Credentials.Timeout = 1
+	creds, err = Get(user)
+	assert.Nil(t, creds)
+	assert.Contains(t, err.Error(), "timed out")
+}
+
+func TestWatchFileCredentials(t *testing.T) {
+	watchInterval = 10 * time.Millisecond
+	defer func() { watchInterval = 30 * time.Second }()
+	passwordFile := filepath.Join(t.TempDir(), "password")
+	assert.Nil(t, os.WriteFile(passwordFile, []byte("test"), 0600))
+	user := &config.User{
+		Email:       "testuser@nokia.com",
+		AuthType:    "PASSWORD",
+		Credentials: &config.CredentialConf{Type: config.FileCredential, PasswordFile: passwordFile},
+	}
+
+	changed := make(chan *Credentials, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go Watch(user, done, func(creds *Credentials) { changed <- creds })
+
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case <-changed:
+		t.Fatal("unchanged credentials shouldn't be notified")
+	default:
+	}
+
+	assert.Nil(t, os.WriteFile(passwordFile, []byte("test2"), 0600))
+	select {
+	case creds := <-changed:
+		assert.Equal(t, "test2", creds.Password)
+	case <-time.After(2 * time.Second):
+		t.Fatal("changed credentials aren't notified")
+	}
+}
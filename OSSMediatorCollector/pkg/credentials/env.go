@@ -0,0 +1,35 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package credentials
+
+import (
+	"collector/pkg/config"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// envProvider reads the credentials from the configured environment variables.
+type envProvider struct {
+	conf *config.CredentialConf
+}
+
+func (p envProvider) Get(user *config.User) (*Credentials, error) {
+	if !isADToken(user) {
+		return &Credentials{Password: os.Getenv(p.conf.PasswordEnv)}, nil
+	}
+	return &Credentials{
+		AccessToken:  os.Getenv(p.conf.AccessTokenEnv),
+		RefreshToken: os.Getenv(p.conf.RefreshTokenEnv),
+	}, nil
+}
+
+// environment variables can't be updated for the next start, the rotated tokens are kept only in memory.
+func (envProvider) Store(user *config.User, credentials *Credentials) error {
+	log.Debugf("Rotated tokens of %s aren't stored, ENV credentials are read-only", user.Email)
+	return nil
+}
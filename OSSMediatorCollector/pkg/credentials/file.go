@@ -0,0 +1,55 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package credentials
+
+import (
+	"collector/pkg/config"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fileProvider reads the credentials from the configured files, ex: kubernetes secret mounted as volume.
+// Each file contains only the credential, trailing new line is ignored.
+type fileProvider struct {
+	conf *config.CredentialConf
+}
+
+func (p fileProvider) Get(user *config.User) (*Credentials, error) {
+	if !isADToken(user) {
+		password, err := readCredentialFile(p.conf.PasswordFile)
+		if err != nil {
+			return nil, err
+		}
+		return &Credentials{Password: password}, nil
+	}
+
+	accessToken, err := readCredentialFile(p.conf.AccessTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := readCredentialFile(p.conf.RefreshTokenFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Credentials{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+}
+
+// mounted secrets are read-only, the rotated tokens are kept only in memory.
+func (fileProvider) Store(user *config.User, credentials *Credentials) error {
+	log.Debugf("Rotated tokens of %s aren't stored, FILE credentials are read-only", user.Email)
+	return nil
+}
+
+func readCredentialFile(fileName string) (string, error) {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
@@ -0,0 +1,41 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package credentials
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/utils"
+	"fmt"
+	"strings"
+)
+
+// secretFileProvider reads the user's secret file stored by storesecret, the rotated tokens are written back to it.
+type secretFileProvider struct{}
+
+func (secretFileProvider) Get(user *config.User) (*Credentials, error) {
+	if !isADToken(user) {
+		password, err := utils.ReadPassword(user.Email)
+		if err != nil {
+			return nil, err
+		}
+		return &Credentials{Password: password}, nil
+	}
+
+	sessionToken, err := utils.ReadSessionToken(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	token := strings.SplitN(sessionToken, "\n", 2)
+	if len(token) != 2 {
+		return nil, fmt.Errorf("refresh token not found in secret file")
+	}
+	return &Credentials{AccessToken: token[0], RefreshToken: token[1]}, nil
+}
+
+func (secretFileProvider) Store(user *config.User, credentials *Credentials) error {
+	return utils.StoreSessionToken(user.Email, credentials.AccessToken, credentials.RefreshToken)
+}
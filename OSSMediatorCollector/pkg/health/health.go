@@ -0,0 +1,85 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package health
+
+import (
+	"collector/pkg/config"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UserStatus keeps the readiness details of a user.
+type UserStatus struct {
+	Email             string `json:"email_id"`
+	SessionAlive      bool   `json:"session_alive"`
+	NetworkFetched    bool   `json:"network_list_fetched"`
+	ActiveNetworks    int    `json:"active_networks"`
+	NetworkRestored   bool   `json:"network_list_restored"`
+	NetworkAgeSeconds int64  `json:"network_list_age_seconds"`
+}
+
+// ReadinessStatus is the response body of readiness endpoint.
+type ReadinessStatus struct {
+	Ready bool         `json:"ready"`
+	Users []UserStatus `json:"users"`
+}
+
+// Register adds /healthz and /readyz endpoints to mux.
+func Register(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", healthHandler)
+	mux.HandleFunc("/readyz", readinessHandler)
+}
+
+// liveness check, collector is healthy as long as it is able to serve the request.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok\n"))
+}
+
+// readiness check, collector is ready when all the users have an active session and their network list is fetched.
+func readinessHandler(w http.ResponseWriter, r *http.Request) {
+	status := GetReadinessStatus()
+	w.Header().Set("Content-Type", "application/json")
+	if status.Ready {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(status)
+}
+
+// GetReadinessStatus returns the readiness status of all the configured users.
+func GetReadinessStatus() ReadinessStatus {
+	users := config.Current().Users
+	status := ReadinessStatus{Ready: len(users) > 0}
+	for _, user := range users {
+		networks := config.NetworksFor(user)
+		user.NhgMux.RLock()
+		userStatus := UserStatus{
+			Email:           user.Email,
+			SessionAlive:    config.SessionAlive(user),
+			NetworkFetched:  !user.NetworkFetched.IsZero(),
+			NetworkRestored: user.NetworkRestored,
+		}
+		if userStatus.NetworkFetched {
+			userStatus.NetworkAgeSeconds = int64(time.Since(user.NetworkFetched).Seconds())
+		}
+		if strings.ToUpper(user.AuthType) == "ADTOKEN" {
+			userStatus.ActiveNetworks = len(networks.NhgIDsABAC)
+		} else {
+			userStatus.ActiveNetworks = len(networks.NhgIDs)
+		}
+		user.NhgMux.RUnlock()
+		if !userStatus.SessionAlive || !userStatus.NetworkFetched {
+			status.Ready = false
+		}
+		status.Users = append(status.Users, userStatus)
+	}
+	return status
+}
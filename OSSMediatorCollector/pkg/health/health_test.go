@@ -0,0 +1,93 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package health
+
+import (
+	"collector/pkg/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealthz(t *testing.T) {
+	mux := http.NewServeMux()
+	Register(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fail()
+	}
+}
+
+func TestReadyzWithActiveSession(t *testing.T) {
+	config.Conf.Users = []*config.User{
+		{Email: "user1@nokia.com", AuthType: "PASSWORD", IsSessionAlive: true},
+		{Email: "user2@nokia.com", AuthType: "ADTOKEN", IsSessionAlive: true},
+	}
+	config.SetNetworks(config.Conf.Users[0], &config.NetworkSnapshot{NhgIDs: []string{"nhg1", "nhg2"}}, time.Now())
+	config.SetNetworks(config.Conf.Users[1], &config.NetworkSnapshot{NhgIDsABAC: map[string]config.OrgAccDetails{"nhg3": {}}}, time.Now())
+	defer func() { config.Conf.Users = nil }()
+
+	mux := http.NewServeMux()
+	Register(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", recorder.Code)
+	}
+	var status ReadinessStatus
+	err := json.NewDecoder(recorder.Body).Decode(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Ready || len(status.Users) != 2 || status.Users[0].ActiveNetworks != 2 || status.Users[1].ActiveNetworks != 1 {
+		t.Errorf("unexpected readiness status: %+v", status)
+	}
+}
+
+func TestReadyzWithoutNetworkList(t *testing.T) {
+	config.Conf.Users = []*config.User{
+		{Email: "user1@nokia.com", AuthType: "PASSWORD", IsSessionAlive: true, NetworkFetched: time.Now()},
+		{Email: "user2@nokia.com", AuthType: "PASSWORD", IsSessionAlive: true},
+	}
+	defer func() { config.Conf.Users = nil }()
+
+	mux := http.NewServeMux()
+	Register(mux)
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code 503, got %d", recorder.Code)
+	}
+}
+
+func TestReadyzWithInactiveSession(t *testing.T) {
+	config.Conf.Users = []*config.User{
+		{Email: "user1@nokia.com", AuthType: "PASSWORD", IsSessionAlive: false, NetworkFetched: time.Now()},
+	}
+	defer func() { config.Conf.Users = nil }()
+
+	status := GetReadinessStatus()
+	if status.Ready || status.Users[0].SessionAlive {
+		t.Errorf("unexpected readiness status: %+v", status)
+	}
+}
+
+func TestReadyzWithRestoredNetworkList(t *testing.T) {
+	config.Conf.Users = []*config.User{
+		{Email: "user1@nokia.com", AuthType: "PASSWORD", IsSessionAlive: true},
+	}
+	config.RestoreNetworks(config.Conf.Users[0], &config.NetworkSnapshot{NhgIDs: []string{"nhg1"}}, time.Now().Add(-time.Hour))
+	defer func() { config.Conf.Users = nil }()
+
+	status := GetReadinessStatus()
+	if !status.Ready || !status.Users[0].NetworkRestored || status.Users[0].NetworkAgeSeconds < 3600 {
+		t.Errorf("unexpected readiness status: %+v", status)
+	}
+}
@@ -0,0 +1,164 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package inventory
+
+import (
+	"collector/pkg/config"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// sub directory of the inventory directory in which the last network states of each user are stored
+const networkStatesDir = "network_states"
+
+var (
+	//directory in which the inventory of each user is stored, inventory isn't persisted if empty
+	dir    string
+	dirMux sync.RWMutex
+)
+
+// Inventory is the last known network inventory of a user, persisted so that the data collection can start with it
+// when the network APIs are unavailable at startup.
+type Inventory struct {
+	FetchedAt      time.Time                       `json:"fetched_at"` //time at which the network list was fetched
+	NhgIDs         []string                        `json:"nhg_ids,omitempty"`
+	HwIDs          []string                        `json:"hw_ids,omitempty"`
+	NhgIDsABAC     map[string]config.OrgAccDetails `json:"nhg_ids_abac,omitempty"`
+	HwIDsABAC      map[string]config.OrgAccDetails `json:"hw_ids_abac,omitempty"`
+	AccountIDsABAC map[string][]string             `json:"account_ids_abac,omitempty"`
+}
+
+// Init creates the inventory directory, the inventory and network states of the users are stored in and restored from it.
+func Init(inventoryDir string) error {
+	if inventoryDir != "" {
+		err := os.MkdirAll(filepath.Join(inventoryDir, networkStatesDir), os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("unable to create inventory directory %s: %w", inventoryDir, err)
+		}
+	}
+	dirMux.Lock()
+	dir = inventoryDir
+	dirMux.Unlock()
+	return nil
+}
+
+// returns the user's file in the sub directory of the inventory directory, empty if the inventory isn't persisted.
+func fileName(subDir string, email string) string {
+	dirMux.RLock()
+	defer dirMux.RUnlock()
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, subDir, url.PathEscape(email)+".json")
+}
+
+// Save stores the user's network inventory fetched at the given time, it's called after the network list is fetched.
+func Save(user *config.User, networks *config.NetworkSnapshot, fetchedAt time.Time) error {
+	name := fileName("", user.Email)
+	if name == "" {
+		return nil
+	}
+
+	inv := Inventory{
+		FetchedAt:      fetchedAt,
+		NhgIDs:         networks.NhgIDs,
+		HwIDs:          networks.HwIDs,
+		NhgIDsABAC:     networks.NhgIDsABAC,
+		HwIDsABAC:      networks.HwIDsABAC,
+		AccountIDsABAC: networks.AccountIDsABAC,
+	}
+	return writeJSON(name, inv)
+}
+
+// SaveNetworkStates stores the user's last network states, with which the next network lists are compared to find
+// the network events.
+func SaveNetworkStates(user *config.User, states interface{}) error {
+	name := fileName(networkStatesDir, user.Email)
+	if name == "" {
+		return nil
+	}
+	return writeJSON(name, states)
+}
+
+// RestoreNetworkStates reads the user's network states stored by SaveNetworkStates into states.
+// Returns false if the states aren't stored.
+func RestoreNetworkStates(user *config.User, states interface{}) (bool, error) {
+	name := fileName(networkStatesDir, user.Email)
+	if name == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	err = json.Unmarshal(data, states)
+	if err != nil {
+		return false, fmt.Errorf("invalid network states file %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// writes v as JSON to a temporary file renamed to name, so that an interrupted write doesn't corrupt the stored file.
+func writeJSON(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(name), ".tmp_"+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), name)
+}
+
+// Restore seeds the user's network inventory from the stored inventory, if the user doesn't have a network list yet.
+// user.NetworkFetched is set to the time the stored inventory was fetched, so its age reflects the staleness.
+// Returns true if the inventory is restored.
+func Restore(user *config.User) (bool, error) {
+	name := fileName("", user.Email)
+	if name == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(name)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var inv Inventory
+	err = json.Unmarshal(data, &inv)
+	if err != nil {
+		return false, fmt.Errorf("invalid inventory file %s: %w", name, err)
+	}
+
+	networks := &config.NetworkSnapshot{
+		NhgIDs:         inv.NhgIDs,
+		HwIDs:          inv.HwIDs,
+		NhgIDsABAC:     inv.NhgIDsABAC,
+		HwIDsABAC:      inv.HwIDsABAC,
+		AccountIDsABAC: inv.AccountIDsABAC,
+	}
+	return config.RestoreNetworks(user, networks, inv.FetchedAt), nil
+}
@@ -0,0 +1,105 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package inventory
+
+import (
+	"collector/pkg/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAndRestore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "inventory")
+	assert.Nil(t, Init(dir))
+	defer Init("")
+
+	fetchedAt := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	orgAcc := config.OrgAccDetails{OrgDetails: config.OrgDetails{OrgUUID: "org1"}, AccDetails: config.AccDetails{AccUUID: "acc1"}}
+	user := &config.User{Email: "user1@nokia.com"}
+	networks := &config.NetworkSnapshot{
+		NhgIDs:         []string{"nhg1", "gng1"},
+		HwIDs:          []string{"hw1"},
+		NhgIDsABAC:     map[string]config.OrgAccDetails{"nhg2": orgAcc},
+		HwIDsABAC:      map[string]config.OrgAccDetails{"hw2": orgAcc},
+		AccountIDsABAC: map[string][]string{"org1": {"acc1"}},
+	}
+	assert.Nil(t, Save(user, networks, fetchedAt))
+
+	restoredUser := &config.User{Email: "user1@nokia.com"}
+	restored, err := Restore(restoredUser)
+	assert.Nil(t, err)
+	assert.True(t, restored)
+	assert.True(t, restoredUser.NetworkRestored)
+	assert.True(t, restoredUser.NetworkFetched.Equal(fetchedAt))
+	assert.Equal(t, networks, config.NetworksFor(restoredUser))
+
+	//network list already fetched isn't replaced
+	fetchedUser := &config.User{Email: "user1@nokia.com"}
+	config.SetNetworks(fetchedUser, &config.NetworkSnapshot{NhgIDs: []string{"nhg3"}}, time.Now())
+	restored, err = Restore(fetchedUser)
+	assert.Nil(t, err)
+	assert.False(t, restored)
+	assert.False(t, fetchedUser.NetworkRestored)
+	assert.Equal(t, []string{"nhg3"}, config.NetworksFor(fetchedUser).NhgIDs)
+
+	//user without stored inventory
+	restored, err = Restore(&config.User{Email: "user2@nokia.com"})
+	assert.Nil(t, err)
+	assert.False(t, restored)
+}
+
+func TestSaveAndRestoreNetworkStates(t *testing.T) {
+	assert.Nil(t, Init(t.TempDir()))
+	defer Init("")
+
+	user := &config.User{Email: "user1@nokia.com"}
+	states := map[string]map[string]string{"NHG": {"nhg1": "ACTIVE"}}
+	assert.Nil(t, SaveNetworkStates(user, states))
+	//inventory and network states of the user are stored separately
+	assert.Nil(t, Save(user, &config.NetworkSnapshot{NhgIDs: []string{"nhg1"}}, time.Now()))
+
+	var restoredStates map[string]map[string]string
+	restored, err := RestoreNetworkStates(user, &restoredStates)
+	assert.Nil(t, err)
+	assert.True(t, restored)
+	assert.Equal(t, states, restoredStates)
+
+	restored, err = RestoreNetworkStates(&config.User{Email: "user2@nokia.com"}, &restoredStates)
+	assert.Nil(t, err)
+	assert.False(t, restored)
+}
+
+func TestRestoreWithInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, Init(dir))
+	defer Init("")
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "user1@nokia.com.json"), []byte("invalid"), 0600))
+
+	user := &config.User{Email: "user1@nokia.com"}
+	restored, err := Restore(user)
+	assert.NotNil(t, err)
+	assert.False(t, restored)
+	assert.True(t, user.NetworkFetched.IsZero())
+}
+
+func TestInventoryDisabled(t *testing.T) {
+	assert.Nil(t, Init(""))
+	user := &config.User{Email: "user1@nokia.com"}
+	assert.Nil(t, Save(user, &config.NetworkSnapshot{NhgIDs: []string{"nhg1"}}, time.Now()))
+	assert.Nil(t, SaveNetworkStates(user, map[string]string{}))
+	restored, err := Restore(&config.User{Email: "user1@nokia.com"})
+	assert.Nil(t, err)
+	assert.False(t, restored)
+	var states map[string]string
+	restored, err = RestoreNetworkStates(user, &states)
+	assert.Nil(t, err)
+	assert.False(t, restored)
+}
@@ -0,0 +1,239 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package metrics
+
+import (
+	"collector/pkg/checkpoint"
+	"collector/pkg/config"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	namespace = "ossmediator_collector"
+
+	//status label values for API calls
+	statusSuccess = "success"
+	statusFailure = "failure"
+
+	//SkipReasonSessionInactive is used when an API call is skipped because the user's session is inactive.
+	SkipReasonSessionInactive = "session_inactive"
+	//SkipReasonPreviousCallActive is used when an API call is skipped because the previous call is still running.
+	SkipReasonPreviousCallActive = "previous_call_active"
+	//SkipReasonAPIFailure is used when the data of a time window is skipped after all the retries failed.
+	SkipReasonAPIFailure = "api_failure"
+	//SkipReasonCircuitOpen is used when an API call is short-circuited because the endpoint's circuit breaker is open.
+	SkipReasonCircuitOpen = "circuit_open"
+)
+
+var (
+	apiLabels = []string{"api", "metric_type", "type", "user"}
+
+	apiCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_calls_total",
+		Help:      "Number of DAC API calls made per API and user.",
+	}, append(apiLabels, "status"))
+
+	apiResponseTime = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "api_response_time_seconds",
+		Help:      "Response time of DAC API calls per API and user.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, apiLabels)
+
+	recordsReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "records_received_total",
+		Help:      "Number of PM/FM records received per API and user.",
+	}, apiLabels)
+
+	apiRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "api_retries_total",
+		Help:      "Number of retried DAC API calls per API and user.",
+	}, apiLabels)
+
+	skippedCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "skipped_calls_total",
+		Help:      "Number of API calls or data windows skipped per API and user.",
+	}, append(apiLabels, "reason"))
+
+	circuitState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "circuit_breaker_state",
+		Help:      "State of the circuit breaker per DAC API endpoint, closed (0), open (1) or half-open (2).",
+	}, []string{"endpoint"})
+
+	sessionAliveDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "session_alive"),
+		"Whether the user's session is alive (1) or not (0).",
+		[]string{"user"}, nil)
+
+	networkAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "network_list_age_seconds"),
+		"Time elapsed since the user's network list was fetched, including the network list restored from the stored inventory.",
+		[]string{"user"}, nil)
+
+	checkpointLagDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "", "checkpoint_lag_seconds"),
+		"Time elapsed since the last stored checkpoint per API, user and NHG.",
+		[]string{"api", "metric_type", "type", "user", "nhg_id"}, nil)
+
+	registry = prometheus.NewRegistry()
+
+	checkpoints   = make(map[checkpointKey]time.Time)
+	checkpointMux sync.RWMutex
+
+	//CurrentTime used for calculating checkpoint lag.
+	CurrentTime = time.Now
+)
+
+type checkpointKey struct {
+	api        string
+	metricType string
+	apiType    string
+	user       string
+	nhgID      string
+}
+
+// stateCollector reports gauges whose values are read at scrape time.
+type stateCollector struct{}
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		apiCalls,
+		apiResponseTime,
+		recordsReceived,
+		apiRetries,
+		skippedCalls,
+		circuitState,
+		stateCollector{},
+	)
+}
+
+// Handler returns the HTTP handler exposing the collector's metrics in Prometheus format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveAPICall records the call count and response time of an API call made for the user.
+func ObserveAPICall(user *config.User, api *config.APIConf, startTime time.Time, err error) {
+	labels := apiLabelValues(user, api)
+	status := statusSuccess
+	if err != nil {
+		status = statusFailure
+	}
+	apiCalls.WithLabelValues(append(labels, status)...).Inc()
+	apiResponseTime.WithLabelValues(labels...).Observe(time.Since(startTime).Seconds())
+}
+
+// AddRecordsReceived adds the no. of records received from the API for the user.
+func AddRecordsReceived(user *config.User, api *config.APIConf, noOfRecords int) {
+	recordsReceived.WithLabelValues(apiLabelValues(user, api)...).Add(float64(noOfRecords))
+}
+
+// IncRetries increments the retry count of the API for the user.
+func IncRetries(user *config.User, api *config.APIConf) {
+	apiRetries.WithLabelValues(apiLabelValues(user, api)...).Inc()
+}
+
+// IncSkipped increments the no. of skipped API calls of the user with the given reason.
+func IncSkipped(user *config.User, api *config.APIConf, reason string) {
+	skippedCalls.WithLabelValues(append(apiLabelValues(user, api), reason)...).Inc()
+}
+
+// SetCircuitState records the circuit breaker state of the endpoint, 0 for closed, 1 for open and 2 for half-open.
+func SetCircuitState(endpoint string, state int) {
+	circuitState.WithLabelValues(endpoint).Set(float64(state))
+}
+
+// SetCheckpoint records the last checkpoint time stored for the API, user and NHG.
+func SetCheckpoint(user *config.User, api *config.APIConf, nhgID string, checkpoint time.Time) {
+	key := checkpointKey{
+		api:        path.Base(api.API),
+		metricType: api.MetricType,
+		apiType:    api.Type,
+		user:       user.Email,
+		nhgID:      nhgID,
+	}
+	checkpointMux.Lock()
+	checkpoints[key] = checkpoint
+	checkpointMux.Unlock()
+}
+
+// LoadCheckpoints records the checkpoints stored by the earlier runs, called once the checkpoint store is opened so that
+// the lag of the APIs and NHGs which don't return data after restart is exposed as well.
+func LoadCheckpoints() error {
+	stored, err := checkpoint.List(checkpoint.Key{})
+	if err != nil {
+		return err
+	}
+	checkpointMux.Lock()
+	defer checkpointMux.Unlock()
+	for _, c := range stored {
+		checkpointTime, err := time.Parse(time.RFC3339, c.Time)
+		if err != nil {
+			continue
+		}
+		key := checkpointKey{api: c.API, metricType: c.MetricType, apiType: c.Type, user: c.User, nhgID: c.NhgID}
+		//checkpoint stored by this process since it's started is more recent
+		if _, ok := checkpoints[key]; !ok {
+			checkpoints[key] = checkpointTime
+		}
+	}
+	return nil
+}
+
+func apiLabelValues(user *config.User, api *config.APIConf) []string {
+	return []string{path.Base(api.API), api.MetricType, api.Type, user.Email}
+}
+
+// Describe implements prometheus.Collector.
+func (stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- sessionAliveDesc
+	ch <- networkAgeDesc
+	ch <- checkpointLagDesc
+}
+
+// Collect implements prometheus.Collector.
+func (stateCollector) Collect(ch chan<- prometheus.Metric) {
+	users := config.Current().Users
+	for _, user := range users {
+		var alive float64
+		if config.SessionAlive(user) {
+			alive = 1
+		}
+		ch <- prometheus.MustNewConstMetric(sessionAliveDesc, prometheus.GaugeValue, alive, user.Email)
+	}
+
+	now := CurrentTime()
+	for _, user := range users {
+		user.NhgMux.RLock()
+		networkFetched := user.NetworkFetched
+		user.NhgMux.RUnlock()
+		if !networkFetched.IsZero() {
+			ch <- prometheus.MustNewConstMetric(networkAgeDesc, prometheus.GaugeValue, now.Sub(networkFetched).Seconds(), user.Email)
+		}
+	}
+
+	checkpointMux.RLock()
+	defer checkpointMux.RUnlock()
+	for key, checkpointTime := range checkpoints {
+		ch <- prometheus.MustNewConstMetric(checkpointLagDesc, prometheus.GaugeValue, now.Sub(checkpointTime).Seconds(),
+			key.api, key.metricType, key.apiType, key.user, key.nhgID)
+	}
+}
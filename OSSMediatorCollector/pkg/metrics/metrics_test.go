@@ -0,0 +1,130 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package metrics
+
+import (
+	"collector/pkg/checkpoint"
+	"collector/pkg/config"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveAPICall(t *testing.T) {
+	user := &config.User{Email: "test@nokia.com"}
+	api := &config.APIConf{API: "/network-hardware-groups/{nhg_id}/fmdata", Type: "ACTIVE", MetricType: "RADIO"}
+	ObserveAPICall(user, api, time.Now(), nil)
+	ObserveAPICall(user, api, time.Now(), errors.New("500: internal error"))
+	ObserveAPICall(user, api, time.Now(), nil)
+
+	if testutil.ToFloat64(apiCalls.WithLabelValues("fmdata", "RADIO", "ACTIVE", "test@nokia.com", statusSuccess)) != 2 {
+		t.Fail()
+	}
+	if testutil.ToFloat64(apiCalls.WithLabelValues("fmdata", "RADIO", "ACTIVE", "test@nokia.com", statusFailure)) != 1 {
+		t.Fail()
+	}
+}
+
+func TestRecordsRetriesAndSkips(t *testing.T) {
+	user := &config.User{Email: "test@nokia.com"}
+	api := &config.APIConf{API: "/network-hardware-groups/{nhg_id}/pmdata", MetricType: "RADIO"}
+	AddRecordsReceived(user, api, 10)
+	AddRecordsReceived(user, api, 5)
+	IncRetries(user, api)
+	IncSkipped(user, api, SkipReasonAPIFailure)
+
+	if testutil.ToFloat64(recordsReceived.WithLabelValues("pmdata", "RADIO", "", "test@nokia.com")) != 15 {
+		t.Fail()
+	}
+	if testutil.ToFloat64(apiRetries.WithLabelValues("pmdata", "RADIO", "", "test@nokia.com")) != 1 {
+		t.Fail()
+	}
+	if testutil.ToFloat64(skippedCalls.WithLabelValues("pmdata", "RADIO", "", "test@nokia.com", SkipReasonAPIFailure)) != 1 {
+		t.Fail()
+	}
+}
+
+func TestHandlerExposesStateMetrics(t *testing.T) {
+	now := time.Date(2021, 3, 10, 10, 15, 0, 0, time.UTC)
+	CurrentTime = func() time.Time { return now }
+	defer func() { CurrentTime = time.Now }()
+
+	user := &config.User{Email: "test@nokia.com", IsSessionAlive: true, NetworkFetched: now.Add(-time.Hour)}
+	config.Conf.Users = []*config.User{user}
+	defer func() { config.Conf.Users = nil }()
+	SetCheckpoint(user, &config.APIConf{API: "/network-hardware-groups/{nhg_id}/pmdata", MetricType: "RADIO"}, "test_nhg_1", now.Add(-15*time.Minute))
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	if !strings.Contains(string(body), `ossmediator_collector_session_alive{user="test@nokia.com"} 1`) {
+		t.Fail()
+	}
+	if !strings.Contains(string(body), `ossmediator_collector_network_list_age_seconds{user="test@nokia.com"} 3600`) {
+		t.Fail()
+	}
+	if !strings.Contains(string(body), `ossmediator_collector_checkpoint_lag_seconds{api="pmdata",metric_type="RADIO",nhg_id="test_nhg_1",type="",user="test@nokia.com"} 900`) {
+		t.Fail()
+	}
+}
+
+func TestSessionAliveUpdatedWhileScraping(t *testing.T) {
+	user := &config.User{Email: "test@nokia.com"}
+	config.Conf.Users = []*config.User{user}
+	defer func() { config.Conf.Users = nil }()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			config.SetSessionAlive(user, i%2 == 0)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	}
+	<-done
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	if !strings.Contains(string(body), `ossmediator_collector_session_alive{user="test@nokia.com"} 0`) {
+		t.Fail()
+	}
+}
+
+func TestLoadCheckpoints(t *testing.T) {
+	now := time.Date(2021, 3, 10, 10, 15, 0, 0, time.UTC)
+	CurrentTime = func() time.Time { return now }
+	defer func() { CurrentTime = time.Now }()
+
+	err := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+	key := checkpoint.Key{User: "restart@nokia.com", API: "pmdata", MetricType: "RADIO", NhgID: "test_nhg_2"}
+	if err = checkpoint.Set(key, now.Add(-2*time.Hour).Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+	if err = LoadCheckpoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(recorder.Body)
+	if !strings.Contains(string(body), `ossmediator_collector_checkpoint_lag_seconds{api="pmdata",metric_type="RADIO",nhg_id="test_nhg_2",type="",user="restart@nokia.com"} 7200`) {
+		t.Errorf("stored checkpoint isn't exposed: %s", body)
+	}
+}
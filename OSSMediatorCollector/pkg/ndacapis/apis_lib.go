@@ -8,16 +8,19 @@ package ndacapis
 
 import (
 	"collector/pkg/config"
+	"collector/pkg/inventory"
+	"collector/pkg/schedule"
+	"collector/pkg/sink"
 	"collector/pkg/utils"
 	"compress/gzip"
-	"crypto/tls"
-	"crypto/x509"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
-	"net/url"
-	"os"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -26,9 +29,6 @@ import (
 )
 
 const (
-	//Maximum no. of retry attempt for API call
-	maxRetryAttempts = 3
-
 	//Time interval at which the 1st API call should start
 	interval = 15
 
@@ -57,130 +57,220 @@ const (
 var (
 	//HTTP client for all API calls
 	client *http.Client
+	//client side rate limit of the API calls, nil if it isn't configured
+	limiter *rateLimiter
 
 	//used for logging
 	txnID uint64 = 1000
 
 	activeAPIs = map[string]struct{}{}
 	mux        = sync.RWMutex{}
+
+	//API calls in progress, waited for by Shutdown
+	activeRuns = sync.WaitGroup{}
+	//set by Shutdown, no new API call is triggered after it
+	stopping bool
+	//aborts the API calls in progress
+	abortRuns = context.CancelFunc(func() {})
+	runMux    = sync.Mutex{}
+
+	//time for which the aborted API calls are waited for
+	abortWait = 10 * time.Second
+
+	//used to compute the next trigger time of the APIs, overridden in tests
+	scheduleNow = time.Now
 )
 
-type fn func(*config.APIConf, *config.User, uint64, bool)
-
-// StartDataCollection starts the tickers for PM/FM APIs.
-func StartDataCollection() {
-	for _, user := range config.Conf.Users {
-		if config.Conf.ListNetworkAPI != nil {
-			getNhgDetails(&config.APIConf{API: config.Conf.ListNetworkAPI.NhgAPI, Interval: config.Conf.ListNetworkAPI.Interval}, user, atomic.AddUint64(&txnID, 1), config.Conf.PrettyResponse)
-			if config.Conf.ListNetworkAPI.GngAPI != "" {
-				getGngDetails(&config.APIConf{API: config.Conf.ListNetworkAPI.GngAPI, Interval: config.Conf.ListNetworkAPI.Interval}, user, atomic.AddUint64(&txnID, 1), config.Conf.PrettyResponse)
-			}
-			ticker := time.NewTicker(time.Duration(config.Conf.ListNetworkAPI.Interval) * time.Minute)
-			go triggerNetworkAPI(ticker, config.Conf.ListNetworkAPI, user, config.Conf.PrettyResponse)
-		}
+type fn func(context.Context, *config.APIConf, *config.User, uint64, bool)
+
+// StartDataCollection starts the jobs triggering the network, PM/FM and SIM APIs of all the users.
+// The network details are fetched before it returns. Once ctx is cancelled the jobs are stopped and no new API call
+// is triggered, the API calls in progress continue until they complete or are aborted by Shutdown.
+func StartDataCollection(ctx context.Context) {
+	//API calls aren't cancelled with ctx, so that the time windows in progress are completed on shutdown
+	callCtx, abort := context.WithCancel(context.WithoutCancel(ctx))
+	runMux.Lock()
+	abortRuns = abort
+	stopping = false
+	runMux.Unlock()
+
+	jobMux.Lock()
+	collectionCtx = ctx
+	apiCallCtx = callCtx
+	jobs = map[string]*job{}
+	jobMux.Unlock()
+	SyncJobs()
+}
+
+// Shutdown stops triggering new API calls and waits up to timeout for the API calls in progress to complete.
+// If they don't complete in time they are aborted, and waited for abortWait so that they return without writing
+// partial data. Returns false if the API calls were aborted.
+func Shutdown(timeout time.Duration) bool {
+	runMux.Lock()
+	stopping = true
+	abort := abortRuns
+	runMux.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		activeRuns.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
 	}
 
-	currentTime := utils.CurrentTime()
-	diff := currentTime.Minute() - (currentTime.Minute() / interval * interval) - config.Conf.Delay
-	begTime := currentTime.Add(time.Duration(-1*diff) * time.Minute)
-	if currentTime.After(begTime) {
-		begTime = begTime.Add(time.Duration(interval) * time.Minute)
-		for _, user := range config.Conf.Users {
-			for _, api := range config.Conf.MetricAPIs {
-				go fetchMetricsData(api, user, atomic.AddUint64(&txnID, 1), config.Conf.PrettyResponse)
-			}
-			for _, api := range config.Conf.SimAPIs {
-				go fetchSimData(api, user, atomic.AddUint64(&txnID, 1), config.Conf.PrettyResponse)
-			}
-		}
+	log.Warnf("API calls in progress didn't complete within %v, aborting them", timeout)
+	abort()
+	select {
+	case <-done:
+	case <-time.After(abortWait):
+		log.Warnf("Aborted API calls didn't return within %v", abortWait)
+	}
+	return false
+}
+
+// run calls f unless the collector is shutting down, Shutdown waits for f to return.
+func run(f func()) {
+	runMux.Lock()
+	if stopping {
+		runMux.Unlock()
+		return
+	}
+	activeRuns.Add(1)
+	runMux.Unlock()
+	defer activeRuns.Done()
+	f()
+}
+
+// fetches the NHG and GNG details of the user, the user's network inventory is replaced as a whole with the inventory
+// built from the fetched lists and it's stored. The earlier inventory is kept if the lists aren't fetched completely.
+// Once the complete lists are applied, they are compared with the user's last lists to emit the network events.
+func fetchNetworkDetails(ctx context.Context, api *config.ListNetworkAPIConf, user *config.User, prettyResponse bool) {
+	states := map[string]map[string]networkState{nhgNetworkType: {}}
+	networks, complete := getNhgDetails(ctx, &config.APIConf{API: api.NhgAPI, Interval: api.Interval}, user, states[nhgNetworkType], atomic.AddUint64(&txnID, 1), prettyResponse)
+	if networks != nil && api.GngAPI != "" {
+		states[gngNetworkType] = map[string]networkState{}
+		complete = getGngDetails(ctx, &config.APIConf{API: api.GngAPI, Interval: api.Interval}, user, networks, states[gngNetworkType], atomic.AddUint64(&txnID, 1), prettyResponse) && complete
 	}
 
-	timer := time.NewTimer(time.Until(begTime))
-	<-timer.C
-	//For each API creates ticker to trigger the API periodically at specified interval.
-	for _, user := range config.Conf.Users {
-		for _, api := range config.Conf.MetricAPIs {
-			go fetchMetricsData(api, user, atomic.AddUint64(&txnID, 1), config.Conf.PrettyResponse)
-			ticker := time.NewTicker(time.Duration(api.Interval) * time.Minute)
-			go trigger(ticker, api, user, config.Conf.PrettyResponse, fetchMetricsData)
+	user.NhgMux.RLock()
+	fetchedEarlier := !user.NetworkFetched.IsZero()
+	user.NhgMux.RUnlock()
+	//partially fetched inventory is used only if there isn't an earlier inventory
+	if networks != nil && !complete && fetchedEarlier {
+		log.Warnf("Network list of %s isn't fetched completely, earlier network list is used", user.Email)
+		networks = nil
+	}
+	if networks != nil {
+		fetched := utils.CurrentTime()
+		config.SetNetworks(user, networks, fetched)
+		err := inventory.Save(user, networks, fetched)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Errorf("Unable to store network inventory of %s", user.Email)
 		}
-		for _, api := range config.Conf.SimAPIs {
-			go fetchSimData(api, user, atomic.AddUint64(&txnID, 1), config.Conf.PrettyResponse)
-			ticker := time.NewTicker(time.Duration(api.Interval) * time.Minute)
-			go trigger(ticker, api, user, config.Conf.PrettyResponse, fetchSimData)
+		//network events are found only from the complete lists, the networks of the failed calls would be reported as removed
+		if complete {
+			diffNetworks(user, states, atomic.AddUint64(&txnID, 1), prettyResponse)
 		}
 	}
+
+	var nhgs []string
+	if strings.ToUpper(user.AuthType) == "ADTOKEN" {
+		nhgs = slices.Sorted(maps.Keys(config.NetworksFor(user).NhgIDsABAC))
+	} else {
+		nhgs = config.NetworksFor(user).NhgIDs
+	}
+	config.SetSessionAlive(user, len(nhgs) != 0)
+	log.WithFields(log.Fields{"user": user.Email}).Infof("active networks: %v", nhgs)
 }
 
-// triggers the network apis periodically at specified interval.
-func triggerNetworkAPI(ticker *time.Ticker, api *config.ListNetworkAPIConf, user *config.User, prettyResponse bool) {
+// restores the user's network inventory stored by the earlier run, returns true if it's restored.
+func restoreNetworkDetails(user *config.User) bool {
+	restored, err := inventory.Restore(user)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Unable to restore network inventory of %s", user.Email)
+		return false
+	}
+	if restored {
+		log.Infof("Restored network inventory of %s fetched at %v, it's refreshed in background", user.Email, user.NetworkFetched)
+	}
+	return restored
+}
+
+// triggers the network apis periodically at specified interval, until ctx is cancelled.
+func triggerNetworkAPI(ctx context.Context, runCtx context.Context, ticker *time.Ticker, api *config.ListNetworkAPIConf, user *config.User, prettyResponse bool) {
+	defer ticker.Stop()
 	for {
-		<-ticker.C
-		getNhgDetails(&config.APIConf{API: api.NhgAPI, Interval: api.Interval}, user, atomic.AddUint64(&txnID, 1), prettyResponse)
-		if config.Conf.ListNetworkAPI.GngAPI != "" {
-			getGngDetails(&config.APIConf{API: api.GngAPI, Interval: api.Interval}, user, atomic.AddUint64(&txnID, 1), prettyResponse)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
+		run(func() { fetchNetworkDetails(runCtx, api, user, prettyResponse) })
 	}
 }
 
-// triggers the method periodically at specified interval.
-func trigger(ticker *time.Ticker, api *config.APIConf, user *config.User, prettyResponse bool, method fn) {
+// triggers the method at the times of sched, delayed by the random jitter of the API's schedule, until ctx is cancelled.
+// The method is called with runCtx, which is cancelled only when Shutdown aborts the API calls.
+// The trigger times missed while the method is running are skipped.
+func trigger(ctx context.Context, runCtx context.Context, sched schedule.Schedule, api *config.APIConf, user *config.User, prettyResponse bool, method fn) {
 	for {
-		<-ticker.C
-		method(api, user, atomic.AddUint64(&txnID, 1), prettyResponse)
+		next := sched.Next(scheduleNow())
+		if next.IsZero() {
+			log.Warnf("%s isn't scheduled to be triggered again for %s", api.API, user.Email)
+			return
+		}
+		timer := time.NewTimer(next.Sub(scheduleNow()) + schedule.Jitter(api.Schedule))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		run(func() { method(runCtx, api, user, atomic.AddUint64(&txnID, 1), prettyResponse) })
 	}
 }
 
+// writes the API response to the sink configured for the user's API.
+func writeResponse(user *config.User, api *config.APIConf, data interface{}, id string, txnID uint64, prettyResponse bool) error {
+	return sink.For(user, api).Write(user, api, data, id, txnID, prettyResponse)
+}
+
 // CreateHTTPClient creates HTTP client for all the GET/POST API calls, if certFile is empty and skipTLS is false TLS authentication will be done using root certificates.
 // certFile keeps the server certificate file path
 // skipTLS if true all API calls will skip TLS auth.
+// The certFile and skipTLS override the global tls config, which is used for the users without tls config, the requests
+// are sent with the transport of the user's console.
 func CreateHTTPClient(certFile string, skipTLS bool) {
-	var tr *http.Transport
+	defaultTLS := config.Current().TLS
+	if certFile != "" {
+		defaultTLS.CACertFile = certFile
+	}
 	if skipTLS {
-		//skipping certificates
-		tr = &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		}
-		log.Debugf("Skipping TLS authentication")
-	} else if certFile == "" {
-		tr = &http.Transport{}
-		log.Debugf("TLS authentication using root certificates")
-	} else {
-		//Load CA cert
-		caCert, err := os.ReadFile(certFile)
-		if err != nil {
-			log.WithFields(log.Fields{"error": err}).Error("Error while reading server certificate file")
-			tr = &http.Transport{}
-			log.Debugf("TLS authentication using root certificates")
-		} else {
-			caCertPool := x509.NewCertPool()
-			caCertPool.AppendCertsFromPEM(caCert)
-
-			//Setup HTTPS client
-			tlsConfig := &tls.Config{
-				RootCAs: caCertPool,
-			}
-			tlsConfig.BuildNameToCertificate()
-			tr = &http.Transport{TLSClientConfig: tlsConfig}
-			log.Debugf("Using CA certificate %s", certFile)
-		}
+		defaultTLS.InsecureSkipVerify = true
 	}
-
-	if config.Conf.Proxy.Enabled {
-		if config.Conf.Proxy.Mode == "SYSTEM" {
-			tr.Proxy = http.ProxyFromEnvironment
-		} else if config.Conf.Proxy.Mode == "CONFIG" {
-			proxyURL, _ := url.Parse(config.Conf.Proxy.URL)
-			tr.Proxy = http.ProxyURL(proxyURL)
-		}
+	transport := newEndpointTransport(defaultTLS)
+	//transport of the global console is created upfront
+	_, err := transport.transportFor(nil)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Error("Error while creating TLS config, API calls to the console will fail")
 	}
-	client = &http.Client{Transport: tr, Timeout: time.Second * time.Duration(config.Conf.Timeout)}
+	client = &http.Client{Transport: transport, Timeout: time.Second * time.Duration(config.Current().Timeout)}
+	limiter = newRateLimiter(config.Current().RateLimit)
 }
 
-// Executes the request.
+// Executes the user's request, waiting if the user's rate limit is reached. The request is aborted once ctx is cancelled.
 // If successful returns response and nil, if there is any error it return error.
-func doRequest(request *http.Request) ([]byte, error) {
-	response, err := client.Do(request)
+func doRequest(ctx context.Context, request *http.Request, user *config.User) ([]byte, error) {
+	release, err := limiter.wait(ctx, request, user)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	response, err := client.Do(withUser(request.WithContext(ctx), user))
 	if err != nil {
 		return nil, err
 	}
@@ -188,7 +278,11 @@ func doRequest(request *http.Request) ([]byte, error) {
 	if !(response.StatusCode >= 200 && response.StatusCode <= 299) {
 		errResp := new(ErrorResponse)
 		_ = json.NewDecoder(response.Body).Decode(errResp)
-		return nil, fmt.Errorf("%d: %s", response.StatusCode, errResp.Detail)
+		return nil, &APIError{
+			StatusCode: response.StatusCode,
+			Detail:     errResp.Detail,
+			RetryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+		}
 	}
 
 	var reader io.ReadCloser
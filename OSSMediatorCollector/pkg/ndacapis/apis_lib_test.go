@@ -9,9 +9,12 @@ package ndacapis
 import (
 	"bytes"
 	"collector/pkg/config"
+	"collector/pkg/inventory"
 	"collector/pkg/utils"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -21,6 +24,7 @@ import (
 	"time"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestCreateHTTPClientForSkipTLS(t *testing.T) {
@@ -139,7 +143,7 @@ func TestStartDataCollectionWithInvalidURL(t *testing.T) {
 	config.Conf.MaxConcurrentProcess = 1
 	CreateHTTPClient("", true)
 
-	StartDataCollection()
+	StartDataCollection(context.Background())
 	time.Sleep(2 * time.Millisecond)
 	if !strings.Contains(buf.String(), "Triggered http://localhost:8080/network-hardware-groups") {
 		t.Fail()
@@ -196,7 +200,7 @@ func TestStartDataCollection(t *testing.T) {
 	config.Conf.MaxConcurrentProcess = 1
 	CreateHTTPClient("", true)
 
-	StartDataCollection()
+	StartDataCollection(context.Background())
 	time.Sleep(20 * time.Millisecond)
 	if !strings.Contains(buf.String(), "Triggered "+testServer.URL) {
 		t.Fail()
@@ -243,3 +247,248 @@ func Test5(t *testing.T) {
 
 	fmt.Println(nhg)
 }
+
+func TestShutdownWaitsForAPICallsInProgress(t *testing.T) {
+	started := make(chan struct{}, 1)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, listNhgResp)
+	}))
+	defer testServer.Close()
+	user := setShutdownTestConf(t, testServer.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	collectionDone := make(chan struct{})
+	go func() {
+		StartDataCollection(ctx)
+		close(collectionDone)
+	}()
+	<-started
+	cancel()
+	defer func() { <-collectionDone }()
+	assert.True(t, Shutdown(5*time.Second))
+	assert.False(t, user.NetworkFetched.IsZero())
+
+	//no API call is triggered after shutdown
+	called := false
+	run(func() { called = true })
+	assert.False(t, called)
+}
+
+func TestShutdownAbortsAPICallsInProgress(t *testing.T) {
+	started := make(chan struct{}, 1)
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer testServer.Close()
+	user := setShutdownTestConf(t, testServer.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	collectionDone := make(chan struct{})
+	go func() {
+		StartDataCollection(ctx)
+		close(collectionDone)
+	}()
+	<-started
+	cancel()
+	defer func() { <-collectionDone }()
+	start := time.Now()
+	assert.False(t, Shutdown(50*time.Millisecond))
+	assert.True(t, time.Since(start) < abortWait, time.Since(start))
+	assert.True(t, user.NetworkFetched.IsZero())
+}
+
+// configures only the network API for the user, so that a single API call is in progress on shutdown.
+func setShutdownTestConf(t *testing.T, baseURL string) *config.User {
+	t.Helper()
+	prevConf := config.Conf
+	user := &config.User{Email: "testuser@nokia.com", IsSessionAlive: true, ResponseDest: "./tmp", SessionToken: &config.SessionToken{}}
+	config.Conf = config.Config{
+		BaseURL:              baseURL,
+		Users:                []*config.User{user},
+		ListNetworkAPI:       &config.ListNetworkAPIConf{NhgAPI: "/network-hardware-groups", Interval: 60},
+		Limit:                10,
+		MaxConcurrentProcess: 1,
+		Retry:                config.RetryConf{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 60, Multiplier: 2, MaxRetryAfter: 60},
+	}
+	CreateHTTPClient("", false)
+	utils.CreateResponseDirectory(user.ResponseDest, "/network-hardware-groups")
+	t.Cleanup(func() {
+		config.Conf = prevConf
+		os.RemoveAll(user.ResponseDest)
+		runMux.Lock()
+		stopping = false
+		runMux.Unlock()
+	})
+	return user
+}
+
+func TestFetchNetworkDetailsStoresInventory(t *testing.T) {
+	response := listHwResp
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, response)
+	}))
+	defer testServer.Close()
+	prevConf := config.Conf
+	config.Conf = config.Config{BaseURL: testServer.URL}
+	defer func() { config.Conf = prevConf }()
+	CreateHTTPClient("", false)
+	assert.Nil(t, inventory.Init(t.TempDir()))
+	defer inventory.Init("")
+
+	api := &config.ListNetworkAPIConf{NhgAPI: "/network-hardware-groups", Interval: 60}
+	user := &config.User{Email: "inventory@nokia.com", AuthType: "PASSWORD", ResponseDest: t.TempDir(), SessionToken: &config.SessionToken{}}
+	utils.CreateResponseDirectory(user.ResponseDest, api.NhgAPI)
+	fetchNetworkDetails(context.Background(), api, user, false)
+	assert.Equal(t, []string{"test_nhg_1"}, config.NetworksFor(user).NhgIDs)
+
+	//network API is unavailable after restart, the stored inventory is used
+	response = "invalid"
+	restartedUser := &config.User{Email: "inventory@nokia.com", AuthType: "PASSWORD", ResponseDest: user.ResponseDest, SessionToken: &config.SessionToken{}}
+	assert.True(t, restoreNetworkDetails(restartedUser))
+	fetchNetworkDetails(context.Background(), api, restartedUser, false)
+	assert.Equal(t, []string{"test_nhg_1"}, config.NetworksFor(restartedUser).NhgIDs)
+	assert.Equal(t, []string{"test_hw"}, config.NetworksFor(restartedUser).HwIDs)
+	assert.True(t, restartedUser.NetworkRestored)
+	assert.True(t, restartedUser.NetworkFetched.Equal(user.NetworkFetched))
+}
+
+func TestFetchNetworkDetailsReplacesNetworks(t *testing.T) {
+	activeNhgs := `{"status": {"status_code": "SUCCESS"}, "network_info": [
+		{"nhg_id": "nhg_1", "nhg_config_status": "ACTIVE", "clusters": [{"cluster_id": "1", "slice_id": "slice_1", "hw_set": [{"hw_id": "hw_1"}]}]},
+		{"nhg_id": "nhg_2", "nhg_config_status": "ACTIVE", "clusters": [{"cluster_id": "1", "slice_id": "slice_1", "hw_set": [{"hw_id": "hw_2"}]}]}
+	]}`
+	gngs := `{"status": {"status_code": "SUCCESS"}, "gng_info": [{"gng_id": "gng_1", "admin_state": "FULLY_ACTIVATED", "slice_id": "slice_1"}]}`
+	for _, authType := range []string{"PASSWORD", "ADTOKEN"} {
+		t.Run(authType, func(t *testing.T) {
+			nhgResponse, gngResponse := activeNhgs, gngs
+			testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				switch r.URL.Path {
+				case "/nhgs":
+					fmt.Fprintln(w, nhgResponse)
+				case "/gngs":
+					fmt.Fprintln(w, gngResponse)
+				case "/orgs":
+					fmt.Fprintln(w, listOrgResp)
+				case "/accounts":
+					fmt.Fprintln(w, listAccResp)
+				}
+			}))
+			defer testServer.Close()
+			prevConf := config.Conf
+			config.Conf = config.Config{BaseURL: testServer.URL, UserAGAPIs: config.UserAGConf{ListOrgUUID: "/orgs", ListAccUUID: "/accounts"}}
+			defer func() { config.Conf = prevConf }()
+			CreateHTTPClient("", false)
+
+			api := &config.ListNetworkAPIConf{NhgAPI: "/nhgs", GngAPI: "/gngs", Interval: 60}
+			user := &config.User{Email: "replace_" + authType + "@nokia.com", AuthType: authType, ResponseDest: t.TempDir(), SessionToken: &config.SessionToken{}}
+			utils.CreateResponseDirectory(user.ResponseDest, api.NhgAPI)
+			utils.CreateResponseDirectory(user.ResponseDest, api.GngAPI)
+			activeNetworks := func() ([]string, []string) {
+				networks := config.NetworksFor(user)
+				if authType == "ADTOKEN" {
+					return slices.Sorted(maps.Keys(networks.NhgIDsABAC)), slices.Sorted(maps.Keys(networks.HwIDsABAC))
+				}
+				return slices.Sorted(slices.Values(networks.NhgIDs)), networks.HwIDs
+			}
+
+			fetchNetworkDetails(context.Background(), api, user, false)
+			first := config.NetworksFor(user)
+			nhgs, hwIDs := activeNetworks()
+			assert.Equal(t, []string{"gng_1", "nhg_1", "nhg_2"}, nhgs)
+			assert.Equal(t, []string{"hw_1", "hw_2"}, hwIDs)
+			assert.True(t, user.IsSessionAlive)
+
+			//networks aren't accumulated across the refreshes
+			fetchNetworkDetails(context.Background(), api, user, false)
+			nhgs, hwIDs = activeNetworks()
+			assert.Equal(t, []string{"gng_1", "nhg_1", "nhg_2"}, nhgs)
+			assert.Equal(t, []string{"hw_1", "hw_2"}, hwIDs)
+
+			//deactivated NHG and its hardware are removed, the earlier inventory isn't modified
+			nhgResponse = strings.Replace(activeNhgs, `"nhg_id": "nhg_2", "nhg_config_status": "ACTIVE"`, `"nhg_id": "nhg_2", "nhg_config_status": "NW_CFG_UNAVAILABLE"`, 1)
+			fetchNetworkDetails(context.Background(), api, user, false)
+			nhgs, hwIDs = activeNetworks()
+			assert.Equal(t, []string{"gng_1", "nhg_1"}, nhgs)
+			assert.Equal(t, []string{"hw_1"}, hwIDs)
+			assert.NotSame(t, first, config.NetworksFor(user))
+			assert.Equal(t, 3, len(first.NhgIDs)+len(first.NhgIDsABAC))
+
+			//earlier inventory is kept if the network list isn't fetched completely
+			fetched := user.NetworkFetched
+			gngResponse = "invalid"
+			fetchNetworkDetails(context.Background(), api, user, false)
+			nhgs, hwIDs = activeNetworks()
+			assert.Equal(t, []string{"gng_1", "nhg_1"}, nhgs)
+			assert.Equal(t, []string{"hw_1"}, hwIDs)
+			assert.True(t, user.NetworkFetched.Equal(fetched))
+		})
+	}
+}
+
+func TestFetchNetworkDetailsFiltersAllowedSlices(t *testing.T) {
+	//nhg_2 spans slice_1 and slice_2, nhg_3 and gng_2 are in slice_2 only
+	nhgs := `{"status": {"status_code": "SUCCESS"}, "network_info": [
+		{"nhg_id": "nhg_1", "nhg_config_status": "ACTIVE", "clusters": [{"cluster_id": "1", "slice_id": "slice_1", "hw_set": [{"hw_id": "hw_1"}]}]},
+		{"nhg_id": "nhg_2", "nhg_config_status": "ACTIVE", "clusters": [
+			{"cluster_id": "1", "slice_id": "slice_1", "hw_set": [{"hw_id": "hw_2"}]},
+			{"cluster_id": "2", "slice_id": "slice_2", "hw_set": [{"hw_id": "hw_3"}]}
+		]},
+		{"nhg_id": "nhg_3", "nhg_config_status": "ACTIVE", "clusters": [{"cluster_id": "1", "slice_id": "slice_2", "hw_set": [{"hw_id": "hw_4"}]}]}
+	]}`
+	gngs := `{"status": {"status_code": "SUCCESS"}, "gng_info": [
+		{"gng_id": "gng_1", "admin_state": "FULLY_ACTIVATED", "slice_id": "slice_1"},
+		{"gng_id": "gng_2", "admin_state": "FULLY_ACTIVATED", "slice_id": "slice_2"}
+	]}`
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/nhgs":
+			fmt.Fprintln(w, nhgs)
+		case "/gngs":
+			fmt.Fprintln(w, gngs)
+		case "/orgs":
+			fmt.Fprintln(w, listOrgResp)
+		case "/accounts":
+			fmt.Fprintln(w, listAccResp)
+		}
+	}))
+	defer testServer.Close()
+	prevConf := config.Conf
+	config.Conf = config.Config{BaseURL: testServer.URL, UserAGAPIs: config.UserAGConf{ListOrgUUID: "/orgs", ListAccUUID: "/accounts"}}
+	defer func() { config.Conf = prevConf }()
+	CreateHTTPClient("", false)
+
+	tests := []struct {
+		allowedSliceIDs []string
+		nhgIDs          []string
+		hwIDs           []string
+	}{
+		{[]string{"slice_1"}, []string{"gng_1", "nhg_1"}, []string{"hw_1"}},
+		{[]string{"slice_2"}, []string{"gng_2", "nhg_3"}, []string{"hw_4"}},
+		{[]string{"slice_1", "slice_2"}, []string{"gng_1", "gng_2", "nhg_1", "nhg_2", "nhg_3"}, []string{"hw_1", "hw_2", "hw_3", "hw_4"}},
+	}
+	for _, authType := range []string{"PASSWORD", "ADTOKEN"} {
+		for _, test := range tests {
+			api := &config.ListNetworkAPIConf{NhgAPI: "/nhgs", GngAPI: "/gngs", Interval: 60}
+			user := &config.User{Email: "slices_" + authType + "@nokia.com", AuthType: authType, AllowedSliceIDs: test.allowedSliceIDs, ResponseDest: t.TempDir(), SessionToken: &config.SessionToken{}}
+			utils.CreateResponseDirectory(user.ResponseDest, api.NhgAPI)
+			utils.CreateResponseDirectory(user.ResponseDest, api.GngAPI)
+
+			fetchNetworkDetails(context.Background(), api, user, false)
+			networks := config.NetworksFor(user)
+			nhgIDs, hwIDs := slices.Sorted(slices.Values(networks.NhgIDs)), slices.Sorted(slices.Values(networks.HwIDs))
+			if authType == "ADTOKEN" {
+				nhgIDs, hwIDs = slices.Sorted(maps.Keys(networks.NhgIDsABAC)), slices.Sorted(maps.Keys(networks.HwIDsABAC))
+			}
+			assert.Equal(t, test.nhgIDs, nhgIDs, "%s slices %v", authType, test.allowedSliceIDs)
+			assert.Equal(t, test.hwIDs, hwIDs, "%s slices %v", authType, test.allowedSliceIDs)
+			assert.True(t, user.IsSessionAlive)
+		}
+	}
+}
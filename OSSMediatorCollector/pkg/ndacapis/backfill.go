@@ -0,0 +1,167 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BackfillRequest keeps the details of the historical PM/FM data to be collected for user's API.
+type BackfillRequest struct {
+	User        *config.User
+	API         *config.APIConf
+	NhgIDs      []string  //NHGs for which data is collected, all the user's NHGs if empty
+	From        time.Time //start time of the data, truncated to API's interval
+	To          time.Time //end time of the data
+	Concurrency int       //no. of concurrent API calls, independent of max_concurrent_process
+}
+
+// Window is the time range of a backfill API call.
+type Window struct {
+	NhgID     string
+	StartTime string
+	EndTime   string
+}
+
+// Backfill collects the PM/FM data between From and To by calling the API in API interval sized windows for each NHG.
+// The data is written through the configured sink as for the periodic calls, the checkpoints aren't updated
+// and alarm notifications aren't raised.
+// Returns the windows for which the API call failed, they can be backfilled again. Once ctx is cancelled the API calls
+// are aborted and the remaining windows are returned as failed.
+func Backfill(ctx context.Context, req BackfillRequest) ([]Window, error) {
+	if req.API.Interval <= 0 {
+		return nil, fmt.Errorf("API call interval can't be zero")
+	}
+	baseAPI := path.Base(req.API.API)
+	if baseAPI != "pmdata" && baseAPI != fmResponseType {
+		return nil, fmt.Errorf("backfill is supported only for pmdata and fmdata APIs")
+	}
+	if baseAPI == fmResponseType && req.API.Type == "ACTIVE" {
+		return nil, fmt.Errorf("backfill isn't supported for ACTIVE fmdata, as it doesn't accept time range")
+	}
+	if !req.From.Before(req.To) {
+		return nil, fmt.Errorf("backfill start time %v should be before end time %v", req.From, req.To)
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = 1
+	}
+
+	//fetch the user's networks, so that the access restrictions of the periodic calls are applied
+	conf := config.Current()
+	if conf.ListNetworkAPI != nil {
+		fetchNetworkDetails(ctx, conf.ListNetworkAPI, req.User, conf.PrettyResponse)
+	}
+	nhgs, err := backfillNhgs(ctx, req.User, req.NhgIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	windows := backfillWindows(req.From, req.To, time.Duration(req.API.Interval)*time.Minute)
+	log.Infof("Backfilling %s for %s, %d NHGs, %d windows from %s to %s", req.API.API, req.User.Email, len(nhgs), len(windows), windows[0].StartTime, windows[len(windows)-1].EndTime)
+
+	var failed []Window
+	var failedMux sync.Mutex
+	wg := sync.WaitGroup{}
+	requests := make(chan struct{}, req.Concurrency)
+	for nhgID, accDetail := range nhgs {
+		for _, window := range windows {
+			window.NhgID = nhgID
+			requests <- struct{}{}
+			wg.Add(1)
+			go func(window Window, accDetail config.OrgAccDetails) {
+				defer wg.Done()
+				apiReq := apiCallRequest{
+					api:       req.API,
+					user:      req.User,
+					nhgID:     window.NhgID,
+					startTime: window.StartTime,
+					endTime:   window.EndTime,
+					index:     0,
+					limit:     conf.Limit,
+					orgUUID:   accDetail.OrgDetails.OrgUUID,
+					accUUID:   accDetail.AccDetails.AccUUID,
+					backfill:  true,
+				}
+				tid := atomic.AddUint64(&txnID, 1)
+				msg := callMetricAPI(ctx, apiReq, conf.Retry.MaxAttempts, tid, conf.PrettyResponse)
+				if msg == retryCurrentMsg {
+					msg = callMetricAPI(ctx, apiReq, 0, tid, conf.PrettyResponse)
+				}
+				if msg != "" {
+					log.WithFields(log.Fields{"tid": tid, "nhg_id": window.NhgID, "start_time": window.StartTime, "end_time": window.EndTime}).Errorf("Backfill of %s failed for %s", req.API.API, req.User.Email)
+					failedMux.Lock()
+					failed = append(failed, window)
+					failedMux.Unlock()
+				}
+				<-requests
+			}(window, accDetail)
+		}
+	}
+	wg.Wait()
+
+	slices.SortFunc(failed, func(a, b Window) int {
+		return strings.Compare(a.NhgID+a.StartTime, b.NhgID+b.StartTime)
+	})
+	return failed, nil
+}
+
+// returns the user's NHGs to be backfilled along with their org and account details, which are set only for ABAC users.
+func backfillNhgs(ctx context.Context, user *config.User, nhgIDs []string) (map[string]config.OrgAccDetails, error) {
+	networks := config.NetworksFor(user)
+	userNhgs := make(map[string]config.OrgAccDetails)
+	if strings.ToUpper(user.AuthType) == "ADTOKEN" {
+		for nhgID, accDetail := range networks.NhgIDsABAC {
+			userNhgs[nhgID] = accDetail
+		}
+	} else {
+		for _, nhgID := range networks.NhgIDs {
+			userNhgs[nhgID] = config.OrgAccDetails{}
+		}
+	}
+	if len(nhgIDs) == 0 {
+		if len(userNhgs) == 0 {
+			return nil, fmt.Errorf("no active NHG found for %s", user.Email)
+		}
+		return userNhgs, nil
+	}
+
+	nhgs := make(map[string]config.OrgAccDetails)
+	for _, nhgID := range nhgIDs {
+		accDetail, ok := userNhgs[nhgID]
+		if !ok {
+			return nil, fmt.Errorf("NHG %s isn't an active NHG of %s", nhgID, user.Email)
+		}
+		nhgs[nhgID] = accDetail
+	}
+	return nhgs, nil
+}
+
+// splits from-to time range into windows of interval size, aligned to the interval as the periodic calls.
+func backfillWindows(from, to time.Time, interval time.Duration) []Window {
+	var windows []Window
+	for start := from.UTC().Truncate(interval); start.Before(to); start = start.Add(interval) {
+		end := start.Add(interval)
+		if end.After(to) {
+			end = to
+		}
+		windows = append(windows, Window{
+			StartTime: start.Format(time.RFC3339),
+			EndTime:   end.UTC().Format(time.RFC3339),
+		})
+	}
+	return windows
+}
@@ -0,0 +1,118 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/checkpoint"
+	"collector/pkg/config"
+	"collector/pkg/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBackfillWindows(t *testing.T) {
+	from, _ := time.Parse(time.RFC3339, "2020-10-30T13:05:00Z")
+	to, _ := time.Parse(time.RFC3339, "2020-10-30T13:50:00Z")
+	windows := backfillWindows(from, to, 15*time.Minute)
+	expected := []Window{
+		{StartTime: "2020-10-30T13:00:00Z", EndTime: "2020-10-30T13:15:00Z"},
+		{StartTime: "2020-10-30T13:15:00Z", EndTime: "2020-10-30T13:30:00Z"},
+		{StartTime: "2020-10-30T13:30:00Z", EndTime: "2020-10-30T13:45:00Z"},
+		{StartTime: "2020-10-30T13:45:00Z", EndTime: "2020-10-30T13:50:00Z"},
+	}
+	if fmt.Sprint(windows) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, windows)
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	var startTimes []string
+	var mu sync.Mutex
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		startTime := r.URL.Query().Get(startTimeQueryParam)
+		mu.Lock()
+		startTimes = append(startTimes, startTime)
+		mu.Unlock()
+		if startTime == "2020-10-30T13:15:00Z" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, fmResponse)
+	}))
+	defer testServer.Close()
+
+	err := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+
+	user := &config.User{Email: "testuser@nokia.com", IsSessionAlive: true, ResponseDest: t.TempDir()}
+	config.SetNetworks(user, &config.NetworkSnapshot{NhgIDs: []string{"test_nhg_1"}}, utils.CurrentTime())
+	user.SessionToken = &config.SessionToken{AccessToken: "accessToken", RefreshToken: "refreshToken", ExpiryTime: utils.CurrentTime()}
+	api := &config.APIConf{API: "/fmdata", Interval: 15, Type: "HISTORY", MetricType: "RADIO"}
+	CreateHTTPClient("", true)
+	config.Conf.BaseURL = testServer.URL
+	tmp := config.Conf.ListNetworkAPI
+	config.Conf.ListNetworkAPI = nil
+	defer func() { config.Conf.ListNetworkAPI = tmp }()
+	utils.CreateResponseDirectory(user.ResponseDest, api.API)
+
+	from, _ := time.Parse(time.RFC3339, "2020-10-30T13:05:00Z")
+	to, _ := time.Parse(time.RFC3339, "2020-10-30T13:50:00Z")
+	failed, err := Backfill(context.Background(), BackfillRequest{User: user, API: api, From: from, To: to, Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(startTimes)
+	if fmt.Sprint(startTimes) != "[2020-10-30T13:00:00Z 2020-10-30T13:15:00Z 2020-10-30T13:30:00Z 2020-10-30T13:45:00Z]" {
+		t.Errorf("unexpected API calls: %v", startTimes)
+	}
+	if len(failed) != 1 || failed[0] != (Window{NhgID: "test_nhg_1", StartTime: "2020-10-30T13:15:00Z", EndTime: "2020-10-30T13:30:00Z"}) {
+		t.Errorf("unexpected failed windows: %v", failed)
+	}
+	files, _ := os.ReadDir(user.ResponseDest + api.API)
+	if len(files) != 3 {
+		t.Errorf("expected 3 response files, got %d", len(files))
+	}
+	//live checkpoint isn't updated by backfill
+	if value, _ := checkpoint.Get(checkpoint.KeyFor(user, api, "test_nhg_1")); value != "" {
+		t.Errorf("expected no checkpoint, got %s", value)
+	}
+}
+
+func TestBackfillWithInvalidRequest(t *testing.T) {
+	user := &config.User{Email: "testuser@nokia.com"}
+	config.SetNetworks(user, &config.NetworkSnapshot{NhgIDs: []string{"test_nhg_1"}}, time.Now())
+	from, _ := time.Parse(time.RFC3339, "2020-10-30T13:00:00Z")
+	to := from.Add(time.Hour)
+	tmp := config.Conf.ListNetworkAPI
+	config.Conf.ListNetworkAPI = nil
+	defer func() { config.Conf.ListNetworkAPI = tmp }()
+
+	tests := []BackfillRequest{
+		{User: user, API: &config.APIConf{API: "/sims", Interval: 15}, From: from, To: to},
+		{User: user, API: &config.APIConf{API: "/fmdata", Interval: 15, Type: "ACTIVE"}, From: from, To: to},
+		{User: user, API: &config.APIConf{API: "/pmdata", Interval: 15}, From: to, To: from},
+		{User: user, API: &config.APIConf{API: "/pmdata", Interval: 15}, From: from, To: to, NhgIDs: []string{"test_nhg_2"}},
+	}
+	for _, req := range tests {
+		if _, err := Backfill(context.Background(), req); err == nil {
+			t.Errorf("expected error for %+v", req)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/metrics"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Circuit breaker states
+const (
+	circuitClosed   = "closed"    //calls are allowed
+	circuitOpen     = "open"      //calls are short-circuited until open_timeout elapses
+	circuitHalfOpen = "half-open" //a single trial call is allowed, its result closes or opens the circuit again
+)
+
+var (
+	//circuit breakers per endpoint
+	circuitBreakers   = map[string]*circuitBreaker{}
+	circuitBreakerMux = sync.Mutex{}
+
+	//used for open timeout, overridden in tests
+	circuitNow = time.Now
+)
+
+// circuitOpenError is returned when the call is short-circuited as the endpoint's circuit is open.
+type circuitOpenError struct {
+	endpoint string
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker is open for %s", e.endpoint)
+}
+
+// circuitBreaker tracks the consecutive failures of an endpoint.
+type circuitBreaker struct {
+	mux      sync.Mutex
+	endpoint string
+	state    string
+	failures int
+	openedAt time.Time
+	//true while the trial call of half-open state is in progress
+	probing bool
+}
+
+// CircuitBreakerStatus is the current state of an endpoint's circuit breaker.
+type CircuitBreakerStatus struct {
+	Endpoint string     `json:"endpoint"`
+	State    string     `json:"state"`
+	Failures int        `json:"consecutive_failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+// returns the endpoint's circuit breaker, creating it on first call.
+func circuitFor(endpoint string) *circuitBreaker {
+	circuitBreakerMux.Lock()
+	defer circuitBreakerMux.Unlock()
+	cb, ok := circuitBreakers[endpoint]
+	if !ok {
+		cb = &circuitBreaker{endpoint: endpoint, state: circuitClosed}
+		circuitBreakers[endpoint] = cb
+	}
+	return cb
+}
+
+// returns the endpoint of the API in the user's console, used as the circuit breaker key.
+func endpointOf(user *config.User, api string) string {
+	return config.BaseURLFor(user) + api
+}
+
+// isCircuitOpen returns true if the endpoint's circuit is open and its open_timeout isn't elapsed yet.
+// Unlike allow, it doesn't change the state, used to skip a whole run of an API.
+func isCircuitOpen(endpoint string) bool {
+	if config.Current().CircuitBreaker.FailureThreshold <= 0 {
+		return false
+	}
+	cb := circuitFor(endpoint)
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	return cb.state == circuitOpen && circuitNow().Sub(cb.openedAt) < openTimeout()
+}
+
+// allow returns error if the call has to be short-circuited.
+// Once open_timeout elapses the circuit becomes half-open and only one trial call is allowed until its result is recorded.
+func (cb *circuitBreaker) allow() error {
+	if config.Current().CircuitBreaker.FailureThreshold <= 0 {
+		return nil
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	switch cb.state {
+	case circuitOpen:
+		if circuitNow().Sub(cb.openedAt) < openTimeout() {
+			return &circuitOpenError{endpoint: cb.endpoint}
+		}
+		cb.setState(circuitHalfOpen)
+	case circuitHalfOpen:
+		if cb.probing {
+			return &circuitOpenError{endpoint: cb.endpoint}
+		}
+	default:
+		return nil
+	}
+	cb.probing = true
+	return nil
+}
+
+// record updates the circuit with the result of the call. Only the errors which are retried (429, 5xx and network
+// errors) are counted as failures, other errors like 404 show that the endpoint is reachable.
+func (cb *circuitBreaker) record(err error) {
+	threshold := config.Current().CircuitBreaker.FailureThreshold
+	if threshold <= 0 {
+		return
+	}
+	//short-circuited calls don't show the endpoint's health, and aren't the trial call of half-open state
+	if _, ok := err.(*circuitOpenError); ok {
+		return
+	}
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.probing = false
+	//aborted calls, the calls abandoned while waiting for the rate limit and the calls failed due to invalid TLS config
+	//don't show the endpoint's health either, but the trial call is over, so that the next call is allowed as the trial call
+	var waitErr *rateLimitWaitError
+	var transportErr *transportError
+	if errors.Is(err, context.Canceled) || errors.As(err, &waitErr) || errors.As(err, &transportErr) {
+		return
+	}
+	if err == nil || !isRetryable(err) {
+		cb.failures = 0
+		if cb.state != circuitClosed {
+			cb.setState(circuitClosed)
+		}
+		return
+	}
+
+	cb.failures++
+	if cb.state == circuitHalfOpen || (cb.state == circuitClosed && cb.failures >= threshold) {
+		cb.openedAt = circuitNow()
+		cb.setState(circuitOpen)
+	}
+}
+
+// changes the state and logs the transition, called with cb.mux locked.
+func (cb *circuitBreaker) setState(state string) {
+	log.WithFields(log.Fields{"endpoint": cb.endpoint, "consecutive_failures": cb.failures}).Warnf("Circuit breaker state changed from %s to %s", cb.state, state)
+	cb.state = state
+	switch state {
+	case circuitClosed:
+		metrics.SetCircuitState(cb.endpoint, 0)
+	case circuitOpen:
+		metrics.SetCircuitState(cb.endpoint, 1)
+	case circuitHalfOpen:
+		metrics.SetCircuitState(cb.endpoint, 2)
+	}
+}
+
+func openTimeout() time.Duration {
+	return time.Duration(config.Current().CircuitBreaker.OpenTimeout) * time.Second
+}
+
+// GetCircuitBreakerStatus returns the circuit breaker state of all the endpoints called so far, sorted by endpoint.
+func GetCircuitBreakerStatus() []CircuitBreakerStatus {
+	circuitBreakerMux.Lock()
+	breakers := make([]*circuitBreaker, 0, len(circuitBreakers))
+	for _, cb := range circuitBreakers {
+		breakers = append(breakers, cb)
+	}
+	circuitBreakerMux.Unlock()
+
+	status := make([]CircuitBreakerStatus, 0, len(breakers))
+	for _, cb := range breakers {
+		cb.mux.Lock()
+		s := CircuitBreakerStatus{Endpoint: cb.endpoint, State: cb.state, Failures: cb.failures}
+		if cb.state != circuitClosed {
+			openedAt := cb.openedAt
+			s.OpenedAt = &openedAt
+		}
+		cb.mux.Unlock()
+		status = append(status, s)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Endpoint < status[j].Endpoint })
+	return status
+}
+
+// CircuitBreakerHandler serves the circuit breaker state of all the endpoints as JSON.
+func CircuitBreakerHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(GetCircuitBreakerStatus())
+}
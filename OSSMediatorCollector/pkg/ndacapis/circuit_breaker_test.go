@@ -0,0 +1,163 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// enables the circuit breaker with a fake clock, the breakers and config are reset when the test ends.
+func setTestCircuitBreaker(t *testing.T, threshold int, openTimeout int) *time.Time {
+	t.Helper()
+	now := time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+	prevConf := config.Conf.CircuitBreaker
+	config.Conf.CircuitBreaker = config.CircuitBreakerConf{FailureThreshold: threshold, OpenTimeout: openTimeout}
+	circuitNow = func() time.Time { return now }
+	t.Cleanup(func() {
+		config.Conf.CircuitBreaker = prevConf
+		circuitNow = time.Now
+		circuitBreakerMux.Lock()
+		circuitBreakers = map[string]*circuitBreaker{}
+		circuitBreakerMux.Unlock()
+	})
+	return &now
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	now := setTestCircuitBreaker(t, 2, 60)
+	cb := circuitFor("https://localhost/api/v2/fmdata")
+	serverErr := &APIError{StatusCode: http.StatusServiceUnavailable}
+
+	assert.Nil(t, cb.allow())
+	cb.record(serverErr)
+	assert.Equal(t, circuitClosed, cb.state)
+	//non retryable errors reset the failures
+	cb.record(&APIError{StatusCode: http.StatusNotFound})
+	cb.record(serverErr)
+	assert.Equal(t, circuitClosed, cb.state)
+	cb.record(serverErr)
+	assert.Equal(t, circuitOpen, cb.state)
+	assert.True(t, isCircuitOpen("https://localhost/api/v2/fmdata"))
+
+	var openErr *circuitOpenError
+	assert.True(t, errors.As(cb.allow(), &openErr))
+	assert.False(t, isRetryable(openErr))
+
+	//single trial call is allowed after open timeout
+	*now = now.Add(time.Minute)
+	assert.False(t, isCircuitOpen("https://localhost/api/v2/fmdata"))
+	assert.Nil(t, cb.allow())
+	assert.Equal(t, circuitHalfOpen, cb.state)
+	assert.NotNil(t, cb.allow())
+
+	//failed trial call opens the circuit again
+	cb.record(serverErr)
+	assert.Equal(t, circuitOpen, cb.state)
+	assert.NotNil(t, cb.allow())
+
+	*now = now.Add(time.Minute)
+	assert.Nil(t, cb.allow())
+	cb.record(nil)
+	assert.Equal(t, circuitClosed, cb.state)
+	assert.Equal(t, 0, cb.failures)
+	assert.Nil(t, cb.allow())
+}
+
+func TestCircuitBreakerAbortedTrialCall(t *testing.T) {
+	now := setTestCircuitBreaker(t, 1, 60)
+	cb := circuitFor("https://localhost/api/v2/fmdata")
+	cb.record(&APIError{StatusCode: http.StatusServiceUnavailable})
+	assert.Equal(t, circuitOpen, cb.state)
+
+	//aborted trial calls keep the circuit half-open and allow the next trial call
+	*now = now.Add(time.Minute)
+	for _, err := range []error{context.Canceled, &rateLimitWaitError{err: context.DeadlineExceeded}} {
+		assert.Nil(t, cb.allow())
+		assert.NotNil(t, cb.allow())
+		cb.record(err)
+		assert.Equal(t, circuitHalfOpen, cb.state)
+		assert.False(t, cb.probing)
+	}
+
+	//short-circuited calls don't end the trial call
+	assert.Nil(t, cb.allow())
+	cb.record(&circuitOpenError{endpoint: cb.endpoint})
+	assert.True(t, cb.probing)
+	cb.record(nil)
+	assert.Equal(t, circuitClosed, cb.state)
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	setTestCircuitBreaker(t, 0, 60)
+	cb := circuitFor("https://localhost/api/v2/fmdata")
+	for i := 0; i < 10; i++ {
+		cb.record(&APIError{StatusCode: http.StatusServiceUnavailable})
+	}
+	assert.Nil(t, cb.allow())
+	assert.False(t, isCircuitOpen("https://localhost/api/v2/fmdata"))
+}
+
+func TestDoRequestWithRetryShortCircuits(t *testing.T) {
+	setTestCircuitBreaker(t, 2, 60)
+	setTestRetryPolicy(t, config.RetryConf{MaxAttempts: 5, InitialBackoff: 1, MaxBackoff: 60, Multiplier: 2, MaxRetryAfter: 60})
+	count := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer testServer.Close()
+	CreateHTTPClient("", false)
+	config.Conf.BaseURL = testServer.URL
+	user := &config.User{Email: "testuser@nokia.com", SessionToken: &config.SessionToken{AccessToken: "accessToken"}}
+	api := &config.APIConf{API: "/network-hardware-groups"}
+
+	request, _ := http.NewRequest(http.MethodGet, testServer.URL+api.API, nil)
+	_, err := doRequestWithRetry(context.Background(), request, user, api, 123)
+	var openErr *circuitOpenError
+	assert.True(t, errors.As(err, &openErr))
+	assert.Equal(t, 2, count)
+
+	//calls aren't sent while the circuit is open
+	request, _ = http.NewRequest(http.MethodGet, testServer.URL+api.API, nil)
+	_, err = doRequestWithRetry(context.Background(), request, user, api, 124)
+	assert.True(t, errors.As(err, &openErr))
+	assert.Equal(t, 2, count)
+
+	status := GetCircuitBreakerStatus()
+	assert.Len(t, status, 1)
+	assert.Equal(t, testServer.URL+api.API, status[0].Endpoint)
+	assert.Equal(t, circuitOpen, status[0].State)
+	assert.Equal(t, 2, status[0].Failures)
+	assert.NotNil(t, status[0].OpenedAt)
+}
+
+func TestCircuitBreakerHandler(t *testing.T) {
+	setTestCircuitBreaker(t, 1, 60)
+	circuitFor("https://localhost/api/v2/sims").record(&APIError{StatusCode: http.StatusInternalServerError})
+	circuitFor("https://localhost/api/v2/pmdata").record(nil)
+
+	recorder := httptest.NewRecorder()
+	CircuitBreakerHandler(recorder, httptest.NewRequest(http.MethodGet, "/circuit_breakers", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var status []CircuitBreakerStatus
+	assert.Nil(t, json.NewDecoder(recorder.Body).Decode(&status))
+	assert.Len(t, status, 2)
+	assert.Equal(t, "https://localhost/api/v2/pmdata", status[0].Endpoint)
+	assert.Equal(t, "https://localhost/api/v2/sims", status[1].Endpoint)
+	assert.Equal(t, circuitClosed, status[0].State)
+	assert.Nil(t, status[0].OpenedAt)
+	assert.Equal(t, circuitOpen, status[1].State)
+}
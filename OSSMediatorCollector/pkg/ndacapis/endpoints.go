@@ -0,0 +1,114 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// context key of the user making the request, used to select the user's console transport and token bucket.
+type requestUserKey struct{}
+
+// withUser returns the request with the user in its context.
+func withUser(request *http.Request, user *config.User) *http.Request {
+	if user == nil {
+		return request
+	}
+	return request.WithContext(context.WithValue(request.Context(), requestUserKey{}, user))
+}
+
+// returns the user making the request, nil if it isn't set.
+func requestUser(request *http.Request) *config.User {
+	user, _ := request.Context().Value(requestUserKey{}).(*config.User)
+	return user
+}
+
+// endpointTransport sends the request with the transport of the user's console, so that the users of different
+// consoles can use different proxy and TLS config. Transports are created on first request per base URL, proxy and
+// TLS config, and reused by the users having the same config.
+type endpointTransport struct {
+	//TLS config from the command line options, used for the users without tls config
+	defaultTLS config.TLSConf
+
+	mux        sync.Mutex
+	transports map[string]*http.Transport
+}
+
+func newEndpointTransport(defaultTLS config.TLSConf) *endpointTransport {
+	return &endpointTransport{defaultTLS: defaultTLS, transports: make(map[string]*http.Transport)}
+}
+
+// transportError is returned when the transport of the user's console can't be created, ex: client certificate can't
+// be read. The requests of the console fail until its config is fixed, they aren't retried.
+type transportError struct {
+	err error
+}
+
+func (e *transportError) Error() string {
+	return fmt.Sprintf("unable to create transport: %v", e.err)
+}
+
+func (e *transportError) Unwrap() error {
+	return e.err
+}
+
+func (t *endpointTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	tr, err := t.transportFor(requestUser(request))
+	if err != nil {
+		return nil, err
+	}
+	return tr.RoundTrip(request)
+}
+
+// returns the transport of the user's console, creating it on first call.
+// The transport isn't stored if it can't be created, so that it's created again on next request.
+func (t *endpointTransport) transportFor(user *config.User) (*http.Transport, error) {
+	tlsConf := t.defaultTLS
+	if user != nil && user.TLS != nil {
+		tlsConf = *user.TLS
+	}
+	proxy := config.ProxyFor(user)
+	key := fmt.Sprintf("%s %+v %+v", config.BaseURLFor(user), proxy, tlsConf)
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	tr, ok := t.transports[key]
+	if !ok {
+		var err error
+		tr, err = newTransport(tlsConf, proxy)
+		if err != nil {
+			return nil, &transportError{err: err}
+		}
+		t.transports[key] = tr
+	}
+	return tr, nil
+}
+
+// creates the transport with the TLS and proxy config, returns error if the TLS config is invalid.
+func newTransport(tlsConf config.TLSConf, proxy config.ProxyConfig) (*http.Transport, error) {
+	tlsConfig, err := utils.TLSConfig(tlsConf)
+	if err != nil {
+		return nil, err
+	}
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+
+	if proxy.Enabled {
+		if proxy.Mode == "SYSTEM" {
+			tr.Proxy = http.ProxyFromEnvironment
+		} else if proxy.Mode == "CONFIG" {
+			proxyURL, _ := url.Parse(proxy.URL)
+			tr.Proxy = http.ProxyURL(proxyURL)
+		}
+	}
+	return tr, nil
+}
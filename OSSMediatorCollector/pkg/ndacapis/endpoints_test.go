@@ -0,0 +1,143 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestsSentToUsersConsole(t *testing.T) {
+	var globalCalls, stagingCalls []string
+	global := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		globalCalls = append(globalCalls, r.URL.Path)
+		fmt.Fprint(w, "{}")
+	}))
+	defer global.Close()
+	//staging console's certificate isn't trusted by the global TLS config
+	staging := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stagingCalls = append(stagingCalls, r.URL.Path)
+		fmt.Fprint(w, "{}")
+	}))
+	defer staging.Close()
+
+	prevConf := config.Conf
+	defer func() {
+		config.Conf = prevConf
+		CreateHTTPClient("", false)
+	}()
+	config.Conf = config.Config{BaseURL: global.URL, UMAPIs: config.UMConf{Logout: "/logout"}}
+	CreateHTTPClient("", false)
+	user1 := &config.User{Email: "user1@nokia.com", SessionToken: &config.SessionToken{}}
+	user2 := &config.User{Email: "user2@nokia.com", SessionToken: &config.SessionToken{}, BaseURL: staging.URL, UMAPIs: &config.UMConf{Logout: "/v2/logout"}}
+
+	assert.Nil(t, Logout(user1))
+	//untrusted certificate
+	assert.NotNil(t, Logout(user2))
+	user2.TLS = &config.TLSConf{InsecureSkipVerify: true}
+	assert.Nil(t, Logout(user2))
+	assert.Equal(t, []string{"/logout"}, globalCalls)
+	assert.Equal(t, []string{"/v2/logout"}, stagingCalls)
+
+	request, _ := http.NewRequest(http.MethodGet, config.BaseURLFor(user2)+"/pmdata", nil)
+	_, err := doRequest(context.Background(), request, user2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"/v2/logout", "/pmdata"}, stagingCalls)
+}
+
+func TestEndpointTransportReused(t *testing.T) {
+	prevConf := config.Conf
+	defer func() { config.Conf = prevConf }()
+	config.Conf = config.Config{BaseURL: "https://global.example.com"}
+	transport := newEndpointTransport(config.TLSConf{})
+
+	transportFor := func(user *config.User) *http.Transport {
+		tr, err := transport.transportFor(user)
+		assert.Nil(t, err)
+		return tr
+	}
+	global := transportFor(nil)
+	assert.Same(t, global, transportFor(&config.User{Email: "user1@nokia.com"}))
+	staging := transportFor(&config.User{Email: "user2@nokia.com", BaseURL: "https://staging.example.com"})
+	assert.NotSame(t, global, staging)
+	assert.Same(t, staging, transportFor(&config.User{Email: "user3@nokia.com", BaseURL: "https://staging.example.com"}))
+	assert.NotSame(t, staging, transportFor(&config.User{Email: "user3@nokia.com", BaseURL: "https://staging.example.com", TLS: &config.TLSConf{InsecureSkipVerify: true}}))
+}
+
+func TestRequestsWithInvalidTLSConfig(t *testing.T) {
+	calls := 0
+	console := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprint(w, "{}")
+	}))
+	defer console.Close()
+
+	prevConf := config.Conf
+	defer func() {
+		config.Conf = prevConf
+		CreateHTTPClient("", false)
+	}()
+	config.Conf = config.Config{BaseURL: console.URL, UMAPIs: config.UMConf{Logout: "/logout"}}
+	CreateHTTPClient("", false)
+
+	//requests of the console with invalid TLS config fail without falling back to the default TLS config
+	user := &config.User{Email: "user1@nokia.com", SessionToken: &config.SessionToken{}, TLS: &config.TLSConf{ClientCertFile: "./non_existing.crt", ClientKeyFile: "./non_existing.key"}}
+	err := Logout(user)
+	var transportErr *transportError
+	assert.True(t, errors.As(err, &transportErr))
+	assert.False(t, isRetryable(err))
+	assert.Equal(t, 0, calls)
+
+	//other consoles aren't affected
+	assert.Nil(t, Logout(&config.User{Email: "user2@nokia.com", SessionToken: &config.SessionToken{}}))
+	assert.Equal(t, 1, calls)
+}
+
+func TestRequestsWithClientCertificate(t *testing.T) {
+	console := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{}")
+	}))
+	console.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	console.StartTLS()
+	defer console.Close()
+
+	//console's own certificate is used as client certificate
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	keyDER, err := x509.MarshalPKCS8PrivateKey(console.TLS.Certificates[0].PrivateKey)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: console.TLS.Certificates[0].Certificate[0]}), 0600))
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	prevConf := config.Conf
+	defer func() {
+		config.Conf = prevConf
+		CreateHTTPClient("", false)
+	}()
+	config.Conf = config.Config{BaseURL: console.URL, UMAPIs: config.UMConf{Logout: "/logout"}, TLS: config.TLSConf{InsecureSkipVerify: true}}
+	CreateHTTPClient("", false)
+	//client certificate is required
+	assert.NotNil(t, Logout(&config.User{Email: "user1@nokia.com", SessionToken: &config.SessionToken{}}))
+
+	config.Conf.TLS.ClientCertFile = certFile
+	config.Conf.TLS.ClientKeyFile = keyFile
+	CreateHTTPClient("", false)
+	assert.Nil(t, Logout(&config.User{Email: "user1@nokia.com", SessionToken: &config.SessionToken{}}))
+}
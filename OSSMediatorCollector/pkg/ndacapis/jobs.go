@@ -0,0 +1,178 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/schedule"
+	"collector/pkg/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// job triggers an API of a user periodically until it's stopped.
+type job struct {
+	stop context.CancelFunc
+	//identifies the user and API config the job was started with, the job is restarted if it changes
+	fingerprint string
+}
+
+// jobSpec describes a job expected to run for the current config.
+type jobSpec struct {
+	key         string
+	fingerprint string
+	network     bool
+	start       func(ctx context.Context)
+}
+
+var (
+	//jobs running per user and API, keyed by network/<email>, metric/<email>/<api>/<metric_type>/<type> or sim/<email>/<api>
+	jobs   = map[string]*job{}
+	jobMux = sync.Mutex{}
+
+	//set by StartDataCollection, jobs are stopped once collectionCtx is cancelled and API calls are made with apiCallCtx
+	collectionCtx = context.Background()
+	apiCallCtx    = context.Background()
+)
+
+// SyncJobs starts and stops the jobs to match the current config. Jobs of removed users and APIs are stopped, jobs whose
+// user or API config changed are restarted, new jobs are started and the unchanged jobs keep running.
+// The API calls in progress of the stopped jobs complete in the background.
+// The jobs are started after jobMux is released, as starting the network job fetches the network details, so that the
+// other job changes and shutdown aren't blocked by the network API calls.
+func SyncJobs() {
+	type startingJob struct {
+		spec jobSpec
+		ctx  context.Context
+	}
+	var starting []startingJob
+
+	jobMux.Lock()
+	specs := jobSpecs()
+	wanted := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		wanted[spec.key] = spec.fingerprint
+	}
+	for key, j := range jobs {
+		if fingerprint, ok := wanted[key]; ok && fingerprint == j.fingerprint {
+			continue
+		}
+		j.stop()
+		delete(jobs, key)
+		log.Infof("Stopped %s", key)
+	}
+
+	//the network details are fetched, or restored from the stored inventory, before the other jobs are started, as they
+	//are needed for the metric APIs
+	sort.SliceStable(specs, func(i, j int) bool { return specs[i].network && !specs[j].network })
+	for _, spec := range specs {
+		if _, ok := jobs[spec.key]; ok {
+			continue
+		}
+		ctx, stop := context.WithCancel(collectionCtx)
+		jobs[spec.key] = &job{stop: stop, fingerprint: spec.fingerprint}
+		starting = append(starting, startingJob{spec: spec, ctx: ctx})
+	}
+	jobMux.Unlock()
+
+	for _, j := range starting {
+		//job is stopped by another sync or shutdown while the earlier jobs were starting
+		if j.ctx.Err() != nil {
+			continue
+		}
+		j.spec.start(j.ctx)
+		log.Infof("Started %s", j.spec.key)
+	}
+}
+
+// returns the jobs expected to run for the current config.
+func jobSpecs() []jobSpec {
+	callCtx := apiCallCtx
+	conf := config.Current()
+	prettyResponse := conf.PrettyResponse
+	delay := conf.Delay
+	var specs []jobSpec
+	for _, user := range conf.Users {
+		if api := conf.ListNetworkAPI; api != nil {
+			specs = append(specs, jobSpec{
+				key:         "network/" + user.Email,
+				fingerprint: fingerprint(user, api, prettyResponse, delay),
+				network:     true,
+				start: func(ctx context.Context) {
+					//the restored inventory is used until the network list is fetched, so the other jobs aren't blocked
+					if restoreNetworkDetails(user) {
+						go run(func() { fetchNetworkDetails(callCtx, api, user, prettyResponse) })
+					} else {
+						run(func() { fetchNetworkDetails(callCtx, api, user, prettyResponse) })
+					}
+					ticker := time.NewTicker(time.Duration(api.Interval) * time.Minute)
+					go triggerNetworkAPI(ctx, callCtx, ticker, api, user, prettyResponse)
+				},
+			})
+		}
+		for _, api := range conf.MetricAPIs {
+			specs = append(specs, jobSpec{
+				key:         fmt.Sprintf("metric/%s/%s/%s/%s", user.Email, api.API, api.MetricType, api.Type),
+				fingerprint: fingerprint(user, api, prettyResponse, delay),
+				start: func(ctx context.Context) {
+					go scheduleAPI(ctx, callCtx, api, user, prettyResponse, delay, fetchMetricsData)
+				},
+			})
+		}
+		for _, api := range conf.SimAPIs {
+			specs = append(specs, jobSpec{
+				key:         fmt.Sprintf("sim/%s/%s", user.Email, api.API),
+				fingerprint: fingerprint(user, api, prettyResponse, delay),
+				start: func(ctx context.Context) {
+					go scheduleAPI(ctx, callCtx, api, user, prettyResponse, delay, fetchSimData)
+				},
+			})
+		}
+	}
+	return specs
+}
+
+// returns the fingerprint of the job's config, the user is compared by identity so that a user replaced on reload
+// restarts its jobs.
+func fingerprint(user *config.User, api interface{}, prettyResponse bool, delay int) string {
+	apiConf, _ := json.Marshal(api)
+	return fmt.Sprintf("%p %t %d %s", user, prettyResponse, delay, apiConf)
+}
+
+// scheduleAPI triggers the method at the API's schedule until ctx is cancelled. APIs without schedule are triggered
+// immediately if the current interval has already started, then at the API's interval starting from the next quarter
+// hour plus delay minutes. APIs with interval schedule are triggered immediately as well, cron schedules aren't.
+func scheduleAPI(ctx context.Context, callCtx context.Context, api *config.APIConf, user *config.User, prettyResponse bool, delay int, method fn) {
+	if api.Schedule != nil {
+		sched, err := schedule.Parse(api.Schedule, api.Interval)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Errorf("Invalid schedule of %s, it won't be triggered for %s", api.API, user.Email)
+			return
+		}
+		if api.Schedule.Cron == "" {
+			go run(func() { method(callCtx, api, user, atomic.AddUint64(&txnID, 1), prettyResponse) })
+		}
+		trigger(ctx, callCtx, sched, api, user, prettyResponse, method)
+		return
+	}
+
+	currentTime := utils.CurrentTime()
+	diff := currentTime.Minute() - (currentTime.Minute() / interval * interval) - delay
+	begTime := currentTime.Add(time.Duration(-1*diff) * time.Minute)
+	if currentTime.After(begTime) {
+		begTime = begTime.Add(time.Duration(interval) * time.Minute)
+		go run(func() { method(callCtx, api, user, atomic.AddUint64(&txnID, 1), prettyResponse) })
+	}
+	trigger(ctx, callCtx, schedule.Every(begTime, time.Duration(api.Interval)*time.Minute), api, user, prettyResponse, method)
+}
@@ -0,0 +1,177 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/schedule"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// returns the keys of the running jobs and the jobs, sorted by key.
+func runningJobs() ([]string, map[string]*job) {
+	jobMux.Lock()
+	defer jobMux.Unlock()
+	running := map[string]*job{}
+	var keys []string
+	for key, j := range jobs {
+		keys = append(keys, key)
+		running[key] = j
+	}
+	sort.Strings(keys)
+	return keys, running
+}
+
+func TestSyncJobs(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.URL.String(), "network-hardware-groups") {
+			fmt.Fprintln(w, listNhgResp)
+		} else {
+			fmt.Fprintln(w, fmResponse)
+		}
+	}))
+	defer testServer.Close()
+	user := setShutdownTestConf(t, testServer.URL)
+	config.Conf.MetricAPIs = []*config.APIConf{{API: "/fmdata", Interval: 15, Type: "ACTIVE"}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		Shutdown(time.Second)
+	}()
+	StartDataCollection(ctx)
+	keys, started := runningJobs()
+	assert.Equal(t, []string{"metric/testuser@nokia.com//fmdata//ACTIVE", "network/testuser@nokia.com"}, keys)
+
+	//new API is started, unchanged jobs keep running
+	config.Conf.SimAPIs = []*config.APIConf{{API: "/sims", Interval: 15}}
+	SyncJobs()
+	keys, synced := runningJobs()
+	assert.Equal(t, []string{"metric/testuser@nokia.com//fmdata//ACTIVE", "network/testuser@nokia.com", "sim/testuser@nokia.com//sims"}, keys)
+	assert.Same(t, started["network/testuser@nokia.com"], synced["network/testuser@nokia.com"])
+	assert.Same(t, started["metric/testuser@nokia.com//fmdata//ACTIVE"], synced["metric/testuser@nokia.com//fmdata//ACTIVE"])
+
+	//changed API is restarted and removed API is stopped
+	config.Conf.MetricAPIs = []*config.APIConf{{API: "/fmdata", Interval: 30, Type: "ACTIVE"}}
+	config.Conf.SimAPIs = nil
+	SyncJobs()
+	keys, synced = runningJobs()
+	assert.Equal(t, []string{"metric/testuser@nokia.com//fmdata//ACTIVE", "network/testuser@nokia.com"}, keys)
+	assert.NotSame(t, started["metric/testuser@nokia.com//fmdata//ACTIVE"], synced["metric/testuser@nokia.com//fmdata//ACTIVE"])
+	assert.Same(t, started["network/testuser@nokia.com"], synced["network/testuser@nokia.com"])
+
+	//replaced user restarts its jobs
+	config.Conf.Users = []*config.User{{Email: user.Email, IsSessionAlive: true, ResponseDest: user.ResponseDest, SessionToken: &config.SessionToken{}}}
+	SyncJobs()
+	keys, synced = runningJobs()
+	assert.Equal(t, []string{"metric/testuser@nokia.com//fmdata//ACTIVE", "network/testuser@nokia.com"}, keys)
+	assert.NotSame(t, started["network/testuser@nokia.com"], synced["network/testuser@nokia.com"])
+
+	config.Conf.Users = nil
+	SyncJobs()
+	keys, _ = runningJobs()
+	assert.Empty(t, keys)
+}
+
+func TestSyncJobsDoesNotBlockWhileFetchingNetworks(t *testing.T) {
+	fetching := make(chan struct{}, 1)
+	release := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.String(), "network-hardware-groups") {
+			select {
+			case fetching <- struct{}{}:
+			default:
+			}
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, listNhgResp)
+	}))
+	defer testServer.Close()
+	setShutdownTestConf(t, testServer.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		Shutdown(time.Second)
+	}()
+	done := make(chan struct{})
+	go func() {
+		StartDataCollection(ctx)
+		close(done)
+	}()
+	<-fetching
+
+	//jobs can be listed and synced while the network list is being fetched
+	synced := make(chan struct{})
+	go func() {
+		keys, _ := runningJobs()
+		assert.Equal(t, []string{"network/testuser@nokia.com"}, keys)
+		SyncJobs()
+		close(synced)
+	}()
+	select {
+	case <-synced:
+	case <-time.After(time.Second):
+		t.Error("SyncJobs is blocked by the network API call")
+	}
+	close(release)
+	<-done
+}
+
+func TestTriggerWithSchedule(t *testing.T) {
+	var calls int32
+	method := func(ctx context.Context, api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
+		atomic.AddInt32(&calls, 1)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		trigger(ctx, context.Background(), schedule.Every(time.Now(), 20*time.Millisecond), &config.APIConf{API: "/fmdata"}, &config.User{}, false, method)
+		close(done)
+	}()
+	time.Sleep(110 * time.Millisecond)
+	cancel()
+	<-done
+	n := atomic.LoadInt32(&calls)
+	assert.True(t, n >= 3 && n <= 6, n)
+}
+
+func TestScheduleAPI(t *testing.T) {
+	calls := make(chan string, 10)
+	method := func(ctx context.Context, api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
+		calls <- api.API
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	//cron schedule isn't triggered on start, interval schedule is
+	go scheduleAPI(ctx, context.Background(), &config.APIConf{API: "/sims", Interval: 15, Schedule: &config.ScheduleConf{Cron: "0 2 * * *"}}, &config.User{}, false, 7, method)
+	go scheduleAPI(ctx, context.Background(), &config.APIConf{API: "/fmdata", Interval: 15, Schedule: &config.ScheduleConf{Offset: 30}}, &config.User{}, false, 7, method)
+	select {
+	case api := <-calls:
+		assert.Equal(t, "/fmdata", api)
+	case <-time.After(time.Second):
+		t.Fatal("API with interval schedule isn't triggered on start")
+	}
+	select {
+	case api := <-calls:
+		t.Errorf("unexpected call of %s", api)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -3,11 +3,14 @@ package ndacapis
 import (
 	"bytes"
 	"collector/pkg/config"
+	"collector/pkg/metrics"
 	"collector/pkg/utils"
+	"context"
 	"encoding/json"
 	"net/http"
 	"slices"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -27,35 +30,19 @@ type gngAPIAllResponse struct {
 	GngInfo interface{} `json:"gng_info"`
 }
 
-func getGngDetails(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
+// get gng details for the customer and adds the user's allowed ACTIVE GNGs to the networks built from the nhg list.
+// Returns false if the gng list or the gng list of any of the ABAC user's accounts isn't fetched.
+// The states of the GNGs in the user's allowed slices are added to states, if it isn't nil, to find the network events.
+func getGngDetails(ctx context.Context, api *config.APIConf, user *config.User, networks *config.NetworkSnapshot, states map[string]networkState, txnID uint64, prettyResponse bool) bool {
 	authType := strings.ToUpper(user.AuthType)
 	if authType == "ADTOKEN" {
-		listGngABAC(api, user, txnID, prettyResponse)
-		nhgs := make([]string, len(user.NhgIDsABAC))
-		i := 0
-		for k := range user.NhgIDsABAC {
-			nhgs[i] = k
-			i++
-		}
-		if len(user.NhgIDsABAC) == 0 {
-			user.IsSessionAlive = false
-		} else {
-			user.IsSessionAlive = true
-		}
-		log.WithFields(log.Fields{"tid": txnID, "user": user.Email}).Infof("active networks: %v", nhgs)
-	} else {
-		listGngRBAC(api, user, txnID, prettyResponse)
-		if len(user.NhgIDs) == 0 {
-			user.IsSessionAlive = false
-		} else {
-			user.IsSessionAlive = true
-		}
-		log.WithFields(log.Fields{"tid": txnID, "user": user.Email}).Infof("active networks: %v", user.NhgIDs)
+		return listGngABAC(ctx, api, user, networks, states, txnID, prettyResponse)
 	}
+	return listGngRBAC(ctx, api, user, networks, states, txnID, prettyResponse)
 }
 
-func listGngRBAC(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
-	apiURL := config.Conf.BaseURL + api.API
+func listGngRBAC(ctx context.Context, api *config.APIConf, user *config.User, networks *config.NetworkSnapshot, states map[string]networkState, txnID uint64, prettyResponse bool) bool {
+	apiURL := config.BaseURLFor(user) + api.API
 	//wait if refresh token api is running
 	if user != nil && user.RefreshDone != nil {
 		<-user.RefreshDone
@@ -65,69 +52,68 @@ func listGngRBAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 	request, err := http.NewRequest("GET", apiURL, nil)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while calling %s for %s", apiURL, user.Email)
-		return
+		return false
 	}
 
 	request.Header.Set(authorizationHeader, user.SessionToken.AccessToken)
-	response, err := doRequest(request)
+	reqStartTime := time.Now()
+	response, err := doRequestWithRetry(ctx, request, user, api, txnID)
+	metrics.ObserveAPICall(user, api, reqStartTime, err)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while calling %s for %s", apiURL, user.Email)
-		return
+		return false
 	}
 
 	resp := new(gngAPIResponse)
 	err = json.NewDecoder(bytes.NewReader(response)).Decode(&resp)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Error("Unable to decode response")
-		return
+		return false
 	}
 
 	//check response for status code
 	err = checkStatusCode(resp.Status)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Invalid status code received while calling %s for %s", apiURL, user.Email)
-		return
+		return false
 	}
 
-	user.NhgMux.Lock()
-	storeUserGngRBAC(resp.GngInfo, user)
-	user.NhgMux.Unlock()
+	addGngsRBAC(networks, resp.GngInfo, user.AllowedSliceIDs)
+	gngStates(resp.GngInfo, states, user.AllowedSliceIDs, "", "")
 	if len(resp.GngInfo) > 0 {
 		gngData := new(gngAPIAllResponse)
 		_ = json.NewDecoder(bytes.NewReader(response)).Decode(&gngData)
-		err = utils.WriteResponse(user, api, gngData.GngInfo, "", txnID, prettyResponse)
+		err = writeResponse(user, api, gngData.GngInfo, "", txnID, prettyResponse)
 		if err != nil {
 			log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("unable to write response for %s", user.Email)
 		}
 	} else {
 		log.WithFields(log.Fields{"tid": txnID, "user": user.Email}).Info("no GNG found for user")
 	}
-	if len(user.NhgIDs) == 0 {
+	if len(networks.NhgIDs) == 0 {
 		//user.IsSessionAlive = false
 		log.WithFields(log.Fields{"tid": txnID, "user": user.Email}).Info("no active nhg found for user")
 	}
+	return true
 }
 
-func storeUserGngRBAC(gngData []GngInfo, user *config.User) {
+// adds the allowed ACTIVE GNGs to the RBAC user's networks.
+func addGngsRBAC(networks *config.NetworkSnapshot, gngData []GngInfo, allowedSliceIDs []string) {
 	for _, gngInfo := range gngData {
-		if strings.Contains(gngInfo.AdminState, "FULLY_ACTIVATED") && !containsNhg(user.NhgIDs, gngInfo.GngId) {
-			if len(user.AllowedSliceIDs) != 0 && !slices.Contains(user.AllowedSliceIDs, gngInfo.SliceID) {
-				continue
-			}
-			user.NhgIDs = append(user.NhgIDs, gngInfo.GngId)
+		if isGngAllowed(gngInfo, allowedSliceIDs) && !containsNhg(networks.NhgIDs, gngInfo.GngId) {
+			networks.NhgIDs = append(networks.NhgIDs, gngInfo.GngId)
 		}
 	}
 }
 
-func listGngABAC(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
+func listGngABAC(ctx context.Context, api *config.APIConf, user *config.User, networks *config.NetworkSnapshot, states map[string]networkState, txnID uint64, prettyResponse bool) bool {
 	//wait if refresh token api is running
 	if user != nil && user.RefreshDone != nil {
 		<-user.RefreshDone
 	}
-	apiURL := config.Conf.BaseURL + api.API
-	user.NhgMux.Lock()
-	defer user.NhgMux.Unlock()
-	for orgID, accIDs := range user.AccountIDsABAC {
+	apiURL := config.BaseURLFor(user) + api.API
+	complete := true
+	for orgID, accIDs := range networks.AccountIDsABAC {
 		if len(accIDs) == 0 {
 			log.WithFields(log.Fields{"tid": txnID, "user": user, "org_id": orgID}).Debug("No accounts mapped")
 			continue
@@ -138,6 +124,7 @@ func listGngABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 			request, err := http.NewRequest("GET", apiURL, nil)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": orgID, "acc_id": accID}).Errorf("Error while calling %s for %s", apiURL, user.Email)
+				complete = false
 				continue
 			}
 
@@ -146,9 +133,12 @@ func listGngABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 			query.Add(orgIDQueryParam, orgID)
 			query.Add(accIDQueryParam, accID)
 			request.URL.RawQuery = query.Encode()
-			response, err := doRequest(request)
+			reqStartTime := time.Now()
+			response, err := doRequestWithRetry(ctx, request, user, api, txnID)
+			metrics.ObserveAPICall(user, api, reqStartTime, err)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": orgID, "acc_id": accID}).Errorf("Error while calling %s for %s", apiURL, user.Email)
+				complete = false
 				continue
 			}
 
@@ -156,6 +146,7 @@ func listGngABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 			err = json.NewDecoder(bytes.NewReader(response)).Decode(&resp)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": orgID, "acc_id": accID}).Error("Unable to decode response")
+				complete = false
 				continue
 			}
 
@@ -163,14 +154,16 @@ func listGngABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 			err = checkStatusCode(resp.Status)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": orgID, "acc_id": accID}).Errorf("Invalid status code received while calling %s for %s", apiURL, user.Email)
+				complete = false
 				continue
 			}
+			gngStates(resp.GngInfo, states, user.AllowedSliceIDs, orgID, accID)
 
-			storeUserGngABAC(resp.GngInfo, user, orgID, accID)
+			addGngsABAC(networks, resp.GngInfo, user.AllowedSliceIDs, config.OrgAccDetails{OrgDetails: config.OrgDetails{OrgUUID: orgID}, AccDetails: config.AccDetails{AccUUID: accID}})
 			if len(resp.GngInfo) > 0 {
 				gngData := new(gngAPIAllResponse)
 				_ = json.NewDecoder(bytes.NewReader(response)).Decode(&gngData)
-				err = utils.WriteResponse(user, api, gngData.GngInfo, "", txnID, prettyResponse)
+				err = writeResponse(user, api, gngData.GngInfo, "", txnID, prettyResponse)
 				if err != nil {
 					log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": orgID, "acc_id": accID}).Errorf("unable to write response for %s", user.Email)
 				}
@@ -179,32 +172,32 @@ func listGngABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 			}
 		}
 	}
-	if len(user.NhgIDsABAC) == 0 {
+	if len(networks.NhgIDsABAC) == 0 {
 		//user.IsSessionAlive = false
 		log.WithFields(log.Fields{"tid": txnID, "user": user.Email}).Info("no active nhg found for user")
 	}
+	return complete
 }
 
-func storeUserGngABAC(gngData []GngInfo, user *config.User, orgID, accID string) {
-	orgAcc := config.OrgAccDetails{}
-	orgDet := config.OrgDetails{OrgUUID: orgID}
-	accDet := config.AccDetails{AccUUID: accID}
-
-	orgAcc.OrgDetails = orgDet
-	orgAcc.AccDetails = accDet
-
+// adds the allowed ACTIVE GNGs of the account to the ABAC user's networks.
+func addGngsABAC(networks *config.NetworkSnapshot, gngData []GngInfo, allowedSliceIDs []string, orgAcc config.OrgAccDetails) {
 	for _, gngInfo := range gngData {
-		if strings.Contains(gngInfo.AdminState, "FULLY_ACTIVATED") {
-			if _, ok := user.NhgIDsABAC[gngInfo.GngId]; !ok {
-				if len(user.AllowedSliceIDs) != 0 && !slices.Contains(user.AllowedSliceIDs, gngInfo.SliceID) {
-					continue
-				}
-				user.NhgIDsABAC[gngInfo.GngId] = orgAcc
-			}
+		if _, ok := networks.NhgIDsABAC[gngInfo.GngId]; !ok && isGngAllowed(gngInfo, allowedSliceIDs) {
+			networks.NhgIDsABAC[gngInfo.GngId] = orgAcc
 		}
 	}
 }
 
+// returns true if the GNG is fully activated and belongs to the allowed slices, all the slices are allowed if allowedSliceIDs is empty.
+func isGngAllowed(gngInfo GngInfo, allowedSliceIDs []string) bool {
+	return strings.Contains(gngInfo.AdminState, "FULLY_ACTIVATED") && isGngInSlices(gngInfo, allowedSliceIDs)
+}
+
+// returns true if the GNG belongs to the allowed slices, all the slices are allowed if allowedSliceIDs is empty.
+func isGngInSlices(gngInfo GngInfo, allowedSliceIDs []string) bool {
+	return len(allowedSliceIDs) == 0 || slices.Contains(allowedSliceIDs, gngInfo.SliceID)
+}
+
 func containsNhg(nhgList []string, gng string) bool {
 	for _, nhg := range nhgList {
 		if nhg == gng {
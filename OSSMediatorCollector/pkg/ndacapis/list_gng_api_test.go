@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"collector/pkg/config"
 	"collector/pkg/utils"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -57,11 +58,12 @@ func TestGetGngDetails(t *testing.T) {
 	}
 	CreateHTTPClient("", false)
 	utils.CreateResponseDirectory(user.ResponseDest, "/getGngDetail")
-	getGngDetails(&config.APIConf{API: "/getGngDetail", Interval: 15}, &user, 1234, true)
-	if len(user.NhgIDs) != 1 {
+	networks := &config.NetworkSnapshot{}
+	getGngDetails(context.Background(), &config.APIConf{API: "/getGngDetail", Interval: 15}, &user, networks, nil, 1234, true)
+	if len(networks.NhgIDs) != 1 {
 		t.Fail()
 	}
-	if user.NhgIDs[0] != "test_gng_2" {
+	if networks.NhgIDs[0] != "test_gng_2" {
 		t.Fail()
 	}
 }
@@ -91,8 +93,9 @@ func TestGetGngDetailsForInvalidCase(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	getGngDetails(&config.APIConf{API: "/getGngDetail", Interval: 15}, &user, 1234, true)
-	if len(user.NhgIDs) != 0 {
+	networks := &config.NetworkSnapshot{}
+	getGngDetails(context.Background(), &config.APIConf{API: "/getGngDetail", Interval: 15}, &user, networks, nil, 1234, true)
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
 }
@@ -114,11 +117,12 @@ func TestGetGngDetailsForInvalidURL(t *testing.T) {
 	config.Conf = config.Config{
 		BaseURL: ":",
 	}
-	getGngDetails(&config.APIConf{API: "/getGngDetails", Interval: 15}, &user, 1234, true)
+	networks := &config.NetworkSnapshot{}
+	getGngDetails(context.Background(), &config.APIConf{API: "/getGngDetails", Interval: 15}, &user, networks, nil, 1234, true)
 	if !strings.Contains(buf.String(), "missing protocol scheme") {
 		t.Fail()
 	}
-	if len(user.NhgIDs) != 0 {
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
 }
@@ -145,11 +149,12 @@ func TestGetGngDetailsWithInvalidResponse(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	getGngDetails(&config.APIConf{API: "/getGngDetails", Interval: 15}, &user, 1234, true)
+	networks := &config.NetworkSnapshot{}
+	getGngDetails(context.Background(), &config.APIConf{API: "/getGngDetails", Interval: 15}, &user, networks, nil, 1234, true)
 	if !strings.Contains(buf.String(), "Unable to decode response") {
 		t.Fail()
 	}
-	if len(user.NhgIDs) != 0 {
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
 }
@@ -161,11 +166,13 @@ func TestGetGngDetailsABAC(t *testing.T) {
 		RefreshToken: "refreshToken",
 		ExpiryTime:   utils.CurrentTime(),
 	}
-	user.HwIDsABAC = map[string]config.OrgAccDetails{}
-	user.NhgIDsABAC = map[string]config.OrgAccDetails{}
-	user.AccountIDsABAC = map[string][]string{
-		"org1": {"acc1", "acc2"},
-		"org2": {"acc3", "acc4"},
+	networks := &config.NetworkSnapshot{
+		HwIDsABAC:  map[string]config.OrgAccDetails{},
+		NhgIDsABAC: map[string]config.OrgAccDetails{},
+		AccountIDsABAC: map[string][]string{
+			"org1": {"acc1", "acc2"},
+			"org2": {"acc3", "acc4"},
+		},
 	}
 
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -178,11 +185,11 @@ func TestGetGngDetailsABAC(t *testing.T) {
 	}
 	CreateHTTPClient("", false)
 	utils.CreateResponseDirectory(user.ResponseDest, "/getGngDetail")
-	getGngDetails(&config.APIConf{API: "/getGngDetail", Interval: 15}, &user, 1234, true)
-	if len(user.NhgIDs) != 0 {
+	getGngDetails(context.Background(), &config.APIConf{API: "/getGngDetail", Interval: 15}, &user, networks, nil, 1234, true)
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 1 {
+	if len(networks.NhgIDsABAC) != 1 {
 		t.Fail()
 	}
 }
@@ -194,11 +201,13 @@ func TestGetGngDetailsABACForInvalidCase(t *testing.T) {
 		RefreshToken: "refreshToken",
 		ExpiryTime:   utils.CurrentTime(),
 	}
-	user.HwIDsABAC = map[string]config.OrgAccDetails{}
-	user.NhgIDsABAC = map[string]config.OrgAccDetails{}
-	user.AccountIDsABAC = map[string][]string{
-		"org1": {"acc1", "acc2"},
-		"org2": {"acc3", "acc4"},
+	networks := &config.NetworkSnapshot{
+		HwIDsABAC:  map[string]config.OrgAccDetails{},
+		NhgIDsABAC: map[string]config.OrgAccDetails{},
+		AccountIDsABAC: map[string][]string{
+			"org1": {"acc1", "acc2"},
+			"org2": {"acc3", "acc4"},
+		},
 	}
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -218,11 +227,11 @@ func TestGetGngDetailsABACForInvalidCase(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	getGngDetails(&config.APIConf{API: "/getGngDetail", Interval: 15}, &user, 1234, true)
-	if len(user.NhgIDs) != 0 {
+	getGngDetails(context.Background(), &config.APIConf{API: "/getGngDetail", Interval: 15}, &user, networks, nil, 1234, true)
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(networks.NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -239,25 +248,27 @@ func TestGetGngDetailsABACForInvalidURL(t *testing.T) {
 		RefreshToken: "refreshToken",
 		ExpiryTime:   utils.CurrentTime(),
 	}
-	user.HwIDsABAC = map[string]config.OrgAccDetails{}
-	user.NhgIDsABAC = map[string]config.OrgAccDetails{}
-	user.AccountIDsABAC = map[string][]string{
-		"org1": {"acc1", "acc2"},
-		"org2": {"acc3", "acc4"},
+	networks := &config.NetworkSnapshot{
+		HwIDsABAC:  map[string]config.OrgAccDetails{},
+		NhgIDsABAC: map[string]config.OrgAccDetails{},
+		AccountIDsABAC: map[string][]string{
+			"org1": {"acc1", "acc2"},
+			"org2": {"acc3", "acc4"},
+		},
 	}
 
 	CreateHTTPClient("", true)
 	config.Conf = config.Config{
 		BaseURL: ":",
 	}
-	getGngDetails(&config.APIConf{API: "/getGngDetails", Interval: 15}, &user, 1234, true)
+	getGngDetails(context.Background(), &config.APIConf{API: "/getGngDetails", Interval: 15}, &user, networks, nil, 1234, true)
 	if !strings.Contains(buf.String(), "missing protocol scheme") {
 		t.Fail()
 	}
-	if len(user.NhgIDs) != 0 {
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(networks.NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -274,11 +285,13 @@ func TestGetGngDetailsABACWithInvalidResponse(t *testing.T) {
 		RefreshToken: "refreshToken",
 		ExpiryTime:   utils.CurrentTime(),
 	}
-	user.HwIDsABAC = map[string]config.OrgAccDetails{}
-	user.NhgIDsABAC = map[string]config.OrgAccDetails{}
-	user.AccountIDsABAC = map[string][]string{
-		"org1": {"acc1", "acc2"},
-		"org2": {"acc3", "acc4"},
+	networks := &config.NetworkSnapshot{
+		HwIDsABAC:  map[string]config.OrgAccDetails{},
+		NhgIDsABAC: map[string]config.OrgAccDetails{},
+		AccountIDsABAC: map[string][]string{
+			"org1": {"acc1", "acc2"},
+			"org2": {"acc3", "acc4"},
+		},
 	}
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -290,14 +303,14 @@ func TestGetGngDetailsABACWithInvalidResponse(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	getGngDetails(&config.APIConf{API: "/getGngDetails", Interval: 15}, &user, 1234, true)
+	getGngDetails(context.Background(), &config.APIConf{API: "/getGngDetails", Interval: 15}, &user, networks, nil, 1234, true)
 	if !strings.Contains(buf.String(), "Unable to decode response") {
 		t.Fail()
 	}
-	if len(user.NhgIDs) != 0 {
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(networks.NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -9,11 +9,15 @@ package ndacapis
 import (
 	"bytes"
 	"collector/pkg/config"
+	"collector/pkg/metrics"
 	"collector/pkg/utils"
+	"context"
 	"encoding/json"
+	"maps"
 	"net/http"
 	"slices"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -29,7 +33,8 @@ type nhgAPIAllResponse struct {
 
 type NetworkInfo struct {
 	Clusters []struct {
-		HwSet []struct {
+		ClusterID string `json:"cluster_id"`
+		HwSet     []struct {
 			HwID string `json:"hw_id"`
 		} `json:"hw_set"`
 		SliceID string `json:"slice_id"`
@@ -42,18 +47,20 @@ const (
 	activeNhgStatus = "ACTIVE"
 )
 
-// get nhg details for the customer
-func getNhgDetails(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
+// get nhg details for the customer, returns the user's networks built from the fetched nhg list or nil if the list isn't fetched.
+// complete is false if the nhg list of any of the ABAC user's accounts isn't fetched.
+// The states of the NHGs in the user's allowed slices are added to states, if it isn't nil, to find the network events.
+func getNhgDetails(ctx context.Context, api *config.APIConf, user *config.User, states map[string]networkState, txnID uint64, prettyResponse bool) (*config.NetworkSnapshot, bool) {
 	authType := strings.ToUpper(user.AuthType)
 	if authType == "ADTOKEN" {
-		listNhgABAC(api, user, txnID, prettyResponse)
-	} else {
-		listNhgRBAC(api, user, txnID, prettyResponse)
+		return listNhgABAC(ctx, api, user, states, txnID, prettyResponse)
 	}
+	networks := listNhgRBAC(ctx, api, user, states, txnID, prettyResponse)
+	return networks, networks != nil
 }
 
-func listNhgRBAC(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
-	apiURL := config.Conf.BaseURL + api.API
+func listNhgRBAC(ctx context.Context, api *config.APIConf, user *config.User, states map[string]networkState, txnID uint64, prettyResponse bool) *config.NetworkSnapshot {
+	apiURL := config.BaseURLFor(user) + api.API
 	//wait if refresh token api is running
 	if user != nil && user.RefreshDone != nil {
 		<-user.RefreshDone
@@ -64,15 +71,17 @@ func listNhgRBAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 	if err != nil {
 		//user.IsSessionAlive = false
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while calling %s for %s", apiURL, user.Email)
-		return
+		return nil
 	}
 
 	request.Header.Set(authorizationHeader, user.SessionToken.AccessToken)
-	response, err := doRequest(request)
+	reqStartTime := time.Now()
+	response, err := doRequestWithRetry(ctx, request, user, api, txnID)
+	metrics.ObserveAPICall(user, api, reqStartTime, err)
 	if err != nil {
 		//user.IsSessionAlive = false
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while calling %s for %s", apiURL, user.Email)
-		return
+		return nil
 	}
 
 	resp := new(nhgAPIResponse)
@@ -80,7 +89,7 @@ func listNhgRBAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 	if err != nil {
 		//user.IsSessionAlive = false
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Error("Unable to decode response")
-		return
+		return nil
 	}
 
 	//check response for status code
@@ -88,78 +97,73 @@ func listNhgRBAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 	if err != nil {
 		//user.IsSessionAlive = false
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Invalid status code received while calling %s for %s", apiURL, user.Email)
-		return
+		return nil
 	}
 
-	user.NhgMux.Lock()
-	storeUserNetworkInfoRBAC(resp.NetworkInfo, user)
-	user.NhgMux.Unlock()
+	networks := &config.NetworkSnapshot{}
+	addNhgsRBAC(networks, resp.NetworkInfo, user.AllowedSliceIDs)
 	nhgData := new(nhgAPIAllResponse)
 	_ = json.NewDecoder(bytes.NewReader(response)).Decode(&nhgData)
-	err = utils.WriteResponse(user, api, nhgData.NhgDetails, "", txnID, prettyResponse)
+	err = writeResponse(user, api, nhgData.NhgDetails, "", txnID, prettyResponse)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("unable to write response for %s", user.Email)
 	}
-	if len(user.NhgIDs) == 0 {
+	nhgStates(resp.NetworkInfo, states, user.AllowedSliceIDs, "", "")
+	if len(networks.NhgIDs) == 0 {
 		//user.IsSessionAlive = false
 		log.WithFields(log.Fields{"tid": txnID, "user": user.Email}).Info("no active nhg found for user")
 	}
+	return networks
 }
 
-func storeUserNetworkInfoRBAC(nhgData []NetworkInfo, user *config.User) {
-	user.HwIDs = []string{}
+// adds the allowed ACTIVE NHGs and their access point hardware to the RBAC user's networks.
+func addNhgsRBAC(networks *config.NetworkSnapshot, nhgData []NetworkInfo, allowedSliceIDs []string) {
 	hwIDs := make(map[string]struct{})
+	for _, hwID := range networks.HwIDs {
+		hwIDs[hwID] = struct{}{}
+	}
 	for _, nhgInfo := range nhgData {
-		if nhgInfo.NhgConfigStatus != activeNhgStatus {
+		if !isNhgAllowed(nhgInfo, allowedSliceIDs) {
 			continue
 		}
-		isNhgAllowed := true
+		networks.NhgIDs = append(networks.NhgIDs, nhgInfo.NhgID)
 		for _, cluster := range nhgInfo.Clusters {
-			if len(user.AllowedSliceIDs) != 0 && !slices.Contains(user.AllowedSliceIDs, cluster.SliceID) {
-				isNhgAllowed = false
-				break
-			}
 			for _, hwSet := range cluster.HwSet {
 				hwIDs[hwSet.HwID] = struct{}{}
 			}
 		}
-		if isNhgAllowed {
-			user.NhgIDs = append(user.NhgIDs, nhgInfo.NhgID)
-		}
-	}
-
-	for hwID := range hwIDs {
-		user.HwIDs = append(user.HwIDs, hwID)
 	}
-	//log.WithFields(log.Fields{"tid": txnID, "user": user.Email, "hw_ids": user.HwIDs}).Debug("user's access point hardware")
+	networks.HwIDs = slices.Sorted(maps.Keys(hwIDs))
 }
 
-func listNhgABAC(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
+func listNhgABAC(ctx context.Context, api *config.APIConf, user *config.User, states map[string]networkState, txnID uint64, prettyResponse bool) (*config.NetworkSnapshot, bool) {
 	//wait if refresh token api is running
 	if user != nil && user.RefreshDone != nil {
 		<-user.RefreshDone
 	}
 
-	orgResponse, err := fetchOrgUUID(api, user, txnID, prettyResponse)
+	orgResponse, err := fetchOrgUUID(ctx, api, user, txnID, prettyResponse)
 	if err != nil {
-		user.IsSessionAlive = false
+		config.SetSessionAlive(user, false)
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while fetching orguuid")
-		return
+		return nil, false
 	}
 	if len(orgResponse.OrgDetails) == 0 {
-		user.IsSessionAlive = false
-		return
+		config.SetSessionAlive(user, false)
+		return nil, false
 	}
 
-	user.NhgMux.Lock()
-	defer user.NhgMux.Unlock()
-	user.HwIDsABAC = map[string]config.OrgAccDetails{}
-	user.NhgIDsABAC = map[string]config.OrgAccDetails{}
-	user.AccountIDsABAC = map[string][]string{}
+	networks := &config.NetworkSnapshot{
+		NhgIDsABAC:     map[string]config.OrgAccDetails{},
+		HwIDsABAC:      map[string]config.OrgAccDetails{},
+		AccountIDsABAC: map[string][]string{},
+	}
+	complete := true
 	for _, org := range orgResponse.OrgDetails {
-		accResponse, err := fetchAccUUID(api, user, org, txnID, prettyResponse)
+		accResponse, err := fetchAccUUID(ctx, api, user, org, txnID, prettyResponse)
 		if err != nil {
 			log.WithFields(log.Fields{"tid": txnID, "user": user.Email, "org_id": org, "error": err}).Errorf("Error while getting account_id")
+			complete = false
 			continue
 		}
 		if len(accResponse.AccDetails) == 0 {
@@ -171,14 +175,15 @@ func listNhgABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 		for _, acc := range accResponse.AccDetails {
 			accIDs = append(accIDs, acc.AccUUID)
 		}
-		user.AccountIDsABAC[org.OrgUUID] = accIDs
+		networks.AccountIDsABAC[org.OrgUUID] = accIDs
 
 		for _, acc := range accResponse.AccDetails {
-			apiURL := config.Conf.BaseURL + api.API
+			apiURL := config.BaseURLFor(user) + api.API
 			log.WithFields(log.Fields{"tid": txnID, "org_id": org, "acc_id": acc}).Infof("Triggered %s for %s at %v", apiURL, user.Email, utils.CurrentTime())
 			request, err := http.NewRequest(http.MethodGet, apiURL, nil)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": org, "acc_id": acc}).Errorf("Error while calling %s for %s", apiURL, user.Email)
+				complete = false
 				continue
 			}
 
@@ -187,9 +192,12 @@ func listNhgABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 			query.Add(orgIDQueryParam, org.OrgUUID)
 			query.Add(accIDQueryParam, acc.AccUUID)
 			request.URL.RawQuery = query.Encode()
-			response, err := doRequest(request)
+			reqStartTime := time.Now()
+			response, err := doRequestWithRetry(ctx, request, user, api, txnID)
+			metrics.ObserveAPICall(user, api, reqStartTime, err)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": org, "acc_id": acc}).Errorf("Error while calling %s for %s", apiURL, user.Email)
+				complete = false
 				continue
 			}
 
@@ -197,6 +205,7 @@ func listNhgABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 			err = json.NewDecoder(bytes.NewReader(response)).Decode(&resp)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": org, "acc_id": acc}).Error("Unable to decode response")
+				complete = false
 				continue
 			}
 
@@ -204,59 +213,61 @@ func listNhgABAC(api *config.APIConf, user *config.User, txnID uint64, prettyRes
 			err = checkStatusCode(resp.Status)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": org, "acc_id": acc}).Errorf("Invalid status code received while calling %s for %s", apiURL, user.Email)
+				complete = false
 				continue
 			}
+			nhgStates(resp.NetworkInfo, states, user.AllowedSliceIDs, org.OrgUUID, acc.AccUUID)
 
 			if len(resp.NetworkInfo) == 0 {
 				log.WithFields(log.Fields{"tid": txnID, "user": user.Email, "org_id": org.OrgUUID, "acc_id": acc.AccUUID}).Info("No nhg mapped")
 				continue
 			}
 
-			storeUserNetworkInfoABAC(resp.NetworkInfo, user, &org, &acc)
+			addNhgsABAC(networks, resp.NetworkInfo, user.AllowedSliceIDs, config.OrgAccDetails{OrgDetails: org, AccDetails: acc})
 			nhgData := new(nhgAPIAllResponse)
 			_ = json.NewDecoder(bytes.NewReader(response)).Decode(&nhgData)
-			err = utils.WriteResponse(user, api, nhgData.NhgDetails, "", txnID, prettyResponse)
+			err = writeResponse(user, api, nhgData.NhgDetails, "", txnID, prettyResponse)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "error": err, "org_id": org, "acc_id": acc}).Errorf("unable to write response for %s", user.Email)
 			}
 		}
 	}
-	if len(user.NhgIDsABAC) == 0 {
+	if len(networks.NhgIDsABAC) == 0 {
 		//user.IsSessionAlive = false
 		log.WithFields(log.Fields{"tid": txnID, "user": user.Email}).Info("no active nhg found for user")
 	}
+	return networks, complete
 }
 
-func storeUserNetworkInfoABAC(nhgData []NetworkInfo, user *config.User, org *config.OrgDetails, acc *config.AccDetails) {
-	orgAcc := config.OrgAccDetails{}
-	orgDet := config.OrgDetails{OrgUUID: org.OrgUUID, OrgAlias: org.OrgAlias}
-	accDet := config.AccDetails{AccUUID: acc.AccUUID, AccAlias: acc.AccAlias}
-
-	orgAcc.OrgDetails = orgDet
-	orgAcc.AccDetails = accDet
-
-	hwIDsMap := make(map[string]struct{})
+// adds the allowed ACTIVE NHGs and their access point hardware of the account to the ABAC user's networks.
+func addNhgsABAC(networks *config.NetworkSnapshot, nhgData []NetworkInfo, allowedSliceIDs []string, orgAcc config.OrgAccDetails) {
 	for _, nhgInfo := range nhgData {
-		if nhgInfo.NhgConfigStatus != activeNhgStatus {
+		if !isNhgAllowed(nhgInfo, allowedSliceIDs) {
 			continue
 		}
-		isNhgAllowed := true
+		networks.NhgIDsABAC[nhgInfo.NhgID] = orgAcc
 		for _, cluster := range nhgInfo.Clusters {
-			if len(user.AllowedSliceIDs) != 0 && !slices.Contains(user.AllowedSliceIDs, cluster.SliceID) {
-				isNhgAllowed = false
-				break
-			}
 			for _, hwSet := range cluster.HwSet {
-				hwIDsMap[hwSet.HwID] = struct{}{}
+				networks.HwIDsABAC[hwSet.HwID] = orgAcc
 			}
 		}
-		if isNhgAllowed {
-			user.NhgIDsABAC[nhgInfo.NhgID] = orgAcc
-		}
 	}
+}
 
-	for hwID := range hwIDsMap {
-		user.HwIDsABAC[hwID] = orgAcc
+// returns true if the NHG is ACTIVE and all its clusters belong to the allowed slices, all the slices are allowed if allowedSliceIDs is empty.
+func isNhgAllowed(nhgInfo NetworkInfo, allowedSliceIDs []string) bool {
+	return nhgInfo.NhgConfigStatus == activeNhgStatus && isNhgInSlices(nhgInfo, allowedSliceIDs)
+}
+
+// returns true if all the NHG's clusters belong to the allowed slices, all the slices are allowed if allowedSliceIDs is empty.
+func isNhgInSlices(nhgInfo NetworkInfo, allowedSliceIDs []string) bool {
+	if len(allowedSliceIDs) == 0 {
+		return true
+	}
+	for _, cluster := range nhgInfo.Clusters {
+		if !slices.Contains(allowedSliceIDs, cluster.SliceID) {
+			return false
+		}
 	}
-	//log.WithFields(log.Fields{"tid": txnID, "user": user.Email, "hw_ids": user.HwIDsABAC}).Debug("user's access point hardware")
+	return true
 }
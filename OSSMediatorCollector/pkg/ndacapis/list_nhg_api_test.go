@@ -10,15 +10,19 @@ import (
 	"bytes"
 	"collector/pkg/config"
 	"collector/pkg/utils"
+	"context"
 	"encoding/json"
 	"fmt"
+	"maps"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 
 	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
 )
 
 var (
@@ -201,8 +205,6 @@ var (
 func TestStoreNhgABAC(t *testing.T) {
 	resp := new(nhgAPIResponse)
 	user := config.User{Email: "testuser@nokia.com", IsSessionAlive: true, ResponseDest: "./tmp"}
-	nhgMap := make(map[string]config.OrgAccDetails)
-	user.NhgIDsABAC = nhgMap
 	orgUUID := config.OrgDetails{OrgUUID: "org", OrgAlias: "orgalias"}
 	accUUID := config.AccDetails{AccUUID: "acc", AccAlias: "accAlias"}
 	user.SessionToken = &config.SessionToken{
@@ -226,11 +228,12 @@ func TestStoreNhgABAC(t *testing.T) {
 		fmt.Println("Failed to unmarshal JSON:", err)
 		return
 	}
-	storeUserNetworkInfoABAC(resp.NetworkInfo, &user, &orgUUID, &accUUID)
-	if len(user.NhgIDsABAC) != 1 {
+	networks := &config.NetworkSnapshot{NhgIDsABAC: map[string]config.OrgAccDetails{}, HwIDsABAC: map[string]config.OrgAccDetails{}}
+	addNhgsABAC(networks, resp.NetworkInfo, user.AllowedSliceIDs, config.OrgAccDetails{OrgDetails: orgUUID, AccDetails: accUUID})
+	if len(networks.NhgIDsABAC) != 1 {
 		t.Fail()
 	}
-	_, exists := user.NhgIDsABAC["test_nhg_2"]
+	_, exists := networks.NhgIDsABAC["test_nhg_2"]
 	if !exists {
 		t.Fail()
 	}
@@ -239,8 +242,6 @@ func TestStoreNhgABAC(t *testing.T) {
 func TestStoreNhgABACInActive(t *testing.T) {
 	resp := new(nhgAPIResponse)
 	user := config.User{Email: "testuser@nokia.com", IsSessionAlive: true, ResponseDest: "./tmp"}
-	nhgMap := make(map[string]config.OrgAccDetails)
-	user.NhgIDsABAC = nhgMap
 	orgUUID := config.OrgDetails{OrgUUID: "org", OrgAlias: "orgalias"}
 	accUUID := config.AccDetails{AccUUID: "acc", AccAlias: "accAlias"}
 	user.SessionToken = &config.SessionToken{
@@ -264,8 +265,9 @@ func TestStoreNhgABACInActive(t *testing.T) {
 		fmt.Println("Failed to unmarshal JSON:", err)
 		return
 	}
-	storeUserNetworkInfoABAC(resp.NetworkInfo, &user, &orgUUID, &accUUID)
-	if len(user.NhgIDsABAC) != 0 {
+	networks := &config.NetworkSnapshot{NhgIDsABAC: map[string]config.OrgAccDetails{}, HwIDsABAC: map[string]config.OrgAccDetails{}}
+	addNhgsABAC(networks, resp.NetworkInfo, user.AllowedSliceIDs, config.OrgAccDetails{OrgDetails: orgUUID, AccDetails: accUUID})
+	if len(networks.NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -295,11 +297,12 @@ func TestStoreNhgRBAC(t *testing.T) {
 		fmt.Println("Failed to unmarshal JSON:", err)
 		return
 	}
-	storeUserNetworkInfoRBAC(resp.NetworkInfo, &user)
-	if len(user.NhgIDs) != 1 {
+	networks := &config.NetworkSnapshot{}
+	addNhgsRBAC(networks, resp.NetworkInfo, user.AllowedSliceIDs)
+	if len(networks.NhgIDs) != 1 {
 		t.Fail()
 	}
-	if user.NhgIDs[0] != "test_nhg_2" {
+	if networks.NhgIDs[0] != "test_nhg_2" {
 		t.Fail()
 	}
 }
@@ -329,8 +332,9 @@ func TestStoreNhgRBACInactiveUser(t *testing.T) {
 		fmt.Println("Failed to unmarshal JSON:", err)
 		return
 	}
-	storeUserNetworkInfoRBAC(resp.NetworkInfo, &user)
-	if len(user.NhgIDs) != 0 {
+	networks := &config.NetworkSnapshot{}
+	addNhgsRBAC(networks, resp.NetworkInfo, user.AllowedSliceIDs)
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
 }
@@ -338,8 +342,6 @@ func TestStoreNhgRBACInactiveUser(t *testing.T) {
 func TestStoreHWABAC(t *testing.T) {
 	resp2 := new(nhgAPIResponse)
 	user := config.User{Email: "testuser@nokia.com", IsSessionAlive: true, ResponseDest: "./tmp"}
-	hwMap := make(map[string]config.OrgAccDetails)
-	user.HwIDsABAC = hwMap
 	orgUUID := config.OrgDetails{OrgUUID: "org", OrgAlias: "orgalias"}
 	accUUID := config.AccDetails{AccUUID: "acc", AccAlias: "accAlias"}
 	user.SessionToken = &config.SessionToken{
@@ -363,12 +365,12 @@ func TestStoreHWABAC(t *testing.T) {
 		fmt.Println("Failed to unmarshal JSON:", err)
 		return
 	}
-	user.NhgIDsABAC = map[string]config.OrgAccDetails{}
-	storeUserNetworkInfoABAC(resp2.NetworkInfo, &user, &orgUUID, &accUUID)
-	if len(user.HwIDsABAC) != 1 {
+	networks := &config.NetworkSnapshot{NhgIDsABAC: map[string]config.OrgAccDetails{}, HwIDsABAC: map[string]config.OrgAccDetails{}}
+	addNhgsABAC(networks, resp2.NetworkInfo, user.AllowedSliceIDs, config.OrgAccDetails{OrgDetails: orgUUID, AccDetails: accUUID})
+	if len(networks.HwIDsABAC) != 1 {
 		t.Fail()
 	}
-	_, exists := user.HwIDsABAC["test_hw"]
+	_, exists := networks.HwIDsABAC["test_hw"]
 	if !exists {
 		t.Fail()
 	}
@@ -377,8 +379,6 @@ func TestStoreHWABAC(t *testing.T) {
 func TestStoreHWABACInactive(t *testing.T) {
 	resp2 := new(nhgAPIResponse)
 	user := config.User{Email: "testuser@nokia.com", IsSessionAlive: true, ResponseDest: "./tmp"}
-	hwMap := make(map[string]config.OrgAccDetails)
-	user.HwIDsABAC = hwMap
 	orgUUID := config.OrgDetails{OrgUUID: "org", OrgAlias: "orgalias"}
 	accUUID := config.AccDetails{AccUUID: "acc", AccAlias: "accAlias"}
 	user.SessionToken = &config.SessionToken{
@@ -402,9 +402,9 @@ func TestStoreHWABACInactive(t *testing.T) {
 		fmt.Println("Failed to unmarshal JSON:", err)
 		return
 	}
-	user.NhgIDsABAC = map[string]config.OrgAccDetails{}
-	storeUserNetworkInfoABAC(resp2.NetworkInfo, &user, &orgUUID, &accUUID)
-	if len(user.HwIDsABAC) != 0 {
+	networks := &config.NetworkSnapshot{NhgIDsABAC: map[string]config.OrgAccDetails{}, HwIDsABAC: map[string]config.OrgAccDetails{}}
+	addNhgsABAC(networks, resp2.NetworkInfo, user.AllowedSliceIDs, config.OrgAccDetails{OrgDetails: orgUUID, AccDetails: accUUID})
+	if len(networks.HwIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -433,8 +433,9 @@ func TestStoreHWRBAC(t *testing.T) {
 		fmt.Println("Failed to unmarshal JSON:", err)
 		return
 	}
-	storeUserNetworkInfoRBAC(resp2.NetworkInfo, &user)
-	if len(user.HwIDs) != 1 {
+	networks := &config.NetworkSnapshot{}
+	addNhgsRBAC(networks, resp2.NetworkInfo, user.AllowedSliceIDs)
+	if len(networks.HwIDs) != 1 {
 		t.Fail()
 	}
 }
@@ -457,11 +458,11 @@ func TestGetNhgDetails(t *testing.T) {
 	}
 	CreateHTTPClient("", false)
 	utils.CreateResponseDirectory(user.ResponseDest, "/getNhgDetail")
-	getNhgDetails(&config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, 1234, true)
-	if len(user.NhgIDs) != 1 {
+	networks, _ := getNhgDetails(context.Background(), &config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, nil, 1234, true)
+	if len(networks.NhgIDs) != 1 {
 		t.Fail()
 	}
-	if user.NhgIDs[0] != "test_nhg_2" {
+	if networks.NhgIDs[0] != "test_nhg_2" {
 		t.Fail()
 	}
 }
@@ -477,7 +478,7 @@ func TestGetNhgDetails(t *testing.T) {
 //	config.Conf = config.Config{
 //		BaseURL: "http://localhost:8080/v1",
 //	}
-//	getNhgDetails(&config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, 1234, true)
+//	getNhgDetails(context.Background(), &config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, nil, 1234, true)
 //	if !strings.Contains(buf.String(), "Skipping API call for testuser@nokia.com") {
 //		t.Fail()
 //	}
@@ -508,8 +509,8 @@ func TestGetNhgDetailsForInvalidCase(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	getNhgDetails(&config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, 1234, true)
-	if len(user.NhgIDs) != 0 {
+	networks, _ := getNhgDetails(context.Background(), &config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, nil, 1234, true)
+	if networks != nil {
 		t.Fail()
 	}
 }
@@ -531,11 +532,11 @@ func TestGetNhgDetailsForInvalidURL(t *testing.T) {
 	config.Conf = config.Config{
 		BaseURL: ":",
 	}
-	getNhgDetails(&config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, 1234, true)
+	networks, _ := getNhgDetails(context.Background(), &config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, nil, 1234, true)
 	if !strings.Contains(buf.String(), "missing protocol scheme") {
 		t.Fail()
 	}
-	if len(user.NhgIDs) != 0 {
+	if networks != nil {
 		t.Fail()
 	}
 }
@@ -562,11 +563,11 @@ func TestGetNhgDetailsWithInvalidResponse(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	getNhgDetails(&config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, 1234, true)
+	networks, _ := getNhgDetails(context.Background(), &config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, nil, 1234, true)
 	if !strings.Contains(buf.String(), "Unable to decode response") {
 		t.Fail()
 	}
-	if len(user.NhgIDs) != 0 {
+	if networks != nil {
 		t.Fail()
 	}
 }
@@ -600,12 +601,60 @@ func TestGetNhgDetailsABAC(t *testing.T) {
 	}
 	CreateHTTPClient("", false)
 	utils.CreateResponseDirectory(user.ResponseDest, "/getNhgDetail")
-	getNhgDetails(&config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, 1234, true)
-	if len(user.NhgIDs) != 0 {
+	networks, _ := getNhgDetails(context.Background(), &config.APIConf{API: "/getNhgDetail", Interval: 15}, &user, nil, 1234, true)
+	if len(networks.NhgIDs) != 0 {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 1 {
+	if len(networks.NhgIDsABAC) != 1 {
 		t.Fail()
 	}
-	t.Log(user.NhgIDsABAC)
+	t.Log(networks.NhgIDsABAC)
+}
+
+func TestNetworksFilteredByAllowedSlices(t *testing.T) {
+	//nhg_2 spans slice_1 and slice_2, nhg_3 and gng_3 aren't active
+	var nhgData []NetworkInfo
+	err := json.Unmarshal([]byte(`[
+		{"nhg_id": "nhg_1", "nhg_config_status": "ACTIVE", "clusters": [{"cluster_id": "1", "slice_id": "slice_1", "hw_set": [{"hw_id": "hw_1"}]}]},
+		{"nhg_id": "nhg_2", "nhg_config_status": "ACTIVE", "clusters": [
+			{"cluster_id": "1", "slice_id": "slice_1", "hw_set": [{"hw_id": "hw_2"}]},
+			{"cluster_id": "2", "slice_id": "slice_2", "hw_set": [{"hw_id": "hw_3"}]}
+		]},
+		{"nhg_id": "nhg_3", "nhg_config_status": "CONFIG_READY", "clusters": [{"cluster_id": "1", "slice_id": "slice_1", "hw_set": [{"hw_id": "hw_4"}]}]}
+	]`), &nhgData)
+	assert.Nil(t, err)
+	gngData := []GngInfo{
+		{GngId: "gng_1", AdminState: "FULLY_ACTIVATED", SliceID: "slice_1"},
+		{GngId: "gng_2", AdminState: "FULLY_ACTIVATED", SliceID: "slice_2"},
+		{GngId: "gng_3", AdminState: "ACTIVATED", SliceID: "slice_1"},
+	}
+	orgAcc := config.OrgAccDetails{OrgDetails: config.OrgDetails{OrgUUID: "org_1"}, AccDetails: config.AccDetails{AccUUID: "acc_1"}}
+
+	tests := []struct {
+		allowedSliceIDs []string
+		nhgIDs          []string
+		hwIDs           []string
+	}{
+		{nil, []string{"nhg_1", "nhg_2", "gng_1", "gng_2"}, []string{"hw_1", "hw_2", "hw_3"}},
+		{[]string{"slice_1"}, []string{"nhg_1", "gng_1"}, []string{"hw_1"}},
+		{[]string{"slice_2"}, []string{"gng_2"}, nil},
+		{[]string{"slice_1", "slice_2"}, []string{"nhg_1", "nhg_2", "gng_1", "gng_2"}, []string{"hw_1", "hw_2", "hw_3"}},
+	}
+	for _, test := range tests {
+		rbac := &config.NetworkSnapshot{}
+		addNhgsRBAC(rbac, nhgData, test.allowedSliceIDs)
+		addGngsRBAC(rbac, gngData, test.allowedSliceIDs)
+		assert.Equal(t, test.nhgIDs, rbac.NhgIDs, "slices %v", test.allowedSliceIDs)
+		assert.Equal(t, test.hwIDs, rbac.HwIDs, "slices %v", test.allowedSliceIDs)
+
+		//ABAC user gets the same networks as RBAC user
+		abac := &config.NetworkSnapshot{NhgIDsABAC: map[string]config.OrgAccDetails{}, HwIDsABAC: map[string]config.OrgAccDetails{}}
+		addNhgsABAC(abac, nhgData, test.allowedSliceIDs, orgAcc)
+		addGngsABAC(abac, gngData, test.allowedSliceIDs, orgAcc)
+		assert.ElementsMatch(t, rbac.NhgIDs, slices.Collect(maps.Keys(abac.NhgIDsABAC)), "slices %v", test.allowedSliceIDs)
+		assert.ElementsMatch(t, rbac.HwIDs, slices.Collect(maps.Keys(abac.HwIDsABAC)), "slices %v", test.allowedSliceIDs)
+		for _, accDetail := range abac.NhgIDsABAC {
+			assert.Equal(t, orgAcc, accDetail)
+		}
+	}
 }
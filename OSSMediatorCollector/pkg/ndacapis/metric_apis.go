@@ -9,8 +9,10 @@ package ndacapis
 import (
 	"bytes"
 	"collector/pkg/config"
+	"collector/pkg/metrics"
 	"collector/pkg/notifier"
 	"collector/pkg/utils"
+	"context"
 	"encoding/json"
 	"net/http"
 	"path"
@@ -64,18 +66,26 @@ type apiCallRequest struct {
 	searchAfterKey string
 	orgUUID        string
 	accUUID        string
+	//backfill requests neither update the checkpoint nor raise alarm notifications
+	backfill bool
 }
 
 const (
 	//retry msg
 	retryCurrentMsg = "retry current"
+	//msg when API call failed and the data is skipped
+	apiFailedMsg = "api failed"
 )
 
-func fetchMetricsData(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
-	user.NhgMux.RLock()
-	defer user.NhgMux.RUnlock()
-	if !user.IsSessionAlive {
+func fetchMetricsData(ctx context.Context, api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
+	if !config.SessionAlive(user) {
 		log.WithFields(log.Fields{"tid": txnID, "api": api.API, "api_type": api.Type, "metric_type": api.MetricType}).Warnf("Skipping API call for %s at %v as user's session is inactive", user.Email, utils.CurrentTime())
+		metrics.IncSkipped(user, api, metrics.SkipReasonSessionInactive)
+		return
+	}
+	if endpoint := endpointOf(user, api.API); isCircuitOpen(endpoint) {
+		log.WithFields(log.Fields{"tid": txnID, "api": api.API, "api_type": api.Type, "metric_type": api.MetricType}).Warnf("Skipping API call for %s at %v as circuit breaker of %s is open", user.Email, utils.CurrentTime(), endpoint)
+		metrics.IncSkipped(user, api, metrics.SkipReasonCircuitOpen)
 		return
 	}
 	apiKey := user.Email + "_" + path.Base(api.API) + "_" + api.MetricType
@@ -87,6 +97,7 @@ func fetchMetricsData(api *config.APIConf, user *config.User, txnID uint64, pret
 	mux.RUnlock()
 	if ok {
 		log.WithFields(log.Fields{"tid": txnID, "api": api.API, "api_type": api.Type, "metric_type": api.MetricType}).Debugf("Previous API call for %s at %v is  still active", user.Email, utils.CurrentTime())
+		metrics.IncSkipped(user, api, metrics.SkipReasonPreviousCallActive)
 		return
 	}
 	mux.Lock()
@@ -94,11 +105,13 @@ func fetchMetricsData(api *config.APIConf, user *config.User, txnID uint64, pret
 	mux.Unlock()
 
 	wg := sync.WaitGroup{}
-	requests := make(chan struct{}, config.Conf.MaxConcurrentProcess)
+	conf := config.Current()
+	requests := make(chan struct{}, conf.MaxConcurrentProcess)
+	networks := config.NetworksFor(user)
 	authType := strings.ToUpper(user.AuthType)
 	if authType == "ADTOKEN" {
 		//ABAC user
-		for nhg, orgAcc := range user.NhgIDsABAC {
+		for nhg, orgAcc := range networks.NhgIDsABAC {
 			requests <- struct{}{}
 			wg.Add(1)
 			go func(nhgID string, accDetail config.OrgAccDetails) {
@@ -110,13 +123,13 @@ func fetchMetricsData(api *config.APIConf, user *config.User, txnID uint64, pret
 					startTime: startTime,
 					endTime:   endTime,
 					index:     0,
-					limit:     config.Conf.Limit,
+					limit:     conf.Limit,
 					orgUUID:   accDetail.OrgDetails.OrgUUID,
 					accUUID:   accDetail.AccDetails.AccUUID,
 				}
-				msg := callMetricAPI(apiReq, maxRetryAttempts, txnID, prettyResponse)
+				msg := callMetricAPI(ctx, apiReq, conf.Retry.MaxAttempts, txnID, prettyResponse)
 				if msg == retryCurrentMsg {
-					callMetricAPI(apiReq, 0, txnID, prettyResponse)
+					callMetricAPI(ctx, apiReq, 0, txnID, prettyResponse)
 				}
 				<-requests
 				wg.Done()
@@ -124,7 +137,7 @@ func fetchMetricsData(api *config.APIConf, user *config.User, txnID uint64, pret
 		}
 	} else {
 		//RBAC user
-		for _, nhg := range user.NhgIDs {
+		for _, nhg := range networks.NhgIDs {
 			requests <- struct{}{}
 			wg.Add(1)
 			go func(nhgID string) {
@@ -136,11 +149,11 @@ func fetchMetricsData(api *config.APIConf, user *config.User, txnID uint64, pret
 					startTime: startTime,
 					endTime:   endTime,
 					index:     0,
-					limit:     config.Conf.Limit,
+					limit:     conf.Limit,
 				}
-				msg := callMetricAPI(apiReq, maxRetryAttempts, txnID, prettyResponse)
+				msg := callMetricAPI(ctx, apiReq, conf.Retry.MaxAttempts, txnID, prettyResponse)
 				if msg == retryCurrentMsg {
-					callMetricAPI(apiReq, 0, txnID, prettyResponse)
+					callMetricAPI(ctx, apiReq, 0, txnID, prettyResponse)
 				}
 				<-requests
 				wg.Done()
@@ -154,23 +167,28 @@ func fetchMetricsData(api *config.APIConf, user *config.User, txnID uint64, pret
 	mux.Unlock()
 }
 
-func callMetricAPI(req apiCallRequest, retryAttempts int, txnID uint64, prettyResponse bool) string {
-	apiURL := config.Conf.BaseURL + req.api.API
+func callMetricAPI(ctx context.Context, req apiCallRequest, retryAttempts int, txnID uint64, prettyResponse bool) string {
+	apiURL := config.BaseURLFor(req.user) + req.api.API
 	apiURL = strings.Replace(apiURL, "{nhg_id}", req.nhgID, -1)
 	req.url = apiURL
 
 	log.WithFields(log.Fields{"tid": txnID, "nhg_id": req.nhgID, "api_type": req.api.Type, "metric_type": req.api.MetricType}).Infof("Triggered %s for %s at %v", apiURL, req.user.Email, utils.CurrentTime())
-	response, err := callAPI(req, txnID, prettyResponse)
+	response, err := callAPI(ctx, req, txnID, prettyResponse)
 	if err != nil {
-		//retry api when 500 status code is returned
-		if strings.Contains(err.Error(), "500") {
-			response, err = retryAPICall(req, retryAttempts, txnID, prettyResponse)
+		//retry api when it's rate limited or failed with server or network error
+		if isRetryable(err) {
+			response, err = retryAPICall(ctx, req, retryAttempts, err, txnID, prettyResponse)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "nhg_id": req.nhgID, "api_url": apiURL, "start_time": req.startTime, "end_time": req.endTime, "api_type": req.api.Type, "metric_type": req.api.MetricType}).Infof("API call failed, data will be skipped...")
-				return ""
+				metrics.IncSkipped(req.user, req.api, metrics.SkipReasonAPIFailure)
+				return apiFailedMsg
 			}
+		} else if _, ok := err.(*circuitOpenError); ok {
+			metrics.IncSkipped(req.user, req.api, metrics.SkipReasonCircuitOpen)
+			return apiFailedMsg
 		} else {
-			return ""
+			metrics.IncSkipped(req.user, req.api, metrics.SkipReasonAPIFailure)
+			return apiFailedMsg
 		}
 	}
 	if response == nil {
@@ -187,7 +205,7 @@ func callMetricAPI(req apiCallRequest, retryAttempts int, txnID uint64, prettyRe
 	if response.NextRecord > 0 {
 		req.index = response.NextRecord
 		req.searchAfterKey = response.SearchAfterKey
-		noOfRecords, err = handlePagination(req, retryAttempts, txnID, prettyResponse)
+		noOfRecords, err = handlePagination(ctx, req, retryAttempts, txnID, prettyResponse)
 		if err != nil {
 			return retryCurrentMsg
 		}
@@ -198,15 +216,15 @@ func callMetricAPI(req apiCallRequest, retryAttempts int, txnID uint64, prettyRe
 	return ""
 }
 
-func handlePagination(req apiCallRequest, retryAttempts int, txnID uint64, prettyResponse bool) (int, error) {
+func handlePagination(ctx context.Context, req apiCallRequest, retryAttempts int, txnID uint64, prettyResponse bool) (int, error) {
 	var receivedNoOfRecords int
 	for req.index > 0 {
-		response, err := callAPI(req, txnID, prettyResponse)
+		response, err := callAPI(ctx, req, txnID, prettyResponse)
 		if response == nil {
 			log.WithFields(log.Fields{"tid": txnID, "nhg_id": req.nhgID, "api_url": req.url, "start_time": req.startTime, "end_time": req.endTime, "api_type": req.api.Type, "metric_type": req.api.MetricType}).Infof("found nil response, resp: %v, err: %v", response, err)
 		}
 		if err != nil {
-			response, err = retryAPICall(req, retryAttempts, txnID, prettyResponse)
+			response, err = retryAPICall(ctx, req, retryAttempts, err, txnID, prettyResponse)
 			if err != nil {
 				log.WithFields(log.Fields{"tid": txnID, "nhg_id": req.nhgID, "api_url": req.url, "start_time": req.startTime, "end_time": req.endTime, "api_type": req.api.Type, "metric_type": req.api.MetricType}).Infof("API call failed, will be retried from starting...")
 				return 0, err
@@ -232,13 +250,26 @@ func handlePagination(req apiCallRequest, retryAttempts int, txnID uint64, prett
 	return receivedNoOfRecords, nil
 }
 
-// retry failed API call
-func retryAPICall(req apiCallRequest, retryAttempts int, txnID uint64, prettyResponse bool) (*GetAPIResponse, error) {
-	var err error
+// retries the API call failed with err, waiting for the backoff of the retry policy before each attempt.
+// The call isn't retried if err, or the error of the retried call, isn't retryable, ex: 4xx response or open circuit.
+func retryAPICall(ctx context.Context, req apiCallRequest, retryAttempts int, err error, txnID uint64, prettyResponse bool) (*GetAPIResponse, error) {
 	var response *GetAPIResponse
 	for i := 0; i < retryAttempts; i++ {
-		log.WithFields(log.Fields{"txn_id": txnID, "nhg_id": req.nhgID, "api_url": req.url, "start_time": req.startTime, "end_time": req.endTime, "limit": req.limit, "index": req.index, "api_type": req.api.Type, "metric_type": req.api.MetricType}).Info("retrying api call")
-		response, err = callAPI(req, txnID, prettyResponse)
+		if !isRetryable(err) {
+			break
+		}
+		backoff, ok := retryBackoff(i, err)
+		if !ok {
+			log.WithFields(log.Fields{"tid": txnID, "error": err, "nhg_id": req.nhgID, "api_url": req.url}).Warn("Not retrying api call, Retry-After exceeds max_retry_after")
+			break
+		}
+		waitForRetry(ctx, backoff)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.WithFields(log.Fields{"txn_id": txnID, "nhg_id": req.nhgID, "api_url": req.url, "start_time": req.startTime, "end_time": req.endTime, "limit": req.limit, "index": req.index, "api_type": req.api.Type, "metric_type": req.api.MetricType, "backoff": backoff}).Info("retrying api call")
+		metrics.IncRetries(req.user, req.api)
+		response, err = callAPI(ctx, req, txnID, prettyResponse)
 		if response == nil {
 			log.WithFields(log.Fields{"tid": txnID, "nhg_id": req.nhgID, "api_url": req.url, "start_time": req.startTime, "end_time": req.endTime, "api_type": req.api.Type, "metric_type": req.api.MetricType}).Infof("err: %v, resp: %v", err, response)
 		}
@@ -251,7 +282,7 @@ func retryAPICall(req apiCallRequest, retryAttempts int, txnID uint64, prettyRes
 
 // CallAPI calls the API, adds authorization, query params and returns response.
 // If successful it returns response as array of byte, if there is any error it returns nil.
-func callAPI(req apiCallRequest, txnID uint64, prettyResponse bool) (*GetAPIResponse, error) {
+func callAPI(ctx context.Context, req apiCallRequest, txnID uint64, prettyResponse bool) (*GetAPIResponse, error) {
 	reqStartTime := time.Now()
 	request, err := http.NewRequest(http.MethodGet, req.url, nil)
 	if err != nil {
@@ -297,15 +328,25 @@ func callAPI(req apiCallRequest, txnID uint64, prettyResponse bool) (*GetAPIResp
 	request.URL.RawQuery = query.Encode()
 	log.WithFields(log.Fields{"tid": txnID, startTimeQueryParam: query[startTimeQueryParam], endTimeQueryParam: query[endTimeQueryParam]}).Info("URL:", request.URL)
 
-	response, err := doRequest(request)
+	cb := circuitFor(endpointOf(req.user, req.api.API))
+	err = cb.allow()
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "nhg_id": req.nhgID, "start_time": req.startTime, "end_time": req.endTime}).Debugf("Skipping %s for %s, %v", req.url, req.user.Email, err)
+		return nil, err
+	}
+	response, err := doRequest(ctx, request, req.user)
+	cb.record(err)
 	if err != nil {
 		if strings.Contains(err.Error(), "404: no records found") {
+			metrics.ObserveAPICall(req.user, req.api, reqStartTime, nil)
 			log.WithFields(log.Fields{"tid": txnID, "nhg_id": req.nhgID, "start_time": req.startTime, "end_time": req.endTime, "api_type": req.api.Type, "metric_type": req.api.MetricType}).Infof("No records found for %s, %s", req.url, req.user.Email)
 			return nil, nil
 		}
+		metrics.ObserveAPICall(req.user, req.api, reqStartTime, err)
 		log.WithFields(log.Fields{"tid": txnID, "error": err, "nhg_id": req.nhgID, "start_time": req.startTime, "end_time": req.endTime, "api_type": req.api.Type, "metric_type": req.api.MetricType}).Errorf("Error while calling %s for %s", req.url, req.user.Email)
 		return nil, err
 	}
+	metrics.ObserveAPICall(req.user, req.api, reqStartTime, nil)
 
 	//Map the received response to getAPIResponse struct
 	resp := new(GetAPIResponse)
@@ -329,22 +370,26 @@ func callAPI(req apiCallRequest, txnID uint64, prettyResponse bool) (*GetAPIResp
 		log.WithFields(log.Fields{"tid": txnID, "api_url": req.url, "user": req.user.Email, "total_no_of_records": resp.TotalNumRecords}).Info("no records found")
 		return resp, nil
 	}
+	metrics.AddRecordsReceived(req.user, req.api, resp.NumOfRecords)
 
-	//storing LastReceivedDataTime timestamp value to file
-	err = utils.StoreLastReceivedDataTime(req.user, resp.Data, req.api, req.nhgID, txnID)
-	if err != nil {
-		log.WithFields(log.Fields{"tid": txnID}).Error(err)
-	}
-
-	if path.Base(req.api.API) == fmResponseType {
-		go notifier.RaiseAlarmNotification(txnID, resp.Data, req.api.Type)
-	}
-	//write response
-	err = utils.WriteResponse(req.user, req.api, resp.Data, req.nhgID, txnID, prettyResponse)
+	//write response, the checkpoint is stored and the alarms are notified only once the response is written to the sink,
+	//so that the data is collected again if the sink is down
+	err = writeResponse(req.user, req.api, resp.Data, req.nhgID, txnID, prettyResponse)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("unable to write response for %s", req.user.Email)
 		return nil, err
 	}
+	if !req.backfill {
+		//storing LastReceivedDataTime timestamp value to checkpoint store
+		err = utils.StoreLastReceivedDataTime(req.user, resp.Data, req.api, req.nhgID, txnID)
+		if err != nil {
+			log.WithFields(log.Fields{"tid": txnID}).Error(err)
+		}
+
+		if path.Base(req.api.API) == fmResponseType {
+			go notifier.RaiseAlarmNotification(txnID, resp.Data, req.api.Type)
+		}
+	}
 	resp.Data = nil
 	return resp, nil
 }
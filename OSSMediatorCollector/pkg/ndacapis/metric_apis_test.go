@@ -8,16 +8,20 @@ package ndacapis
 
 import (
 	"bytes"
+	"collector/pkg/checkpoint"
 	"collector/pkg/config"
 	"collector/pkg/utils"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -121,7 +125,7 @@ func TestCallAPIForInvalidCase(t *testing.T) {
 		index:     0,
 		limit:     100,
 	}
-	response, err := callAPI(apiReq, 123, true)
+	response, err := callAPI(context.Background(), apiReq, 123, true)
 	if err == nil || response != nil || !strings.Contains(err.Error(), "error while validating response status") {
 		t.Fail()
 	}
@@ -151,7 +155,7 @@ func TestCallAPIForInvalidURL(t *testing.T) {
 		index:     0,
 		limit:     100,
 	}
-	response, err := callAPI(apiReq, 123, true)
+	response, err := callAPI(context.Background(), apiReq, 123, true)
 	if err == nil || response != nil || !strings.Contains(err.Error(), "missing protocol scheme") {
 		t.Fail()
 	}
@@ -188,7 +192,7 @@ func TestCallAPI(t *testing.T) {
 		index:     0,
 		limit:     100,
 	}
-	resp, err := callAPI(apiReq, 123, true)
+	resp, err := callAPI(context.Background(), apiReq, 123, true)
 	if err != nil || resp.Status.StatusCode != "SUCCESS" || resp.Type != "fmdata" || resp.TotalNumRecords != 2 || resp.NumOfRecords != 2 || resp.NextRecord != 0 {
 		t.Fail()
 	}
@@ -224,7 +228,7 @@ func TestCallAPIWithInvalidResponse(t *testing.T) {
 		limit:     100,
 	}
 
-	resp, err := callAPI(apiReq, 123, true)
+	resp, err := callAPI(context.Background(), apiReq, 123, true)
 	if resp != nil && strings.Contains(err.Error(), "Unable to decode response") {
 		t.Fail()
 	}
@@ -261,7 +265,7 @@ func TestCallAPIWithSkipCert(t *testing.T) {
 		index:     0,
 		limit:     100,
 	}
-	resp, err := callAPI(apiReq, 123, true)
+	resp, err := callAPI(context.Background(), apiReq, 123, true)
 	if err != nil || resp.Status.StatusCode != "SUCCESS" || resp.Type != "fmdata" || resp.TotalNumRecords != 2 || resp.NumOfRecords != 2 || resp.NextRecord != 0 {
 		t.Fail()
 	}
@@ -301,7 +305,7 @@ func TestCallAPIWithCert(t *testing.T) {
 		limit:     100,
 	}
 
-	resp, err := callAPI(apiReq, 123, true)
+	resp, err := callAPI(context.Background(), apiReq, 123, true)
 	if err != nil || resp.Status.StatusCode != "SUCCESS" || resp.Type != "fmdata" || resp.TotalNumRecords != 2 || resp.NumOfRecords != 2 || resp.NextRecord != 0 {
 		t.Fail()
 	}
@@ -336,7 +340,7 @@ func TestCallAPIWithErrorStatusCode(t *testing.T) {
 		index:     0,
 		limit:     100,
 	}
-	resp, err := callAPI(apiReq, 123, true)
+	resp, err := callAPI(context.Background(), apiReq, 123, true)
 	if err == nil || resp != nil {
 		t.Fail()
 	}
@@ -351,7 +355,7 @@ func TestCallAPIWithInactiveSession(t *testing.T) {
 	user := config.User{Email: "testuser@nokia.com", IsSessionAlive: false}
 	api := &config.APIConf{API: "/fmdata", Interval: 15}
 	config.Conf.MaxConcurrentProcess = 1
-	fetchMetricsData(api, &user, 123, false)
+	fetchMetricsData(context.Background(), api, &user, 123, false)
 
 	if !strings.Contains(buf.String(), "Skipping API call for testuser@nokia.com") {
 		t.Fail()
@@ -368,7 +372,7 @@ func TestCallAPIWithInactiveSessionABAC(t *testing.T) {
 	user.AuthType = "ADTOKEN"
 	api := &config.APIConf{API: "/fmdata", Interval: 15}
 	config.Conf.MaxConcurrentProcess = 1
-	fetchMetricsData(api, &user, 123, false)
+	fetchMetricsData(context.Background(), api, &user, 123, false)
 
 	if !strings.Contains(buf.String(), "Skipping API call for testuser@nokia.com") {
 		t.Fail()
@@ -402,14 +406,14 @@ func TestAPICallWithPagination(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test_nhg_1"] = orgAcc
-	user.NhgIDs = []string{"test_nhg_1"}
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDs: []string{"test_nhg_1"}}, utils.CurrentTime())
 	CreateHTTPClient("", true)
 	apiConf := &config.APIConf{API: "/fmdata", Interval: 15}
 	config.Conf.BaseURL = testServer.URL
 	config.Conf.MaxConcurrentProcess = 1
 	utils.CreateResponseDirectory(user.ResponseDest, apiConf.API)
 
-	fetchMetricsData(apiConf, &user, 123, true)
+	fetchMetricsData(context.Background(), apiConf, &user, 123, true)
 	files, err := ioutil.ReadDir(user.ResponseDest + apiConf.API)
 	if err != nil {
 		t.Error(err)
@@ -447,7 +451,7 @@ func TestAPICallWithPaginationABAC(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test_nhg_1"] = orgAcc
-	user.NhgIDsABAC = m
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDsABAC: m}, utils.CurrentTime())
 	user.AuthType = "ADTOKEN"
 	CreateHTTPClient("", true)
 	apiConf := &config.APIConf{API: "/fmdata", Interval: 15}
@@ -455,7 +459,7 @@ func TestAPICallWithPaginationABAC(t *testing.T) {
 	config.Conf.MaxConcurrentProcess = 1
 	utils.CreateResponseDirectory(user.ResponseDest, apiConf.API)
 
-	fetchMetricsData(apiConf, &user, 123, true)
+	fetchMetricsData(context.Background(), apiConf, &user, 123, true)
 	files, err := ioutil.ReadDir(user.ResponseDest + apiConf.API)
 	if err != nil {
 		t.Error(err)
@@ -497,14 +501,14 @@ func TestRetryAPICall(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test_nhg_1"] = orgAcc
-	user.NhgIDs = []string{"test_nhg_1"}
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDs: []string{"test_nhg_1"}}, utils.CurrentTime())
 	CreateHTTPClient("", true)
 	apiConf := &config.APIConf{API: "/fmdata", Interval: 15}
 	config.Conf.BaseURL = testServer.URL
 	config.Conf.MaxConcurrentProcess = 1
 	utils.CreateResponseDirectory(user.ResponseDest, apiConf.API)
 
-	fetchMetricsData(apiConf, &user, 123, false)
+	fetchMetricsData(context.Background(), apiConf, &user, 123, false)
 	files, err := ioutil.ReadDir(user.ResponseDest + apiConf.API)
 	if err != nil {
 		t.Error(err)
@@ -547,14 +551,14 @@ func TestRetryAPICallABAC(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test_nhg_1"] = orgAcc
-	user.NhgIDsABAC = m
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDsABAC: m}, utils.CurrentTime())
 	CreateHTTPClient("", true)
 	apiConf := &config.APIConf{API: "/fmdata", Interval: 15}
 	config.Conf.BaseURL = testServer.URL
 	config.Conf.MaxConcurrentProcess = 1
 	utils.CreateResponseDirectory(user.ResponseDest, apiConf.API)
 
-	fetchMetricsData(apiConf, &user, 123, false)
+	fetchMetricsData(context.Background(), apiConf, &user, 123, false)
 	files, err := ioutil.ReadDir(user.ResponseDest + apiConf.API)
 	if err != nil {
 		t.Error(err)
@@ -603,7 +607,7 @@ func TestCallMetricAPIForLargeResponse(t *testing.T) {
 	}
 	config.Conf.BaseURL = testServer.URL
 
-	status := callMetricAPI(apiReq, 1, 123, false)
+	status := callMetricAPI(context.Background(), apiReq, 1, 123, false)
 	if status != "" {
 		t.Fail()
 	}
@@ -635,7 +639,7 @@ func TestFetchMetricsDataWithRetryNextABAC(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test_nhg_1"] = orgAcc
-	user.NhgIDsABAC = m
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDsABAC: m}, utils.CurrentTime())
 
 	user.AuthType = "ADTOKEN"
 	CreateHTTPClient("", true)
@@ -644,7 +648,7 @@ func TestFetchMetricsDataWithRetryNextABAC(t *testing.T) {
 	config.Conf.MaxConcurrentProcess = 1
 	utils.CreateResponseDirectory(user.ResponseDest, apiConf.API)
 
-	fetchMetricsData(apiConf, &user, 123, false)
+	fetchMetricsData(context.Background(), apiConf, &user, 123, false)
 	files, err := ioutil.ReadDir(user.ResponseDest + apiConf.API)
 	if err != nil {
 		t.Error(err)
@@ -681,14 +685,14 @@ func TestFetchMetricsDataWithRetryNext(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test_nhg_1"] = orgAcc
-	user.NhgIDs = []string{"test_nhg_1"}
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDs: []string{"test_nhg_1"}}, utils.CurrentTime())
 	CreateHTTPClient("", true)
 	apiConf := &config.APIConf{API: "/fmdata", Interval: 15}
 	config.Conf.BaseURL = testServer.URL
 	config.Conf.MaxConcurrentProcess = 1
 	utils.CreateResponseDirectory(user.ResponseDest, apiConf.API)
 
-	fetchMetricsData(apiConf, &user, 123, false)
+	fetchMetricsData(context.Background(), apiConf, &user, 123, false)
 	files, err := ioutil.ReadDir(user.ResponseDest + apiConf.API)
 	if err != nil {
 		t.Error(err)
@@ -698,3 +702,73 @@ func TestFetchMetricsDataWithRetryNext(t *testing.T) {
 	}
 	os.RemoveAll(user.ResponseDest)
 }
+
+func TestCallAPIStoresCheckpointAfterWrite(t *testing.T) {
+	sinkStatus := http.StatusBadRequest
+	sinkServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(sinkStatus)
+	}))
+	defer sinkServer.Close()
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, fmResponse)
+	}))
+	defer testServer.Close()
+
+	err := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer checkpoint.Close()
+
+	user := &config.User{Email: "testuser@nokia.com", IsSessionAlive: true}
+	user.SessionToken = &config.SessionToken{AccessToken: "accessToken", RefreshToken: "refreshToken", ExpiryTime: utils.CurrentTime()}
+	apiConf := &config.APIConf{API: "/fmdata", Interval: 15, Type: "HISTORY", Sink: &config.SinkConf{Type: config.HTTPSink, URL: sinkServer.URL}}
+	CreateHTTPClient("", false)
+	apiReq := apiCallRequest{url: testServer.URL + apiConf.API, api: apiConf, user: user, nhgID: "test_nhg_1", limit: 100}
+
+	//checkpoint isn't moved if the response isn't written to the sink
+	_, err = callAPI(context.Background(), apiReq, 123, false)
+	if err == nil {
+		t.Error("expected error when sink write fails")
+	}
+	if value, _ := checkpoint.Get(checkpoint.KeyFor(user, apiConf, "test_nhg_1")); value != "" {
+		t.Errorf("expected no checkpoint, got %s", value)
+	}
+
+	sinkStatus = http.StatusAccepted
+	_, err = callAPI(context.Background(), apiReq, 124, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := checkpoint.Get(checkpoint.KeyFor(user, apiConf, "test_nhg_1")); value == "" {
+		t.Error("expected checkpoint to be stored after the response is written")
+	}
+}
+
+func TestRetryAPICallWithNonRetryableError(t *testing.T) {
+	calls := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		fmt.Fprintln(w, fmResponse)
+	}))
+	defer testServer.Close()
+	prevRetry := config.Conf.Retry
+	defer func() { config.Conf.Retry = prevRetry }()
+	config.Conf.Retry = config.RetryConf{MaxAttempts: 3, InitialBackoff: 60, MaxBackoff: 60, Multiplier: 1}
+	CreateHTTPClient("", false)
+
+	user := &config.User{Email: "testuser@nokia.com", IsSessionAlive: true, SessionToken: &config.SessionToken{AccessToken: "accessToken"}}
+	apiReq := apiCallRequest{url: testServer.URL + "/fmdata", api: &config.APIConf{API: "/fmdata", Interval: 15}, user: user, limit: 100}
+	for _, err := range []error{&APIError{StatusCode: http.StatusBadRequest}, &circuitOpenError{endpoint: apiReq.url}, &transportError{err: os.ErrNotExist}} {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		response, retryErr := retryAPICall(ctx, apiReq, 3, err, 123, false)
+		cancel()
+		if response != nil || retryErr != err {
+			t.Errorf("expected %v without retry, got %v", err, retryErr)
+		}
+	}
+	if calls != 0 {
+		t.Errorf("expected no retries, got %d calls", calls)
+	}
+}
@@ -0,0 +1,223 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/inventory"
+	"collector/pkg/notifier"
+	"collector/pkg/utils"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NetworkEventsAPI is the response directory of the network events, it isn't a DAC API.
+const NetworkEventsAPI = "/network-events"
+
+// Network event types.
+const (
+	networkAddedEvent          = "ADDED"
+	networkRemovedEvent        = "REMOVED"
+	networkStatusChangedEvent  = "STATUS_CHANGED"
+	networkClusterChangedEvent = "CLUSTER_CHANGED"
+	networkHwSetChangedEvent   = "HW_SET_CHANGED"
+
+	nhgNetworkType = "NHG"
+	gngNetworkType = "GNG"
+)
+
+// networkState is the state of a network in the network list, compared with the next list to find the changes.
+// The last states are stored along with the user's inventory, so the changes made while the collector is down are found.
+type networkState struct {
+	Status   string   `json:"status"`
+	Clusters []string `json:"clusters,omitempty"`
+	HwIDs    []string `json:"hw_ids,omitempty"`
+	OrgID    string   `json:"org_id,omitempty"`
+	AccID    string   `json:"acc_id,omitempty"`
+}
+
+var (
+	//last network states per user by network type, restored from the stored states on first diff of the user
+	networkStates    = make(map[string]map[string]map[string]networkState)
+	networkStatesMux sync.Mutex
+)
+
+// adds the states of the networks in NHG list to states, all the networks in the allowed slices are included
+// irrespective of their status. states can be nil if the network events aren't required.
+func nhgStates(nhgData []NetworkInfo, states map[string]networkState, allowedSliceIDs []string, orgID, accID string) {
+	if states == nil {
+		return
+	}
+	for _, nhgInfo := range nhgData {
+		if !isNhgInSlices(nhgInfo, allowedSliceIDs) {
+			continue
+		}
+		state := networkState{Status: nhgInfo.NhgConfigStatus, OrgID: orgID, AccID: accID}
+		for _, cluster := range nhgInfo.Clusters {
+			state.Clusters = append(state.Clusters, cluster.ClusterID)
+			for _, hwSet := range cluster.HwSet {
+				state.HwIDs = append(state.HwIDs, hwSet.HwID)
+			}
+		}
+		slices.Sort(state.Clusters)
+		slices.Sort(state.HwIDs)
+		state.Clusters = slices.Compact(state.Clusters)
+		state.HwIDs = slices.Compact(state.HwIDs)
+		states[nhgInfo.NhgID] = state
+	}
+}
+
+// adds the states of the networks in GNG list to states, all the networks in the allowed slices are included
+// irrespective of their admin state. states can be nil if the network events aren't required.
+func gngStates(gngData []GngInfo, states map[string]networkState, allowedSliceIDs []string, orgID, accID string) {
+	if states == nil {
+		return
+	}
+	for _, gngInfo := range gngData {
+		if isGngInSlices(gngInfo, allowedSliceIDs) {
+			states[gngInfo.GngId] = networkState{Status: gngInfo.AdminState, OrgID: orgID, AccID: accID}
+		}
+	}
+}
+
+// compares the networks with the user's last network lists and emits the changes as network events, states are keyed
+// by network type. The last lists are restored from the stored states after restart, the first lists of the user are
+// only stored, as there is nothing to compare them with.
+// The caller should pass only the complete lists, a partially fetched list reports the missing networks as removed.
+func diffNetworks(user *config.User, states map[string]map[string]networkState, txnID uint64, prettyResponse bool) {
+	networkStatesMux.Lock()
+	last, ok := networkStates[user.Email]
+	if !ok {
+		last = restoreNetworkStates(user)
+	}
+	updated := make(map[string]map[string]networkState)
+	maps.Copy(updated, last)
+	maps.Copy(updated, states)
+	networkStates[user.Email] = updated
+	err := inventory.SaveNetworkStates(user, updated)
+	networkStatesMux.Unlock()
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Unable to store network states of %s", user.Email)
+	}
+
+	var events []notifier.NetworkEvent
+	eventTime := utils.CurrentTime()
+	for _, networkType := range []string{nhgNetworkType, gngNetworkType} {
+		current, ok := states[networkType]
+		lastStates, found := last[networkType]
+		if !ok || !found {
+			continue
+		}
+		typeEvents := networkEvents(user.Email, networkType, lastStates, current, eventTime)
+		if len(typeEvents) > 0 {
+			log.WithFields(log.Fields{"tid": txnID, "user": user.Email}).Infof("Found %d %s network changes", len(typeEvents), networkType)
+		}
+		events = append(events, typeEvents...)
+	}
+	if len(events) == 0 {
+		return
+	}
+	err = writeResponse(user, &config.APIConf{API: NetworkEventsAPI}, events, "", txnID, prettyResponse)
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("unable to write network events for %s", user.Email)
+	}
+	go notifier.RaiseNetworkEventNotification(txnID, events)
+}
+
+// returns the user's network states stored by the earlier run, nil if they aren't stored.
+func restoreNetworkStates(user *config.User) map[string]map[string]networkState {
+	var states map[string]map[string]networkState
+	_, err := inventory.RestoreNetworkStates(user, &states)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Unable to restore network states of %s", user.Email)
+		return nil
+	}
+	return states
+}
+
+// returns the events of the changes from last to current network states, sorted by network ID.
+func networkEvents(email string, networkType string, last, current map[string]networkState, eventTime time.Time) []notifier.NetworkEvent {
+	var events []notifier.NetworkEvent
+	newEvent := func(eventType string, networkID string, state networkState) notifier.NetworkEvent {
+		return notifier.NetworkEvent{
+			EventType:   eventType,
+			EventTime:   eventTime.UTC().Format(time.RFC3339),
+			User:        email,
+			NetworkType: networkType,
+			NetworkID:   networkID,
+			OrgID:       state.OrgID,
+			AccID:       state.AccID,
+		}
+	}
+
+	for networkID, state := range current {
+		lastState, ok := last[networkID]
+		if !ok {
+			event := newEvent(networkAddedEvent, networkID, state)
+			event.NewStatus = state.Status
+			event.AddedClusters = state.Clusters
+			event.AddedHwIDs = state.HwIDs
+			events = append(events, event)
+			continue
+		}
+		if lastState.Status != state.Status {
+			event := newEvent(networkStatusChangedEvent, networkID, state)
+			event.OldStatus = lastState.Status
+			event.NewStatus = state.Status
+			events = append(events, event)
+		}
+		if added, removed := difference(lastState.Clusters, state.Clusters); len(added) > 0 || len(removed) > 0 {
+			event := newEvent(networkClusterChangedEvent, networkID, state)
+			event.AddedClusters = added
+			event.RemovedClusters = removed
+			events = append(events, event)
+		}
+		if added, removed := difference(lastState.HwIDs, state.HwIDs); len(added) > 0 || len(removed) > 0 {
+			event := newEvent(networkHwSetChangedEvent, networkID, state)
+			event.AddedHwIDs = added
+			event.RemovedHwIDs = removed
+			events = append(events, event)
+		}
+	}
+	for networkID, lastState := range last {
+		if _, ok := current[networkID]; !ok {
+			event := newEvent(networkRemovedEvent, networkID, lastState)
+			event.OldStatus = lastState.Status
+			event.RemovedClusters = lastState.Clusters
+			event.RemovedHwIDs = lastState.HwIDs
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].NetworkID != events[j].NetworkID {
+			return events[i].NetworkID < events[j].NetworkID
+		}
+		return events[i].EventType < events[j].EventType
+	})
+	return events
+}
+
+// returns the items of current not in last and the items of last not in current, both lists are sorted.
+func difference(last, current []string) ([]string, []string) {
+	var added, removed []string
+	for _, item := range current {
+		if _, found := slices.BinarySearch(last, item); !found {
+			added = append(added, item)
+		}
+	}
+	for _, item := range last {
+		if _, found := slices.BinarySearch(current, item); !found {
+			removed = append(removed, item)
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,151 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/inventory"
+	"collector/pkg/notifier"
+	"collector/pkg/utils"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkEvents(t *testing.T) {
+	last := map[string]networkState{
+		"nhg1": {Status: "ACTIVE", Clusters: []string{"1"}, HwIDs: []string{"hw1", "hw2"}},
+		"nhg2": {Status: "ACTIVE", Clusters: []string{"1", "2"}, HwIDs: []string{"hw3"}},
+		"nhg3": {Status: "ACTIVE"},
+	}
+	current := map[string]networkState{
+		"nhg1": {Status: "NW_CFG_UNAVAILABLE", Clusters: []string{"1"}, HwIDs: []string{"hw1", "hw4"}},
+		"nhg2": {Status: "ACTIVE", Clusters: []string{"2"}, HwIDs: []string{"hw3"}},
+		"nhg4": {Status: "CONFIG_READY", Clusters: []string{"1"}, HwIDs: []string{"hw5"}, OrgID: "org1", AccID: "acc1"},
+	}
+	eventTime := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	events := networkEvents("user1@nokia.com", nhgNetworkType, last, current, eventTime)
+
+	newEvent := func(eventType, networkID string) notifier.NetworkEvent {
+		return notifier.NetworkEvent{EventType: eventType, EventTime: "2024-01-02T15:00:00Z", User: "user1@nokia.com", NetworkType: nhgNetworkType, NetworkID: networkID}
+	}
+	hwSetChanged := newEvent(networkHwSetChangedEvent, "nhg1")
+	hwSetChanged.AddedHwIDs = []string{"hw4"}
+	hwSetChanged.RemovedHwIDs = []string{"hw2"}
+	statusChanged := newEvent(networkStatusChangedEvent, "nhg1")
+	statusChanged.OldStatus = "ACTIVE"
+	statusChanged.NewStatus = "NW_CFG_UNAVAILABLE"
+	clusterChanged := newEvent(networkClusterChangedEvent, "nhg2")
+	clusterChanged.RemovedClusters = []string{"1"}
+	removed := newEvent(networkRemovedEvent, "nhg3")
+	removed.OldStatus = "ACTIVE"
+	added := newEvent(networkAddedEvent, "nhg4")
+	added.OrgID = "org1"
+	added.AccID = "acc1"
+	added.NewStatus = "CONFIG_READY"
+	added.AddedClusters = []string{"1"}
+	added.AddedHwIDs = []string{"hw5"}
+	assert.Equal(t, []notifier.NetworkEvent{hwSetChanged, statusChanged, clusterChanged, removed, added}, events)
+
+	assert.Empty(t, networkEvents("user1@nokia.com", nhgNetworkType, current, current, eventTime))
+}
+
+func TestFetchNetworkDetailsWritesNetworkEvents(t *testing.T) {
+	//nhg_2 is outside the user's allowed slices
+	nhgs := `{"status": {"status_code": "SUCCESS"}, "network_info": [
+		{"nhg_id": "nhg_1", "nhg_config_status": "ACTIVE", "clusters": [{"cluster_id": "1", "slice_id": "slice_1", "hw_set": [{"hw_id": "hw_1"}]}]},
+		{"nhg_id": "nhg_2", "nhg_config_status": "ACTIVE", "clusters": [{"cluster_id": "1", "slice_id": "slice_2", "hw_set": [{"hw_id": "hw_2"}]}]}
+	]}`
+	gngs := `{"status": {"status_code": "SUCCESS"}, "gng_info": [{"gng_id": "gng_1", "admin_state": "FULLY_ACTIVATED", "slice_id": "slice_1"}]}`
+	nhgResponse, gngResponse := nhgs, gngs
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/nhgs":
+			fmt.Fprintln(w, nhgResponse)
+		case "/gngs":
+			fmt.Fprintln(w, gngResponse)
+		}
+	}))
+	defer testServer.Close()
+	prevConf := config.Conf
+	config.Conf = config.Config{BaseURL: testServer.URL}
+	defer func() { config.Conf = prevConf }()
+	CreateHTTPClient("", false)
+	assert.Nil(t, inventory.Init(t.TempDir()))
+	defer inventory.Init("")
+
+	api := &config.ListNetworkAPIConf{NhgAPI: "/nhgs", GngAPI: "/gngs", Interval: 60}
+	user := &config.User{Email: "events@nokia.com", ResponseDest: t.TempDir(), AuthType: "PASSWORD", AllowedSliceIDs: []string{"slice_1"}, SessionToken: &config.SessionToken{}}
+	utils.CreateResponseDirectory(user.ResponseDest, api.NhgAPI)
+	utils.CreateResponseDirectory(user.ResponseDest, api.GngAPI)
+	utils.CreateResponseDirectory(user.ResponseDest, NetworkEventsAPI)
+	forgetStates := func() {
+		networkStatesMux.Lock()
+		delete(networkStates, user.Email)
+		networkStatesMux.Unlock()
+	}
+	defer forgetStates()
+	eventsDir := filepath.Join(user.ResponseDest, "network-events")
+	readEvents := func() []notifier.NetworkEvent {
+		files, err := os.ReadDir(eventsDir)
+		assert.Nil(t, err)
+		var events []notifier.NetworkEvent
+		for _, file := range files {
+			data, err := os.ReadFile(filepath.Join(eventsDir, file.Name()))
+			assert.Nil(t, err)
+			var fileEvents []notifier.NetworkEvent
+			assert.Nil(t, json.Unmarshal(data, &fileEvents))
+			events = append(events, fileEvents...)
+			os.Remove(filepath.Join(eventsDir, file.Name()))
+		}
+		return events
+	}
+
+	fetchNetworkDetails(context.Background(), api, user, false)
+	assert.Empty(t, readEvents(), "first network list shouldn't be reported")
+
+	//networks changed while the collector is down are found with the stored network states
+	forgetStates()
+	nhgResponse = strings.Replace(nhgs, `"nhg_id": "nhg_1", "nhg_config_status": "ACTIVE"`, `"nhg_id": "nhg_1", "nhg_config_status": "NW_CFG_UNAVAILABLE"`, 1)
+	nhgResponse = strings.Replace(nhgResponse, `"nhg_id": "nhg_2", "nhg_config_status": "ACTIVE"`, `"nhg_id": "nhg_2", "nhg_config_status": "NW_CFG_UNAVAILABLE"`, 1)
+	fetchNetworkDetails(context.Background(), api, user, false)
+	events := readEvents()
+	if assert.Len(t, events, 1, "networks outside the allowed slices shouldn't be reported") {
+		assert.Equal(t, networkStatusChangedEvent, events[0].EventType)
+		assert.Equal(t, "nhg_1", events[0].NetworkID)
+		assert.Equal(t, "ACTIVE", events[0].OldStatus)
+		assert.Equal(t, "NW_CFG_UNAVAILABLE", events[0].NewStatus)
+	}
+
+	//lists aren't compared until both are fetched, the NHGs missing in the partial fetch aren't reported as removed
+	gngResponse = "invalid"
+	nhgResponse = `{"status": {"status_code": "SUCCESS"}, "network_info": []}`
+	fetchNetworkDetails(context.Background(), api, user, false)
+	assert.Empty(t, readEvents())
+
+	gngResponse = `{"status": {"status_code": "SUCCESS"}, "gng_info": []}`
+	nhgResponse = nhgs
+	fetchNetworkDetails(context.Background(), api, user, false)
+	events = readEvents()
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, networkStatusChangedEvent, events[0].EventType)
+		assert.Equal(t, "nhg_1", events[0].NetworkID)
+		assert.Equal(t, networkRemovedEvent, events[1].EventType)
+		assert.Equal(t, gngNetworkType, events[1].NetworkType)
+		assert.Equal(t, "gng_1", events[1].NetworkID)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// tokenBucket allows rate requests per second, with up to burst requests together.
+type tokenBucket struct {
+	mux    sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	return &tokenBucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// reserve takes a token from the bucket and returns the duration to wait before the request can be sent.
+// The token is taken even if the bucket is empty, so the waiting requests are served in order.
+func (b *tokenBucket) reserve(now time.Time) time.Duration {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel gives back the token taken by reserve, when the request is abandoned before it's sent.
+func (b *tokenBucket) cancel() {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	b.tokens++
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+}
+
+// rateLimitWaitError is returned when the request is abandoned while waiting for the rate limit. The request isn't
+// sent, so it doesn't show the endpoint's health.
+type rateLimitWaitError struct {
+	err error
+}
+
+func (e *rateLimitWaitError) Error() string {
+	return fmt.Sprintf("request abandoned while waiting for rate limit: %v", e.err)
+}
+
+func (e *rateLimitWaitError) Unwrap() error {
+	return e.err
+}
+
+// rateLimiter limits the requests sent by the HTTP client, as per the rate limit config.
+// Requests are rate limited per base URL and user, and the no. of requests in progress is limited across all the users.
+// The requests wait before they are sent, so the wait isn't counted in the HTTP client's timeout.
+type rateLimiter struct {
+	conf     config.RateLimitConf
+	inFlight chan struct{}
+
+	mux     sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+// creates the rate limiter, nil is returned if the rate limit isn't configured.
+func newRateLimiter(conf config.RateLimitConf) *rateLimiter {
+	if conf.RequestsPerSecond <= 0 && conf.MaxInFlight <= 0 {
+		return nil
+	}
+	limiter := &rateLimiter{conf: conf, buckets: make(map[string]*tokenBucket)}
+	if conf.MaxInFlight > 0 {
+		limiter.inFlight = make(chan struct{}, conf.MaxInFlight)
+	}
+	return limiter
+}
+
+// returns the token bucket of the request's base URL and user, creating it on first request.
+func (l *rateLimiter) bucket(request *http.Request, user *config.User) *tokenBucket {
+	var email string
+	if user != nil {
+		email = user.Email
+	}
+	key := request.URL.Scheme + "://" + request.URL.Host + " " + email
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = newTokenBucket(l.conf.RequestsPerSecond, l.conf.Burst)
+		l.buckets[key] = b
+	}
+	return b
+}
+
+// wait blocks until the user's request can be sent or ctx is cancelled. The returned release has to be called once
+// the response is read. If ctx is cancelled while waiting, the token is given back and rateLimitWaitError is returned.
+func (l *rateLimiter) wait(ctx context.Context, request *http.Request, user *config.User) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	var email string
+	if user != nil {
+		email = user.Email
+	}
+	if l.conf.RequestsPerSecond > 0 {
+		b := l.bucket(request, user)
+		if wait := b.reserve(time.Now()); wait > 0 {
+			log.WithFields(log.Fields{"wait": wait}).Infof("Rate limit reached for %s, %s, waiting before calling %s", request.URL.Host, email, request.URL.Path)
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				b.cancel()
+				return nil, &rateLimitWaitError{err: ctx.Err()}
+			}
+		}
+	}
+
+	if l.inFlight == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.inFlight <- struct{}{}:
+	default:
+		log.Infof("%d requests are in progress, waiting before calling %s", l.conf.MaxInFlight, request.URL.Path)
+		select {
+		case l.inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, &rateLimitWaitError{err: ctx.Err()}
+		}
+	}
+	var once sync.Once
+	return func() { once.Do(func() { <-l.inFlight }) }, nil
+}
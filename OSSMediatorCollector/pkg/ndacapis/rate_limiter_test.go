@@ -0,0 +1,164 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketReserve(t *testing.T) {
+	b := newTokenBucket(2, 2)
+	now := b.last
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	//bucket is empty, waits for 1 token at 2 per second
+	assert.Equal(t, 500*time.Millisecond, b.reserve(now))
+	assert.Equal(t, time.Second, b.reserve(now))
+
+	//tokens are refilled up to burst
+	assert.Equal(t, time.Duration(0), b.reserve(now.Add(10*time.Second)))
+	assert.Equal(t, time.Duration(0), b.reserve(now.Add(10*time.Second)))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(now.Add(10*time.Second)))
+}
+
+func TestTokenBucketCancel(t *testing.T) {
+	b := newTokenBucket(2, 1)
+	now := b.last
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, 500*time.Millisecond, b.reserve(now))
+	//abandoned request gives back its token, the next request waits same as the abandoned one
+	b.cancel()
+	assert.Equal(t, 500*time.Millisecond, b.reserve(now))
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	assert.Nil(t, newRateLimiter(config.RateLimitConf{}))
+}
+
+func TestRateLimiterPerUser(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{}")
+	}))
+	defer testServer.Close()
+	limiter = newRateLimiter(config.RateLimitConf{RequestsPerSecond: 10, Burst: 1})
+	defer func() { limiter = nil }()
+	user1 := &config.User{Email: "user1@nokia.com"}
+	user2 := &config.User{Email: "user2@nokia.com"}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		request, _ := http.NewRequest(http.MethodGet, testServer.URL, nil)
+		_, err := doRequest(context.Background(), request, user1)
+		assert.Nil(t, err)
+	}
+	assert.True(t, time.Since(start) >= 180*time.Millisecond, time.Since(start))
+
+	//other user's requests aren't limited by user1's bucket
+	start = time.Now()
+	request, _ := http.NewRequest(http.MethodGet, testServer.URL, nil)
+	_, err := doRequest(context.Background(), request, user2)
+	assert.Nil(t, err)
+	assert.True(t, time.Since(start) < 80*time.Millisecond, time.Since(start))
+}
+
+func TestRateLimiterMaxInFlight(t *testing.T) {
+	var current, peak int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&current, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&current, -1)
+		fmt.Fprint(w, "{}")
+	}))
+	defer testServer.Close()
+	limiter = newRateLimiter(config.RateLimitConf{MaxInFlight: 2})
+	defer func() { limiter = nil }()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			request, _ := http.NewRequest(http.MethodGet, testServer.URL, nil)
+			_, err := doRequest(context.Background(), request, &config.User{Email: fmt.Sprintf("user%d@nokia.com", i)})
+			assert.Nil(t, err)
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&peak))
+}
+
+func TestRateLimiterWaitIsNotCountedInTimeout(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{}")
+	}))
+	defer testServer.Close()
+	client = &http.Client{Timeout: 100 * time.Millisecond}
+	defer CreateHTTPClient("", false)
+	limiter = newRateLimiter(config.RateLimitConf{RequestsPerSecond: 5, Burst: 1})
+	defer func() { limiter = nil }()
+	user := &config.User{Email: "user1@nokia.com"}
+
+	//second request waits 200ms for the rate limit, longer than the client's timeout
+	for i := 0; i < 2; i++ {
+		request, _ := http.NewRequest(http.MethodGet, testServer.URL, nil)
+		_, err := doRequest(context.Background(), request, user)
+		assert.Nil(t, err)
+	}
+}
+
+func TestRateLimiterWaitAbandoned(t *testing.T) {
+	prevConf := config.Conf
+	config.Conf.CircuitBreaker = config.CircuitBreakerConf{FailureThreshold: 1, OpenTimeout: 60}
+	defer func() { config.Conf = prevConf }()
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{}")
+	}))
+	defer testServer.Close()
+	limiter = newRateLimiter(config.RateLimitConf{RequestsPerSecond: 1, Burst: 1})
+	defer func() { limiter = nil }()
+	user := &config.User{Email: "user1@nokia.com"}
+
+	request, _ := http.NewRequest(http.MethodGet, testServer.URL, nil)
+	_, err := doRequest(context.Background(), request, user)
+	assert.Nil(t, err)
+
+	//request abandoned while waiting isn't retried and isn't a failure of the endpoint
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	request, _ = http.NewRequest(http.MethodGet, testServer.URL, nil)
+	_, err = doRequest(ctx, request, user)
+	var waitErr *rateLimitWaitError
+	assert.ErrorAs(t, err, &waitErr)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.False(t, isRetryable(err))
+	cb := circuitFor(testServer.URL + "/abandoned")
+	cb.record(err)
+	assert.Nil(t, cb.allow())
+	assert.Equal(t, 0, cb.failures)
+
+	//token of the abandoned request is given back
+	b := limiter.bucket(request, user)
+	b.mux.Lock()
+	assert.True(t, b.tokens > -1, b.tokens)
+	b.mux.Unlock()
+}
@@ -0,0 +1,151 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/metrics"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	//waits for the backoff before retrying the API call, returns early if ctx is cancelled. Overridden in tests.
+	waitForRetry = func(ctx context.Context, backoff time.Duration) {
+		timer := time.NewTimer(backoff)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+)
+
+// APIError is returned when the API responds with non 2xx status code.
+// RetryAfter is the duration sent by the API in Retry-After header, zero if it's not sent.
+type APIError struct {
+	StatusCode int
+	Detail     string
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d: %s", e.StatusCode, e.Detail)
+}
+
+// parses Retry-After header, given either as seconds or HTTP date. Returns zero if it's empty or invalid.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := t.Sub(time.Now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// isRetryable returns true if the API call failed due to rate limiting, server error or network error.
+// Calls aborted on shutdown and the calls abandoned while waiting for the rate limit aren't retried.
+func isRetryable(err error) bool {
+	var waitErr *rateLimitWaitError
+	var transportErr *transportError
+	if errors.Is(err, context.Canceled) || errors.As(err, &waitErr) || errors.As(err, &transportErr) {
+		return false
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// retryBackoff returns the duration to wait before the attempt'th retry (starting from 0) of the call failed with err.
+// Retry-After sent by the API is honored up to max_retry_after, false is returned if the API asks to wait longer.
+// Otherwise the backoff is increased exponentially up to max_backoff, with jitter so that the calls aren't retried together.
+func retryBackoff(attempt int, err error) (time.Duration, bool) {
+	retry := config.Current().Retry
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > time.Duration(retry.MaxRetryAfter)*time.Second {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	backoff := float64(retry.InitialBackoff) * float64(time.Second) * math.Pow(retry.Multiplier, float64(attempt))
+	if maxBackoff := float64(retry.MaxBackoff) * float64(time.Second); backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	backoff *= 1 + retry.Jitter*(2*rand.Float64()-1)
+	return time.Duration(backoff), true
+}
+
+// doRequestWithRetry executes the user's request, retrying it as per the retry policy if it fails with retryable error.
+// The session token is set again before each retry, as it may be refreshed while waiting.
+// The request isn't sent while the API endpoint's circuit breaker is open.
+func doRequestWithRetry(ctx context.Context, request *http.Request, user *config.User, api *config.APIConf, txnID uint64) ([]byte, error) {
+	cb := circuitFor(endpointOf(user, api.API))
+	if err := cb.allow(); err != nil {
+		return nil, err
+	}
+	response, err := doRequest(ctx, request, user)
+	cb.record(err)
+	maxAttempts := config.Current().Retry.MaxAttempts
+	for attempt := 0; err != nil && isRetryable(err) && attempt < maxAttempts; attempt++ {
+		backoff, ok := retryBackoff(attempt, err)
+		if !ok {
+			log.WithFields(log.Fields{"tid": txnID, "error": err}).Warnf("Not retrying %s for %s, Retry-After exceeds max_retry_after", request.URL.Path, user.Email)
+			break
+		}
+		log.WithFields(log.Fields{"tid": txnID, "error": err, "backoff": backoff, "attempt": attempt + 1}).Infof("Retrying %s for %s", request.URL.Path, user.Email)
+		waitForRetry(ctx, backoff)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		if request.GetBody != nil {
+			request.Body, err = request.GetBody()
+			if err != nil {
+				return nil, err
+			}
+		}
+		//wait if refresh token api is running
+		if user.RefreshDone != nil {
+			<-user.RefreshDone
+		}
+		request.Header.Set(authorizationHeader, user.SessionToken.AccessToken)
+		if openErr := cb.allow(); openErr != nil {
+			return nil, openErr
+		}
+		metrics.IncRetries(user, api)
+		response, err = doRequest(ctx, request, user)
+		cb.record(err)
+	}
+	return response, err
+}
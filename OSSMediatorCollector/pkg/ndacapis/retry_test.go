@@ -0,0 +1,177 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package ndacapis
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/utils"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// sets the retry policy and records the backoffs instead of waiting, both are restored when the test ends.
+func setTestRetryPolicy(t *testing.T, retry config.RetryConf) *[]time.Duration {
+	t.Helper()
+	var backoffs []time.Duration
+	prevRetry := config.Conf.Retry
+	config.Conf.Retry = retry
+	prevWait := waitForRetry
+	waitForRetry = func(ctx context.Context, d time.Duration) { backoffs = append(backoffs, d) }
+	t.Cleanup(func() {
+		config.Conf.Retry = prevRetry
+		waitForRetry = prevWait
+	})
+	return &backoffs
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert.Equal(t, 120*time.Second, parseRetryAfter("120"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(""))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("-1"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("invalid"))
+	assert.Equal(t, time.Duration(0), parseRetryAfter(time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)))
+
+	d := parseRetryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.True(t, d > 55*time.Second && d <= time.Minute, d)
+}
+
+func TestIsRetryable(t *testing.T) {
+	assert.True(t, isRetryable(&APIError{StatusCode: http.StatusTooManyRequests}))
+	assert.True(t, isRetryable(&APIError{StatusCode: http.StatusInternalServerError}))
+	assert.True(t, isRetryable(&APIError{StatusCode: http.StatusServiceUnavailable}))
+	assert.True(t, isRetryable(&url.Error{Op: "Get", URL: "http://localhost", Err: errors.New("connection refused")}))
+	assert.False(t, isRetryable(&APIError{StatusCode: http.StatusNotFound}))
+	assert.False(t, isRetryable(&APIError{StatusCode: http.StatusUnauthorized}))
+	assert.False(t, isRetryable(errors.New("unable to decode response")))
+	//calls aborted on shutdown
+	assert.False(t, isRetryable(&url.Error{Op: "Get", URL: "http://localhost", Err: context.Canceled}))
+}
+
+func TestAPIErrorMessage(t *testing.T) {
+	err := error(&APIError{StatusCode: 404, Detail: "no records found"})
+	assert.Equal(t, "404: no records found", err.Error())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	setTestRetryPolicy(t, config.RetryConf{MaxAttempts: 5, InitialBackoff: 1, MaxBackoff: 5, Multiplier: 2, Jitter: 0.2, MaxRetryAfter: 60})
+	err := &APIError{StatusCode: http.StatusServiceUnavailable}
+	for attempt, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		backoff, ok := retryBackoff(attempt, err)
+		assert.True(t, ok)
+		assert.True(t, backoff >= expected*8/10 && backoff <= expected*12/10, "attempt %d: %v", attempt, backoff)
+	}
+
+	//Retry-After takes precedence over backoff
+	backoff, ok := retryBackoff(0, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 30 * time.Second})
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, backoff)
+
+	_, ok = retryBackoff(0, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 2 * time.Minute})
+	assert.False(t, ok)
+}
+
+func TestDoRequestWithRetry(t *testing.T) {
+	backoffs := setTestRetryPolicy(t, config.RetryConf{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 60, Multiplier: 2, MaxRetryAfter: 60})
+	count := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, "{}", string(body))
+		count++
+		switch count {
+		case 1:
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, `{"status": {"status_code": "SUCCESS"}}`)
+		}
+	}))
+	defer testServer.Close()
+	CreateHTTPClient("", false)
+	user := &config.User{Email: "testuser@nokia.com", SessionToken: &config.SessionToken{AccessToken: "accessToken"}}
+
+	request, _ := http.NewRequest(http.MethodPost, testServer.URL, strings.NewReader("{}"))
+	response, err := doRequestWithRetry(context.Background(), request, user, &config.APIConf{API: "/organizations"}, 123)
+	assert.Nil(t, err)
+	assert.Contains(t, string(response), "SUCCESS")
+	assert.Equal(t, 3, count)
+	assert.Equal(t, []time.Duration{7 * time.Second, 2 * time.Second}, *backoffs)
+}
+
+func TestDoRequestWithRetryFailure(t *testing.T) {
+	backoffs := setTestRetryPolicy(t, config.RetryConf{MaxAttempts: 2, InitialBackoff: 1, MaxBackoff: 60, Multiplier: 2, MaxRetryAfter: 60})
+	count := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer testServer.Close()
+	CreateHTTPClient("", false)
+	user := &config.User{Email: "testuser@nokia.com", SessionToken: &config.SessionToken{AccessToken: "accessToken"}}
+
+	request, _ := http.NewRequest(http.MethodGet, testServer.URL, nil)
+	_, err := doRequestWithRetry(context.Background(), request, user, &config.APIConf{API: "/network-hardware-groups"}, 123)
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusBadGateway, apiErr.StatusCode)
+	assert.Equal(t, 3, count)
+	assert.Len(t, *backoffs, 2)
+
+	//non retryable error isn't retried
+	count = 0
+	*backoffs = nil
+	testServer.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		w.WriteHeader(http.StatusForbidden)
+	})
+	request, _ = http.NewRequest(http.MethodGet, testServer.URL, nil)
+	_, err = doRequestWithRetry(context.Background(), request, user, &config.APIConf{API: "/network-hardware-groups"}, 123)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, count)
+	assert.Empty(t, *backoffs)
+}
+
+func TestCallMetricAPIRetriesRateLimitedCall(t *testing.T) {
+	backoffs := setTestRetryPolicy(t, config.RetryConf{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 60, Multiplier: 2, MaxRetryAfter: 60})
+	count := 0
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count++
+		if count == 1 {
+			w.Header().Set("Retry-After", "10")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintln(w, fmResponse)
+	}))
+	defer testServer.Close()
+	CreateHTTPClient("", false)
+	config.Conf.BaseURL = testServer.URL
+	user := &config.User{Email: "testuser@nokia.com", IsSessionAlive: true, ResponseDest: "./tmp"}
+	user.SessionToken = &config.SessionToken{AccessToken: "accessToken"}
+	apiConf := &config.APIConf{API: "/fmdata", Type: "ACTIVE", MetricType: "RADIO", Interval: 15}
+	utils.CreateResponseDirectory(user.ResponseDest, apiConf.API)
+	defer os.RemoveAll(user.ResponseDest)
+
+	apiReq := apiCallRequest{api: apiConf, user: user, nhgID: "nhg_1", limit: 100, backfill: true}
+	msg := callMetricAPI(context.Background(), apiReq, config.Conf.Retry.MaxAttempts, 123, false)
+	assert.Equal(t, "", msg)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []time.Duration{10 * time.Second}, *backoffs)
+}
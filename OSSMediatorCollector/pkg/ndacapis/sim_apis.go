@@ -9,11 +9,14 @@ package ndacapis
 import (
 	"bytes"
 	"collector/pkg/config"
+	"collector/pkg/metrics"
 	"collector/pkg/utils"
+	"context"
 	"encoding/json"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -57,52 +60,51 @@ const (
 	hwIDQueryParam     = "access_point_hw_id"
 )
 
-func fetchSimData(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
-	if !user.IsSessionAlive {
+func fetchSimData(ctx context.Context, api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) {
+	if !config.SessionAlive(user) {
 		log.WithFields(log.Fields{"tid": txnID, "api": api.API}).Warnf("Skipping API call for %s at %v as user's session is inactive", user.Email, utils.CurrentTime())
 		return
 	}
 	authType := strings.ToUpper(user.AuthType)
-	user.NhgMux.RLock()
-	defer user.NhgMux.RUnlock()
+	networks := config.NetworksFor(user)
 	if strings.Contains(api.API, accessPointSimsAPI) {
 		if authType == "ADTOKEN" {
-			log.WithFields(log.Fields{"tid": txnID, "hw_ids": len(user.HwIDsABAC)}).Infof("starting ap_sims api")
-			for hwID, orgAcc := range user.HwIDsABAC {
-				callAccessPointsSimAPI(api, user, hwID, orgAcc.OrgDetails.OrgUUID, orgAcc.AccDetails.AccUUID, txnID, prettyResponse)
+			log.WithFields(log.Fields{"tid": txnID, "hw_ids": len(networks.HwIDsABAC)}).Infof("starting ap_sims api")
+			for hwID, orgAcc := range networks.HwIDsABAC {
+				callAccessPointsSimAPI(ctx, api, user, hwID, orgAcc.OrgDetails.OrgUUID, orgAcc.AccDetails.AccUUID, txnID, prettyResponse)
 			}
 		} else {
-			for _, hwID := range user.HwIDs {
-				log.WithFields(log.Fields{"tid": txnID, "hw_ids": len(user.HwIDs)}).Infof("starting ap_sims api")
-				callAccessPointsSimAPI(api, user, hwID, "", "", txnID, prettyResponse)
+			for _, hwID := range networks.HwIDs {
+				log.WithFields(log.Fields{"tid": txnID, "hw_ids": len(networks.HwIDs)}).Infof("starting ap_sims api")
+				callAccessPointsSimAPI(ctx, api, user, hwID, "", "", txnID, prettyResponse)
 			}
 		}
-		log.WithFields(log.Fields{"tid": txnID, "hw_ids": len(user.HwIDs)}).Infof("finished ap_sims api")
+		log.WithFields(log.Fields{"tid": txnID, "hw_ids": len(networks.HwIDs)}).Infof("finished ap_sims api")
 	} else if strings.Contains(api.API, nhgPathParam) {
 		if authType == "ADTOKEN" {
-			for nhgID, orgAcc := range user.NhgIDsABAC {
-				callSimAPI(api, user, nhgID, orgAcc.OrgDetails.OrgUUID, orgAcc.AccDetails.AccUUID, 1, txnID, prettyResponse)
+			for nhgID, orgAcc := range networks.NhgIDsABAC {
+				callSimAPI(ctx, api, user, nhgID, orgAcc.OrgDetails.OrgUUID, orgAcc.AccDetails.AccUUID, 1, txnID, prettyResponse)
 			}
 		} else {
-			for _, nhgID := range user.NhgIDs {
-				callSimAPI(api, user, nhgID, "", "", 1, txnID, prettyResponse)
+			for _, nhgID := range networks.NhgIDs {
+				callSimAPI(ctx, api, user, nhgID, "", "", 1, txnID, prettyResponse)
 			}
 		}
 	} else {
 		if authType == "ADTOKEN" {
-			for orgID, accIDs := range user.AccountIDsABAC {
+			for orgID, accIDs := range networks.AccountIDsABAC {
 				for _, accID := range accIDs {
-					callSimAPI(api, user, "", orgID, accID, 1, txnID, prettyResponse)
+					callSimAPI(ctx, api, user, "", orgID, accID, 1, txnID, prettyResponse)
 				}
 			}
 		} else {
-			callSimAPI(api, user, "", "", "", 1, txnID, prettyResponse)
+			callSimAPI(ctx, api, user, "", "", "", 1, txnID, prettyResponse)
 		}
 	}
 }
 
-func callSimAPI(api *config.APIConf, user *config.User, nhgID string, orgUUID string, accUUID string, pageNo int, txnID uint64, prettyResponse bool) {
-	apiURL := config.Conf.BaseURL + api.API
+func callSimAPI(ctx context.Context, api *config.APIConf, user *config.User, nhgID string, orgUUID string, accUUID string, pageNo int, txnID uint64, prettyResponse bool) {
+	apiURL := config.BaseURLFor(user) + api.API
 	apiURL = strings.Replace(apiURL, "{nhg_id}", nhgID, -1)
 
 	//wait if refresh token api is running
@@ -125,7 +127,9 @@ func callSimAPI(api *config.APIConf, user *config.User, nhgID string, orgUUID st
 	query.Add(accIDQueryParam, accUUID)
 	request.URL.RawQuery = query.Encode()
 
-	response, err := doRequest(request)
+	reqStartTime := time.Now()
+	response, err := doRequestWithRetry(ctx, request, user, api, txnID)
+	metrics.ObserveAPICall(user, api, reqStartTime, err)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while calling %s for %s", apiURL, user.Email)
 		return
@@ -152,7 +156,7 @@ func callSimAPI(api *config.APIConf, user *config.User, nhgID string, orgUUID st
 		Subsc:         resp.Subsc,
 		RequestedSims: resp.RequestedSims,
 	}
-	err = utils.WriteResponse(user, api, simData, nhgID, txnID, prettyResponse)
+	err = writeResponse(user, api, simData, nhgID, txnID, prettyResponse)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("unable to write response for %s", user.Email)
 		return
@@ -161,12 +165,12 @@ func callSimAPI(api *config.APIConf, user *config.User, nhgID string, orgUUID st
 	if resp.PageResponse.TotalPages == resp.PageResponse.PageDetails.PageNumber {
 		return
 	} else {
-		callSimAPI(api, user, nhgID, orgUUID, accUUID, pageNo+1, txnID, prettyResponse)
+		callSimAPI(ctx, api, user, nhgID, orgUUID, accUUID, pageNo+1, txnID, prettyResponse)
 	}
 }
 
-func callAccessPointsSimAPI(api *config.APIConf, user *config.User, hwID string, orgUUID string, accUUID string, txnID uint64, prettyResponse bool) {
-	apiURL := config.Conf.BaseURL + api.API
+func callAccessPointsSimAPI(ctx context.Context, api *config.APIConf, user *config.User, hwID string, orgUUID string, accUUID string, txnID uint64, prettyResponse bool) {
+	apiURL := config.BaseURLFor(user) + api.API
 	//wait if refresh token api is running
 	if user != nil && user.RefreshDone != nil {
 		<-user.RefreshDone
@@ -187,7 +191,9 @@ func callAccessPointsSimAPI(api *config.APIConf, user *config.User, hwID string,
 	query.Add(accIDQueryParam, accUUID)
 	request.URL.RawQuery = query.Encode()
 
-	response, err := doRequest(request)
+	reqStartTime := time.Now()
+	response, err := doRequestWithRetry(ctx, request, user, api, txnID)
+	metrics.ObserveAPICall(user, api, reqStartTime, err)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err, "hw_id": hwID}).Errorf("Error while calling %s for %s", apiURL, user.Email)
 		return
@@ -214,7 +220,7 @@ func callAccessPointsSimAPI(api *config.APIConf, user *config.User, hwID string,
 		log.WithFields(log.Fields{"tid": txnID, "hw_id": hwID}).Errorf("no access point sims found for %s", user.Email)
 		return
 	}
-	err = utils.WriteResponse(user, api, resp.AccessPointDetails, "", txnID, prettyResponse)
+	err = writeResponse(user, api, resp.AccessPointDetails, "", txnID, prettyResponse)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err, "hw_id": hwID}).Errorf("unable to write response for %s", user.Email)
 	}
@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"collector/pkg/config"
 	"collector/pkg/utils"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"net/http"
@@ -128,7 +129,7 @@ func TestCallSimAPI(t *testing.T) {
 		return time.Date(2018, 12, 17, 20, 9, 58, 0, time.UTC)
 	}
 	utils.CurrentTime = myCurrentTime
-	fetchSimData(&apiConf, &user, 123, true)
+	fetchSimData(context.Background(), &apiConf, &user, 123, true)
 
 	fileName := "./tmp/sims/sims_testuser@nokia.com_response_" + strconv.Itoa(int(utils.CurrentTime().Unix())) + ".json"
 	if _, err := os.Stat(fileName); os.IsNotExist(err) {
@@ -157,9 +158,8 @@ func TestCallSimAPIABAC(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test_nhg1"] = orgAcc
-	user.NhgIDsABAC = m
-	user.AccountIDsABAC = map[string][]string{}
-	user.AccountIDsABAC[orgAcc.OrgDetails.OrgUUID] = []string{"acc_uuid_1"}
+	accounts := map[string][]string{orgAcc.OrgDetails.OrgUUID: {"acc_uuid_1"}}
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDsABAC: m, AccountIDsABAC: accounts}, utils.CurrentTime())
 
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -182,7 +182,7 @@ func TestCallSimAPIABAC(t *testing.T) {
 		return time.Date(2018, 12, 17, 20, 9, 58, 0, time.UTC)
 	}
 	utils.CurrentTime = myCurrentTime
-	fetchSimData(&apiConf, &user, 123, true)
+	fetchSimData(context.Background(), &apiConf, &user, 123, true)
 
 	fileName := "./tmp/sims/sims_testuser@nokia.com_response_" + strconv.Itoa(int(utils.CurrentTime().Unix())) + ".json"
 	if _, err := os.Stat(fileName); os.IsNotExist(err) {
@@ -212,7 +212,7 @@ func TestCallSimAPIWithWrongURL(t *testing.T) {
 	user.AuthType = "ADTOKEN"
 
 	m["test_nhg1"] = orgAcc
-	user.NhgIDsABAC = m
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDsABAC: m}, utils.CurrentTime())
 
 	config.Conf = config.Config{
 		BaseURL: "http://localhost",
@@ -228,7 +228,7 @@ func TestCallSimAPIWithWrongURL(t *testing.T) {
 		return time.Date(2018, 12, 17, 20, 9, 58, 0, time.UTC)
 	}
 	utils.CurrentTime = myCurrentTime
-	fetchSimData(&apiConf, &user, 123, true)
+	fetchSimData(context.Background(), &apiConf, &user, 123, true)
 	fileName := "./tmp/sims/sims_testuser@nokia.com_response_" + strconv.Itoa(int(utils.CurrentTime().Unix())) + ".json"
 	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
 		t.Fail()
@@ -242,7 +242,7 @@ func TestGetSimsDataWithInactiveSession(t *testing.T) {
 		log.SetOutput(os.Stderr)
 	}()
 	user := config.User{Email: "testuser@nokia.com", IsSessionAlive: false}
-	fetchSimData(&config.APIConf{API: "/sims/{nhg_id}", Interval: 15}, &user, 1234, true)
+	fetchSimData(context.Background(), &config.APIConf{API: "/sims/{nhg_id}", Interval: 15}, &user, 1234, true)
 	if !strings.Contains(buf.String(), "Skipping API call for testuser@nokia.com") {
 		t.Fail()
 	}
@@ -261,7 +261,7 @@ func TestCallAPSimAPIWithWrongURL(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test_nhg1"] = orgAcc
-	user.NhgIDsABAC = m
+	config.SetNetworks(&user, &config.NetworkSnapshot{NhgIDsABAC: m}, utils.CurrentTime())
 
 	config.Conf = config.Config{
 		BaseURL: "http://localhost",
@@ -277,7 +277,7 @@ func TestCallAPSimAPIWithWrongURL(t *testing.T) {
 		return time.Date(2018, 12, 17, 20, 9, 58, 0, time.UTC)
 	}
 	utils.CurrentTime = myCurrentTime
-	fetchSimData(&apiConf, &user, 123, true)
+	fetchSimData(context.Background(), &apiConf, &user, 123, true)
 	fileName := "./tmp/access-point-sims/access-point-sims_testuser@nokia.com_response_" + strconv.Itoa(int(utils.CurrentTime().Unix())) + ".json"
 	if _, err := os.Stat(fileName); !os.IsNotExist(err) {
 		t.Fail()
@@ -291,7 +291,7 @@ func TestGetAPSimsDataWithInactiveSession(t *testing.T) {
 		log.SetOutput(os.Stderr)
 	}()
 	user := config.User{Email: "testuser@nokia.com", IsSessionAlive: false}
-	fetchSimData(&config.APIConf{API: "/access-point-sims", Interval: 15}, &user, 1234, true)
+	fetchSimData(context.Background(), &config.APIConf{API: "/access-point-sims", Interval: 15}, &user, 1234, true)
 	if !strings.Contains(buf.String(), "Skipping API call for testuser@nokia.com") {
 		t.Fail()
 	}
@@ -311,7 +311,7 @@ func TestCallAPSimAPI(t *testing.T) {
 	orgAcc.AccDetails.AccAlias = "acc_alias_1"
 
 	m["test-hw1"] = orgAcc
-	user.HwIDsABAC = m
+	config.SetNetworks(&user, &config.NetworkSnapshot{HwIDsABAC: m}, utils.CurrentTime())
 
 	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -334,7 +334,7 @@ func TestCallAPSimAPI(t *testing.T) {
 		return time.Date(2018, 12, 17, 20, 9, 58, 0, time.UTC)
 	}
 	utils.CurrentTime = myCurrentTime
-	fetchSimData(&apiConf, &user, 123, true)
+	fetchSimData(context.Background(), &apiConf, &user, 123, true)
 
 	fileName := "./tmp/access-point-sims/access-point-sims_testuser@nokia.com_response_" + strconv.Itoa(int(utils.CurrentTime().Unix())) + ".json"
 	if _, err := os.Stat(fileName); os.IsNotExist(err) {
@@ -9,8 +9,9 @@ package ndacapis
 import (
 	"bytes"
 	"collector/pkg/config"
+	"collector/pkg/credentials"
 	"collector/pkg/utils"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -69,17 +70,17 @@ func Login(user *config.User) error {
 	//{"email_id": "string", "password": "string"}
 	reqBody := LoginRequestBody{
 		EmailID:  user.Email,
-		Password: user.Password,
+		Password: config.PasswordFor(user),
 	}
 	body, _ := json.Marshal(reqBody)
-	apiURL := config.Conf.BaseURL + config.Conf.UMAPIs.Login
+	apiURL := config.BaseURLFor(user) + config.UMAPIsFor(user).Login
 	request, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
 
 	request.Header.Set("Content-Type", "application/json")
-	response, err := doRequest(request)
+	response, err := doRequest(context.Background(), request, user)
 	if err != nil {
 		return err
 	}
@@ -101,7 +102,7 @@ func Login(user *config.User) error {
 	setToken(resp, user)
 
 	log.Infof("Login successful for %s", user.Email)
-	fmt.Printf("\nLogin successful for %s\n", user.Email)
+	fmt.Fprintf(os.Stderr, "\nLogin successful for %s\n", user.Email)
 	return nil
 }
 
@@ -128,25 +129,25 @@ func setToken(response *UMResponse, user *config.User) {
 		RefreshToken: response.RT.RefreshToken,
 		ExpiryTime:   expTime,
 	}
-	user.IsSessionAlive = true
+	config.SetSessionAlive(user, true)
 	log.Debugf("Expiry time: %v for %s", user.SessionToken.ExpiryTime, user.Email)
 }
 
-// RefreshToken refreshes the session token before expiry_time.
+// RefreshToken refreshes the session token before expiry_time, until ctx is cancelled.
 // Input parameter apiUrl is the API URL for refreshing session.
-func RefreshToken(user *config.User) {
+func RefreshToken(ctx context.Context, user *config.User) {
 	var refreshMu sync.Mutex
 	// Re-create RefreshDone channel before starting refresh cycle
 	if user.RefreshDone != nil {
 		close(user.RefreshDone)
 	}
 	user.RefreshDone = make(chan struct{})
-	apiURL := config.Conf.BaseURL
+	apiURL := config.BaseURLFor(user)
 	authType := strings.ToUpper(user.AuthType)
 	if authType == "ADTOKEN" {
-		apiURL = apiURL + config.Conf.AzureSessionAPIs.Refresh
+		apiURL = apiURL + config.AzureSessionAPIsFor(user).Refresh
 	} else {
-		apiURL = apiURL + config.Conf.UMAPIs.Refresh
+		apiURL = apiURL + config.UMAPIsFor(user).Refresh
 	}
 	duration := getRefreshDuration(user)
 	if duration <= 0 || authType == "ADTOKEN" {
@@ -154,14 +155,19 @@ func RefreshToken(user *config.User) {
 		err := callRefreshAPI(apiURL, user)
 		if err != nil {
 			log.WithFields(log.Fields{"error": err}).Errorf("Refresh token failed for %s", user.Email)
-			user.IsSessionAlive = false
+			config.SetSessionAlive(user, false)
 		}
 	}
 	refreshTimer := time.NewTimer(duration)
 	// Signal that refresh is done
 	close(user.RefreshDone)
 	for {
-		<-refreshTimer.C
+		select {
+		case <-ctx.Done():
+			refreshTimer.Stop()
+			return
+		case <-refreshTimer.C:
+		}
 		refreshMu.Lock()
 		// Re-create RefreshDone channel for next refresh
 		user.RefreshDone = make(chan struct{})
@@ -170,45 +176,45 @@ func RefreshToken(user *config.User) {
 			if authType == "ADTOKEN" {
 				if err != nil {
 					log.WithFields(log.Fields{"error": err}).Errorf("Refresh token failed for %s, retrying again...", user.Email)
-					user.IsSessionAlive = false
+					config.SetSessionAlive(user, false)
 					done := make(chan bool, 1)
 					go retryADRefresh(apiURL, initialBackoff, user, done)
 					<-done
 				} else {
-					user.IsSessionAlive = true
+					config.SetSessionAlive(user, true)
 				}
 			} else {
 				log.WithFields(log.Fields{"error": err}).Errorf("Refresh token failed for %s, retrying to login", user.Email)
 				err = Login(user)
 				if err != nil {
 					log.WithFields(log.Fields{"error": err}).Errorf("Login Failed for %s.", user.Email)
-					user.IsSessionAlive = false
+					config.SetSessionAlive(user, false)
 					done := make(chan bool, 1)
 					go retryLogin(initialBackoff, user, done)
 					<-done
 				} else {
-					user.IsSessionAlive = true
+					config.SetSessionAlive(user, true)
 				}
 			}
 		} else {
-			user.IsSessionAlive = true
+			config.SetSessionAlive(user, true)
 		}
 		duration = getRefreshDuration(user)
 		if duration < 10*time.Second {
 			log.WithFields(log.Fields{"refresh_duration": duration, "user": user.Email}).Debugf("Found less refresh duration, login will be tried for %s.", user.Email)
 			if authType == "ADTOKEN" {
 				duration = 5 * time.Second
-				user.IsSessionAlive = false
+				config.SetSessionAlive(user, false)
 			} else {
 				err = Login(user)
 				if err != nil {
 					log.WithFields(log.Fields{"error": err}).Errorf("Login Failed for %s.", user.Email)
-					user.IsSessionAlive = false
+					config.SetSessionAlive(user, false)
 					done := make(chan bool, 1)
 					go retryLogin(initialBackoff, user, done)
 					<-done
 				} else {
-					user.IsSessionAlive = true
+					config.SetSessionAlive(user, true)
 				}
 			}
 		}
@@ -243,7 +249,7 @@ func callRefreshAPI(apiURL string, user *config.User) error {
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set(authorizationHeader, user.SessionToken.AccessToken)
-	response, err := doRequest(request)
+	response, err := doRequest(context.Background(), request, user)
 	if err != nil {
 		return err
 	}
@@ -271,11 +277,9 @@ func callRefreshAPI(apiURL string, user *config.User) error {
 	}
 	setToken(resp, user)
 	if authType == "ADTOKEN" {
-		fileName := ".secret/." + user.Email
-		encodedPassword := base64.StdEncoding.EncodeToString([]byte(resp.UAT.AccessToken)) + "\n" + base64.StdEncoding.EncodeToString([]byte(resp.RT.RefreshToken))
-		err = os.WriteFile(fileName, []byte(encodedPassword), 0600)
+		err = credentials.StoreSessionToken(user, resp.UAT.AccessToken, resp.RT.RefreshToken)
 		if err != nil {
-			log.WithFields(log.Fields{"error": err}).Errorf("Unable to store session token for %v to %v", user, fileName)
+			log.WithFields(log.Fields{"error": err}).Errorf("Unable to store session token for %v", user.Email)
 		}
 	}
 	return nil
@@ -295,7 +299,7 @@ func retryLogin(backoff time.Duration, user *config.User, done chan bool) {
 			}
 			timer.Reset(backoff)
 		} else {
-			user.IsSessionAlive = true
+			config.SetSessionAlive(user, true)
 			done <- true
 			return
 		}
@@ -316,7 +320,7 @@ func retryADRefresh(apiURL string, backoff time.Duration, user *config.User, don
 			}
 			timer.Reset(backoff)
 		} else {
-			user.IsSessionAlive = true
+			config.SetSessionAlive(user, true)
 			done <- true
 			return
 		}
@@ -326,10 +330,10 @@ func retryADRefresh(apiURL string, backoff time.Duration, user *config.User, don
 // Logout to close the session.
 // If successful it returns nil, if there is any error it return error.
 func Logout(user *config.User) error {
-	log.Infof("Logging out from %s for user %s.", config.Conf.BaseURL, user.Email)
+	log.Infof("Logging out from %s for user %s.", config.BaseURLFor(user), user.Email)
 	authType := strings.ToUpper(user.AuthType)
 	if authType == "ADTOKEN" {
-		user.IsSessionAlive = false
+		config.SetSessionAlive(user, false)
 		log.Infof("%s Logged out", user.Email)
 		return nil
 	}
@@ -338,7 +342,7 @@ func Logout(user *config.User) error {
 		RefreshToken: user.SessionToken.RefreshToken,
 	}
 	body, _ := json.Marshal(reqBody)
-	apiURL := config.Conf.BaseURL + config.Conf.UMAPIs.Logout
+	apiURL := config.BaseURLFor(user) + config.UMAPIsFor(user).Logout
 	request, err := http.NewRequest(http.MethodPost, apiURL, bytes.NewBuffer(body))
 	if err != nil {
 		return err
@@ -346,7 +350,7 @@ func Logout(user *config.User) error {
 
 	request.Header.Set("Content-Type", "application/json")
 	request.Header.Set(authorizationHeader, user.SessionToken.AccessToken)
-	_, err = doRequest(request)
+	_, err = doRequest(context.Background(), request, user)
 	if err != nil {
 		return err
 	}
@@ -9,6 +9,7 @@ package ndacapis
 import (
 	"bytes"
 	"collector/pkg/config"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -406,7 +407,7 @@ func TestRefreshTokenRBAC(t *testing.T) {
 		RefreshToken: "",
 		ExpiryTime:   time.Now().Add(30100 * time.Millisecond),
 	}
-	go RefreshToken(&user)
+	go RefreshToken(context.Background(), &user)
 	time.Sleep(200 * time.Millisecond)
 	if user.SessionToken.AccessToken != tokenString && user.SessionToken.RefreshToken != tokenString {
 		t.Fail()
@@ -454,7 +455,7 @@ func TestRefreshTokenABAC(t *testing.T) {
 		ExpiryTime:   time.Now().Add(30100 * time.Millisecond),
 	}
 
-	go RefreshToken(&user)
+	go RefreshToken(context.Background(), &user)
 	time.Sleep(200 * time.Millisecond)
 	if user.SessionToken.AccessToken != tokenString && user.SessionToken.RefreshToken != tokenString {
 		t.Fail()
@@ -501,7 +502,7 @@ func TestRefreshTokenABACError(t *testing.T) {
 		ExpiryTime:   time.Now().Add(30100 * time.Millisecond),
 	}
 	fmt.Println("user token: ", user.SessionToken.AccessToken)
-	go RefreshToken(&user)
+	go RefreshToken(context.Background(), &user)
 	time.Sleep(200 * time.Millisecond)
 	if user.SessionToken.AccessToken != tokenString && user.SessionToken.RefreshToken != tokenString {
 		t.Fail()
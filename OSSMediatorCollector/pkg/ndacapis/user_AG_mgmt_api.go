@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"collector/pkg/config"
 	"collector/pkg/utils"
+	"context"
 	"encoding/json"
 	"net/http"
 	"strings"
@@ -21,28 +22,28 @@ type AccUUIDResponse struct {
 	Status     Status              `json:"status"` // Status of the response
 }
 
-func fetchOrgUUID(api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) (OrgUUIDResponse, error) {
+func fetchOrgUUID(ctx context.Context, api *config.APIConf, user *config.User, txnID uint64, prettyResponse bool) (OrgUUIDResponse, error) {
 	orgResp := OrgUUIDResponse{}
-	apiURL := config.Conf.BaseURL + config.Conf.UserAGAPIs.ListOrgUUID
+	apiURL := config.BaseURLFor(user) + config.Current().UserAGAPIs.ListOrgUUID
 	log.WithFields(log.Fields{"tid": txnID, "user": user.Email, "api_type": api.Type, "metric_type": api.MetricType}).Infof("Triggered %s for %s at %v", apiURL, user.Email, utils.CurrentTime())
 
 	request, err := http.NewRequest(http.MethodPost, apiURL, strings.NewReader("{}"))
 	if err != nil {
-		user.IsSessionAlive = false
+		config.SetSessionAlive(user, false)
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while calling %s for %s", apiURL, user.Email)
 		return orgResp, err
 	}
 	request.Header.Set(authorizationHeader, user.SessionToken.AccessToken)
-	response, err := doRequest(request)
+	response, err := doRequestWithRetry(ctx, request, user, &config.APIConf{API: config.Current().UserAGAPIs.ListOrgUUID}, txnID)
 	if err != nil {
-		user.IsSessionAlive = false
+		config.SetSessionAlive(user, false)
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while calling %s for %s", apiURL, user.Email)
 		return orgResp, err
 	}
 
 	err = json.NewDecoder(bytes.NewReader(response)).Decode(&orgResp)
 	if err != nil {
-		user.IsSessionAlive = false
+		config.SetSessionAlive(user, false)
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Error("Unable to decode response")
 		return orgResp, err
 	}
@@ -50,7 +51,7 @@ func fetchOrgUUID(api *config.APIConf, user *config.User, txnID uint64, prettyRe
 	//check response for status code
 	err = checkStatusCode(orgResp.Status)
 	if err != nil {
-		user.IsSessionAlive = false
+		config.SetSessionAlive(user, false)
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Invalid status code received while calling %s for %s", apiURL, user.Email)
 		return orgResp, err
 	}
@@ -60,16 +61,16 @@ func fetchOrgUUID(api *config.APIConf, user *config.User, txnID uint64, prettyRe
 		return orgResp, nil
 	}
 
-	err = utils.WriteResponse(user, &config.APIConf{API: config.Conf.UserAGAPIs.ListOrgUUID}, orgResp.OrgDetails, "", txnID, prettyResponse)
+	err = writeResponse(user, &config.APIConf{API: config.Current().UserAGAPIs.ListOrgUUID}, orgResp.OrgDetails, "", txnID, prettyResponse)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("unable to write response for %s", user.Email)
 	}
 	return orgResp, nil
 }
 
-func fetchAccUUID(api *config.APIConf, user *config.User, org config.OrgDetails, txnID uint64, prettyResponse bool) (AccUUIDResponse, error) {
+func fetchAccUUID(ctx context.Context, api *config.APIConf, user *config.User, org config.OrgDetails, txnID uint64, prettyResponse bool) (AccUUIDResponse, error) {
 	accResp := AccUUIDResponse{}
-	apiURL := config.Conf.BaseURL + config.Conf.UserAGAPIs.ListAccUUID
+	apiURL := config.BaseURLFor(user) + config.Current().UserAGAPIs.ListAccUUID
 	apiURL = strings.Replace(apiURL, "{org_uuid}", org.OrgUUID, -1)
 	log.WithFields(log.Fields{"tid": txnID, "user": user.Email, "api_type": api.Type, "metric_type": api.MetricType}).Infof("Triggered %s for %s at %v", apiURL, user.Email, utils.CurrentTime())
 
@@ -80,7 +81,7 @@ func fetchAccUUID(api *config.APIConf, user *config.User, org config.OrgDetails,
 	}
 
 	request.Header.Set(authorizationHeader, user.SessionToken.AccessToken)
-	response, err := doRequest(request)
+	response, err := doRequestWithRetry(ctx, request, user, &config.APIConf{API: config.Current().UserAGAPIs.ListAccUUID}, txnID)
 	if err != nil || len(response) == 0 {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Error while calling %s for %s", apiURL, user.Email)
 		return accResp, err
@@ -104,7 +105,7 @@ func fetchAccUUID(api *config.APIConf, user *config.User, org config.OrgDetails,
 		return accResp, nil
 	}
 
-	err = utils.WriteResponse(user, &config.APIConf{API: config.Conf.UserAGAPIs.ListAccUUID}, accResp.AccDetails, org.OrgUUID, txnID, prettyResponse)
+	err = writeResponse(user, &config.APIConf{API: config.Current().UserAGAPIs.ListAccUUID}, accResp.AccDetails, org.OrgUUID, txnID, prettyResponse)
 	if err != nil {
 		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("unable to write response for %s", user.Email)
 	}
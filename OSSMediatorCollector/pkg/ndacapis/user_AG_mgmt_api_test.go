@@ -10,6 +10,7 @@ import (
 	"bytes"
 	"collector/pkg/config"
 	"collector/pkg/utils"
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -60,7 +61,7 @@ func TestFetchOrgUUID(t *testing.T) {
 	}
 	CreateHTTPClient("", false)
 	utils.CreateResponseDirectory(user.ResponseDest, "/getOrgDetail")
-	_, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+	_, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 	if err != nil {
 		t.Fail()
 	}
@@ -89,7 +90,7 @@ func TestFetchOrgUUID(t *testing.T) {
 //	}
 //	CreateHTTPClient("", false)
 //
-//	_, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+//	_, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 //	if err != nil || !strings.Contains(buf.String(), "Skipping API call for testuser@nokia.com") {
 //		t.Fail()
 //	}
@@ -119,11 +120,11 @@ func TestFetchOrgUUIDForInvalidCase(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	_, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+	_, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 	if err == nil {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(config.NetworksFor(&user).NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -144,7 +145,7 @@ func TestFetchOrgUUIDError(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	orgResp, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+	orgResp, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 	if err != nil && len(orgResp.OrgDetails) != 0 {
 		t.Fail()
 	}
@@ -169,7 +170,7 @@ func TestFetchOrgUUIDInvalidResponse(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	orgResp, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+	orgResp, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 	if err != nil && len(orgResp.OrgDetails) != 0 {
 		t.Fail()
 	}
@@ -194,7 +195,7 @@ func TestFetchOrgUUIDDecodingError(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	orgResp, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+	orgResp, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 	if err != nil && len(orgResp.OrgDetails) != 0 {
 		t.Fail()
 	}
@@ -217,14 +218,14 @@ func TestFetchOrgUUIDForInvalidURL(t *testing.T) {
 	config.Conf = config.Config{
 		BaseURL: ":",
 	}
-	_, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+	_, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 	if err == nil {
 		t.Fail()
 	}
 	if !strings.Contains(buf.String(), "missing protocol scheme") {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(config.NetworksFor(&user).NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -251,14 +252,14 @@ func TestFetchOrgUUIDWithInvalidResponse(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	_, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+	_, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 	if err == nil {
 		t.Fail()
 	}
 	if !strings.Contains(buf.String(), "Unable to decode response") {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(config.NetworksFor(&user).NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -283,7 +284,7 @@ func TestFetchAccUUID(t *testing.T) {
 	}
 	CreateHTTPClient("", false)
 	utils.CreateResponseDirectory(user.ResponseDest, "/getAccDetail")
-	_, err := fetchAccUUID(&config.APIConf{API: "/getAccDetail", Interval: 15}, &user, orgDet, 1234, true)
+	_, err := fetchAccUUID(context.Background(), &config.APIConf{API: "/getAccDetail", Interval: 15}, &user, orgDet, 1234, true)
 	if err != nil {
 		t.Fail()
 	}
@@ -313,7 +314,7 @@ func TestFetchAccUUID(t *testing.T) {
 //	}
 //	CreateHTTPClient("", false)
 //
-//	_, err := fetchAccUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, orgDet, 1234, true)
+//	_, err := fetchAccUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, orgDet, 1234, true)
 //	if err != nil || !strings.Contains(buf.String(), "Skipping API call for testuser@nokia.com") {
 //		t.Fail()
 //	}
@@ -336,7 +337,7 @@ func TestFetchAccUUIDError(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	orgResp, err := fetchAccUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, orgDet, 1234, true)
+	orgResp, err := fetchAccUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, orgDet, 1234, true)
 	if err != nil && len(orgResp.AccDetails) != 0 {
 		t.Fail()
 	}
@@ -362,7 +363,7 @@ func TestFetchAccUUIDInvalidResponse(t *testing.T) {
 	orgDet := config.OrgDetails{OrgUUID: "org_uuid_1", OrgAlias: "org_alias_1"}
 
 	CreateHTTPClient("", true)
-	orgResp, err := fetchAccUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, orgDet, 1234, true)
+	orgResp, err := fetchAccUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, orgDet, 1234, true)
 	if err != nil && len(orgResp.AccDetails) != 0 {
 		t.Fail()
 	}
@@ -396,11 +397,11 @@ func TestFetchAccUUIDForInvalidCase(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	_, err := fetchAccUUID(&config.APIConf{API: "/getAccDetail", Interval: 15}, &user, orgDet, 1234, true)
+	_, err := fetchAccUUID(context.Background(), &config.APIConf{API: "/getAccDetail", Interval: 15}, &user, orgDet, 1234, true)
 	if err == nil {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(config.NetworksFor(&user).NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -422,14 +423,14 @@ func TestFetchAccUUIDForInvalidURL(t *testing.T) {
 	config.Conf = config.Config{
 		BaseURL: ":",
 	}
-	_, err := fetchOrgUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
+	_, err := fetchOrgUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, 1234, true)
 	if err == nil {
 		t.Fail()
 	}
 	if !strings.Contains(buf.String(), "missing protocol scheme") {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(config.NetworksFor(&user).NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
@@ -457,14 +458,14 @@ func TestFetchAccUUIDWithInvalidResponse(t *testing.T) {
 	}
 
 	CreateHTTPClient("", true)
-	_, err := fetchAccUUID(&config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, orgDet, 1234, true)
+	_, err := fetchAccUUID(context.Background(), &config.APIConf{API: "/getOrgDetail", Interval: 15}, &user, orgDet, 1234, true)
 	if err == nil {
 		t.Fail()
 	}
 	if !strings.Contains(buf.String(), "Unable to decode response") {
 		t.Fail()
 	}
-	if len(user.NhgIDsABAC) != 0 {
+	if len(config.NetworksFor(&user).NhgIDsABAC) != 0 {
 		t.Fail()
 	}
 }
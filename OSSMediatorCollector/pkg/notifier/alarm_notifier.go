@@ -43,15 +43,16 @@ var (
 
 // AlarmNotifier keeps alarm notification config.
 type AlarmNotifier struct {
-	WebhookURL        string              `yaml:"webhook_url"`
-	SeverityThreshold string              `yaml:"severity_threshold"`
-	RadioAlarmFilters []RadioAlarmFilters `yaml:"radio_alarm_filters"`
-	DACAlarmFilters   []AlarmIDFilters    `yaml:"dac_alarm_filters"`
-	COREAlarmFilters  []AlarmIDFilters    `yaml:"core_alarm_filters"`
-	AlarmSyncDuration int                 `yaml:"alarm_sync_duration"`
-	GroupEvents       bool                `yaml:"group_events"`
-	NotifyClearEvents bool                `yaml:"notify_clear_event"`
-	MessageFormat     string              `yaml:"message_format"`
+	WebhookURL          string              `yaml:"webhook_url"`
+	SeverityThreshold   string              `yaml:"severity_threshold"`
+	RadioAlarmFilters   []RadioAlarmFilters `yaml:"radio_alarm_filters"`
+	DACAlarmFilters     []AlarmIDFilters    `yaml:"dac_alarm_filters"`
+	COREAlarmFilters    []AlarmIDFilters    `yaml:"core_alarm_filters"`
+	AlarmSyncDuration   int                 `yaml:"alarm_sync_duration"`
+	GroupEvents         bool                `yaml:"group_events"`
+	NotifyClearEvents   bool                `yaml:"notify_clear_event"`
+	MessageFormat       string              `yaml:"message_format"`
+	NotifyNetworkEvents bool                `yaml:"notify_network_events"`
 }
 
 // AlarmIDFilters stores alarm_id to be applied on dac/core alarms before notifying.
@@ -0,0 +1,105 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NetworkEvent is a change of the user's network, found by comparing the successive network lists.
+type NetworkEvent struct {
+	EventType       string   `json:"event_type"`
+	EventTime       string   `json:"event_time"`
+	User            string   `json:"user"`
+	NetworkType     string   `json:"network_type"`
+	NetworkID       string   `json:"network_id"`
+	OrgID           string   `json:"organization_uuid,omitempty"`
+	AccID           string   `json:"account_uuid,omitempty"`
+	OldStatus       string   `json:"old_status,omitempty"`
+	NewStatus       string   `json:"new_status,omitempty"`
+	AddedClusters   []string `json:"added_clusters,omitempty"`
+	RemovedClusters []string `json:"removed_clusters,omitempty"`
+	AddedHwIDs      []string `json:"added_hw_ids,omitempty"`
+	RemovedHwIDs    []string `json:"removed_hw_ids,omitempty"`
+}
+
+// RaiseNetworkEventNotification notifies the network events to the webhook configured in resources/alarm_notifier.yaml,
+// if notify_network_events is enabled. The events are sent in a single message.
+func RaiseNetworkEventNotification(txnID uint64, events []NetworkEvent) {
+	if _, err := os.Stat(alarmConfigFIlePath); os.IsNotExist(err) {
+		log.WithFields(log.Fields{"tid": txnID}).Debugf("Alarm notifier config not present, skipping network event notification")
+		return
+	}
+	err := readAlarmNotifierConfig(txnID)
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Unable to read alarm notifier config")
+		return
+	}
+	if !alarmNotifier.NotifyNetworkEvents {
+		log.WithFields(log.Fields{"tid": txnID}).Debugf("Network event notifier not enabled, skipping network event notification")
+		return
+	}
+
+	var message []byte
+	if alarmNotifier.MessageFormat == msTeamsMsgFormat {
+		message = formMSTeamsNetworkMessage(txnID, events)
+	} else if alarmNotifier.MessageFormat == jsonMsgFormat {
+		message = formJSONNetworkMessage(txnID, events)
+	}
+	if message != nil {
+		pushToWebHook(txnID, message)
+	}
+}
+
+func formJSONNetworkMessage(txnID uint64, events []NetworkEvent) []byte {
+	type JsonMessage struct {
+		Text []NetworkEvent `json:"text"`
+	}
+	data, err := json.Marshal(JsonMessage{Text: events})
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID}).Debugf("Unable to marshal message")
+		return nil
+	}
+	return data
+}
+
+func formMSTeamsNetworkMessage(txnID uint64, events []NetworkEvent) []byte {
+	msg := fmt.Sprintf("#**Network changes for %s**  \nFollowing changes have been found:\n\n---", events[0].User)
+	for _, v := range events {
+		msg += fmt.Sprintf("\n\n*Event:* **%s**\n\n", v.EventType)
+		msg += fmt.Sprintf("*NetworkID:* **%s** (%s)\n\n", v.NetworkID, v.NetworkType)
+		if v.OldStatus != "" || v.NewStatus != "" {
+			msg += fmt.Sprintf("*Status:* **%s** -> **%s**\n\n", v.OldStatus, v.NewStatus)
+		}
+		if len(v.AddedClusters) > 0 {
+			msg += fmt.Sprintf("*AddedClusters:* **%s**\n\n", strings.Join(v.AddedClusters, ", "))
+		}
+		if len(v.RemovedClusters) > 0 {
+			msg += fmt.Sprintf("*RemovedClusters:* **%s**\n\n", strings.Join(v.RemovedClusters, ", "))
+		}
+		if len(v.AddedHwIDs) > 0 {
+			msg += fmt.Sprintf("*AddedAccessPoints:* **%s**\n\n", strings.Join(v.AddedHwIDs, ", "))
+		}
+		if len(v.RemovedHwIDs) > 0 {
+			msg += fmt.Sprintf("*RemovedAccessPoints:* **%s**\n\n", strings.Join(v.RemovedHwIDs, ", "))
+		}
+		msg += fmt.Sprintf("*EventTime:* **%s**\n\n", v.EventTime)
+		msg += "---"
+	}
+	message := TeamsMessage{Text: msg, TextFormat: "markdown"}
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID}).Debugf("Unable to marshal message")
+		return nil
+	}
+	return data
+}
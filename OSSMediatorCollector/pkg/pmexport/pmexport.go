@@ -0,0 +1,470 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package pmexport
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// Output formats of the exported files.
+const (
+	ParquetFormat = "parquet"
+	CSVFormat     = "csv"
+)
+
+const (
+	pmdataPrefix = "pmdata_"
+	//partition value of the records without NHG ID in pm_data_source and response file name, as used by Hive
+	defaultPartition = "__HIVE_DEFAULT_PARTITION__"
+	//event time format of Nokia cells, other records use RFC3339
+	eventTimeFormatNokiaCell = "2006-01-02T15:04:05Z07:00:00"
+)
+
+var csvHeader = []string{"nhg_alias", "edge_id", "hw_id", "hw_alias", "serial_no", "dn", "technology", "timestamp", "object_type", "counter", "value"}
+
+// Row is a PM counter of a record, flattened with the record's pm_data_source.
+// metric_type, nhg_id and date are the partition columns, so they aren't written in the files.
+type Row struct {
+	NhgAlias   string    `parquet:"nhg_alias"`
+	EdgeID     string    `parquet:"edge_id"`
+	HwID       string    `parquet:"hw_id"`
+	HwAlias    string    `parquet:"hw_alias"`
+	SerialNo   string    `parquet:"serial_no"`
+	DN         string    `parquet:"dn"`
+	Technology string    `parquet:"technology"`
+	Timestamp  time.Time `parquet:"timestamp,timestamp(millisecond)"`
+	ObjectType string    `parquet:"object_type"`
+	Counter    string    `parquet:"counter"`
+	Value      *float64  `parquet:"value,optional"`
+}
+
+// returns the key identifying the counter, exporting the same record again replaces its rows.
+func (r Row) key() string {
+	return strings.Join([]string{r.HwID, r.DN, r.Timestamp.UTC().Format(time.RFC3339), r.ObjectType, r.Counter}, "\x00")
+}
+
+// Summary is the result of the export.
+type Summary struct {
+	Files       int      //no. of pmdata files read
+	Rows        int      //no. of rows in the written files, including the merged existing rows
+	OutputFiles []string //hourly files written
+	Failed      []string //pmdata files which couldn't be read
+}
+
+type pmRecord struct {
+	PMData       map[string]interface{} `json:"pm_data"`
+	PMDataSource map[string]interface{} `json:"pm_data_source"`
+}
+
+// partition is the hourly file of the metric type and NHG.
+type partition struct {
+	metricType string
+	nhgID      string
+	hour       time.Time
+}
+
+// path returns the file path of the partition in Hive layout: metric_type=<type>/nhg_id=<id>/date=<date>/pmdata_<date>T<hour>.<format>
+func (p partition) path(outputDir string, format string) string {
+	nhgID := defaultPartition
+	if p.nhgID != "" {
+		nhgID = url.PathEscape(p.nhgID)
+	}
+	date := p.hour.Format("2006-01-02")
+	return filepath.Join(outputDir, "metric_type="+url.PathEscape(p.metricType), "nhg_id="+nhgID, "date="+date,
+		pmdataPrefix+p.hour.Format("2006-01-02T15")+"."+format)
+}
+
+// Export reads the pmdata response files, or the pmdata response files within the directories, and writes their
+// counters as rows in hourly files partitioned by metric type, NHG ID and date under outputDir.
+// The response files can be JSON, NDJSON or gzip compressed NDJSON, as written by collector.
+// If the hourly file already exists its rows are merged with the exported rows.
+func Export(inputs []string, outputDir string, format string) (Summary, error) {
+	var summary Summary
+	if format != ParquetFormat && format != CSVFormat {
+		return summary, fmt.Errorf("invalid export format: %s, accepted values are parquet/csv", format)
+	}
+	files, err := findFiles(inputs)
+	if err != nil {
+		return summary, err
+	}
+
+	partitions := make(map[partition][]Row)
+	for _, file := range files {
+		metricType := metricTypeOf(filepath.Base(file))
+		fileNhgID := nhgIDOf(filepath.Base(file))
+		records, err := readRecords(file)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Errorf("Unable to read %s", file)
+			summary.Failed = append(summary.Failed, file)
+			continue
+		}
+		summary.Files++
+		for _, record := range records {
+			nhgID, rows, err := flatten(record)
+			if err != nil {
+				log.WithFields(log.Fields{"error": err}).Warnf("Skipping record of %s", file)
+				continue
+			}
+			if nhgID == "" {
+				nhgID = fileNhgID
+			}
+			for _, row := range rows {
+				p := partition{metricType: metricType, nhgID: nhgID, hour: row.Timestamp.UTC().Truncate(time.Hour)}
+				partitions[p] = append(partitions[p], row)
+			}
+		}
+	}
+
+	for p, rows := range partitions {
+		filePath := p.path(outputDir, format)
+		n, err := writePartition(filePath, format, rows)
+		if err != nil {
+			return summary, fmt.Errorf("unable to write %s: %w", filePath, err)
+		}
+		summary.Rows += n
+		summary.OutputFiles = append(summary.OutputFiles, filePath)
+	}
+	sort.Strings(summary.OutputFiles)
+	return summary, nil
+}
+
+// returns the pmdata response files of the inputs, directories are walked recursively.
+func findFiles(inputs []string) ([]string, error) {
+	var files []string
+	for _, input := range inputs {
+		info, err := os.Stat(input)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, input)
+			continue
+		}
+		err = filepath.WalkDir(input, func(filePath string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && isPMDataFile(d.Name()) {
+				files = append(files, filePath)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func isPMDataFile(name string) bool {
+	if !strings.HasPrefix(name, pmdataPrefix) || !strings.Contains(name, "_response_") {
+		return false
+	}
+	return strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".ndjson") || strings.HasSuffix(name, ".ndjson.gz")
+}
+
+// returns the metric type from the response file name, ex: pmdata_RADIO_<nhg id>_response_<time>.json
+func metricTypeOf(name string) string {
+	name = strings.TrimPrefix(name, pmdataPrefix)
+	if i := strings.Index(name, "_"); i > 0 {
+		return name[:i]
+	}
+	return defaultPartition
+}
+
+// returns the NHG ID from the response file name, ex: pmdata_RADIO_<nhg id>_response_<time>.json or
+// pmdata_RADIO_ACTIVE_<nhg id>_response_<time>.json, empty if the name doesn't contain it.
+func nhgIDOf(name string) string {
+	i := strings.Index(name, "_response_")
+	if i < 0 {
+		return ""
+	}
+	fields := strings.SplitN(strings.TrimPrefix(name[:i], pmdataPrefix), "_", 2)
+	if len(fields) < 2 {
+		return ""
+	}
+	nhgID := fields[1]
+	for _, apiType := range []string{"ACTIVE_", "HISTORY_"} {
+		if strings.HasPrefix(nhgID, apiType) {
+			return strings.TrimPrefix(nhgID, apiType)
+		}
+	}
+	return nhgID
+}
+
+// reads the records of the response file by its extension.
+func readRecords(filePath string) ([]pmRecord, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(filePath, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var records []pmRecord
+	dec := json.NewDecoder(r)
+	if strings.HasSuffix(filePath, ".json") {
+		err = dec.Decode(&records)
+		return records, err
+	}
+	for dec.More() {
+		var record pmRecord
+		err = dec.Decode(&record)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// flatten returns the NHG ID and the rows of the record's counters, the NHG ID is empty if pm_data_source doesn't have it.
+// pm_data is either the counters prefixed by object type, ex: Cat_M_Accessibility_M8100C0, or the counters
+// grouped by object type.
+func flatten(record pmRecord) (string, []Row, error) {
+	source := record.PMDataSource
+	eventTime := stringOf(source["timestamp"])
+	timestamp, err := parseEventTime(eventTime)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid timestamp %q: %w", eventTime, err)
+	}
+	base := Row{
+		NhgAlias:   stringOf(source["nhg_alias"]),
+		EdgeID:     stringOf(source["edge_id"]),
+		HwID:       stringOf(source["hw_id"]),
+		HwAlias:    stringOf(source["hw_alias"]),
+		SerialNo:   stringOf(source["serial_no"]),
+		DN:         stringOf(source["dn"]),
+		Technology: stringOf(source["technology"]),
+		Timestamp:  timestamp,
+	}
+
+	var rows []Row
+	for name, value := range record.PMData {
+		if counters, ok := value.(map[string]interface{}); ok {
+			rows = appendCounters(rows, base, name, "", counters)
+			continue
+		}
+		row := base
+		row.ObjectType = objectTypeOf(name)
+		row.Counter = name
+		row.Value = valueOf(value)
+		rows = append(rows, row)
+	}
+	return stringOf(source["nhg_id"]), rows, nil
+}
+
+// appends the counters of the object type, nested counters are named by their path joined with dot.
+func appendCounters(rows []Row, base Row, objectType string, prefix string, counters map[string]interface{}) []Row {
+	for name, value := range counters {
+		if nested, ok := value.(map[string]interface{}); ok {
+			rows = appendCounters(rows, base, objectType, prefix+name+".", nested)
+			continue
+		}
+		row := base
+		row.ObjectType = objectType
+		row.Counter = prefix + name
+		row.Value = valueOf(value)
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// returns the object type of the counter, ex: Cat_M_Accessibility for Cat_M_Accessibility_M8100C0.
+func objectTypeOf(counter string) string {
+	if i := strings.LastIndex(counter, "_"); i > 0 {
+		return counter[:i]
+	}
+	return counter
+}
+
+func parseEventTime(eventTime string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, eventTime)
+	if err != nil {
+		t, err = time.Parse(eventTimeFormatNokiaCell, eventTime)
+	}
+	return t.UTC(), err
+}
+
+func stringOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// returns the counter's value, nil if it isn't a number.
+func valueOf(value interface{}) *float64 {
+	switch v := value.(type) {
+	case float64:
+		return &v
+	case bool:
+		f := 0.0
+		if v {
+			f = 1
+		}
+		return &f
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil
+		}
+		return &f
+	}
+	return nil
+}
+
+// writes the rows to the partition's file merged with its existing rows, returns the no. of rows written.
+func writePartition(filePath string, format string, rows []Row) (int, error) {
+	existing, err := readPartition(filePath, format)
+	if err != nil {
+		return 0, err
+	}
+	merged := make(map[string]Row, len(existing)+len(rows))
+	for _, row := range append(existing, rows...) {
+		merged[row.key()] = row
+	}
+	rows = make([]Row, 0, len(merged))
+	for _, row := range merged {
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].Timestamp.Equal(rows[j].Timestamp) {
+			return rows[i].Timestamp.Before(rows[j].Timestamp)
+		}
+		return rows[i].key() < rows[j].key()
+	})
+
+	err = os.MkdirAll(filepath.Dir(filePath), os.ModePerm)
+	if err != nil {
+		return 0, err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(filePath), ".tmp_"+filepath.Base(filePath))
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmpFile.Name())
+	if format == ParquetFormat {
+		err = writeParquet(tmpFile, rows)
+	} else {
+		err = writeCSV(tmpFile, rows)
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(rows), os.Rename(tmpFile.Name(), filePath)
+}
+
+// reads the rows of the partition's file, no rows if the file doesn't exist.
+func readPartition(filePath string, format string) ([]Row, error) {
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		return nil, nil
+	}
+	if format == ParquetFormat {
+		return parquet.ReadFile[Row](filePath)
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readCSV(f)
+}
+
+func writeParquet(w io.Writer, rows []Row) error {
+	writer := parquet.NewGenericWriter[Row](w, parquet.Compression(&parquet.Snappy))
+	_, err := writer.Write(rows)
+	if err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+func writeCSV(w io.Writer, rows []Row) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(csvHeader)
+	if err != nil {
+		return err
+	}
+	for _, row := range rows {
+		var value string
+		if row.Value != nil {
+			value = strconv.FormatFloat(*row.Value, 'f', -1, 64)
+		}
+		err = writer.Write([]string{row.NhgAlias, row.EdgeID, row.HwID, row.HwAlias, row.SerialNo, row.DN, row.Technology,
+			row.Timestamp.UTC().Format(time.RFC3339), row.ObjectType, row.Counter, value})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func readCSV(r io.Reader) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(csvHeader)
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var rows []Row
+	for i, record := range records {
+		if i == 0 {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339, record[7])
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, Row{
+			NhgAlias:   record[0],
+			EdgeID:     record[1],
+			HwID:       record[2],
+			HwAlias:    record[3],
+			SerialNo:   record[4],
+			DN:         record[5],
+			Technology: record[6],
+			Timestamp:  timestamp,
+			ObjectType: record[8],
+			Counter:    record[9],
+			Value:      valueOf(record[10]),
+		})
+	}
+	return rows, nil
+}
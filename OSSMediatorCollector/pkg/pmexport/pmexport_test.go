@@ -0,0 +1,150 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package pmexport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	testRadioPMData = `[
+  {
+    "pm_data": {"Cat_M_Accessibility_M8100C0": 1, "Cat_M_Accessibility_M8100C10": 2.5},
+    "pm_data_source": {"edge_id": "edge1", "hw_id": "EB12345", "hw_alias": "EB12345", "serial_no": "12345", "nhg_id": "nhg1",
+      "nhg_alias": "test nhg", "dn": "MRBTS-1/LNBTS-1/LNCEL-0", "timestamp": "2020-11-10T18:30:00Z", "technology": "4G"}
+  },
+  {
+    "pm_data": {"Cat_M_Accessibility_M8100C0": 3},
+    "pm_data_source": {"edge_id": "edge1", "hw_id": "EB12345", "nhg_id": "nhg1", "dn": "MRBTS-1/LNBTS-1/LNCEL-0",
+      "timestamp": "2020-11-10T19:00:00+00:00:00", "technology": "4G"}
+  }
+]`
+	testCorePMData = `{"pm_data": {"amf_stats": {"registered_users": 10, "status": "up"}}, "pm_data_source": {"nhg_id": "nhg2", "dn": "AMF-1", "timestamp": "2020-11-10T18:15:00Z"}}
+{"pm_data": {"amf_stats": {"registered_users": 12}}, "pm_data_source": {"nhg_id": "nhg2", "dn": "AMF-1", "timestamp": "invalid"}}
+`
+)
+
+func writeGzip(t *testing.T, fileName string, data string) {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write([]byte(data))
+	assert.Nil(t, err)
+	assert.Nil(t, gz.Close())
+	assert.Nil(t, os.WriteFile(fileName, buf.Bytes(), 0600))
+}
+
+func TestExportParquet(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	assert.Nil(t, os.MkdirAll(filepath.Join(inputDir, "pmdata"), 0700))
+	assert.Nil(t, os.WriteFile(filepath.Join(inputDir, "pmdata", "pmdata_RADIO_nhg1_response_1605033000.json"), []byte(testRadioPMData), 0600))
+	writeGzip(t, filepath.Join(inputDir, "pmdata", "pmdata_CORE_nhg2_response_1605033000.ndjson.gz"), testCorePMData)
+	assert.Nil(t, os.WriteFile(filepath.Join(inputDir, "pmdata", "fmdata_RADIO_nhg1_response_1605033000.json"), []byte("[]"), 0600))
+
+	summary, err := Export([]string{inputDir}, outputDir, ParquetFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, summary.Files)
+	assert.Equal(t, 5, summary.Rows)
+	radioFile := filepath.Join(outputDir, "metric_type=RADIO", "nhg_id=nhg1", "date=2020-11-10", "pmdata_2020-11-10T18.parquet")
+	assert.Equal(t, []string{
+		filepath.Join(outputDir, "metric_type=CORE", "nhg_id=nhg2", "date=2020-11-10", "pmdata_2020-11-10T18.parquet"),
+		radioFile,
+		filepath.Join(outputDir, "metric_type=RADIO", "nhg_id=nhg1", "date=2020-11-10", "pmdata_2020-11-10T19.parquet"),
+	}, summary.OutputFiles)
+
+	rows, err := parquet.ReadFile[Row](radioFile)
+	assert.Nil(t, err)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "Cat_M_Accessibility", rows[0].ObjectType)
+		assert.Equal(t, "Cat_M_Accessibility_M8100C0", rows[0].Counter)
+		assert.Equal(t, 1.0, *rows[0].Value)
+		assert.Equal(t, 2.5, *rows[1].Value)
+		assert.Equal(t, "test nhg", rows[0].NhgAlias)
+		assert.Equal(t, "MRBTS-1/LNBTS-1/LNCEL-0", rows[0].DN)
+		assert.True(t, rows[0].Timestamp.Equal(time.Date(2020, 11, 10, 18, 30, 0, 0, time.UTC)))
+	}
+
+	rows, err = parquet.ReadFile[Row](summary.OutputFiles[0])
+	assert.Nil(t, err)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "amf_stats", rows[0].ObjectType)
+		assert.Equal(t, "registered_users", rows[0].Counter)
+		assert.Equal(t, 10.0, *rows[0].Value)
+		//non numeric counter is written without value
+		assert.Equal(t, "status", rows[1].Counter)
+		assert.Nil(t, rows[1].Value)
+	}
+
+	//exporting again replaces the existing rows
+	summary, err = Export([]string{inputDir}, outputDir, ParquetFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, summary.Rows)
+}
+
+func TestExportCSVMergesExistingRows(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	file1 := filepath.Join(inputDir, "pmdata_RADIO_ACTIVE_nhg1_response_1.ndjson")
+	file2 := filepath.Join(inputDir, "pmdata_RADIO_ACTIVE_nhg1_response_2.ndjson")
+	assert.Nil(t, os.WriteFile(file1, []byte(`{"pm_data": {"NCAV_M55601C00001": 1}, "pm_data_source": {"nhg_id": "nhg/1", "dn": "NRCELL-1", "timestamp": "2020-11-10T18:00:00Z"}}`+"\n"), 0600))
+	assert.Nil(t, os.WriteFile(file2, []byte(`{"pm_data": {"NCAV_M55601C00001": "2"}, "pm_data_source": {"nhg_id": "nhg/1", "dn": "NRCELL-1", "timestamp": "2020-11-10T18:15:00Z"}}`+"\n"), 0600))
+
+	_, err := Export([]string{file1}, outputDir, CSVFormat)
+	assert.Nil(t, err)
+	summary, err := Export([]string{file2}, outputDir, CSVFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, summary.Rows)
+	outputFile := filepath.Join(outputDir, "metric_type=RADIO", "nhg_id=nhg%2F1", "date=2020-11-10", "pmdata_2020-11-10T18.csv")
+	assert.Equal(t, []string{outputFile}, summary.OutputFiles)
+
+	data, err := os.ReadFile(outputFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "nhg_alias,edge_id,hw_id,hw_alias,serial_no,dn,technology,timestamp,object_type,counter,value\n"+
+		",,,,,NRCELL-1,,2020-11-10T18:00:00Z,NCAV,NCAV_M55601C00001,1\n"+
+		",,,,,NRCELL-1,,2020-11-10T18:15:00Z,NCAV,NCAV_M55601C00001,2\n", string(data))
+}
+
+func TestExportWithoutNhgIDInDataSource(t *testing.T) {
+	inputDir := t.TempDir()
+	outputDir := t.TempDir()
+	record := `{"pm_data": {"NCAV_M55601C00001": 1}, "pm_data_source": {"dn": "NRCELL-1", "timestamp": "2020-11-10T18:00:00Z"}}` + "\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(inputDir, "pmdata_RADIO_ACTIVE_nhg_1_response_1.ndjson"), []byte(record), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(inputDir, "pmdata_CORE_nhg2_response_1_1.ndjson"), []byte(record), 0600))
+	assert.Nil(t, os.WriteFile(filepath.Join(inputDir, "pmdata_DAC_response_1.ndjson"), []byte(record), 0600))
+
+	summary, err := Export([]string{inputDir}, outputDir, CSVFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(outputDir, "metric_type=CORE", "nhg_id=nhg2", "date=2020-11-10", "pmdata_2020-11-10T18.csv"),
+		filepath.Join(outputDir, "metric_type=DAC", "nhg_id=__HIVE_DEFAULT_PARTITION__", "date=2020-11-10", "pmdata_2020-11-10T18.csv"),
+		filepath.Join(outputDir, "metric_type=RADIO", "nhg_id=nhg_1", "date=2020-11-10", "pmdata_2020-11-10T18.csv"),
+	}, summary.OutputFiles)
+}
+
+func TestExportWithInvalidInput(t *testing.T) {
+	inputDir := t.TempDir()
+	invalidFile := filepath.Join(inputDir, "pmdata_RADIO_nhg1_response_1.json")
+	assert.Nil(t, os.WriteFile(invalidFile, []byte("{invalid"), 0600))
+
+	summary, err := Export([]string{inputDir}, t.TempDir(), CSVFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{invalidFile}, summary.Failed)
+
+	_, err = Export([]string{inputDir}, t.TempDir(), "orc")
+	assert.NotNil(t, err)
+	_, err = Export([]string{filepath.Join(inputDir, "non_existing")}, t.TempDir(), CSVFormat)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,155 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cron triggers at the minutes matching all of its fields, the fields are bit sets of the allowed values.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+	//day of month and day of week are matched with OR if both are restricted, as in crontab
+	domAny, dowAny bool
+}
+
+// bounds of a cron field
+type bounds struct {
+	name     string
+	min, max int
+}
+
+var (
+	minuteBounds = bounds{"minute", 0, 59}
+	hourBounds   = bounds{"hour", 0, 23}
+	domBounds    = bounds{"day of month", 1, 31}
+	monthBounds  = bounds{"month", 1, 12}
+	//7 is sunday as well
+	dowBounds = bounds{"day of week", 0, 7}
+
+	descriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
+
+// parses the cron expression with 5 fields (minute hour day-of-month month day-of-week), each field is *, a value,
+// a range (1-5) or a list (1,3,5), optionally with step (*/15, 0-30/10). Descriptors like @daily are accepted as well.
+func parseCron(expr string) (Schedule, error) {
+	if spec, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = spec
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q, expected 5 fields", expr)
+	}
+	var c cron
+	var err error
+	for i, f := range []struct {
+		bits *uint64
+		b    bounds
+	}{{&c.minute, minuteBounds}, {&c.hour, hourBounds}, {&c.dom, domBounds}, {&c.month, monthBounds}, {&c.dow, dowBounds}} {
+		*f.bits, err = parseField(fields[i], f.b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = strings.HasPrefix(fields[2], "*")
+	c.dowAny = strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// parses the comma separated list of a field into bit set of its values.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			rangePart = part[:i]
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %s", b.name, part)
+			}
+		}
+
+		start, end := b.min, b.max
+		if rangePart != "*" {
+			bound := strings.SplitN(rangePart, "-", 2)
+			var err error
+			start, err = strconv.Atoi(bound[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid value in %s field: %s", b.name, part)
+			}
+			end = start
+			if len(bound) == 2 {
+				end, err = strconv.Atoi(bound[1])
+				if err != nil {
+					return 0, fmt.Errorf("invalid value in %s field: %s", b.name, part)
+				}
+			} else if step != 1 {
+				//a single value with step runs till the maximum, ex: 5/15 is 5-59/15
+				end = b.max
+			}
+		}
+		if start < b.min || end > b.max || start > end {
+			return 0, fmt.Errorf("%s field should be within %d-%d: %s", b.name, b.min, b.max, part)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first minute after t matching the expression, in t's location.
+// Returns zero time if there's no match within 5 years, ex: for 30th February.
+func (c cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (c cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
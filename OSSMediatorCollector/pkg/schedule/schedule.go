@@ -0,0 +1,75 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package schedule
+
+import (
+	"collector/pkg/config"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Schedule computes the times at which an API is triggered.
+type Schedule interface {
+	// Next returns the first trigger time after t.
+	Next(t time.Time) time.Time
+}
+
+// every triggers at start plus multiples of period.
+type every struct {
+	start  time.Time
+	period time.Duration
+}
+
+// Every returns a schedule triggering at start and every period before and after it.
+func Every(start time.Time, period time.Duration) Schedule {
+	return every{start: start, period: period}
+}
+
+func (e every) Next(t time.Time) time.Time {
+	n := t.Sub(e.start) / e.period
+	next := e.start.Add(n * e.period)
+	for !next.After(t) {
+		next = next.Add(e.period)
+	}
+	for next.Add(-e.period).After(t) {
+		next = next.Add(-e.period)
+	}
+	return next.In(t.Location())
+}
+
+// Parse returns the schedule of conf. Without cron expression it triggers every interval minutes aligned to the clock,
+// ex: at 00:00, 00:15, 00:30... for 15 minutes, delayed by offset seconds. apiInterval is used if conf's interval isn't set.
+func Parse(conf *config.ScheduleConf, apiInterval int) (Schedule, error) {
+	if conf.Cron != "" {
+		if conf.Interval != 0 || conf.Offset != 0 {
+			return nil, fmt.Errorf("cron can't be combined with interval and offset")
+		}
+		return parseCron(conf.Cron)
+	}
+	interval := conf.Interval
+	if interval == 0 {
+		interval = apiInterval
+	}
+	if interval <= 0 {
+		return nil, fmt.Errorf("interval should be positive, interval: %d", interval)
+	}
+	period := time.Duration(interval) * time.Minute
+	offset := time.Duration(conf.Offset) * time.Second
+	if conf.Offset < 0 || offset >= period {
+		return nil, fmt.Errorf("offset should be within 0-%d seconds, offset: %d", int(period.Seconds())-1, conf.Offset)
+	}
+	return Every(time.Unix(0, 0).Add(offset), period), nil
+}
+
+// Jitter returns a random delay up to conf's jitter.
+func Jitter(conf *config.ScheduleConf) time.Duration {
+	if conf == nil || conf.Jitter <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(time.Duration(conf.Jitter) * time.Second)))
+}
@@ -0,0 +1,92 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package schedule
+
+import (
+	"collector/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func parseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestEvery(t *testing.T) {
+	start := parseTime(t, "2024-01-02T10:07:00Z")
+	sched := Every(start, 15*time.Minute)
+	assert.Equal(t, start, sched.Next(parseTime(t, "2024-01-02T10:00:00Z")))
+	assert.Equal(t, parseTime(t, "2024-01-02T10:22:00Z"), sched.Next(start))
+	assert.Equal(t, parseTime(t, "2024-01-02T12:07:00Z"), sched.Next(parseTime(t, "2024-01-02T11:55:30Z")))
+	assert.Equal(t, parseTime(t, "2024-01-02T09:52:00Z"), sched.Next(parseTime(t, "2024-01-02T09:40:00Z")))
+}
+
+func TestParseInterval(t *testing.T) {
+	//aligned to the clock with offset
+	sched, err := Parse(&config.ScheduleConf{Offset: 30}, 15)
+	assert.Nil(t, err)
+	assert.Equal(t, parseTime(t, "2024-01-02T10:15:30Z"), sched.Next(parseTime(t, "2024-01-02T10:03:10Z")))
+	assert.Equal(t, parseTime(t, "2024-01-02T10:30:30Z"), sched.Next(parseTime(t, "2024-01-02T10:15:30Z")))
+
+	//schedule's interval overrides API's interval
+	sched, err = Parse(&config.ScheduleConf{Interval: 1440, Offset: 7200}, 15)
+	assert.Nil(t, err)
+	assert.Equal(t, parseTime(t, "2024-01-03T02:00:00Z"), sched.Next(parseTime(t, "2024-01-02T10:03:10Z")))
+
+	_, err = Parse(&config.ScheduleConf{Offset: 60}, 1)
+	assert.EqualError(t, err, "offset should be within 0-59 seconds, offset: 60")
+}
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		cron     string
+		from     string
+		expected string
+	}{
+		{"0 2 * * *", "2024-01-02T10:03:00Z", "2024-01-03T02:00:00Z"},
+		{"*/15 * * * *", "2024-01-02T10:03:10Z", "2024-01-02T10:15:00Z"},
+		{"*/15 * * * *", "2024-01-02T10:15:00Z", "2024-01-02T10:30:00Z"},
+		{"5-10/5 8,20 * * *", "2024-01-02T08:10:00Z", "2024-01-02T20:05:00Z"},
+		{"0 0 * * 7", "2024-01-02T10:00:00Z", "2024-01-07T00:00:00Z"},
+		{"0 0 * * mon", "", ""},
+		//day of month or day of week when both are restricted
+		{"0 0 15 * 1", "2024-01-02T10:00:00Z", "2024-01-08T00:00:00Z"},
+		{"0 0 29 2 *", "2024-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"@monthly", "2024-01-31T23:59:00Z", "2024-02-01T00:00:00Z"},
+		{"@hourly", "2024-12-31T23:30:00Z", "2025-01-01T00:00:00Z"},
+	}
+	for _, test := range tests {
+		sched, err := Parse(&config.ScheduleConf{Cron: test.cron}, 15)
+		if test.expected == "" {
+			assert.NotNil(t, err, test.cron)
+			continue
+		}
+		if assert.Nil(t, err, test.cron) {
+			assert.Equal(t, parseTime(t, test.expected), sched.Next(parseTime(t, test.from)), test.cron)
+		}
+	}
+
+	//no match within 5 years
+	sched, err := Parse(&config.ScheduleConf{Cron: "0 0 30 2 *"}, 15)
+	assert.Nil(t, err)
+	assert.True(t, sched.Next(parseTime(t, "2024-01-02T10:00:00Z")).IsZero())
+}
+
+func TestJitter(t *testing.T) {
+	assert.Equal(t, time.Duration(0), Jitter(nil))
+	for i := 0; i < 100; i++ {
+		jitter := Jitter(&config.ScheduleConf{Jitter: 2})
+		assert.True(t, jitter >= 0 && jitter < 2*time.Second, jitter)
+	}
+}
@@ -0,0 +1,149 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+// Package secret implements the format of the secret files written by storesecret and read by the collector.
+// The secrets are sealed with AES-256-GCM if the secret key is configured, otherwise each line of the secret is stored
+// base64 encoded. It only depends on the standard library, so that storesecret can share it.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	//KeyEnv is the environment variable containing base64 encoded AES-256 key, used if secret key file isn't given
+	KeyEnv = "OSSMEDIATOR_SECRET_KEY"
+
+	//prefix of the encrypted secret file, followed by base64 encoded nonce and AES-GCM sealed secret
+	encryptedPrefix = "enc:v1:"
+)
+
+var (
+	//ErrDecoding is returned when the secret file isn't in the expected format.
+	ErrDecoding = errors.New("unable to decode secret")
+	//ErrDecryption is returned when the secret can't be decrypted with the configured key.
+	ErrDecryption = errors.New("unable to decrypt secret, secret key doesn't match")
+)
+
+// LoadCipher reads the base64 encoded AES-256 key from keyFile, or from KeyEnv environment variable if keyFile is empty,
+// and creates the cipher used to encrypt and decrypt the secrets. nil cipher is returned if the key isn't configured.
+func LoadCipher(keyFile string) (cipher.AEAD, error) {
+	var encodedKey string
+	if keyFile != "" {
+		data, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read secret key file %s: %v", keyFile, err)
+		}
+		encodedKey = string(data)
+	} else {
+		encodedKey = os.Getenv(KeyEnv)
+	}
+	if strings.TrimSpace(encodedKey) == "" {
+		return nil, nil
+	}
+	return NewCipher(encodedKey)
+}
+
+// NewCipher creates AES-GCM cipher from base64 encoded 32 bytes key.
+func NewCipher(encodedKey string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode secret key: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("invalid secret key length %d, expected 32 bytes AES-256 key", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// GenerateKey generates a new AES-256 key and writes it base64 encoded to keyFile, existing key file isn't overwritten.
+func GenerateKey(keyFile string) error {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(keyFile), 0700)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(keyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(base64.StdEncoding.EncodeToString(key) + "\n")
+	return err
+}
+
+// Seal returns the content of the user's secret file, the secret is encrypted if aead isn't nil, otherwise each line of
+// the secret is base64 encoded.
+func Seal(aead cipher.AEAD, email string, secret []byte) string {
+	if aead == nil {
+		return Encode(secret)
+	}
+	return Encrypt(aead, email, secret)
+}
+
+// Encrypt seals the secret with user's email as additional data, so that the secret files can't be swapped between users.
+func Encrypt(aead cipher.AEAD, email string, secret []byte) string {
+	nonce := make([]byte, aead.NonceSize())
+	_, _ = rand.Read(nonce)
+	sealed := aead.Seal(nonce, nonce, secret, []byte(email))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed)
+}
+
+// IsEncrypted returns true if the secret file's content is encrypted.
+func IsEncrypted(data []byte) bool {
+	return strings.HasPrefix(string(data), encryptedPrefix)
+}
+
+// Decrypt opens the secret sealed by Encrypt for the user.
+func Decrypt(aead cipher.AEAD, email string, data []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(string(data), encryptedPrefix)))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, ErrDecoding
+	}
+	secret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(email))
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return secret, nil
+}
+
+// Encode base64 encodes each line of the secret, ex: the access and refresh token of ABAC user.
+func Encode(secret []byte) string {
+	var lines []string
+	for _, line := range strings.Split(string(secret), "\n") {
+		lines = append(lines, base64.StdEncoding.EncodeToString([]byte(line)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Decode decodes each line of the base64 encoded secret written by Encode.
+func Decode(data []byte) ([]byte, error) {
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		if err != nil {
+			return nil, ErrDecoding
+		}
+		lines = append(lines, string(decoded))
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
@@ -0,0 +1,54 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package secret
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadCipherWithoutKey(t *testing.T) {
+	t.Setenv(KeyEnv, "")
+	aead, err := LoadCipher("")
+	assert.Nil(t, err)
+	assert.Nil(t, aead)
+}
+
+func TestSealAndOpen(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "secret.key")
+	assert.Nil(t, GenerateKey(keyFile))
+	assert.NotNil(t, GenerateKey(keyFile))
+	aead, err := LoadCipher(keyFile)
+	assert.Nil(t, err)
+
+	data := Seal(aead, "user@nokia.com", []byte("access\nrefresh"))
+	assert.True(t, IsEncrypted([]byte(data)))
+	decrypted, err := Decrypt(aead, "user@nokia.com", []byte(data))
+	assert.Nil(t, err)
+	assert.Equal(t, "access\nrefresh", string(decrypted))
+
+	_, err = Decrypt(aead, "user2@nokia.com", []byte(data))
+	assert.Equal(t, ErrDecryption, err)
+	_, err = Decrypt(aead, "user@nokia.com", []byte(encryptedPrefix+"???"))
+	assert.Equal(t, ErrDecoding, err)
+}
+
+func TestSealWithoutKey(t *testing.T) {
+	data := Seal(nil, "user@nokia.com", []byte("access\nrefresh"))
+	assert.False(t, IsEncrypted([]byte(data)))
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("access"))+"\n"+base64.StdEncoding.EncodeToString([]byte("refresh")), data)
+
+	decoded, err := Decode([]byte(data + "\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "access\nrefresh", string(decoded))
+
+	_, err = Decode([]byte("???"))
+	assert.Equal(t, ErrDecoding, err)
+}
@@ -0,0 +1,107 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package sink
+
+import (
+	"bytes"
+	"collector/pkg/config"
+	"collector/pkg/utils"
+	esconfig "elasticsearchplugin/pkg/config"
+	"elasticsearchplugin/pkg/elasticsearch"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const fileExtension = ".json"
+
+// elasticsearchSink indexes the response directly to elasticsearch using ElasticsearchPlugin's push logic.
+// The response is pushed with the name the file sink would have written it with,
+// so index names and document IDs are same as when the plugin picks up the collected file.
+type elasticsearchSink struct {
+	conf esconfig.ElasticsearchConf
+	err  error
+}
+
+func newElasticsearchSink(conf *config.SinkConf) *elasticsearchSink {
+	esConf, err := pluginConf(conf.Elasticsearch)
+	return &elasticsearchSink{conf: esConf, err: err}
+}
+
+func (s *elasticsearchSink) Write(user *config.User, api *config.APIConf, data interface{}, id string, txnID uint64, prettyResponse bool) error {
+	if s.err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": s.err}).Errorf("Pushing response to elasticsearch for %s failed", user.Email)
+		return s.err
+	}
+	content, err := json.Marshal(data)
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Pushing response to elasticsearch for %s failed", user.Email)
+		return err
+	}
+
+	fileName := utils.ResponseFileName(user, api, id) + fileExtension
+	log.WithFields(log.Fields{"tid": txnID}).Infof("Pushing response %s to elasticsearch for %s", fileName, user.Email)
+	err = elasticsearch.PushReader(fileName, bytes.NewReader(content), s.conf)
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Pushing response %s to elasticsearch for %s failed", fileName, user.Email)
+		return err
+	}
+	return nil
+}
+
+// initializes the retry queue, dead letter file and index mappings of elasticsearch,
+// and starts retrying the failed requests and cleaning up old data in background, as done by ElasticsearchPlugin at startup.
+// For a one-shot run only the dead letter file and index mappings are initialized.
+func initElasticsearch(conf *config.ElasticsearchSinkConf, oneShot bool) error {
+	esConf, err := pluginConf(conf)
+	if err != nil {
+		return err
+	}
+	if !oneShot {
+		err = elasticsearch.InitRetryQueue(esconfig.RetryQueueConf{Dir: conf.RetryQueueDir, MaxSizeMB: conf.RetryQueueMaxSizeMB})
+		if err != nil {
+			return fmt.Errorf("unable to open elasticsearch retry queue: %w", err)
+		}
+	}
+	err = elasticsearch.InitDeadLetter(conf.DeadLetterFile)
+	if err != nil {
+		return fmt.Errorf("unable to create elasticsearch dead letter file: %w", err)
+	}
+
+	//add elasticsearch mapping for core-pm and ixr-pm index
+	elasticsearch.AddPMMapping(esConf, "core-pm")
+	elasticsearch.AddPMMapping(esConf, "ixr-pm")
+	if oneShot {
+		return nil
+	}
+	//retry pushing data to elasticsearch that was failed earlier
+	elasticsearch.PushFailedData(esConf)
+	//remove old data and indices from elasticsearch
+	if esConf.DataRetentionDuration > 0 {
+		go elasticsearch.CleanUp(esConf)
+	}
+	return nil
+}
+
+// converts the sink's elasticsearch details to ElasticsearchPlugin's config, with the decoded password.
+func pluginConf(conf *config.ElasticsearchSinkConf) (esconfig.ElasticsearchConf, error) {
+	if conf == nil {
+		return esconfig.ElasticsearchConf{}, fmt.Errorf("elasticsearch details can't be empty for ELASTICSEARCH sink")
+	}
+	password, err := base64.StdEncoding.DecodeString(conf.Password)
+	if err != nil {
+		return esconfig.ElasticsearchConf{}, fmt.Errorf("unable to decode elasticsearch password: %w", err)
+	}
+	return esconfig.ElasticsearchConf{
+		URL:                   conf.URL,
+		User:                  conf.User,
+		Password:              string(password),
+		DataRetentionDuration: conf.DataRetentionDuration,
+	}, nil
+}
@@ -0,0 +1,19 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package sink
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/utils"
+)
+
+// fileSink writes the response to the user's response_dest directory, to be picked up by the plugins.
+type fileSink struct{}
+
+func (fileSink) Write(user *config.User, api *config.APIConf, data interface{}, id string, txnID uint64, prettyResponse bool) error {
+	return utils.WriteResponse(user, api, data, id, txnID, prettyResponse)
+}
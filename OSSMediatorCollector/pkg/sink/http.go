@@ -0,0 +1,108 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package sink
+
+import (
+	"bytes"
+	"collector/pkg/config"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//default timeout of HTTP sink requests in seconds
+	defaultHTTPTimeout = 60
+	//no. of retries of the post failed with network error, 429 or 5xx
+	httpMaxRetries = 3
+
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// backoff before the first retry of the failed post, doubled after each retry, overridden in tests
+var httpRetryBackoff = time.Second
+
+// httpSink posts the response records as NDJSON to the configured URL.
+type httpSink struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func newHTTPSink(conf *config.SinkConf) *httpSink {
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultHTTPTimeout
+	}
+	return &httpSink{
+		url:     conf.URL,
+		headers: conf.Headers,
+		client: &http.Client{
+			Timeout:   time.Duration(timeout) * time.Second,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment},
+		},
+	}
+}
+
+// Close closes the idle connections of the sink's HTTP client.
+func (s *httpSink) Close() {
+	s.client.CloseIdleConnections()
+}
+
+// Write posts the records, the post failed with network error, 429 or 5xx is retried with backoff.
+// Error is returned if all the retries fail, so that the caller doesn't store the checkpoint and collects the data again.
+func (s *httpSink) Write(user *config.User, api *config.APIConf, data interface{}, id string, txnID uint64, prettyResponse bool) error {
+	var body bytes.Buffer
+	err := writeNDJSON(&body, user, api, data, id)
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Posting response to %s for %s failed", s.url, user.Email)
+		return err
+	}
+
+	backoff := httpRetryBackoff
+	for i := 0; ; i++ {
+		log.WithFields(log.Fields{"tid": txnID}).Infof("Posting response to %s for %s", s.url, user.Email)
+		var retryable bool
+		retryable, err = s.post(body.Bytes())
+		if err == nil {
+			return nil
+		}
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Posting response to %s for %s failed", s.url, user.Email)
+		if !retryable || i == httpMaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// posts the body, returns true with the error if the post can be retried.
+func (s *httpSink) post(body []byte) (bool, error) {
+	request, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	request.Header.Set("Content-Type", ndjsonContentType)
+	for k, v := range s.headers {
+		request.Header.Set(k, v)
+	}
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return true, err
+	}
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		err = fmt.Errorf("received status code %d from %s", response.StatusCode, s.url)
+		return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500, err
+	}
+	return false, nil
+}
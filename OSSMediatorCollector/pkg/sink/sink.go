@@ -0,0 +1,196 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package sink
+
+import (
+	"collector/pkg/config"
+	"collector/pkg/utils"
+	"encoding/json"
+	"io"
+	"path"
+	"reflect"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Sink writes the data received from the APIs to its destination.
+// prettyResponse is only applicable to the sinks writing a JSON document, NDJSON records are always written in a single line.
+type Sink interface {
+	Write(user *config.User, api *config.APIConf, data interface{}, id string, txnID uint64, prettyResponse bool) error
+}
+
+var (
+	//default sink when no sink is configured
+	defaultConf = &config.SinkConf{Type: config.FileSink}
+
+	//sinks created for each sink config keyed by the sink's config, so that HTTP clients are reused
+	//and the sinks of the unchanged config are kept when the config is reloaded
+	sinks   = map[string]Sink{}
+	sinkMux sync.Mutex
+
+	//elasticsearch config with which the retry queue and mappings are initialized, nil until an ELASTICSEARCH sink is configured
+	esInitConf *config.ElasticsearchSinkConf
+)
+
+// closer is implemented by the sinks holding resources which have to be released when the sink is no longer configured.
+type closer interface {
+	Close()
+}
+
+// record is the NDJSON line written by stdout and HTTP sinks for each record of the response.
+type record struct {
+	User       string          `json:"user"`
+	API        string          `json:"api"`
+	MetricType string          `json:"metric_type,omitempty"`
+	Type       string          `json:"type,omitempty"`
+	ID         string          `json:"id,omitempty"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// ConfFor returns the sink config for the user's API.
+// API's sink takes precedence over user's sink, which takes precedence over the global sink.
+// api can be nil for the APIs which aren't configured individually (ex: network and organization APIs).
+func ConfFor(user *config.User, api *config.APIConf) *config.SinkConf {
+	if api != nil && api.Sink != nil {
+		return api.Sink
+	}
+	if user.Sink != nil {
+		return user.Sink
+	}
+	if sink := config.Current().Sink; sink != nil {
+		return sink
+	}
+	return defaultConf
+}
+
+// For returns the sink to which the user's API response is written.
+func For(user *config.User, api *config.APIConf) Sink {
+	conf := ConfFor(user, api)
+	key := sinkKey(conf)
+	sinkMux.Lock()
+	defer sinkMux.Unlock()
+	s, ok := sinks[key]
+	if !ok {
+		s = newSink(conf)
+		sinks[key] = s
+	}
+	return s
+}
+
+// Init initializes the destinations of the configured sinks, it's called at startup after the config is validated
+// and after the config is reloaded. The sinks which are no longer configured are closed and dropped.
+// All ELASTICSEARCH sinks push to the same elasticsearch, so it's initialized only once, with the first configured one.
+func Init() error {
+	return initSinks(false)
+}
+
+// InitOneShot initializes the destinations of the configured sinks for a one-shot run alongside the running collector,
+// ex: backfill. Elasticsearch's retry queue belongs to the running collector, so it isn't opened and the failed
+// requests are returned as errors, retrying the failed requests and cleaning up old data are left to the collector.
+func InitOneShot() error {
+	return initSinks(true)
+}
+
+func initSinks(oneShot bool) error {
+	confs := configuredSinks(config.Current())
+	keys := map[string]bool{sinkKey(defaultConf): true}
+	for _, conf := range confs {
+		keys[sinkKey(conf)] = true
+	}
+	sinkMux.Lock()
+	for key, s := range sinks {
+		if keys[key] {
+			continue
+		}
+		delete(sinks, key)
+		if c, ok := s.(closer); ok {
+			c.Close()
+		}
+	}
+	sinkMux.Unlock()
+
+	for _, conf := range confs {
+		if conf.Type != config.ElasticsearchSink {
+			continue
+		}
+		if esInitConf != nil {
+			if !reflect.DeepEqual(esInitConf, conf.Elasticsearch) {
+				log.Warn("Change of elasticsearch retry queue, dead letter file and data retention is applied only on restart")
+			}
+			return nil
+		}
+		err := initElasticsearch(conf.Elasticsearch, oneShot)
+		if err != nil {
+			return err
+		}
+		esInitConf = conf.Elasticsearch
+		return nil
+	}
+	return nil
+}
+
+// returns the sink configs of the config, global sink first followed by the users' and the APIs' sinks.
+func configuredSinks(conf config.Config) []*config.SinkConf {
+	confs := []*config.SinkConf{conf.Sink}
+	for _, user := range conf.Users {
+		confs = append(confs, user.Sink)
+	}
+	for _, api := range append(append([]*config.APIConf{}, conf.MetricAPIs...), conf.SimAPIs...) {
+		confs = append(confs, api.Sink)
+	}
+	var configured []*config.SinkConf
+	for _, conf := range confs {
+		if conf != nil {
+			configured = append(configured, conf)
+		}
+	}
+	return configured
+}
+
+// returns the identity of the sink config, the sinks with same config share the sink.
+func sinkKey(conf *config.SinkConf) string {
+	key, _ := json.Marshal(conf)
+	return string(key)
+}
+
+func newSink(conf *config.SinkConf) Sink {
+	switch conf.Type {
+	case config.StdoutSink:
+		return &stdoutSink{}
+	case config.HTTPSink:
+		return newHTTPSink(conf)
+	case config.ElasticsearchSink:
+		return newElasticsearchSink(conf)
+	default:
+		return fileSink{}
+	}
+}
+
+// writes each record of data wrapped in a record envelope, with the user and API it's collected for, as a JSON line to w.
+func writeNDJSON(w io.Writer, user *config.User, api *config.APIConf, data interface{}, id string) error {
+	items, err := utils.NDJSONRecords(data)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	for _, item := range items {
+		err = encoder.Encode(record{
+			User:       user.Email,
+			API:        path.Base(api.API),
+			MetricType: api.MetricType,
+			Type:       api.Type,
+			ID:         id,
+			Data:       item,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
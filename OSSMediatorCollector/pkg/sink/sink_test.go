@@ -0,0 +1,270 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package sink
+
+import (
+	"bytes"
+	"collector/pkg/config"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfForPrecedence(t *testing.T) {
+	globalSink := &config.SinkConf{Type: config.StdoutSink}
+	userSink := &config.SinkConf{Type: config.HTTPSink, URL: "http://localhost:8080"}
+	apiSink := &config.SinkConf{Type: config.FileSink}
+	config.Conf.Sink = globalSink
+	defer func() { config.Conf.Sink = nil }()
+
+	user := &config.User{Email: "user1@nokia.com"}
+	api := &config.APIConf{API: "/pmdata"}
+	if ConfFor(user, api) != globalSink {
+		t.Error("expected global sink")
+	}
+	user.Sink = userSink
+	if ConfFor(user, api) != userSink || ConfFor(user, nil) != userSink {
+		t.Error("expected user's sink")
+	}
+	api.Sink = apiSink
+	if ConfFor(user, api) != apiSink {
+		t.Error("expected API's sink")
+	}
+
+	config.Conf.Sink = nil
+	if ConfFor(&config.User{}, &config.APIConf{}).Type != config.FileSink {
+		t.Error("expected file sink by default")
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	user := &config.User{Email: "user1@nokia.com", ResponseDest: "./tmp"}
+	api := &config.APIConf{API: "/pmdata", MetricType: "RADIO"}
+	os.MkdirAll("./tmp/pmdata", os.ModePerm)
+	defer os.RemoveAll("./tmp")
+
+	err := For(user, api).Write(user, api, []string{"test"}, "", 123, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := os.ReadDir("./tmp/pmdata")
+	if len(files) != 1 || !strings.HasPrefix(files[0].Name(), "pmdata_RADIO_response_") {
+		t.Errorf("expected response file, found %v", files)
+	}
+}
+
+func TestStdoutSink(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	user := &config.User{Email: "user1@nokia.com"}
+	api := &config.APIConf{API: "/fmdata", MetricType: "RADIO", Type: "ACTIVE", Sink: &config.SinkConf{Type: config.StdoutSink}}
+	data := []map[string]interface{}{{"alarm_identifier": "1"}, {"alarm_identifier": "2"}}
+	err := For(user, api).Write(user, api, data, "nhg1", 123, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 records, got %d: %s", len(lines), buf.String())
+	}
+	var rec record
+	err = json.Unmarshal([]byte(lines[1]), &rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.User != "user1@nokia.com" || rec.API != "fmdata" || rec.MetricType != "RADIO" || rec.Type != "ACTIVE" || rec.ID != "nhg1" || string(rec.Data) != `{"alarm_identifier":"2"}` {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var body, contentType, token string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		body = string(content)
+		contentType = r.Header.Get("Content-Type")
+		token = r.Header.Get("X-Token")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	user := &config.User{Email: "user1@nokia.com", Sink: &config.SinkConf{Type: config.HTTPSink, URL: server.URL, Headers: map[string]string{"X-Token": "secret"}}}
+	api := &config.APIConf{API: "/network-hardware-groups"}
+	err := For(user, api).Write(user, api, map[string]string{"nhg_id": "nhg1"}, "", 123, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != ndjsonContentType || token != "secret" || !strings.Contains(body, `"data":{"nhg_id":"nhg1"}`) || strings.Count(body, "\n") != 1 {
+		t.Errorf("unexpected request, content type: %s, body: %s", contentType, body)
+	}
+}
+
+func TestHTTPSinkWithFailedResponse(t *testing.T) {
+	httpRetryBackoff = time.Millisecond
+	defer func() { httpRetryBackoff = time.Second }()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	user := &config.User{Email: "user1@nokia.com"}
+	api := &config.APIConf{API: "/sims", Sink: &config.SinkConf{Type: config.HTTPSink, URL: server.URL}}
+	err := For(user, api).Write(user, api, []string{"test"}, "", 123, false)
+	if err == nil || !strings.Contains(err.Error(), "received status code 500") {
+		t.Error(err)
+	}
+	if calls != httpMaxRetries+1 {
+		t.Errorf("expected %d posts, got %d", httpMaxRetries+1, calls)
+	}
+}
+
+func TestHTTPSinkRetriesFailedPost(t *testing.T) {
+	httpRetryBackoff = time.Millisecond
+	defer func() { httpRetryBackoff = time.Second }()
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(content))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	user := &config.User{Email: "user1@nokia.com"}
+	api := &config.APIConf{API: "/sims", Sink: &config.SinkConf{Type: config.HTTPSink, URL: server.URL}}
+	err := For(user, api).Write(user, api, []string{"test"}, "", 123, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 || bodies[0] != bodies[1] || bodies[1] == "" {
+		t.Errorf("unexpected posts: %v", bodies)
+	}
+}
+
+func TestHTTPSinkDoesNotRetryClientError(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	user := &config.User{Email: "user1@nokia.com"}
+	api := &config.APIConf{API: "/sims", Sink: &config.SinkConf{Type: config.HTTPSink, URL: server.URL}}
+	err := For(user, api).Write(user, api, []string{"test"}, "", 123, false)
+	if err == nil || calls != 1 {
+		t.Errorf("expected single failed post, got %d posts, error: %v", calls, err)
+	}
+}
+
+func TestElasticsearchSink(t *testing.T) {
+	var body, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, _ := io.ReadAll(r.Body)
+		body = string(content)
+		path = r.URL.Path
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	user := &config.User{Email: "user1@nokia.com"}
+	api := &config.APIConf{API: "/pmdata", MetricType: "RADIO", Sink: &config.SinkConf{Type: config.ElasticsearchSink, Elasticsearch: &config.ElasticsearchSinkConf{URL: server.URL}}}
+	data := []map[string]interface{}{{
+		"pm_data":        map[string]interface{}{"Cat_M_Accessibility_M8100C0": 0},
+		"pm_data_source": map[string]interface{}{"hw_id": "EB34567", "dn": "NE-MRBTS-111/NE-LNBTS-222/LNCEL-0", "timestamp": "2020-11-10T18:30:00Z", "technology": "4G"},
+	}}
+	err := For(user, api).Write(user, api, data, "", 123, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//document ID is same as the one used by ElasticsearchPlugin for the collected file
+	if path != "/_bulk" || !strings.Contains(body, `"_id": "EB34567_2020-11-10T18:30:00Z_NE-MRBTS-111/NE-LNBTS-222/LNCEL-0"`) || !strings.Contains(body, `"_index": "4g-pm-cat_m_accessibility-`) {
+		t.Errorf("unexpected bulk request to %s: %s", path, body)
+	}
+}
+
+func TestElasticsearchSinkWithInvalidPassword(t *testing.T) {
+	user := &config.User{Email: "user1@nokia.com"}
+	api := &config.APIConf{API: "/sims", Sink: &config.SinkConf{Type: config.ElasticsearchSink, Elasticsearch: &config.ElasticsearchSinkConf{URL: "http://localhost:9200", Password: "invalid password"}}}
+	err := For(user, api).Write(user, api, []string{"test"}, "", 123, false)
+	if err == nil || !strings.Contains(err.Error(), "unable to decode elasticsearch password") {
+		t.Error(err)
+	}
+}
+
+func TestInitDropsRemovedSinks(t *testing.T) {
+	userSink := &config.SinkConf{Type: config.HTTPSink, URL: "http://localhost:8080"}
+	removedSink := &config.SinkConf{Type: config.HTTPSink, URL: "http://localhost:8081"}
+	user := &config.User{Email: "user1@nokia.com", Sink: userSink}
+	config.Set(config.Config{Users: []*config.User{user}})
+	defer config.Set(config.Config{})
+
+	s := For(user, nil)
+	removed := For(&config.User{Sink: removedSink}, nil)
+	err := Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//reloaded config has a new but equal sink config, the sink is kept
+	reloaded := &config.User{Email: "user1@nokia.com", Sink: &config.SinkConf{Type: config.HTTPSink, URL: "http://localhost:8080"}}
+	config.Set(config.Config{Users: []*config.User{reloaded}})
+	err = Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if For(reloaded, nil) != s {
+		t.Error("expected sink of the unchanged config to be kept")
+	}
+	sinkMux.Lock()
+	_, ok := sinks[sinkKey(removedSink)]
+	sinkMux.Unlock()
+	if ok || For(&config.User{Sink: removedSink}, nil) == removed {
+		t.Error("expected sink of the removed config to be dropped")
+	}
+}
+
+func TestInitOneShotSkipsRetryQueue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+	esSink := &config.SinkConf{Type: config.ElasticsearchSink, Elasticsearch: &config.ElasticsearchSinkConf{
+		URL:                 server.URL,
+		RetryQueueDir:       dir + "/retry",
+		RetryQueueMaxSizeMB: 1,
+		DeadLetterFile:      dir + "/dead_letter/dead_letter.json",
+	}}
+	config.Set(config.Config{Sink: esSink})
+	defer config.Set(config.Config{})
+	defer func() { esInitConf = nil }()
+
+	err := InitOneShot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(dir + "/retry"); !os.IsNotExist(err) {
+		t.Error("expected retry queue of the running collector not to be opened")
+	}
+	if _, err = os.Stat(dir + "/dead_letter"); err != nil {
+		t.Error("expected dead letter directory to be created", err)
+	}
+}
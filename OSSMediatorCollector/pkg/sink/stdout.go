@@ -0,0 +1,46 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package sink
+
+import (
+	"bytes"
+	"collector/pkg/config"
+	"io"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	//destination of stdout sink, overridden in tests
+	stdout    io.Writer = os.Stdout
+	stdoutMux sync.Mutex
+)
+
+// stdoutSink writes the response records as NDJSON to stdout.
+type stdoutSink struct{}
+
+func (*stdoutSink) Write(user *config.User, api *config.APIConf, data interface{}, id string, txnID uint64, prettyResponse bool) error {
+	//records of a response are buffered, so that concurrent responses aren't interleaved
+	var buf bytes.Buffer
+	err := writeNDJSON(&buf, user, api, data, id)
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Writing response to stdout for %s failed", user.Email)
+		return err
+	}
+
+	stdoutMux.Lock()
+	defer stdoutMux.Unlock()
+	_, err = stdout.Write(buf.Bytes())
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Writing response to stdout for %s failed", user.Email)
+		return err
+	}
+	log.WithFields(log.Fields{"tid": txnID}).Infof("Response written to stdout for %s", user.Email)
+	return nil
+}
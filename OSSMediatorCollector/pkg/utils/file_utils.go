@@ -7,14 +7,19 @@
 package utils
 
 import (
+	"collector/pkg/checkpoint"
 	"collector/pkg/config"
+	"collector/pkg/metrics"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -23,12 +28,13 @@ import (
 var (
 	//CurrentTime
 	CurrentTime = time.Now
+
+	//response files being written, so that the concurrent writes of an API don't pick the same file name
+	writingFiles = map[string]struct{}{}
+	writingMux   = sync.Mutex{}
 )
 
 const (
-	//File extension for writing response
-	fileExtension = ".json"
-
 	fmdataResponseType   = "fmdata"
 	pmdataResponseType   = "pmdata"
 	nhgResponseType      = "network-hardware-groups"
@@ -36,6 +42,7 @@ const (
 	simsResponseType     = "sims"
 	orgResponseType      = "organizations"
 	accountsResponseType = "accounts"
+	networkEventsType    = "network-events"
 
 	//field name to extract data from PM response file
 	pmSourceField    = "pm_data_source"
@@ -69,6 +76,34 @@ func writeFile(fileName string, data []byte) error {
 	return nil
 }
 
+// writes the file to a temporary file in the same directory, flushes it to the disk and renames it to fileName,
+// so that the consumers watching the directory never see a partially written file.
+// Temporary files are prefixed with "." to be ignored by the consumers.
+func writeFileAtomic(fileName string, perm os.FileMode, write func(file *os.File) error) error {
+	tmpFile, err := os.CreateTemp(path.Dir(fileName), "."+path.Base(fileName)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("file creation failed: %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	err = write(tmpFile)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	closeErr := tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	err = os.Chmod(tmpFile.Name(), perm)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), fileName)
+}
+
 // CreateResponseDirectory creates directory named path, along with any necessary parents.
 // If the directory creation fails it will terminate the program.
 func CreateResponseDirectory(basePath string, api string) {
@@ -80,8 +115,103 @@ func CreateResponseDirectory(basePath string, api string) {
 	}
 }
 
-// WriteResponse writes the data in json format to responseDest directory.
+// WriteResponse writes the data in the API's response format to responseDest directory.
+// The file extension is the format, so that the plugins can read the file by its extension.
 func WriteResponse(user *config.User, api *config.APIConf, data interface{}, id string, txnID uint64, prettyResponse bool) error {
+	format := config.ResponseFormatFor(api)
+	fileExtension := "." + format
+	fileName := ResponseFileName(user, api, id)
+	responseDest := user.ResponseDest + "/" + path.Base(api.API)
+	fileName = responseDest + "/" + fileName
+	counter := 1
+	name := fileName
+	writingMux.Lock()
+	for fileExists(name+fileExtension) || isWriting(name+fileExtension) {
+		name = fileName + "_" + strconv.Itoa(counter)
+		counter++
+	}
+	fileName = name + fileExtension
+	writingFiles[fileName] = struct{}{}
+	writingMux.Unlock()
+	defer func() {
+		writingMux.Lock()
+		delete(writingFiles, fileName)
+		writingMux.Unlock()
+	}()
+
+	log.WithFields(log.Fields{"tid": txnID}).Infof("Writing response to file %s for %s", fileName, user.Email)
+	err := writeFileAtomic(fileName, 0644, func(file *os.File) error {
+		return encodeResponse(file, format, data, prettyResponse)
+	})
+	if err != nil {
+		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Writing response to file %s for %s failed", fileName, user.Email)
+		return err
+	}
+	return nil
+}
+
+// writes data to w in the format, prettyResponse is only applicable to json format.
+func encodeResponse(w io.Writer, format string, data interface{}, prettyResponse bool) error {
+	switch format {
+	case config.NDJSONFormat:
+		return encodeNDJSON(w, data)
+	case config.NDJSONGzipFormat:
+		gz := gzip.NewWriter(w)
+		err := encodeNDJSON(gz, data)
+		if err != nil {
+			return err
+		}
+		return gz.Close()
+	default:
+		encoder := json.NewEncoder(w)
+		if prettyResponse {
+			encoder.SetIndent("", "  ")
+		}
+		return encoder.Encode(data)
+	}
+}
+
+// writes each record of data as is as a JSON line to w, the NDJSON response file is read by the plugins line by line.
+func encodeNDJSON(w io.Writer, data interface{}) error {
+	records, err := NDJSONRecords(data)
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		_, err = w.Write(append(record, '\n'))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NDJSONRecords returns the JSON encoded records of data, which are written one per line in NDJSON.
+// If data isn't an array it's returned as a single record.
+func NDJSONRecords(data interface{}) ([]json.RawMessage, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	records := []json.RawMessage{content}
+	if len(content) > 0 && content[0] == '[' {
+		err = json.Unmarshal(content, &records)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// returns true if the file is being written, called with writingMux locked.
+func isWriting(fileName string) bool {
+	_, ok := writingFiles[fileName]
+	return ok
+}
+
+// ResponseFileName returns the name, without directory and extension, with which the API response is written.
+// The plugins derive index names and document IDs from this name.
+func ResponseFileName(user *config.User, api *config.APIConf, id string) string {
 	fileName := path.Base(api.API)
 	if fileName == fmdataResponseType || fileName == pmdataResponseType {
 		if api.MetricType != "" {
@@ -93,7 +223,7 @@ func WriteResponse(user *config.User, api *config.APIConf, data interface{}, id
 		if id != "" {
 			fileName += "_" + id
 		}
-	} else if fileName == nhgResponseType || fileName == gngResponseType {
+	} else if fileName == nhgResponseType || fileName == gngResponseType || fileName == networkEventsType {
 		fileName += "_" + user.Email
 	} else if strings.Contains(fileName, simsResponseType) {
 		if id != "" {
@@ -107,63 +237,22 @@ func WriteResponse(user *config.User, api *config.APIConf, data interface{}, id
 			fileName += "_" + id
 		}
 	}
-
-	fileName += "_response_" + strconv.Itoa(int(CurrentTime().Unix()))
-	responseDest := user.ResponseDest + "/" + path.Base(api.API)
-	fileName = responseDest + "/" + fileName
-	counter := 1
-	name := fileName
-	for fileExists(name + fileExtension) {
-		name = fileName + "_" + strconv.Itoa(counter)
-		counter++
-	}
-	fileName = name + fileExtension
-
-	log.WithFields(log.Fields{"tid": txnID}).Infof("Writing response to file %s for %s", fileName, user.Email)
-	file, _ := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
-	defer file.Close()
-	encoder := json.NewEncoder(file)
-	if prettyResponse {
-		encoder.SetIndent("", "  ")
-	}
-	err := encoder.Encode(data)
-	if err != nil {
-		log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Writing response to file %s for %s failed", fileName, user.Email)
-		return err
-	}
-
-	//err = writeFile(fileName, formattedData)
-	//if err != nil {
-	//	log.WithFields(log.Fields{"tid": txnID, "error": err}).Errorf("Writing response to file %s for %s failed", fileName, user.Email)
-	//	return err
-	//}
-	return nil
+	return fileName + "_response_" + strconv.Itoa(int(CurrentTime().Unix()))
 }
 
-// retrieves the last received metric time from file per API
+// retrieves the last received metric time from checkpoint store per API
 func getLastReceivedDataTime(user *config.User, api *config.APIConf, nhgID string) string {
-	//Reading start time value from file
-	fileName := "checkpoints/" + path.Base(api.API)
-	if api.MetricType != "" {
-		fileName = fileName + "_" + api.MetricType
-	}
-	if api.Type != "" {
-		fileName = fileName + "_" + api.Type
-	}
-	fileName = fileName + "_" + user.Email
-	if nhgID != "" {
-		fileName = fileName + "_" + nhgID
-	}
-	data, err := os.ReadFile(fileName)
-	if err != nil || len(data) == 0 {
+	lastReceivedTime, err := checkpoint.Get(checkpoint.KeyFor(user, api, nhgID))
+	if err != nil {
+		log.WithFields(log.Fields{"error": err}).Errorf("Unable to read checkpoint of %s for %s", api.API, user.Email)
 		return ""
 	}
-	return strings.TrimSpace(string(data))
+	return lastReceivedTime
 }
 
-// StoreLastReceivedDataTime writes the last received metric's event time to a file so that next time that time stamp will be used as start_time for api calls.
-// Creates file for each user and each API.
-// returns error if writing to or reading from the response directory fails.
+// StoreLastReceivedDataTime stores the last received metric's event time in checkpoint store so that next time that time stamp will be used as start_time for api calls.
+// Stores checkpoint for each user, API and NHG, the stored time is updated only if the received data is later than it.
+// returns error if updating the checkpoint store fails.
 func StoreLastReceivedDataTime(user *config.User, data interface{}, api *config.APIConf, nhgID string, txnID uint64) error {
 	var fieldName, source string
 	baseAPIPath := path.Base(api.API)
@@ -193,31 +282,25 @@ func StoreLastReceivedDataTime(user *config.User, data interface{}, api *config.
 		}
 		eventTimes = append(eventTimes, eventTime)
 	}
-	lastReceivedTime := getLastReceivedDataTime(user, api, nhgID)
-	if lastReceivedTime != "" {
-		t, err := time.Parse(time.RFC3339, lastReceivedTime)
-		if err == nil {
-			eventTimes = append(eventTimes, t)
-		}
+	if len(eventTimes) == 0 {
+		return nil
 	}
 	sort.Slice(eventTimes, func(i, j int) bool { return eventTimes[i].Before(eventTimes[j]) })
-	latestTime := truncateSeconds(eventTimes[len(eventTimes)-1]).Format(time.RFC3339)
+	latestEventTime := truncateSeconds(eventTimes[len(eventTimes)-1])
 
-	fileName := "checkpoints/" + path.Base(api.API)
-	if api.MetricType != "" {
-		fileName = fileName + "_" + api.MetricType
-	}
-	if api.Type != "" {
-		fileName = fileName + "_" + api.Type
-	}
-	fileName = fileName + "_" + user.Email
-	if nhgID != "" {
-		fileName = fileName + "_" + nhgID
-	}
-	log.WithFields(log.Fields{"tid": txnID}).Debug("Writing to ", fileName)
-	err := writeFile(fileName, []byte(latestTime))
+	key := checkpoint.KeyFor(user, api, nhgID)
+	log.WithFields(log.Fields{"tid": txnID}).Debug("Storing checkpoint of ", key)
+	err := checkpoint.Update(key, func(lastReceivedTime string) (string, error) {
+		t, err := time.Parse(time.RFC3339, lastReceivedTime)
+		if err == nil && t.After(latestEventTime) {
+			latestEventTime = t
+			return lastReceivedTime, nil
+		}
+		return latestEventTime.Format(time.RFC3339), nil
+	})
 	if err != nil {
 		return fmt.Errorf("unable to write last received data time, error: %v", err)
 	}
+	metrics.SetCheckpoint(user, api, nhgID, latestEventTime)
 	return nil
 }
@@ -8,13 +8,18 @@ package utils
 
 import (
 	"bytes"
+	"collector/pkg/checkpoint"
 	"collector/pkg/config"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -94,6 +99,50 @@ func TestWriteResponseForPM(t *testing.T) {
 	}
 }
 
+func TestResponseFileName(t *testing.T) {
+	CurrentTime = func() time.Time { return time.Unix(1600000000, 0) }
+	defer func() { CurrentTime = time.Now }()
+	user := &config.User{Email: "testuser@nokia.com"}
+	tests := []struct {
+		api      *config.APIConf
+		id       string
+		expected string
+	}{
+		{&config.APIConf{API: "/pmdata", MetricType: "RADIO"}, "nhg1", "pmdata_RADIO_nhg1_response_1600000000"},
+		{&config.APIConf{API: "/fmdata", MetricType: "DAC", Type: "ACTIVE"}, "", "fmdata_DAC_ACTIVE_response_1600000000"},
+		{&config.APIConf{API: "/network-hardware-groups"}, "", "network-hardware-groups_testuser@nokia.com_response_1600000000"},
+		{&config.APIConf{API: "/account-sims"}, "acc1", "account-sims_acc1_response_1600000000"},
+	}
+	for _, test := range tests {
+		if name := ResponseFileName(user, test.api, test.id); name != test.expected {
+			t.Errorf("expected %s, got %s", test.expected, name)
+		}
+	}
+}
+
+func TestWriteResponseIsAtomic(t *testing.T) {
+	user := &config.User{Email: "testuser@nokia.com", ResponseDest: "./tmp"}
+	api := &config.APIConf{API: "/pmdata", MetricType: "RADIO", Interval: 15}
+	CreateResponseDirectory(user.ResponseDest, api.API)
+	defer os.RemoveAll(user.ResponseDest)
+
+	err := WriteResponse(user, api, []string{"test"}, "", 123, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := os.ReadDir(user.ResponseDest + api.API)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || strings.HasPrefix(files[0].Name(), ".") {
+		t.Fatalf("expected only the response file in response directory, found %v", files)
+	}
+	content, err := os.ReadFile(user.ResponseDest + api.API + "/" + files[0].Name())
+	if err != nil || string(content) != "[\"test\"]\n" {
+		t.Errorf("unexpected response file content: %s, error: %v", content, err)
+	}
+}
+
 func TestCreateResponseDirectory(t *testing.T) {
 	respDir := "./tmp"
 	CreateResponseDirectory(respDir, "http://localhost:8080/pmdata")
@@ -130,20 +179,12 @@ func TestStoreLastReceivedDataTimeForFM(t *testing.T) {
 	user := &config.User{Email: "testuser@nokia.com"}
 	api := &config.APIConf{API: "/fmdata", Type: "ACTIVE", MetricType: "DAC"}
 	nhgID := "test_nhg_1"
-	_ = os.Mkdir("checkpoints", os.ModePerm)
+	openCheckpointStore(t)
 
 	err = StoreLastReceivedDataTime(user, data, api, nhgID, 123)
 	if err != nil {
 		t.Error(err)
 	}
-	//Reading LastReceivedFile value from file
-	fileName := "checkpoints/fmdata" + "_" + api.MetricType + "_" + api.Type + "_" + user.Email + "_" + nhgID
-	content, err := ioutil.ReadFile(fileName)
-	defer os.Remove(fileName)
-	if err != nil && len(content) == 0 && string(content) != "2020-10-30T13:39:00Z" {
-		t.Fail()
-	}
-
 	lastReceivedTime := getLastReceivedDataTime(user, api, nhgID)
 	if lastReceivedTime != "2020-10-30T13:39:00Z" {
 		t.Fail()
@@ -160,20 +201,92 @@ func TestStoreLastReceivedDataTimeForPM(t *testing.T) {
 	user := &config.User{Email: "testuser@nokia.com"}
 	api := &config.APIConf{API: "/pmdata"}
 	nhgID := "test_nhg_1"
+	openCheckpointStore(t)
 	err = StoreLastReceivedDataTime(user, data, api, nhgID, 123)
 	if err != nil {
 		t.Error(err)
 	}
-	//Reading LastReceivedFile value from file
-	fileName := "checkpoints/pmdata" + "_" + user.Email + "_" + nhgID
-	content, err := ioutil.ReadFile(fileName)
-	defer os.Remove(fileName)
-	if err != nil && len(content) == 0 && string(content) != "2020-10-30T13:39:00Z" {
-		t.Fail()
-	}
 
 	lastReceivedTime := getLastReceivedDataTime(user, api, nhgID)
 	if lastReceivedTime != "2020-10-30T13:39:00Z" {
 		t.Fail()
 	}
 }
+
+func TestStoreLastReceivedDataTimeKeepsLaterCheckpoint(t *testing.T) {
+	var data []interface{}
+	responseData := `[{"pm_data_source":{"timestamp":"2020-10-30T13:29:27Z"}}]`
+	err := json.NewDecoder(bytes.NewReader([]byte(responseData))).Decode(&data)
+	if err != nil {
+		t.Error(err)
+	}
+	user := &config.User{Email: "testuser@nokia.com"}
+	api := &config.APIConf{API: "/pmdata"}
+	openCheckpointStore(t)
+	err = checkpoint.Set(checkpoint.KeyFor(user, api, "test_nhg_1"), "2020-10-30T14:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = StoreLastReceivedDataTime(user, data, api, "test_nhg_1", 123)
+	if err != nil {
+		t.Error(err)
+	}
+	lastReceivedTime := getLastReceivedDataTime(user, api, "test_nhg_1")
+	if lastReceivedTime != "2020-10-30T14:00:00Z" {
+		t.Errorf("expected later checkpoint to be kept, got %s", lastReceivedTime)
+	}
+}
+
+// opens a checkpoint store in a temporary directory for the test
+func openCheckpointStore(t *testing.T) {
+	err := checkpoint.Open(filepath.Join(t.TempDir(), "checkpoints.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { checkpoint.Close() })
+}
+
+func TestWriteResponseWithNDJSONFormat(t *testing.T) {
+	user := &config.User{Email: "testuser@nokia.com", ResponseDest: "./tmp"}
+	data := []map[string]string{{"hw_id": "hw1"}, {"hw_id": "hw2"}}
+	tests := []struct {
+		format    string
+		extension string
+	}{
+		{config.NDJSONFormat, ".ndjson"},
+		{config.NDJSONGzipFormat, ".ndjson.gz"},
+	}
+	defer os.RemoveAll(user.ResponseDest)
+
+	for _, test := range tests {
+		api := &config.APIConf{API: "/pmdata", MetricType: "RADIO", ResponseFormat: test.format}
+		CreateResponseDirectory(user.ResponseDest, api.API)
+		err := WriteResponse(user, api, data, "", 123, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, err := os.ReadDir(user.ResponseDest + api.API)
+		if err != nil || len(files) != 1 || !strings.HasSuffix(files[0].Name(), test.extension) {
+			t.Fatalf("expected %s file, got %v", test.extension, files)
+		}
+
+		file, err := os.Open(user.ResponseDest + api.API + "/" + files[0].Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = file
+		if test.format == config.NDJSONGzipFormat {
+			r, err = gzip.NewReader(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		content, err := io.ReadAll(r)
+		file.Close()
+		if err != nil || string(content) != "{\"hw_id\":\"hw1\"}\n{\"hw_id\":\"hw2\"}\n" {
+			t.Errorf("unexpected %s content: %q, error: %v", test.format, content, err)
+		}
+		os.RemoveAll(user.ResponseDest)
+	}
+}
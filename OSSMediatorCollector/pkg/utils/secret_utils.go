@@ -0,0 +1,120 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package utils
+
+import (
+	"collector/pkg/secret"
+	"crypto/cipher"
+	"errors"
+	"os"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	//SecretKeyEnv is the environment variable containing base64 encoded AES-256 key, used if secret key file isn't given
+	SecretKeyEnv = secret.KeyEnv
+
+	//directory containing the user's secret files, named as .<email>
+	secretDir = ".secret"
+)
+
+var (
+	errorPasswordRead         = errors.New("unable to read password file")
+	errorPasswordDecoding     = errors.New("unable to decode password")
+	errorPasswordFileNotFound = errors.New("secret file not found")
+	errorSecretKeyNotFound    = errors.New("secret file is encrypted, secret key isn't configured")
+	errorSecretDecryption     = secret.ErrDecryption
+
+	//cipher used to encrypt/decrypt the secret files, secrets are stored base64 encoded if it's nil
+	secretCipher cipher.AEAD
+	secretMux    sync.RWMutex
+)
+
+// InitSecretKey loads the AES-256 key used to encrypt and decrypt the secret files.
+// The key is read from keyFile if it's given, otherwise from SecretKeyEnv environment variable.
+// If the key isn't configured, the secret files are read and written base64 encoded as earlier.
+func InitSecretKey(keyFile string) error {
+	aead, err := secret.LoadCipher(keyFile)
+	if err != nil {
+		return err
+	}
+	if aead == nil {
+		log.Warnf("Secret key isn't configured, secrets are stored base64 encoded. Set %s or secret key file to encrypt them", SecretKeyEnv)
+	}
+
+	secretMux.Lock()
+	defer secretMux.Unlock()
+	secretCipher = aead
+	return nil
+}
+
+// ReadPassword reads the user's password stored by storesecret.
+func ReadPassword(email string) (string, error) {
+	return readSecret(email)
+}
+
+// ReadSessionToken reads the ABAC user's access and refresh token stored by storesecret, separated by new line.
+func ReadSessionToken(email string) (string, error) {
+	return readSecret(email)
+}
+
+// StoreSessionToken replaces the ABAC user's stored access and refresh token, ex: when they're rotated by refresh API.
+// The tokens are encrypted if secret key is configured.
+func StoreSessionToken(email string, accessToken string, refreshToken string) error {
+	secretMux.RLock()
+	aead := secretCipher
+	secretMux.RUnlock()
+
+	data := secret.Seal(aead, email, []byte(accessToken+"\n"+refreshToken))
+	return writeFileAtomic(secretDir+"/."+email, 0600, func(file *os.File) error {
+		_, err := file.WriteString(data)
+		return err
+	})
+}
+
+// reads the user's secret file, decrypting it if it's encrypted and decoding it otherwise.
+func readSecret(email string) (string, error) {
+	secretFile := secretDir + "/." + email
+	if !fileExists(secretFile) {
+		return "", errorPasswordFileNotFound
+	}
+	data, err := os.ReadFile(secretFile)
+	if err != nil {
+		return "", err
+	}
+	if len(data) == 0 {
+		return "", errorPasswordRead
+	}
+	if secret.IsEncrypted(data) {
+		return decryptSecret(email, data)
+	}
+	decoded, err := secret.Decode(data)
+	if err != nil {
+		return "", errorPasswordDecoding
+	}
+	return string(decoded), nil
+}
+
+func decryptSecret(email string, data []byte) (string, error) {
+	secretMux.RLock()
+	aead := secretCipher
+	secretMux.RUnlock()
+	if aead == nil {
+		return "", errorSecretKeyNotFound
+	}
+
+	decrypted, err := secret.Decrypt(aead, email, data)
+	if errors.Is(err, secret.ErrDecoding) {
+		return "", errorPasswordDecoding
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(decrypted), nil
+}
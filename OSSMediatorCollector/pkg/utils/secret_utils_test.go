@@ -0,0 +1,137 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"collector/pkg/secret"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// creates the secret directory and loads a new secret key, both are removed when the test ends.
+func initTestSecretKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	assert.Nil(t, err)
+	encodedKey := base64.StdEncoding.EncodeToString(key)
+	keyFile := filepath.Join(t.TempDir(), "secret.key")
+	assert.Nil(t, os.WriteFile(keyFile, []byte(encodedKey+"\n"), 0600))
+	assert.Nil(t, InitSecretKey(keyFile))
+	assert.Nil(t, os.MkdirAll(secretDir, os.ModePerm))
+	t.Cleanup(func() {
+		os.RemoveAll(secretDir)
+		secretCipher = nil
+	})
+	return encodedKey
+}
+
+func TestInitSecretKeyFromEnv(t *testing.T) {
+	encodedKey := base64.StdEncoding.EncodeToString(make([]byte, 32))
+	t.Setenv(SecretKeyEnv, encodedKey)
+	defer func() { secretCipher = nil }()
+
+	assert.Nil(t, InitSecretKey(""))
+	assert.NotNil(t, secretCipher)
+}
+
+func TestInitSecretKeyWithInvalidKey(t *testing.T) {
+	t.Setenv(SecretKeyEnv, base64.StdEncoding.EncodeToString(make([]byte, 16)))
+	err := InitSecretKey("")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "invalid secret key length")
+
+	t.Setenv(SecretKeyEnv, "???")
+	assert.NotNil(t, InitSecretKey(""))
+
+	assert.NotNil(t, InitSecretKey("./non_existing.key"))
+	assert.Nil(t, secretCipher)
+}
+
+func TestStoreSessionTokenEncrypted(t *testing.T) {
+	initTestSecretKey(t)
+	emailID := "testuser@nokia.com"
+
+	err := StoreSessionToken(emailID, "access", "refresh")
+	assert.Nil(t, err)
+
+	fileName := secretDir + "/." + emailID
+	data, err := os.ReadFile(fileName)
+	assert.Nil(t, err)
+	assert.True(t, secret.IsEncrypted(data))
+	assert.NotContains(t, string(data), base64.StdEncoding.EncodeToString([]byte("refresh")))
+	info, err := os.Stat(fileName)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	token, err := ReadSessionToken(emailID)
+	assert.Nil(t, err)
+	assert.Equal(t, "access\nrefresh", token)
+}
+
+func TestStoreSessionTokenWithoutSecretKey(t *testing.T) {
+	assert.Nil(t, os.MkdirAll(secretDir, os.ModePerm))
+	defer os.RemoveAll(secretDir)
+	emailID := "testuser@nokia.com"
+
+	err := StoreSessionToken(emailID, "access", "refresh")
+	assert.Nil(t, err)
+
+	data, err := os.ReadFile(secretDir + "/." + emailID)
+	assert.Nil(t, err)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("access"))+"\n"+base64.StdEncoding.EncodeToString([]byte("refresh")), string(data))
+}
+
+func TestReadEncryptedPassword(t *testing.T) {
+	initTestSecretKey(t)
+	emailID := "testuser@nokia.com"
+	data := secret.Encrypt(secretCipher, emailID, []byte("test"))
+	assert.Nil(t, os.WriteFile(secretDir+"/."+emailID, []byte(data), 0600))
+
+	password, err := ReadPassword(emailID)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", password)
+}
+
+func TestReadLegacyPasswordWithSecretKey(t *testing.T) {
+	initTestSecretKey(t)
+	emailID := "testuser@nokia.com"
+	assert.Nil(t, os.WriteFile(secretDir+"/."+emailID, []byte(base64.StdEncoding.EncodeToString([]byte("test"))), 0600))
+
+	password, err := ReadPassword(emailID)
+	assert.Nil(t, err)
+	assert.Equal(t, "test", password)
+}
+
+func TestReadEncryptedPasswordWithWrongKey(t *testing.T) {
+	initTestSecretKey(t)
+	emailID := "testuser@nokia.com"
+	data := secret.Encrypt(secretCipher, emailID, []byte("test"))
+	assert.Nil(t, os.WriteFile(secretDir+"/."+emailID, []byte(data), 0600))
+
+	//secret file of another user
+	assert.Nil(t, os.WriteFile(secretDir+"/.testuser2@nokia.com", []byte(data), 0600))
+	password, err := ReadPassword("testuser2@nokia.com")
+	assert.Equal(t, "", password)
+	assert.Equal(t, errorSecretDecryption, err)
+
+	initTestSecretKey(t)
+	password, err = ReadPassword(emailID)
+	assert.Equal(t, "", password)
+	assert.Equal(t, errorSecretDecryption, err)
+
+	secretCipher = nil
+	password, err = ReadPassword(emailID)
+	assert.Equal(t, "", password)
+	assert.Equal(t, errorSecretKeyNotFound, err)
+}
@@ -0,0 +1,208 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package utils
+
+import (
+	"collector/pkg/config"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig creates the TLS config of the console's client, if CA certificate file is empty or can't be read TLS
+// authentication will be done using root certificates.
+// The client certificate is read on first handshake and read again when its files change on disk, so that the
+// renewed certificates are used for the new connections without restart.
+func TLSConfig(conf config.TLSConf) (*tls.Config, error) {
+	tlsConfig := &tls.Config{}
+	if conf.InsecureSkipVerify {
+		//skipping certificates
+		tlsConfig.InsecureSkipVerify = true
+		log.Debugf("Skipping TLS authentication")
+	} else if conf.CACertFile == "" {
+		log.Debugf("TLS authentication using root certificates")
+	} else {
+		//Load CA cert
+		caCert, err := os.ReadFile(conf.CACertFile)
+		if err != nil {
+			log.WithFields(log.Fields{"error": err}).Error("Error while reading server certificate file")
+			log.Debugf("TLS authentication using root certificates")
+		} else {
+			caCertPool := x509.NewCertPool()
+			caCertPool.AppendCertsFromPEM(caCert)
+			tlsConfig.RootCAs = caCertPool
+			log.Debugf("Using CA certificate %s", conf.CACertFile)
+		}
+	}
+
+	if conf.MinVersion != "" {
+		version, ok := tlsVersions[conf.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("invalid TLS min_version: %s, accepted values are 1.0/1.1/1.2/1.3", conf.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	for _, name := range conf.CipherSuites {
+		id, err := cipherSuiteID(name)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.CipherSuites = append(tlsConfig.CipherSuites, id)
+	}
+
+	if conf.ClientPKCS12File != "" && (conf.ClientCertFile != "" || conf.ClientKeyFile != "") {
+		return nil, fmt.Errorf("client_pkcs12_file can't be used with client_cert_file and client_key_file")
+	}
+	if (conf.ClientCertFile == "") != (conf.ClientKeyFile == "") {
+		return nil, fmt.Errorf("both client_cert_file and client_key_file are required")
+	}
+	if conf.ClientCertFile != "" || conf.ClientPKCS12File != "" {
+		cert := &clientCertificate{conf: conf}
+		//fail early on invalid certificate, later failures keep the last valid certificate
+		_, err := cert.get(nil)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = cert.get
+	}
+	return tlsConfig, nil
+}
+
+// returns the ID of the cipher suite, insecure cipher suites aren't accepted.
+func cipherSuiteID(name string) (uint16, error) {
+	for _, suite := range tls.CipherSuites() {
+		if suite.Name == name {
+			return suite.ID, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid or insecure cipher suite: %s", name)
+}
+
+// clientCertificate keeps the client certificate, reloading it when its files are modified.
+type clientCertificate struct {
+	conf config.TLSConf
+
+	mux      sync.Mutex
+	cert     *tls.Certificate
+	modTimes []time.Time
+}
+
+// get returns the client certificate, reading it again if any of its files is modified since last read.
+// If the modified certificate can't be read the last certificate is returned.
+func (c *clientCertificate) get(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	modTimes, err := c.modifiedTimes()
+	if err == nil && c.cert != nil && equalTimes(modTimes, c.modTimes) {
+		return c.cert, nil
+	}
+	var cert *tls.Certificate
+	if err == nil {
+		cert, err = c.load()
+	}
+	if err != nil {
+		if c.cert == nil {
+			return nil, err
+		}
+		log.WithFields(log.Fields{"error": err}).Warn("Unable to reload client certificate, using the last certificate")
+		return c.cert, nil
+	}
+	if c.cert != nil {
+		log.Infof("Reloaded client certificate %s", c.name())
+	}
+	c.cert = cert
+	c.modTimes = modTimes
+	return c.cert, nil
+}
+
+// returns the files of the client certificate.
+func (c *clientCertificate) files() []string {
+	if c.conf.ClientPKCS12File == "" {
+		return []string{c.conf.ClientCertFile, c.conf.ClientKeyFile}
+	}
+	files := []string{c.conf.ClientPKCS12File}
+	if c.conf.ClientPKCS12PasswordFile != "" {
+		files = append(files, c.conf.ClientPKCS12PasswordFile)
+	}
+	return files
+}
+
+func (c *clientCertificate) name() string {
+	return c.files()[0]
+}
+
+func (c *clientCertificate) modifiedTimes() ([]time.Time, error) {
+	var modTimes []time.Time
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client certificate: %w", err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func (c *clientCertificate) load() (*tls.Certificate, error) {
+	if c.conf.ClientPKCS12File == "" {
+		cert, err := tls.LoadX509KeyPair(c.conf.ClientCertFile, c.conf.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client certificate: %w", err)
+		}
+		return &cert, nil
+	}
+
+	data, err := os.ReadFile(c.conf.ClientPKCS12File)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read client PKCS#12 file: %w", err)
+	}
+	var password string
+	if c.conf.ClientPKCS12PasswordFile != "" {
+		content, err := os.ReadFile(c.conf.ClientPKCS12PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read client PKCS#12 password file: %w", err)
+		}
+		password = strings.TrimRight(string(content), "\r\n")
+	}
+	key, leaf, caCerts, err := pkcs12.DecodeChain(data, password)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode client PKCS#12 file %s: %w", c.conf.ClientPKCS12File, err)
+	}
+	cert := &tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+	for _, caCert := range caCerts {
+		cert.Certificate = append(cert.Certificate, caCert.Raw)
+	}
+	return cert, nil
+}
+
+func equalTimes(t1 []time.Time, t2 []time.Time) bool {
+	if len(t1) != len(t2) {
+		return false
+	}
+	for i := range t1 {
+		if !t1[i].Equal(t2[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package utils
+
+import (
+	"collector/pkg/config"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// creates a self-signed certificate with the common name.
+func createTestCertificate(t *testing.T, commonName string) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+	return cert, key
+}
+
+// writes the certificate and its key as PEM files.
+func writeTestCertificate(t *testing.T, certFile string, keyFile string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	t.Helper()
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+	assert.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+func TestTLSConfigWithClientCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.crt")
+	keyFile := filepath.Join(dir, "client.key")
+	cert, key := createTestCertificate(t, "client1")
+	writeTestCertificate(t, certFile, keyFile, cert, key)
+
+	tlsConfig, err := TLSConfig(config.TLSConf{ClientCertFile: certFile, ClientKeyFile: keyFile, MinVersion: "1.3"})
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(tls.VersionTLS13), tlsConfig.MinVersion)
+	clientCert, err := tlsConfig.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Raw, clientCert.Certificate[0])
+
+	//renewed certificate is used without restart
+	cert, key = createTestCertificate(t, "client2")
+	writeTestCertificate(t, certFile, keyFile, cert, key)
+	modTime := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(certFile, modTime, modTime))
+	clientCert, err = tlsConfig.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Raw, clientCert.Certificate[0])
+
+	//invalid certificate keeps the last certificate
+	assert.Nil(t, os.WriteFile(keyFile, []byte("invalid"), 0600))
+	clientCert, err = tlsConfig.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Raw, clientCert.Certificate[0])
+}
+
+func TestTLSConfigWithPKCS12(t *testing.T) {
+	dir := t.TempDir()
+	cert, key := createTestCertificate(t, "client")
+	data, err := pkcs12.Modern.Encode(key, cert, nil, "secret")
+	assert.Nil(t, err)
+	p12File := filepath.Join(dir, "client.p12")
+	passwordFile := filepath.Join(dir, "password")
+	assert.Nil(t, os.WriteFile(p12File, data, 0600))
+	assert.Nil(t, os.WriteFile(passwordFile, []byte("secret\n"), 0600))
+
+	tlsConfig, err := TLSConfig(config.TLSConf{ClientPKCS12File: p12File, ClientPKCS12PasswordFile: passwordFile})
+	assert.Nil(t, err)
+	clientCert, err := tlsConfig.GetClientCertificate(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, cert.Raw, clientCert.Certificate[0])
+
+	//wrong password
+	assert.Nil(t, os.WriteFile(passwordFile, []byte("wrong"), 0600))
+	_, err = TLSConfig(config.TLSConf{ClientPKCS12File: p12File, ClientPKCS12PasswordFile: passwordFile})
+	assert.NotNil(t, err)
+}
+
+func TestTLSConfigWithInvalidConf(t *testing.T) {
+	tests := []struct {
+		conf config.TLSConf
+		err  string
+	}{
+		{config.TLSConf{MinVersion: "1.4"}, "invalid TLS min_version: 1.4"},
+		{config.TLSConf{CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}, "invalid or insecure cipher suite: TLS_RSA_WITH_RC4_128_SHA"},
+		{config.TLSConf{ClientCertFile: "client.crt"}, "both client_cert_file and client_key_file are required"},
+		{config.TLSConf{ClientCertFile: "client.crt", ClientKeyFile: "client.key", ClientPKCS12File: "client.p12"}, "client_pkcs12_file can't be used"},
+		{config.TLSConf{ClientCertFile: "./non_existing.crt", ClientKeyFile: "./non_existing.key"}, "unable to read client certificate"},
+	}
+	for _, test := range tests {
+		_, err := TLSConfig(test.conf)
+		if assert.NotNil(t, err) {
+			assert.Contains(t, err.Error(), test.err)
+		}
+	}
+
+	tlsConfig, err := TLSConfig(config.TLSConf{CipherSuites: []string{"TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, tlsConfig.CipherSuites)
+}
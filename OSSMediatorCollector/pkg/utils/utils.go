@@ -8,19 +8,9 @@ package utils
 
 import (
 	"collector/pkg/config"
-	"encoding/base64"
-	"errors"
-	"os"
-	"strings"
 	"time"
 )
 
-var (
-	errorPasswordRead         = errors.New("unable to read password file")
-	errorPasswordDecoding     = errors.New("unable to decode password")
-	errorPasswordFileNotFound = errors.New("secret file not found")
-)
-
 // truncates seconds from time
 func truncateSeconds(t time.Time) time.Time {
 	return t.Truncate(60 * time.Second)
@@ -52,53 +42,3 @@ func GetTimeInterval(user *config.User, api *config.APIConf, nhgID string) (stri
 	}
 	return startTime, truncateSeconds(endTime).Format(time.RFC3339)
 }
-
-func ReadPassword(email string) (string, error) {
-	passwordFile := ".secret/." + email
-	var bytePassword []byte
-	if fileExists(passwordFile) {
-		data, err := os.ReadFile(passwordFile)
-		if err != nil {
-			return "", err
-		}
-		if len(data) == 0 {
-			return "", errorPasswordRead
-		}
-		bytePassword, err = base64.StdEncoding.DecodeString(string(data))
-		if err != nil {
-			return "", errorPasswordDecoding
-		}
-	} else {
-		return "", errorPasswordFileNotFound
-	}
-	return string(bytePassword), nil
-}
-
-func ReadSessionToken(email string) (string, error) {
-	passwordFile := ".secret/." + email
-	var bytePassword []byte
-	var byteAccessToken []byte
-	var byteRefreshToken []byte
-	if fileExists(passwordFile) {
-		data, err := os.ReadFile(passwordFile)
-		if err != nil {
-			return "", err
-		}
-		if len(data) == 0 {
-			return "", errorPasswordRead
-		}
-		sessionToken := strings.Split(string(data), "\n")
-		byteAccessToken, err = base64.StdEncoding.DecodeString(sessionToken[0])
-		if err != nil {
-			return "", errorPasswordDecoding
-		}
-		byteRefreshToken, err = base64.StdEncoding.DecodeString(sessionToken[1])
-		if err != nil {
-			return "", errorPasswordDecoding
-		}
-		bytePassword = []byte(string(byteAccessToken) + "\n" + string(byteRefreshToken))
-	} else {
-		return "", errorPasswordFileNotFound
-	}
-	return string(bytePassword), nil
-}
@@ -7,6 +7,7 @@
 package utils
 
 import (
+	"collector/pkg/checkpoint"
 	"collector/pkg/config"
 	"encoding/base64"
 	"os"
@@ -62,14 +63,8 @@ func TestCallAPIWIthLastReceivedFile(t *testing.T) {
 	nhgID := "test_nhg_1"
 	lastDataTime := "2018-03-14T13:55:00+05:30"
 
-	tmpFile := "checkpoints/fmdata" + "_" + user.Email + "_" + nhgID
-	file, err := os.Create(tmpFile)
-	if err != nil {
-		t.Error(err)
-	}
-	defer file.Close()
-	defer os.Remove(tmpFile)
-	_, err = file.Write([]byte(lastDataTime))
+	openCheckpointStore(t)
+	err := checkpoint.Set(checkpoint.KeyFor(user, api, nhgID), lastDataTime)
 	if err != nil {
 		t.Error(err)
 	}
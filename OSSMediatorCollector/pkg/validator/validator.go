@@ -8,6 +8,9 @@ package validator
 
 import (
 	"collector/pkg/config"
+	"collector/pkg/schedule"
+	"collector/pkg/utils"
+	"encoding/base64"
 	"fmt"
 	"net/url"
 	"strings"
@@ -80,21 +83,234 @@ func ValidateConf(conf config.Config) error {
 		return fmt.Errorf("API response limit should be within 1-10000, limit: %d", conf.Limit)
 	}
 
-	if conf.Proxy.Enabled {
-		if conf.Proxy.Mode != "CONFIG" && conf.Proxy.Mode != "SYSTEM" {
-			return fmt.Errorf("invalid proxy mode: %s, accepted values are CONFIG/SYSTEM", conf.Proxy.Mode)
+	err := validateProxy(conf.Proxy)
+	if err != nil {
+		return err
+	}
+
+	err = validateRetry(conf.Retry)
+	if err != nil {
+		return err
+	}
+	_, err = utils.TLSConfig(conf.TLS)
+	if err != nil {
+		return fmt.Errorf("invalid tls config: %w", err)
+	}
+	err = validateRateLimit(conf.RateLimit)
+	if err != nil {
+		return err
+	}
+	if conf.CircuitBreaker.FailureThreshold < 0 || conf.CircuitBreaker.OpenTimeout < 0 {
+		return fmt.Errorf("circuit_breaker failure_threshold and open_timeout can't be negative")
+	}
+
+	err = validateSink(conf.Sink)
+	if err != nil {
+		return err
+	}
+	err = validateResponseFormat(conf.ResponseFormat)
+	if err != nil {
+		return err
+	}
+	for _, user := range conf.Users {
+		err = validateSink(user.Sink)
+		if err != nil {
+			return fmt.Errorf("invalid sink for %s: %w", user.Email, err)
+		}
+		err = validateCredentials(user)
+		if err != nil {
+			return fmt.Errorf("invalid credentials for %s: %w", user.Email, err)
+		}
+		err = validateConsole(user)
+		if err != nil {
+			return fmt.Errorf("invalid console for %s: %w", user.Email, err)
+		}
+	}
+	for _, api := range append(append([]*config.APIConf{}, conf.MetricAPIs...), conf.SimAPIs...) {
+		err = validateSink(api.Sink)
+		if err != nil {
+			return fmt.Errorf("invalid sink for %s: %w", api.API, err)
+		}
+		err = validateSchedule(api)
+		if err != nil {
+			return fmt.Errorf("invalid schedule for %s: %w", api.API, err)
+		}
+		err = validateResponseFormat(api.ResponseFormat)
+		if err != nil {
+			return fmt.Errorf("invalid response format for %s: %w", api.API, err)
+		}
+	}
+	return validateElasticsearchSinks(conf)
+}
+
+func validateProxy(proxy config.ProxyConfig) error {
+	if !proxy.Enabled {
+		return nil
+	}
+	if proxy.Mode != "CONFIG" && proxy.Mode != "SYSTEM" {
+		return fmt.Errorf("invalid proxy mode: %s, accepted values are CONFIG/SYSTEM", proxy.Mode)
+	}
+	if proxy.Mode == "CONFIG" {
+		if proxy.URL == "" {
+			return fmt.Errorf("proxy URL can't be empty in CONFIG mode")
+		}
+		_, err := url.Parse(proxy.URL)
+		if err != nil {
+			return fmt.Errorf("invalid proxy URL: %w", err)
+		}
+	}
+	return nil
+}
+
+// validates the user's console overrides, the global config is used for the fields which aren't set.
+func validateConsole(user *config.User) error {
+	if user.BaseURL != "" && !isURLValid(user.BaseURL) {
+		return fmt.Errorf("invalid url: %s", user.BaseURL)
+	}
+	if user.Proxy != nil {
+		err := validateProxy(*user.Proxy)
+		if err != nil {
+			return err
+		}
+	}
+	if user.TLS != nil {
+		_, err := utils.TLSConfig(*user.TLS)
+		if err != nil {
+			return fmt.Errorf("invalid tls config: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateSchedule(api *config.APIConf) error {
+	if api.Schedule == nil {
+		return nil
+	}
+	if api.Schedule.Jitter < 0 {
+		return fmt.Errorf("jitter can't be negative")
+	}
+	_, err := schedule.Parse(api.Schedule, api.Interval)
+	return err
+}
+
+// empty format is allowed, global response_format is used for the API.
+func validateResponseFormat(format string) error {
+	switch format {
+	case "", config.JSONFormat, config.NDJSONFormat, config.NDJSONGzipFormat:
+		return nil
+	}
+	return fmt.Errorf("invalid response format: %s, accepted values are %s/%s/%s", format, config.JSONFormat, config.NDJSONFormat, config.NDJSONGzipFormat)
+}
+
+func validateSink(sink *config.SinkConf) error {
+	if sink == nil {
+		return nil
+	}
+	switch sink.Type {
+	case config.FileSink, config.StdoutSink:
+		return nil
+	case config.HTTPSink:
+		if !isURLValid(sink.URL) {
+			return fmt.Errorf("invalid sink url: %s", sink.URL)
 		}
-		if conf.Proxy.Mode == "CONFIG" {
-			if conf.Proxy.URL == "" {
-				return fmt.Errorf("proxy URL can't be empty in CONFIG mode")
-			}
-			_, err := url.Parse(conf.Proxy.URL)
-			if err != nil {
-				return fmt.Errorf("invalid proxy URL: %w", err)
-			}
+		return nil
+	case config.ElasticsearchSink:
+		if sink.Elasticsearch == nil {
+			return fmt.Errorf("elasticsearch details can't be empty for ELASTICSEARCH sink")
 		}
+		if !isURLValid(sink.Elasticsearch.URL) {
+			return fmt.Errorf("invalid elasticsearch url: %s", sink.Elasticsearch.URL)
+		}
+		_, err := base64.StdEncoding.DecodeString(sink.Elasticsearch.Password)
+		if err != nil {
+			return fmt.Errorf("unable to decode elasticsearch password: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid sink type: %s, accepted values are FILE/STDOUT/HTTP/ELASTICSEARCH", sink.Type)
+	}
+}
+
+func validateRateLimit(rateLimit config.RateLimitConf) error {
+	if rateLimit.RequestsPerSecond < 0 || rateLimit.Burst < 0 || rateLimit.MaxInFlight < 0 {
+		return fmt.Errorf("rate_limit requests_per_second, burst and max_in_flight can't be negative")
 	}
+	return nil
+}
 
+func validateRetry(retry config.RetryConf) error {
+	if retry.MaxAttempts < 0 || retry.InitialBackoff < 0 || retry.MaxBackoff < 0 || retry.MaxRetryAfter < 0 {
+		return fmt.Errorf("retry max_attempts, initial_backoff, max_backoff and max_retry_after can't be negative")
+	}
+	if retry.MaxBackoff < retry.InitialBackoff {
+		return fmt.Errorf("retry max_backoff %d should be greater than initial_backoff %d", retry.MaxBackoff, retry.InitialBackoff)
+	}
+	if retry.Multiplier < 0 || (retry.Multiplier > 0 && retry.Multiplier < 1) {
+		return fmt.Errorf("retry multiplier should be at least 1, multiplier: %v", retry.Multiplier)
+	}
+	if retry.Jitter < 0 || retry.Jitter > 1 {
+		return fmt.Errorf("retry jitter should be within 0-1, jitter: %v", retry.Jitter)
+	}
+	return nil
+}
+
+// validates that the user's credential provider has the details required for its auth type.
+func validateCredentials(user *config.User) error {
+	credentials := user.Credentials
+	if credentials == nil {
+		return nil
+	}
+	isADToken := strings.ToUpper(user.AuthType) == "ADTOKEN"
+	switch credentials.Type {
+	case config.SecretFileCredential:
+		return nil
+	case config.EnvCredential:
+		if isADToken && (credentials.AccessTokenEnv == "" || credentials.RefreshTokenEnv == "") {
+			return fmt.Errorf("access_token_env and refresh_token_env can't be empty for ENV credentials")
+		}
+		if !isADToken && credentials.PasswordEnv == "" {
+			return fmt.Errorf("password_env can't be empty for ENV credentials")
+		}
+		return nil
+	case config.FileCredential:
+		if isADToken && (credentials.AccessTokenFile == "" || credentials.RefreshTokenFile == "") {
+			return fmt.Errorf("access_token_file and refresh_token_file can't be empty for FILE credentials")
+		}
+		if !isADToken && credentials.PasswordFile == "" {
+			return fmt.Errorf("password_file can't be empty for FILE credentials")
+		}
+		return nil
+	case config.CommandCredential:
+		if len(credentials.Command) == 0 || strings.TrimSpace(credentials.Command[0]) == "" {
+			return fmt.Errorf("command can't be empty for COMMAND credentials")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid credentials type: %s, accepted values are SECRET_FILE/ENV/FILE/COMMAND", credentials.Type)
+	}
+}
+
+// ELASTICSEARCH sinks share the retry queue and dead letter file, so all of them should push to the same elasticsearch.
+func validateElasticsearchSinks(conf config.Config) error {
+	sinks := []*config.SinkConf{conf.Sink}
+	for _, user := range conf.Users {
+		sinks = append(sinks, user.Sink)
+	}
+	for _, api := range append(append([]*config.APIConf{}, conf.MetricAPIs...), conf.SimAPIs...) {
+		sinks = append(sinks, api.Sink)
+	}
+
+	var esConf *config.ElasticsearchSinkConf
+	for _, sink := range sinks {
+		if sink == nil || sink.Type != config.ElasticsearchSink {
+			continue
+		}
+		if esConf == nil {
+			esConf = sink.Elasticsearch
+		} else if *esConf != *sink.Elasticsearch {
+			return fmt.Errorf("all ELASTICSEARCH sinks should have the same elasticsearch details")
+		}
+	}
 	return nil
 }
 
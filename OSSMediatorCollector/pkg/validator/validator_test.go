@@ -178,9 +178,9 @@ func TestValidateConfWithInvalidAPIMetricTypeForFM(t *testing.T) {
 }
 
 func TestValidateConfWithInvalidListNhgAPIInterval(t *testing.T) {
-	tmp := conf.MetricAPIs
-	conf.ListNetworkAPI.Interval = 0
-	defer func() { conf.MetricAPIs = tmp }()
+	tmp := conf.ListNetworkAPI
+	conf.ListNetworkAPI = &config.ListNetworkAPIConf{NhgAPI: tmp.NhgAPI}
+	defer func() { conf.ListNetworkAPI = tmp }()
 	err := ValidateConf(conf)
 	if err == nil || !strings.Contains(err.Error(), "list_network_api API call interval can't be zero") {
 		t.Error(err)
@@ -188,11 +188,229 @@ func TestValidateConfWithInvalidListNhgAPIInterval(t *testing.T) {
 }
 
 func TestValidateConfWithInvalidListNhgAPI(t *testing.T) {
-	tmp := conf.MetricAPIs
+	tmp := conf.ListNetworkAPI
 	conf.ListNetworkAPI = &config.ListNetworkAPIConf{}
-	defer func() { conf.MetricAPIs = tmp }()
+	defer func() { conf.ListNetworkAPI = tmp }()
 	err := ValidateConf(conf)
 	if err == nil || !strings.Contains(err.Error(), "list_network_api API URL can't be empty") {
 		t.Error(err)
 	}
 }
+
+func TestValidateConfWithInvalidSinkType(t *testing.T) {
+	conf.Sink = &config.SinkConf{Type: "KAFKA"}
+	defer func() { conf.Sink = nil }()
+	err := ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "invalid sink type") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithInvalidHTTPSinkURL(t *testing.T) {
+	conf.Users[0].Sink = &config.SinkConf{Type: config.HTTPSink, URL: "localhost"}
+	defer func() { conf.Users[0].Sink = nil }()
+	err := ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "invalid sink for user1@nokia.com") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithAPISink(t *testing.T) {
+	conf.MetricAPIs[0].Sink = &config.SinkConf{Type: config.StdoutSink}
+	defer func() { conf.MetricAPIs[0].Sink = nil }()
+	err := ValidateConf(conf)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithElasticsearchSink(t *testing.T) {
+	conf.Sink = &config.SinkConf{Type: config.ElasticsearchSink, Elasticsearch: &config.ElasticsearchSinkConf{URL: "http://localhost:9200", Password: "dGVzdDE="}}
+	defer func() { conf.Sink = nil }()
+	err := ValidateConf(conf)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithInvalidElasticsearchSink(t *testing.T) {
+	conf.Sink = &config.SinkConf{Type: config.ElasticsearchSink}
+	defer func() { conf.Sink = nil }()
+	err := ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "elasticsearch details can't be empty") {
+		t.Error(err)
+	}
+
+	conf.Sink.Elasticsearch = &config.ElasticsearchSinkConf{URL: "localhost"}
+	err = ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "invalid elasticsearch url") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithDifferentElasticsearchSinks(t *testing.T) {
+	conf.Sink = &config.SinkConf{Type: config.ElasticsearchSink, Elasticsearch: &config.ElasticsearchSinkConf{URL: "http://localhost:9200"}}
+	conf.MetricAPIs[1].Sink = &config.SinkConf{Type: config.ElasticsearchSink, Elasticsearch: &config.ElasticsearchSinkConf{URL: "http://localhost:9201"}}
+	defer func() {
+		conf.Sink = nil
+		conf.MetricAPIs[1].Sink = nil
+	}()
+	err := ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "same elasticsearch details") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithCredentials(t *testing.T) {
+	conf.Users[0].Credentials = &config.CredentialConf{Type: config.EnvCredential, PasswordEnv: "USER1_PASSWORD"}
+	defer func() { conf.Users[0].Credentials = nil }()
+	err := ValidateConf(conf)
+	if err != nil {
+		t.Error(err)
+	}
+
+	conf.Users[0].Credentials = &config.CredentialConf{Type: config.CommandCredential, Command: []string{"/usr/local/bin/credential-helper"}}
+	err = ValidateConf(conf)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithInvalidCredentials(t *testing.T) {
+	conf.Users[0].Credentials = &config.CredentialConf{Type: "VAULT"}
+	defer func() { conf.Users[0].Credentials = nil }()
+	err := ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "invalid credentials type") {
+		t.Error(err)
+	}
+
+	conf.Users[0].Credentials = &config.CredentialConf{Type: config.FileCredential, AccessTokenFile: "/var/run/secrets/access_token"}
+	err = ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "password_file can't be empty") {
+		t.Error(err)
+	}
+
+	conf.Users[0].Credentials = &config.CredentialConf{Type: config.CommandCredential}
+	err = ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "command can't be empty") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithInvalidRetry(t *testing.T) {
+	defer func() { conf.Retry = config.RetryConf{} }()
+	conf.Retry = config.RetryConf{MaxAttempts: 3, InitialBackoff: 10, MaxBackoff: 5, Multiplier: 2}
+	err := ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "max_backoff 5 should be greater than initial_backoff 10") {
+		t.Error(err)
+	}
+
+	conf.Retry = config.RetryConf{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 60, Multiplier: 0.5}
+	err = ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "multiplier should be at least 1") {
+		t.Error(err)
+	}
+
+	conf.Retry = config.RetryConf{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 60, Multiplier: 2, Jitter: 1.5}
+	err = ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "jitter should be within 0-1") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithInvalidRateLimit(t *testing.T) {
+	conf.RateLimit = config.RateLimitConf{RequestsPerSecond: -1}
+	defer func() { conf.RateLimit = config.RateLimitConf{} }()
+	err := ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "rate_limit requests_per_second, burst and max_in_flight can't be negative") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithInvalidCircuitBreaker(t *testing.T) {
+	conf.CircuitBreaker = config.CircuitBreakerConf{FailureThreshold: -1}
+	defer func() { conf.CircuitBreaker = config.CircuitBreakerConf{} }()
+	err := ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "circuit_breaker failure_threshold and open_timeout can't be negative") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithSchedule(t *testing.T) {
+	defer func() { conf.MetricAPIs[0].Schedule = nil }()
+	valid := []*config.ScheduleConf{
+		{Cron: "0 2 * * *"},
+		{Cron: "@daily", Jitter: 60},
+		{Offset: 30},
+		{Interval: 60, Offset: 420},
+	}
+	for _, schedule := range valid {
+		conf.MetricAPIs[0].Schedule = schedule
+		err := ValidateConf(conf)
+		if err != nil {
+			t.Errorf("schedule %+v should be valid: %v", schedule, err)
+		}
+	}
+
+	invalid := map[*config.ScheduleConf]string{
+		{Cron: "0 2 * *"}:              "expected 5 fields",
+		{Cron: "60 * * * *"}:           "minute field should be within 0-59",
+		{Cron: "*/0 * * * *"}:          "invalid step",
+		{Cron: "0 2 * * *", Offset: 5}: "cron can't be combined with interval and offset",
+		{Offset: 900}:                  "offset should be within 0-899 seconds",
+		{Interval: -5}:                 "interval should be positive",
+		{Jitter: -1}:                   "jitter can't be negative",
+	}
+	for schedule, message := range invalid {
+		conf.MetricAPIs[0].Schedule = schedule
+		err := ValidateConf(conf)
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("schedule %+v: expected error %q, got %v", schedule, message, err)
+		}
+	}
+}
+
+func TestValidateConfWithInvalidConsole(t *testing.T) {
+	defer func() {
+		conf.Users[0].BaseURL = ""
+		conf.Users[0].Proxy = nil
+	}()
+	conf.Users[0].BaseURL = "https://staging.example.com/api/v2"
+	conf.Users[0].Proxy = &config.ProxyConfig{Enabled: true, Mode: "CONFIG", URL: "http://proxy.example.com:3128"}
+	err := ValidateConf(conf)
+	if err != nil {
+		t.Error(err)
+	}
+
+	conf.Users[0].BaseURL = "staging"
+	err = ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "invalid console for user1@nokia.com: invalid url: staging") {
+		t.Error(err)
+	}
+
+	conf.Users[0].BaseURL = ""
+	conf.Users[0].Proxy = &config.ProxyConfig{Enabled: true, Mode: "AUTO"}
+	err = ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "invalid proxy mode: AUTO") {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfWithResponseFormat(t *testing.T) {
+	defer func() {
+		conf.ResponseFormat = ""
+		conf.MetricAPIs[0].ResponseFormat = ""
+	}()
+	conf.ResponseFormat = config.NDJSONGzipFormat
+	conf.MetricAPIs[0].ResponseFormat = config.JSONFormat
+	err := ValidateConf(conf)
+	if err != nil {
+		t.Error(err)
+	}
+
+	conf.MetricAPIs[0].ResponseFormat = "csv"
+	err = ValidateConf(conf)
+	if err == nil || !strings.Contains(err.Error(), "invalid response format: csv") {
+		t.Error(err)
+	}
+}
@@ -2,6 +2,11 @@ module storesecret
 
 go 1.26.5
 
-require golang.org/x/term v0.45.0
+require (
+	collector v0.0.0
+	golang.org/x/term v0.45.0
+)
 
 require golang.org/x/sys v0.47.0 // indirect
+
+replace collector => ../
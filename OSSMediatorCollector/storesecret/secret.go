@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/cipher"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"collector/pkg/secret"
+)
+
+// writes the secret file to a temporary file and renames it, so that the existing secret isn't lost on failure.
+func writeSecretFile(fileName string, data string) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(fileName), filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = tmpFile.WriteString(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	closeErr := tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+	return os.Rename(tmpFile.Name(), fileName)
+}
+
+// encrypts the base64 encoded secret files in dir in place, returns the no. of files migrated.
+// Each line of the file is decoded, so that both password and access/refresh token files are migrated.
+func migrateSecrets(aead cipher.AEAD, dir string) (int, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), ".") || strings.HasSuffix(file.Name(), ".tmp") {
+			continue
+		}
+		fileName := filepath.Join(dir, file.Name())
+		data, err := os.ReadFile(fileName)
+		if err != nil {
+			return count, err
+		}
+		if len(data) == 0 || secret.IsEncrypted(data) {
+			continue
+		}
+
+		decoded, err := secret.Decode(data)
+		if err != nil {
+			return count, fmt.Errorf("unable to decode %s: %v", fileName, err)
+		}
+		email := strings.TrimPrefix(file.Name(), ".")
+		err = writeSecretFile(fileName, secret.Encrypt(aead, email, decoded))
+		if err != nil {
+			return count, fmt.Errorf("unable to write %s: %v", fileName, err)
+		}
+		count++
+	}
+	return count, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"collector/pkg/secret"
+)
+
+func TestMigrateSecrets(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "secret.key")
+	err := secret.GenerateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := secret.LoadCipher(keyFile)
+	if err != nil || aead == nil {
+		t.Fatalf("unable to load generated key, error: %v", err)
+	}
+
+	secretDir := filepath.Join(dir, ".secret")
+	err = os.MkdirAll(secretDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	password := base64.StdEncoding.EncodeToString([]byte("password"))
+	token := base64.StdEncoding.EncodeToString([]byte("access")) + "\n" + base64.StdEncoding.EncodeToString([]byte("refresh"))
+	encrypted := secret.Encrypt(aead, "user3@nokia.com", []byte("secret"))
+	files := map[string]string{
+		".user1@nokia.com": password,
+		".user2@nokia.com": token,
+		".user3@nokia.com": encrypted,
+	}
+	for name, data := range files {
+		err = os.WriteFile(filepath.Join(secretDir, name), []byte(data), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	count, err := migrateSecrets(aead, secretDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 secret files to be migrated, got %d", count)
+	}
+
+	expected := map[string]string{
+		"user1@nokia.com": "password",
+		"user2@nokia.com": "access\nrefresh",
+		"user3@nokia.com": "secret",
+	}
+	for email, want := range expected {
+		data, err := os.ReadFile(filepath.Join(secretDir, "."+email))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !secret.IsEncrypted(data) {
+			t.Errorf("secret file of %s isn't encrypted: %s", email, data)
+			continue
+		}
+		got, err := secret.Decrypt(aead, email, data)
+		if err != nil {
+			t.Errorf("unable to decrypt secret of %s, error: %v", email, err)
+		} else if string(got) != want {
+			t.Errorf("expected secret of %s to be %q, got %q", email, want, got)
+		}
+	}
+	tmpFiles, _ := filepath.Glob(filepath.Join(secretDir, "*.tmp"))
+	if len(tmpFiles) != 0 {
+		t.Errorf("temporary files left after migration: %v", tmpFiles)
+	}
+}
+
+func TestMigrateSecretsWithInvalidSecret(t *testing.T) {
+	aead, err := secret.NewCipher(base64.StdEncoding.EncodeToString(make([]byte, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	fileName := filepath.Join(dir, ".user@nokia.com")
+	err = os.WriteFile(fileName, []byte("not base64!"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := migrateSecrets(aead, dir)
+	if err == nil {
+		t.Error("expected migration of invalid secret file to fail")
+	}
+	if count != 0 {
+		t.Errorf("expected no secret files to be migrated, got %d", count)
+	}
+	data, _ := os.ReadFile(fileName)
+	if string(data) != "not base64!" {
+		t.Errorf("invalid secret file was modified: %s", data)
+	}
+}
+
+func TestGenerateSecretKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "keys", "secret.key")
+	err := secret.GenerateKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected key file permission 0600, got %v", info.Mode().Perm())
+	}
+	key, _ := os.ReadFile(keyFile)
+
+	aead, err := secret.LoadCipher(keyFile)
+	if err != nil || aead == nil {
+		t.Errorf("unable to load generated key, error: %v", err)
+	}
+
+	//existing key isn't overwritten
+	err = secret.GenerateKey(keyFile)
+	if err == nil {
+		t.Error("expected key generation to fail for existing key file")
+	}
+	data, _ := os.ReadFile(keyFile)
+	if string(data) != string(key) {
+		t.Error("existing key file was overwritten")
+	}
+}
+
+func TestStoreSecretWithoutKey(t *testing.T) {
+	t.Setenv(secret.KeyEnv, "")
+	aead, err := secret.LoadCipher("")
+	if err != nil || aead != nil {
+		t.Fatalf("expected no cipher without secret key, got %v, error: %v", aead, err)
+	}
+
+	fileName := filepath.Join(t.TempDir(), ".user@nokia.com")
+	err = writeSecretFile(fileName, secret.Seal(aead, "user@nokia.com", []byte("access\nrefresh")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(fileName)
+	expected := base64.StdEncoding.EncodeToString([]byte("access")) + "\n" + base64.StdEncoding.EncodeToString([]byte("refresh"))
+	if string(data) != expected {
+		t.Errorf("expected base64 encoded secret %q, got %q", expected, data)
+	}
+}
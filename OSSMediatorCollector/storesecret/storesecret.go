@@ -1,7 +1,7 @@
 package main
 
 import (
-	"encoding/base64"
+	"crypto/cipher"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,6 +10,8 @@ import (
 	"strings"
 	"syscall"
 
+	"collector/pkg/secret"
+
 	"golang.org/x/term"
 )
 
@@ -22,6 +24,9 @@ type Config struct {
 
 var (
 	confFile   string
+	keyFile    string
+	genKey     bool
+	migrate    bool
 	version    bool
 	appVersion string
 	secretDir  = ".secret"
@@ -30,12 +35,18 @@ var (
 func main() {
 	//read command line arguments
 	flag.StringVar(&confFile, "c", "../resources/conf.json", "config file path")
+	flag.StringVar(&keyFile, "k", "", "secret key file path")
+	flag.BoolVar(&genKey, "g", false, "generate secret key file")
+	flag.BoolVar(&migrate, "m", false, "encrypt existing secret files")
 	flag.BoolVar(&version, "v", false, "Prints OSSMediator's version")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: ./storesecret [options]\n")
 		fmt.Fprintf(os.Stderr, "Options:\n")
 		fmt.Fprintf(os.Stderr, "\t-h, --help\n\t\tOutput a usage message.\n")
 		fmt.Fprintf(os.Stderr, "\t-c string\n\t\tConfig file path (default \"../resources/conf.json\")\n")
+		fmt.Fprintf(os.Stderr, "\t-k string\n\t\tFile containing base64 encoded AES-256 key used to encrypt the secrets, %s environment variable is used if empty.\n\t\tSecrets are stored base64 encoded if the key isn't configured.\n", secret.KeyEnv)
+		fmt.Fprintf(os.Stderr, "\t-g\n\t\tGenerates a new secret key to the -k file before storing the secrets, existing file isn't overwritten.\n")
+		fmt.Fprintf(os.Stderr, "\t-m\n\t\tEncrypts the existing base64 encoded secret files in place, without reading the secrets again.\n")
 		fmt.Fprintf(os.Stderr, "\t-v\n\t\tPrints OSSMediator's version\n")
 	}
 	flag.Parse()
@@ -44,16 +55,46 @@ func main() {
 		os.Exit(0)
 	}
 
+	if genKey {
+		if keyFile == "" {
+			log.Fatal("-k option is required to generate secret key")
+		}
+		err := secret.GenerateKey(keyFile)
+		if err != nil {
+			log.Fatalf("Unable to generate secret key to %s, error: %v", keyFile, err)
+		}
+		fmt.Printf("Secret key generated to %s\n", keyFile)
+	}
+	aead, err := secret.LoadCipher(keyFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if migrate {
+		if aead == nil {
+			log.Fatalf("Secret key isn't configured, use -k option or set %s environment variable to encrypt the secrets", secret.KeyEnv)
+		}
+		count, err := migrateSecrets(aead, secretDir)
+		if err != nil {
+			log.Fatalf("Unable to migrate secrets in %s, error: %v", secretDir, err)
+		}
+		fmt.Printf("%d secret files encrypted\n", count)
+		return
+	}
+
 	conf, err := readConfig(confFile)
 	if err != nil {
 		log.Fatal("Unable to read config file, error: ", err)
 	}
 
-	err = os.MkdirAll(secretDir, 0600)
+	err = os.MkdirAll(secretDir, 0700)
 	if err != nil {
 		log.Fatalf("Error while creating %s", secretDir)
 	}
-	readPassword(conf)
+	if aead == nil {
+		log.Printf("Secret key isn't configured, secrets are stored base64 encoded. Use -k option or set %s environment variable to encrypt them", secret.KeyEnv)
+	}
+	readPassword(aead, conf)
 }
 
 func readConfig(confFile string) (*Config, error) {
@@ -69,7 +110,7 @@ func readConfig(confFile string) (*Config, error) {
 	return conf, nil
 }
 
-func readPassword(conf *Config) {
+func readPassword(aead cipher.AEAD, conf *Config) {
 	for _, user := range conf.Users {
 		authType := strings.ToUpper(user.AuthType)
 		if authType == "PASSWORD" || authType == "" {
@@ -78,7 +119,7 @@ func readPassword(conf *Config) {
 			if err != nil {
 				log.Fatalf("Error in reading password for %v: %v", user.EmailID, err)
 			}
-			storePassword(user.EmailID, bytePassword)
+			storePassword(aead, user.EmailID, bytePassword)
 		} else if authType == "ADTOKEN" {
 			fmt.Printf("Enter access token for %s: ", user.EmailID)
 			byteAccessToken, err := term.ReadPassword(int(syscall.Stdin))
@@ -90,25 +131,23 @@ func readPassword(conf *Config) {
 			if err != nil {
 				log.Fatalf("Error in reading token for %v: %v", user.EmailID, err)
 			}
-			storeToken(user.EmailID, byteAccessToken, byteRefreshToken)
+			storeToken(aead, user.EmailID, byteAccessToken, byteRefreshToken)
 		}
 	}
 }
 
-func storePassword(user string, password []byte) {
+func storePassword(aead cipher.AEAD, user string, password []byte) {
 	fileName := secretDir + "/." + user
-	encodedPassword := base64.StdEncoding.EncodeToString(password)
-	err := os.WriteFile(fileName, []byte(encodedPassword), 0600)
+	err := writeSecretFile(fileName, secret.Seal(aead, user, password))
 	if err != nil {
 		log.Fatalf("Unable to store password for %v to %v, error: %v", user, fileName, err)
 	}
 	fmt.Printf("\nPassword stored for %v\n", user)
 }
 
-func storeToken(user string, accessToken []byte, refreshToken []byte) {
+func storeToken(aead cipher.AEAD, user string, accessToken []byte, refreshToken []byte) {
 	fileName := secretDir + "/." + user
-	encodedPassword := base64.StdEncoding.EncodeToString(accessToken) + "\n" + base64.StdEncoding.EncodeToString(refreshToken)
-	err := os.WriteFile(fileName, []byte(encodedPassword), 0600)
+	err := writeSecretFile(fileName, secret.Seal(aead, user, append(append(accessToken, '\n'), refreshToken...)))
 	if err != nil {
 		log.Fatalf("Unable to store password for %v to %v, error: %v", user, fileName, err)
 	}
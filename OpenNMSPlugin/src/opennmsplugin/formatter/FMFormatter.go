@@ -7,7 +7,6 @@
 package formatter
 
 import (
-	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
@@ -113,12 +112,7 @@ type ReceivedFMData struct {
 func FormatFMData(filePath string, fmConfig config.FMConfig, openNMSAddress string) {
 	log.Infof("Formatting FM file %s", filePath)
 	receivedFMData := make([]ReceivedFMData, 0)
-	contents, err := ioutil.ReadFile(filePath)
-	if err != nil {
-		log.WithFields(log.Fields{"error": err}).Errorf("Error while reading %s", filePath)
-		return
-	}
-	err = json.Unmarshal(contents, &receivedFMData)
+	err := readRecords(filePath, &receivedFMData)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Errorf("Unable to unmarshal json data %s", filePath)
 		return
@@ -162,8 +156,7 @@ func FormatFMData(filePath string, fmConfig config.FMConfig, openNMSAddress stri
 	}
 	output, _ := xml.MarshalIndent(fmData, "", "  ")
 
-	fileName := filepath.Base(filePath)
-	fileName = fileName[0 : len(fileName)-len(filepath.Ext(fileName))]
+	fileName := trimExtension(filepath.Base(filePath))
 	fileName = fmConfig.DestinationDir + "/" + fileName
 	counter := 1
 	name := fileName
@@ -10,7 +10,6 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"regexp"
 	"strconv"
@@ -42,29 +41,17 @@ type response struct {
 	Data interface{} `json:"data"`
 }
 
-//FormatPMData formats PM Data
+//FormatPMData formats PM Data, the PM file is read by its extension (.json, .ndjson or .ndjson.gz)
 func FormatPMData(filePath string, pmConfig config.PMConfig) {
 	log.Infof("Formatting PM file %s", filePath)
-	f, err := os.Open(filePath)
+	var pmData []interface{}
+	err := readRecords(filePath, &pmData)
 	if err != nil {
 		log.WithFields(log.Fields{"error": err}).Errorf("Error while formatting pm data %s", filePath)
 		return
 	}
-	defer f.Close()
-	content, err := ioutil.ReadAll(f)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-
-	var pmData interface{}
-	err = json.Unmarshal(content, &pmData)
-	if err != nil {
-		log.Error(err)
-		return
-	}
 
-	for _, value := range pmData.([]interface{}) {
+	for _, value := range pmData {
 		source := value.(map[string]interface{})[sourceField].(map[string]interface{})
 		metricTime := source[eventTimeField].(string)
 		dn := source[dnField].(string)
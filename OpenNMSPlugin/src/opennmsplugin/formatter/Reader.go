@@ -0,0 +1,68 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package formatter
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+//Extensions of the files written by collector, other than the JSON array files
+const (
+	ndjsonExtension     = ".ndjson"
+	ndjsonGzipExtension = ".ndjson.gz"
+)
+
+//readRecords decodes the records of the collected file into v, which should be a pointer to slice.
+//The file is read by its extension, JSON array or NDJSON with one record per line, gzip compressed for .gz extension.
+func readRecords(filePath string, v interface{}) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(filePath, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	dec := json.NewDecoder(r)
+	if !strings.HasSuffix(filePath, ndjsonExtension) && !strings.HasSuffix(filePath, ndjsonGzipExtension) {
+		return dec.Decode(v)
+	}
+	records := reflect.ValueOf(v).Elem()
+	for dec.More() {
+		record := reflect.New(records.Type().Elem())
+		err = dec.Decode(record.Interface())
+		if err != nil {
+			return err
+		}
+		records.Set(reflect.Append(records, record.Elem()))
+	}
+	return nil
+}
+
+//trimExtension returns the file name without the extension of the collected file.
+func trimExtension(fileName string) string {
+	for _, ext := range []string{ndjsonGzipExtension, ndjsonExtension} {
+		if strings.HasSuffix(fileName, ext) {
+			return strings.TrimSuffix(fileName, ext)
+		}
+	}
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
+}
@@ -0,0 +1,50 @@
+/*
+* Copyright 2018 Nokia
+* Licensed under BSD 3-Clause Clear License,
+* see LICENSE file for details.
+ */
+
+package formatter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestReadRecords(t *testing.T) {
+	ndjson := "{\"_id\":\"1\"}\n{\"_id\":\"2\"}\n"
+	var gzData bytes.Buffer
+	gz := gzip.NewWriter(&gzData)
+	gz.Write([]byte(ndjson))
+	gz.Close()
+	files := map[string][]byte{
+		"./pmdata_response.json":      []byte(`[{"_id": "1"}, {"_id": "2"}]`),
+		"./pmdata_response.ndjson":    []byte(ndjson),
+		"./pmdata_response.ndjson.gz": gzData.Bytes(),
+	}
+	expected := []interface{}{map[string]interface{}{"_id": "1"}, map[string]interface{}{"_id": "2"}}
+	for fileName, content := range files {
+		err := writeFile(fileName, content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(fileName)
+
+		var records []interface{}
+		err = readRecords(fileName, &records)
+		if err != nil || !reflect.DeepEqual(records, expected) {
+			t.Errorf("Unexpected records %v from %s, error: %v", records, fileName, err)
+		}
+	}
+}
+
+func TestTrimExtension(t *testing.T) {
+	for _, fileName := range []string{"fmdata_response.json", "fmdata_response.ndjson", "fmdata_response.ndjson.gz"} {
+		if name := trimExtension(fileName); name != "fmdata_response" {
+			t.Errorf("Expected fmdata_response, got %s", name)
+		}
+	}
+}
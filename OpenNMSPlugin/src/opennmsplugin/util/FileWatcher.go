@@ -69,11 +69,12 @@ func add(sourceDir string) error {
 }
 
 //WatchEvents watches file creation events and formats PM/FM data.
+//Collector writes the response to a temporary file and renames it, so the complete file is processed on its creation event.
 func WatchEvents(conf config.Config) {
 	for {
 		select {
 		case event := <-watcher.Events:
-			if event.Op&fsnotify.Write == fsnotify.Write {
+			if event.Op&fsnotify.Create == fsnotify.Create && !isTempFile(event.Name) {
 				log.Debugf("Received event: %s", event.Name)
 				user := getUserInfoForEvent(conf, event.Name)
 				if strings.Contains(filepath.Base(event.Name), "pm") {
@@ -111,7 +112,7 @@ func processExistingFiles(directory string, conf config.Config) {
 	}
 
 	for _, file := range files {
-		if file.IsDir() {
+		if file.IsDir() || isTempFile(file.Name()) {
 			continue
 		}
 		user := getUserInfoForEvent(conf, directory)
@@ -122,3 +123,8 @@ func processExistingFiles(directory string, conf config.Config) {
 		}
 	}
 }
+
+//checks if the file is a temporary file being written by the collector.
+func isTempFile(filePath string) bool {
+	return strings.HasPrefix(filepath.Base(filePath), ".")
+}
@@ -8,6 +8,7 @@ package util
 
 import (
 	"bytes"
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
@@ -153,6 +154,39 @@ func TestWatchEvents(t *testing.T) {
 	}
 }
 
+func TestWatchEventsForRenamedFile(t *testing.T) {
+	dir, _ := os.Getwd()
+	tmpDir := "./tmp"
+	users := []config.UserConf{
+		{
+			SourceDir: dir + "/tmp",
+		},
+	}
+	conf := config.Config{
+		UsersConf:       users,
+		CleanupDuration: 60,
+	}
+	os.MkdirAll(tmpDir+"/pm", os.ModePerm)
+	defer os.RemoveAll(tmpDir)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetLevel(log.Level(5))
+	defer func() {
+		log.SetOutput(os.Stderr)
+	}()
+	AddWatcher(conf)
+	go WatchEvents(conf)
+
+	tmpFile := tmpDir + "/pm/.test_file.json.123.tmp"
+	ioutil.WriteFile(tmpFile, []byte("test"), 0644)
+	os.Rename(tmpFile, tmpDir+"/pm/test_file.json")
+	time.Sleep(100 * time.Millisecond)
+	if strings.Contains(buf.String(), "Received event: "+dir+"/tmp/pm/.test_file.json.123.tmp") || !strings.Contains(buf.String(), "Received event: "+dir+"/tmp/pm/test_file.json") {
+		t.Fail()
+	}
+}
+
 func TestProcessExistingFilesWithNonExistingDir(t *testing.T) {
 	var buf bytes.Buffer
 	log.SetOutput(&buf)